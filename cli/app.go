@@ -329,10 +329,15 @@ func NewApp() *App {
 			{"filesystem", "a filesystem", func() StorageFlags { return &storageFilesystemFlags{} }},
 			{"gcs", "a Google Cloud Storage bucket", func() StorageFlags { return &storageGCSFlags{} }},
 			{"gdrive", "a Google Drive folder", func() StorageFlags { return &storageGDriveFlags{} }},
+			{"mirror", "several mirrored storages", func() StorageFlags { return &storageMirrorFlags{} }},
 
 			{"rclone", "a rclone-based provided", func() StorageFlags { return &storageRcloneFlags{} }},
+			{"rest", "a REST blob server", func() StorageFlags { return &storageRESTFlags{} }},
+			{"routing", "storages selected by blob prefix", func() StorageFlags { return &storageRoutingFlags{} }},
 			{"s3", "an S3 bucket", func() StorageFlags { return &storageS3Flags{} }},
 			{"sftp", "an SFTP storage", func() StorageFlags { return &storageSFTPFlags{} }},
+			{"single-file", "a single container file", func() StorageFlags { return &storageSingleFileFlags{} }},
+			{"swift", "an OpenStack Swift container", func() StorageFlags { return &storageSwiftFlags{} }},
 			{"webdav", "a WebDAV storage", func() StorageFlags { return &storageWebDAVFlags{} }},
 		},
 
@@ -575,7 +580,7 @@ func (c *App) maybeRunMaintenance(ctx context.Context, rep repo.Repository) erro
 		return nil
 	}
 
-	if rep.ClientOptions().ReadOnly {
+	if rep.ClientOptions().ReadOnly || rep.ClientOptions().WriteOnly {
 		return nil
 	}
 
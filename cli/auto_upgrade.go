@@ -12,7 +12,7 @@
 func maybeAutoUpgradeRepository(ctx context.Context, r repo.Repository) error {
 	// only upgrade repository when it's directly connected, not via API.
 	dr, _ := r.(repo.DirectRepository)
-	if dr == nil {
+	if dr == nil || r.ClientOptions().WriteOnly {
 		return nil
 	}
 
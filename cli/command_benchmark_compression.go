@@ -29,6 +29,7 @@ type commandBenchmarkCompression struct {
 	optionPrint  bool
 	parallel     int
 	deprecated   bool
+	archival     bool
 	operations   string
 	algorithms   string
 
@@ -46,6 +47,7 @@ func (c *commandBenchmarkCompression) setup(svc appServices, parent commandParen
 	cmd.Flag("verify-stable", "Verify that compression is stable").BoolVar(&c.verifyStable)
 	cmd.Flag("print-options", "Print out options usable for repository creation").BoolVar(&c.optionPrint)
 	cmd.Flag("deprecated", "Included deprecated compression algorithms").BoolVar(&c.deprecated)
+	cmd.Flag("archival", "Include slow archival compression algorithms").BoolVar(&c.archival)
 	cmd.Flag("algorithms", "Comma-separated list of algorithms to benchmark").StringVar(&c.algorithms)
 	cmd.Action(svc.noRepositoryAction(c.run))
 	c.out.setup(svc)
@@ -94,6 +96,10 @@ func (c *commandBenchmarkCompression) shouldIncludeAlgorithm(name compression.Na
 			return false
 		}
 
+		if compression.IsArchival[name] && !c.archival {
+			return false
+		}
+
 		return true
 	}
 
@@ -330,9 +336,13 @@ func (c *commandBenchmarkCompression) printResults(results []compressionBechmark
 	c.out.printStdout("------------------------------------------------------------------------------------------------\n")
 
 	for ndx, r := range results {
-		maybeDeprecated := ""
+		maybeNote := ""
 		if compression.IsDeprecated[r.compression] {
-			maybeDeprecated = " (deprecated)"
+			maybeNote = " (deprecated)"
+		}
+
+		if compression.IsArchival[r.compression] {
+			maybeNote = " (archival)"
 		}
 
 		c.out.printStdout("%3d. %-26v %-12v %-12v/s %-8v %v%v",
@@ -342,7 +352,7 @@ func (c *commandBenchmarkCompression) printResults(results []compressionBechmark
 			units.BytesString(r.throughput),
 			r.allocations,
 			units.BytesString(r.allocBytes),
-			maybeDeprecated,
+			maybeNote,
 		)
 
 		if c.optionPrint {
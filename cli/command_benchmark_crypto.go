@@ -2,10 +2,15 @@
 
 import (
 	"context"
+	"crypto/rand"
 	"sort"
+	"time"
 
+	"github.com/alecthomas/kingpin/v2"
 	atunits "github.com/alecthomas/units"
+	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/crypto"
 	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/internal/timetrack"
 	"github.com/kopia/kopia/internal/units"
@@ -21,6 +26,8 @@ type commandBenchmarkCrypto struct {
 	optionPrint          bool
 	parallel             int
 
+	keyDerivationAlgorithms []string
+
 	out textOutput
 }
 
@@ -31,6 +38,15 @@ func (c *commandBenchmarkCrypto) setup(svc appServices, parent commandParent) {
 	cmd.Flag("deprecated", "Include deprecated algorithms").BoolVar(&c.deprecatedAlgorithms)
 	cmd.Flag("parallel", "Number of parallel goroutines").Default("1").IntVar(&c.parallel)
 	cmd.Flag("print-options", "Print out options usable for repository creation").BoolVar(&c.optionPrint)
+	cmd.Flag("key-derivation-algorithm", "Key derivation algorithm to measure, including Argon2id with custom parameters (can be repeated)").PlaceHolder("ALGO").PreAction(func(_ *kingpin.ParseContext) error {
+		for _, a := range c.keyDerivationAlgorithms {
+			if err := format.ValidateKeyDerivationAlgorithm(a); err != nil {
+				return err //nolint:wrapcheck
+			}
+		}
+
+		return nil
+	}).StringsVar(&c.keyDerivationAlgorithms)
 	cmd.Action(svc.noRepositoryAction(c.run))
 	c.out.setup(svc)
 }
@@ -57,6 +73,45 @@ func (c *commandBenchmarkCrypto) run(ctx context.Context) error {
 	c.out.printStdout("-----------------------------------------------------------------\n")
 	c.out.printStdout("Fastest option for this machine is: --block-hash=%s --encryption=%s\n", results[0].hash, results[0].encryption)
 
+	return c.runKeyDerivationBenchmark(ctx)
+}
+
+// runKeyDerivationBenchmark measures the time it takes to derive the format encryption key from the password,
+// which is the cost of each password guess for an attacker.
+func (c *commandBenchmarkCrypto) runKeyDerivationBenchmark(ctx context.Context) error {
+	algorithms := c.keyDerivationAlgorithms
+	if len(algorithms) == 0 {
+		algorithms = format.SupportedFormatBlobKeyDerivationAlgorithms()
+	}
+
+	salt := make([]byte, format.UniqueIDLengthBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return errors.Wrap(err, "unable to generate salt")
+	}
+
+	c.out.printStdout("\n     %-50v %v\n", "Key Derivation", "Time")
+	c.out.printStdout("-----------------------------------------------------------------\n")
+
+	for ndx, a := range algorithms {
+		log(ctx).Infof("Benchmarking key derivation '%v'...", a)
+
+		tt := timetrack.StartTimer()
+
+		if _, err := crypto.DeriveKeyFromPassword("benchmark-password", salt, 32, a); err != nil { //nolint:mnd
+			return errors.Wrapf(err, "key derivation using %v failed", a)
+		}
+
+		c.out.printStdout("%3d. %-50v %v", ndx, a, tt.Elapsed().Round(time.Millisecond))
+
+		if c.optionPrint {
+			c.out.printStdout(",   --format-block-key-derivation-algorithm=%s", a)
+		}
+
+		c.out.printStdout("\n")
+	}
+
+	c.out.printStdout("-----------------------------------------------------------------\n")
+
 	return nil
 }
 
@@ -4,8 +4,11 @@
 	"bytes"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/kopia/kopia/internal/testutil"
 	"github.com/kopia/kopia/tests/testenv"
 )
@@ -17,6 +20,8 @@ func TestCommandBenchmarkCrypto(t *testing.T) {
 	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
 
 	e.RunAndExpectSuccess(t, "benchmark", "crypto", "--repeat=1", "--block-size=1KB", "--print-options")
+	e.RunAndExpectSuccess(t, "benchmark", "crypto", "--repeat=1", "--block-size=1KB", "--key-derivation-algorithm=argon2id-1024-1-1", "--key-derivation-algorithm=scrypt-65536-8-1")
+	e.RunAndExpectFailure(t, "benchmark", "crypto", "--repeat=1", "--block-size=1KB", "--key-derivation-algorithm=argon2id-1024-0-1")
 }
 
 func TestCommandBenchmarkEncryption(t *testing.T) {
@@ -57,4 +62,9 @@ func TestCommandBenchmarkCompression(t *testing.T) {
 
 	e.RunAndExpectSuccess(t, "benchmark", "compression", "--data-file", testFile, "--repeat=2", "--verify-stable", "--print-options")
 	e.RunAndExpectSuccess(t, "benchmark", "compression", "--data-file", testFile, "--repeat=2", "--by-size")
+
+	// archival algorithms are only included when requested.
+	require.NotContains(t, strings.Join(e.RunAndExpectSuccess(t, "benchmark", "compression", "--data-file", testFile, "--repeat=1"), "\n"), "brotli")
+	require.Contains(t, strings.Join(e.RunAndExpectSuccess(t, "benchmark", "compression", "--data-file", testFile, "--repeat=1", "--archival", "--verify-stable"), "\n"), "(archival)")
+	require.Contains(t, strings.Join(e.RunAndExpectSuccess(t, "benchmark", "compression", "--data-file", testFile, "--repeat=1", "--algorithms=xz"), "\n"), "xz")
 }
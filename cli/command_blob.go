@@ -4,6 +4,8 @@ type commandBlob struct {
 	delete commandBlobDelete
 	gc     commandBlobGC
 	list   commandBlobList
+	repair commandBlobRepair
+	serve  commandBlobServe
 	shards commandBlobShards
 	show   commandBlobShow
 	stats  commandBlobStats
@@ -15,6 +17,8 @@ func (c *commandBlob) setup(svc appServices, parent commandParent) {
 	c.delete.setup(svc, cmd)
 	c.gc.setup(svc, cmd)
 	c.list.setup(svc, cmd)
+	c.repair.setup(svc, cmd)
+	c.serve.setup(svc, cmd)
 	c.shards.setup(svc, cmd)
 	c.show.setup(svc, cmd)
 	c.stats.setup(svc, cmd)
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/maintenance"
+)
+
+type commandBlobRepair struct {
+	dryRun   bool
+	parallel int
+
+	jo  jsonOutput
+	out textOutput
+	svc appServices
+}
+
+func (c *commandBlobRepair) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("repair", "Scan pack and index blobs and repair damage using error correction")
+	cmd.Flag("dry-run", "Do not repair blobs, only report damage").BoolVar(&c.dryRun)
+	cmd.Flag("parallel", "Number of parallel blob scans").Default("8").IntVar(&c.parallel)
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.directRepositoryWriteAction(c.run))
+
+	c.svc = svc
+}
+
+func (c *commandBlobRepair) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	c.svc.advancedCommand(ctx)
+
+	stats, err := maintenance.RepairBlobs(ctx, rep, maintenance.RepairBlobsOptions{
+		DryRun:   c.dryRun,
+		Parallel: c.parallel,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error repairing blobs")
+	}
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(stats))
+	} else {
+		c.out.printStdout("Scanned blobs:       %v\n", stats.ScannedBlobs)
+		c.out.printStdout("Scanned bytes:       %v\n", stats.ScannedBytes)
+		c.out.printStdout("Damaged shards:      %v\n", stats.DamagedShards)
+		c.out.printStdout("Repaired blobs:      %v\n", len(stats.RepairedBlobs))
+		c.out.printStdout("Rewritten contents:  %v\n", stats.RewrittenContents)
+		c.out.printStdout("Unrecoverable blobs: %v\n", len(stats.UnrecoverableBlobs))
+
+		for _, id := range stats.UnrecoverableBlobs {
+			c.out.printStdout("  %v\n", id)
+		}
+	}
+
+	if c.dryRun && len(stats.RepairedBlobs) > 0 {
+		log(ctx).Info("Run without --dry-run to repair.")
+	}
+
+	if len(stats.UnrecoverableBlobs) > 0 {
+		return errors.Errorf("%v blobs are damaged beyond repair", len(stats.UnrecoverableBlobs))
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/ospath"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+	"github.com/kopia/kopia/repo/blob/rest"
+)
+
+type commandBlobServe struct {
+	path        string
+	address     string
+	username    string
+	password    string
+	tlsCertFile string
+	tlsKeyFile  string
+	insecure    bool
+
+	svc appServices
+	out textOutput
+}
+
+func (c *commandBlobServe) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("serve", "Serve a filesystem directory using the REST blob protocol")
+	cmd.Flag("path", "Path to the directory containing blobs").Required().StringVar(&c.path)
+	cmd.Flag("address", "Server address").Default("127.0.0.1:51517").StringVar(&c.address)
+	cmd.Flag("server-username", "Username required to access the server").Envar(svc.EnvName("KOPIA_BLOB_SERVER_USERNAME")).StringVar(&c.username)
+	cmd.Flag("server-password", "Password required to access the server").Envar(svc.EnvName("KOPIA_BLOB_SERVER_PASSWORD")).StringVar(&c.password)
+	cmd.Flag("tls-cert-file", "TLS certificate PEM").StringVar(&c.tlsCertFile)
+	cmd.Flag("tls-key-file", "TLS key PEM file").StringVar(&c.tlsKeyFile)
+	cmd.Flag("insecure", "Allow serving without TLS or authentication (do not use in production)").Hidden().BoolVar(&c.insecure)
+	cmd.Action(svc.noRepositoryAction(c.run))
+
+	c.svc = svc
+	c.out.setup(svc)
+}
+
+func (c *commandBlobServe) run(ctx context.Context) error {
+	useTLS := c.tlsCertFile != "" && c.tlsKeyFile != ""
+
+	if !c.insecure {
+		if !useTLS {
+			return errors.New("TLS not configured. To start server without encryption pass --insecure")
+		}
+
+		if c.username == "" || c.password == "" {
+			return errors.New("--server-username and --server-password are required. To start server without authentication pass --insecure")
+		}
+	}
+
+	p := ospath.ResolveUserFriendlyPath(c.path, false)
+	if !ospath.IsAbs(p) {
+		return errors.New("path must be absolute")
+	}
+
+	st, err := filesystem.New(ctx, &filesystem.Options{Path: p}, false)
+	if err != nil {
+		return errors.Wrap(err, "unable to open filesystem storage")
+	}
+
+	defer st.Close(ctx) //nolint:errcheck
+
+	handler := rest.NewHandler(st)
+	if c.username != "" {
+		handler = rest.RequireBasicAuth(handler, c.username, c.password)
+	}
+
+	httpServer := &http.Server{
+		ReadHeaderTimeout: 15 * time.Second, //nolint:mnd
+		Handler:           handler,
+		BaseContext: func(_ net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	l, err := net.Listen("tcp", c.address)
+	if err != nil {
+		return errors.Wrap(err, "listen error")
+	}
+
+	defer l.Close() //nolint:errcheck
+
+	c.svc.onTerminate(func() {
+		shutdownHTTPServer(ctx, httpServer)
+	})
+
+	if useTLS {
+		fmt.Fprintf(c.out.stderr(), "SERVER ADDRESS: https://%v\n", l.Addr()) //nolint:errcheck
+
+		err = httpServer.ServeTLS(l, c.tlsCertFile, c.tlsKeyFile)
+	} else {
+		fmt.Fprintf(c.out.stderr(), "SERVER ADDRESS: http://%v\n", l.Addr()) //nolint:errcheck
+
+		err = httpServer.Serve(l)
+	}
+
+	if !errors.Is(err, http.ErrServerClosed) {
+		return errors.Wrap(err, "error serving blobs")
+	}
+
+	return nil
+}
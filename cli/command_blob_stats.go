@@ -6,14 +6,16 @@
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
 )
 
 type commandBlobStats struct {
-	raw    bool
-	prefix string
+	raw             bool
+	prefix          string
+	verifyChecksums bool
 
 	out textOutput
 }
@@ -22,6 +24,7 @@ func (c *commandBlobStats) setup(svc appServices, parent commandParent) {
 	cmd := parent.Command("stats", "Blob statistics")
 	cmd.Flag("raw", "Raw numbers").Short('r').BoolVar(&c.raw)
 	cmd.Flag("prefix", "Blob name prefix").StringVar(&c.prefix)
+	cmd.Flag("verify-checksums", "Download all blobs and verify their checksums").BoolVar(&c.verifyChecksums)
 	cmd.Action(svc.directRepositoryReadAction(c.run))
 	c.out.setup(svc)
 }
@@ -40,7 +43,10 @@ func (c *commandBlobStats) run(ctx context.Context, rep repo.DirectRepository) e
 		sizeThreshold *= 10
 	}
 
-	var totalSize, count int64
+	var (
+		totalSize, count int64
+		blobIDs          []blob.ID
+	)
 
 	if err := rep.BlobReader().ListBlobs(
 		ctx,
@@ -48,6 +54,9 @@ func (c *commandBlobStats) run(ctx context.Context, rep repo.DirectRepository) e
 		func(b blob.Metadata) error {
 			totalSize += b.Length
 			count++
+			if c.verifyChecksums {
+				blobIDs = append(blobIDs, b.BlobID)
+			}
 			if count%10000 == 0 {
 				log(ctx).Infof("Got %v blobs...", count)
 			}
@@ -72,8 +81,17 @@ func(b blob.Metadata) error {
 	c.out.printStdout("Count: %v\n", count)
 	c.out.printStdout("Total: %v\n", sizeToString(totalSize))
 
+	mismatches, err := c.verifyBlobChecksums(ctx, rep, blobIDs)
+	if err != nil {
+		return err
+	}
+
+	if c.verifyChecksums {
+		c.out.printStdout("Checksum mismatches: %v\n", mismatches)
+	}
+
 	if count == 0 {
-		return nil
+		return checksumMismatchesError(mismatches)
 	}
 
 	c.out.printStdout("Average: %v\n", sizeToString(totalSize/count))
@@ -93,5 +111,46 @@ func(b blob.Metadata) error {
 		lastSize = size
 	}
 
-	return nil
+	return checksumMismatchesError(mismatches)
+}
+
+// verifyBlobChecksums downloads provided blobs in full, which causes storage providers to verify their checksums
+// and returns the number of blobs whose checksum did not match.
+func (c *commandBlobStats) verifyBlobChecksums(ctx context.Context, rep repo.DirectRepository, blobIDs []blob.ID) (int, error) {
+	var (
+		tmp        gather.WriteBuffer
+		mismatches int
+	)
+
+	defer tmp.Close()
+
+	for i, id := range blobIDs {
+		if i > 0 && i%1000 == 0 {
+			log(ctx).Infof("Verified %v/%v blobs...", i, len(blobIDs))
+		}
+
+		err := rep.BlobReader().GetBlob(ctx, id, 0, -1, &tmp)
+
+		switch {
+		case err == nil:
+		case errors.Is(err, blob.ErrChecksumMismatch):
+			log(ctx).Errorf("checksum mismatch: %v", err)
+
+			mismatches++
+		case errors.Is(err, blob.ErrBlobNotFound):
+			// blob deleted since listing.
+		default:
+			return 0, errors.Wrapf(err, "error reading blob %v", id)
+		}
+	}
+
+	return mismatches, nil
+}
+
+func checksumMismatchesError(mismatches int) error {
+	if mismatches == 0 {
+		return nil
+	}
+
+	return errors.Errorf("found %v blobs with mismatched checksums", mismatches)
 }
@@ -18,6 +18,7 @@ type commandContentRewrite struct {
 	contentRewriteFormatVersion int
 	contentRewritePackPrefix    string
 	contentRewriteDryRun        bool
+	contentRewriteInactiveKeys  bool
 	contentRewriteSafety        maintenance.SafetyParameters
 
 	contentRange contentRangeFlags
@@ -32,6 +33,7 @@ func (c *commandContentRewrite) setup(svc appServices, parent commandParent) {
 	cmd.Flag("short", "Rewrite contents from short packs").BoolVar(&c.contentRewriteShortPacks)
 	cmd.Flag("format-version", "Rewrite contents using the provided format version").Default("-1").IntVar(&c.contentRewriteFormatVersion)
 	cmd.Flag("pack-prefix", "Only rewrite contents from pack blobs with a given prefix").StringVar(&c.contentRewritePackPrefix)
+	cmd.Flag("inactive-encryption-keys", "Rewrite contents encrypted using keys other than the active one").BoolVar(&c.contentRewriteInactiveKeys)
 	cmd.Flag("dry-run", "Do not actually rewrite, only print what would happen").Short('n').BoolVar(&c.contentRewriteDryRun)
 	c.contentRange.setup(cmd)
 	safetyFlagVar(cmd, &c.contentRewriteSafety)
@@ -57,6 +59,8 @@ func (c *commandContentRewrite) runContentRewriteCommand(ctx context.Context, re
 		Parallel:       c.contentRewriteParallelism,
 		ShortPacks:     c.contentRewriteShortPacks,
 		DryRun:         c.contentRewriteDryRun,
+
+		InactiveEncryptionKeys: c.contentRewriteInactiveKeys,
 	}, c.contentRewriteSafety)
 }
 
@@ -9,6 +9,7 @@
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/internal/timetrack"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
@@ -20,6 +21,7 @@ type commandContentVerify struct {
 	contentVerifyFull           bool
 	contentVerifyIncludeDeleted bool
 	contentVerifyPercent        float64
+	verifyBlobChecksums         bool
 	progressInterval            time.Duration
 
 	contentRange contentRangeFlags
@@ -32,6 +34,7 @@ func (c *commandContentVerify) setup(svc appServices, parent commandParent) {
 	cmd.Flag("full", "Full verification (including download)").BoolVar(&c.contentVerifyFull)
 	cmd.Flag("include-deleted", "Include deleted contents").BoolVar(&c.contentVerifyIncludeDeleted)
 	cmd.Flag("download-percent", "Download a percentage of files [0.0 .. 100.0]").Float64Var(&c.contentVerifyPercent)
+	cmd.Flag("verify-blob-checksums", "Download each referenced pack blob in full and verify its checksum").BoolVar(&c.verifyBlobChecksums)
 	cmd.Flag("progress-interval", "Progress output interval").Default("3s").DurationVar(&c.progressInterval)
 	c.contentRange.setup(cmd)
 	cmd.Action(svc.directRepositoryReadAction(c.run))
@@ -55,6 +58,12 @@ func (c *commandContentVerify) run(ctx context.Context, rep repo.DirectRepositor
 		successCount  atomic.Int32
 		errorCount    atomic.Int32
 		totalCount    atomic.Int32
+
+		// number of errors caused by blob checksum mismatches
+		checksumMismatchCount atomic.Int32
+
+		packBlobsMutex sync.Mutex
+		packBlobIDs    = map[blob.ID]bool{}
 	)
 
 	subctx, cancel := context.WithCancel(ctx)
@@ -87,9 +96,19 @@ func (c *commandContentVerify) run(ctx context.Context, rep repo.DirectRepositor
 		Parallel:       c.contentVerifyParallel,
 		IncludeDeleted: c.contentVerifyIncludeDeleted,
 	}, func(ci content.Info) error {
+		if c.verifyBlobChecksums {
+			packBlobsMutex.Lock()
+			packBlobIDs[ci.PackBlobID] = true
+			packBlobsMutex.Unlock()
+		}
+
 		if err := c.contentVerify(ctx, rep.ContentReader(), ci, blobMap, downloadPercent); err != nil {
 			log(ctx).Errorf("error %v", err)
 			errorCount.Add(1)
+
+			if errors.Is(err, blob.ErrChecksumMismatch) {
+				checksumMismatchCount.Add(1)
+			}
 		} else {
 			successCount.Add(1)
 		}
@@ -117,7 +136,14 @@ func (c *commandContentVerify) run(ctx context.Context, rep repo.DirectRepositor
 		return errors.Wrap(err, "iterate contents")
 	}
 
-	log(ctx).Infof("Finished verifying %v contents, found %v errors.", verifiedCount.Load(), errorCount.Load())
+	if c.verifyBlobChecksums {
+		errs, mismatches := c.verifyPackBlobChecksums(ctx, rep, packBlobIDs, blobMap)
+
+		errorCount.Add(errs)
+		checksumMismatchCount.Add(mismatches)
+	}
+
+	log(ctx).Infof("Finished verifying %v contents, found %v errors (%v checksum mismatches).", verifiedCount.Load(), errorCount.Load(), checksumMismatchCount.Load())
 
 	ec := errorCount.Load()
 	if ec == 0 {
@@ -127,6 +153,39 @@ func (c *commandContentVerify) run(ctx context.Context, rep repo.DirectRepositor
 	return errors.Errorf("encountered %v errors", ec)
 }
 
+// verifyPackBlobChecksums downloads each of the provided pack blobs in full, which causes storage providers
+// to verify their checksums and returns the number of errors and how many of them were checksum mismatches.
+func (c *commandContentVerify) verifyPackBlobChecksums(ctx context.Context, rep repo.DirectRepository, packBlobIDs map[blob.ID]bool, blobMap map[blob.ID]blob.Metadata) (errs, mismatches int32) {
+	var tmp gather.WriteBuffer
+
+	defer tmp.Close()
+
+	log(ctx).Infof("Verifying checksums of %v pack blobs...", len(packBlobIDs))
+
+	for id := range packBlobIDs {
+		if _, ok := blobMap[id]; !ok {
+			// already reported as missing.
+			continue
+		}
+
+		err := rep.BlobReader().GetBlob(ctx, id, 0, -1, &tmp)
+
+		if err == nil {
+			continue
+		}
+
+		log(ctx).Errorf("error reading blob %v: %v", id, err)
+
+		errs++
+
+		if errors.Is(err, blob.ErrChecksumMismatch) {
+			mismatches++
+		}
+	}
+
+	return errs, mismatches
+}
+
 func (c *commandContentVerify) getTotalContentCount(ctx context.Context, rep repo.DirectRepository, totalCount *atomic.Int32) {
 	var tc int32
 
@@ -23,6 +23,8 @@ func (s *formatSpecificTestSuite) TestContentVerify(t *testing.T) {
 	env.RunAndExpectSuccess(t, "content", "verify")
 	env.RunAndExpectSuccess(t, "snapshot", "create", dir)
 	env.RunAndExpectSuccess(t, "content", "verify", "--download-percent=30")
+	env.RunAndExpectSuccess(t, "content", "verify", "--verify-blob-checksums")
+	env.RunAndExpectSuccess(t, "blob", "stats", "--verify-checksums")
 
 	// delete one of 'p' blobs.
 	blobIDToDelete := strings.Split(env.RunAndExpectSuccess(t, "blob", "list", "--prefix=p")[0], " ")[0]
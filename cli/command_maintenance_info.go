@@ -72,6 +72,12 @@ func (c *commandMaintenanceInfo) run(ctx context.Context, rep repo.DirectReposit
 		c.out.printStdout("Object Lock Extension: disabled\n")
 	}
 
+	if p.RepairBlobs {
+		c.out.printStdout("Blob Repair: enabled\n")
+	} else {
+		c.out.printStdout("Blob Repair: disabled\n")
+	}
+
 	c.out.printStdout("Recent Maintenance Runs:\n")
 
 	for run, timings := range s.Runs {
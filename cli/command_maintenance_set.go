@@ -25,6 +25,7 @@ type commandMaintenanceSet struct {
 	maxTotalRetainedLogSizeMB int64
 
 	extendObjectLocks []bool // optional boolean
+	repairBlobs       []bool // optional boolean
 }
 
 func (c *commandMaintenanceSet) setup(svc appServices, parent commandParent) {
@@ -54,6 +55,7 @@ func (c *commandMaintenanceSet) setup(svc appServices, parent commandParent) {
 	cmd.Flag("max-retained-log-age", "Set maximum age of log sessions to retain").DurationVar(&c.maxRetainedLogAge)
 	cmd.Flag("max-retained-log-size-mb", "Set maximum total size of log sessions").Int64Var(&c.maxTotalRetainedLogSizeMB)
 	cmd.Flag("extend-object-locks", "Extend retention period of locked objects as part of full maintenance.").BoolListVar(&c.extendObjectLocks)
+	cmd.Flag("repair-blobs", "Scan blobs and repair damage using error correction as part of full maintenance, at most once a week.").BoolListVar(&c.repairBlobs)
 
 	cmd.Action(svc.directRepositoryWriteAction(c.run))
 }
@@ -140,6 +142,22 @@ func (c *commandMaintenanceSet) setMaintenanceObjectLockExtendFromFlags(ctx cont
 	}
 }
 
+func (c *commandMaintenanceSet) setMaintenanceRepairBlobsFromFlags(ctx context.Context, p *maintenance.Params, changed *bool) {
+	// we use lists to distinguish between flag not set
+	// Zero elements == not set, more than zero - flag set, in which case we pick the last value
+	if len(c.repairBlobs) > 0 {
+		lastVal := c.repairBlobs[len(c.repairBlobs)-1]
+		p.RepairBlobs = lastVal
+		*changed = true
+
+		if lastVal {
+			log(ctx).Info("Blob repair maintenance enabled.")
+		} else {
+			log(ctx).Info("Blob repair maintenance disabled.")
+		}
+	}
+}
+
 func (c *commandMaintenanceSet) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
 	p, err := maintenance.GetParams(ctx, rep)
 	if err != nil {
@@ -158,6 +176,7 @@ func (c *commandMaintenanceSet) run(ctx context.Context, rep repo.DirectReposito
 	c.setMaintenanceEnabledAndIntervalFromFlags(ctx, &p.FullCycle, "full", c.maintenanceSetEnableFull, c.maintenanceSetFullFrequency, &changedParams)
 	c.setLogCleanupParametersFromFlags(ctx, p, &changedParams)
 	c.setMaintenanceObjectLockExtendFromFlags(ctx, p, &changedParams)
+	c.setMaintenanceRepairBlobsFromFlags(ctx, p, &changedParams)
 
 	if pauseDuration := c.maintenanceSetPauseQuick; pauseDuration != -1 {
 		s.NextQuickMaintenanceTime = rep.Time().Add(pauseDuration)
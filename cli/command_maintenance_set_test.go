@@ -39,6 +39,37 @@ func TestMaintenanceSetExtendObjectLocks(t *testing.T) {
 	require.False(t, mi.ExtendObjectLocks, "ExtendOjectLocks should be disabled.")
 }
 
+func TestMaintenanceSetRepairBlobs(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	var mi cli.MaintenanceInfo
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "maintenance", "info", "--json"), &mi)
+
+	require.False(t, mi.RepairBlobs, "RepairBlobs should not default to enabled.")
+
+	e.RunAndExpectSuccess(t, "maintenance", "set", "--repair-blobs", "true")
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "maintenance", "info", "--json"), &mi)
+
+	require.True(t, mi.RepairBlobs, "RepairBlobs should be enabled.")
+	require.Contains(t, e.RunAndExpectSuccess(t, "maintenance", "info"), "Blob Repair: enabled")
+
+	// full maintenance skips the repair in repositories without error correction.
+	e.RunAndExpectSuccess(t, "maintenance", "run", "--full", "--safety=none")
+
+	e.RunAndExpectSuccess(t, "maintenance", "set", "--repair-blobs", "false")
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "maintenance", "info", "--json"), &mi)
+
+	require.False(t, mi.RepairBlobs, "RepairBlobs should be disabled.")
+}
+
 func (s *formatSpecificTestSuite) TestInvalidExtendRetainOptions(t *testing.T) {
 	var mi cli.MaintenanceInfo
 
@@ -6,6 +6,7 @@
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
 )
 
 type commandManifestDelete struct {
@@ -26,7 +27,7 @@ func (c *commandManifestDelete) run(ctx context.Context, rep repo.RepositoryWrit
 	c.svc.advancedCommand(ctx)
 
 	for _, it := range toManifestIDs(c.manifestRemoveItems) {
-		if err := rep.DeleteManifest(ctx, it); err != nil {
+		if err := snapshot.DeleteManifest(ctx, rep, it); err != nil {
 			return errors.Wrapf(err, "unable to delete manifest %v", it)
 		}
 	}
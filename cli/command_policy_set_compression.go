@@ -15,6 +15,9 @@ type policyCompressionFlags struct {
 	policySetCompressionMinSize   string
 	policySetCompressionMaxSize   string
 
+	policySetCompressionAutoDetect           string
+	policySetCompressionAutoDetectMinSavings string
+
 	policySetAddOnlyCompress    []string
 	policySetRemoveOnlyCompress []string
 	policySetClearOnlyCompress  bool
@@ -30,6 +33,10 @@ func (c *policyCompressionFlags) setup(cmd *kingpin.CmdClause) {
 	cmd.Flag("compression-min-size", "Min size of file to attempt compression for").StringVar(&c.policySetCompressionMinSize)
 	cmd.Flag("compression-max-size", "Max size of file to attempt compression for").StringVar(&c.policySetCompressionMaxSize)
 
+	// Automatic detection of compressibility.
+	cmd.Flag("compression-auto-detect", "Sample each content of files not excluded by extension and store it uncompressed if it does not compress well ('true', 'false', 'inherit')").EnumVar(&c.policySetCompressionAutoDetect, booleanEnumValues...)
+	cmd.Flag("compression-auto-detect-min-savings", "Minimum percentage by which a sample must shrink for the content to be compressed").PlaceHolder("PERCENT").StringVar(&c.policySetCompressionAutoDetectMinSavings)
+
 	// Files to only compress.
 	cmd.Flag("add-only-compress", "List of extensions to add to the only-compress list").PlaceHolder("PATTERN").StringsVar(&c.policySetAddOnlyCompress)
 	cmd.Flag("remove-only-compress", "List of extensions to remove from the only-compress list").PlaceHolder("PATTERN").StringsVar(&c.policySetRemoveOnlyCompress)
@@ -50,6 +57,18 @@ func (c *policyCompressionFlags) setCompressionPolicyFromFlags(ctx context.Conte
 		return errors.Wrap(err, "maximum file size subject to compression")
 	}
 
+	if err := applyPolicyBoolPtr(ctx, "automatic detection of compressibility", &p.AutoDetect, c.policySetCompressionAutoDetect, changeCount); err != nil {
+		return errors.Wrap(err, "automatic detection of compressibility")
+	}
+
+	if err := applyOptionalInt(ctx, "minimum compression savings percentage", &p.AutoDetectMinSavings, c.policySetCompressionAutoDetectMinSavings, changeCount); err != nil {
+		return errors.Wrap(err, "minimum compression savings percentage")
+	}
+
+	if v := p.AutoDetectMinSavings; v != nil && (*v <= 0 || *v >= 100) {
+		return errors.New("minimum compression savings percentage must be between 1 and 99")
+	}
+
 	if v := c.policySetCompressionAlgorithm; v != "" {
 		*changeCount++
 
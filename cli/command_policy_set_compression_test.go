@@ -0,0 +1,42 @@
+package cli_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestSetCompressionAutoDetectPolicy(t *testing.T) {
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	e.RunAndExpectSuccess(t, "policy", "set", "--global", "--compression=zstd", "--compression-auto-detect=true")
+
+	lines := e.RunAndExpectSuccess(t, "policy", "show", "--global")
+	lines = compressSpaces(lines)
+	require.Contains(t, lines, " Detect compressibility of each content: true (defined for this target)")
+	require.Contains(t, lines, " Minimum savings: 10% (defined for this target)")
+
+	// make some directory we'll be setting policy on
+	td := testutil.TempDirectory(t)
+
+	e.RunAndExpectSuccess(t, "policy", "set", td, "--compression-auto-detect-min-savings=25")
+
+	lines = e.RunAndExpectSuccess(t, "policy", "show", td)
+	lines = compressSpaces(lines)
+	require.Contains(t, lines, " Detect compressibility of each content: true inherited from (global)")
+	require.Contains(t, lines, " Minimum savings: 25% (defined for this target)")
+
+	e.RunAndExpectFailure(t, "policy", "set", td, "--compression-auto-detect-min-savings=100")
+
+	e.RunAndExpectSuccess(t, "policy", "set", "--global", "--compression-auto-detect=false")
+
+	lines = e.RunAndExpectSuccess(t, "policy", "show", td)
+	lines = compressSpaces(lines)
+	require.NotContains(t, lines, " Detect compressibility of each content: true inherited from (global)")
+}
@@ -344,6 +344,18 @@ func appendCompressionPolicyRows(rows []policyTableRow, p *policy.Policy, def *p
 		policyTableRow{"Compression:", "", ""},
 		policyTableRow{"  Compressor:", string(p.CompressionPolicy.CompressorName), definitionPointToString(p.Target(), def.CompressionPolicy.CompressorName)})
 
+	if p.CompressionPolicy.AutoDetect.OrDefault(false) {
+		rows = append(rows,
+			policyTableRow{
+				"  Detect compressibility of each content:", "true",
+				definitionPointToString(p.Target(), def.CompressionPolicy.AutoDetect),
+			},
+			policyTableRow{
+				"  Minimum savings:", fmt.Sprintf("%v%%", p.CompressionPolicy.MinSavingsPercent()),
+				definitionPointToString(p.Target(), def.CompressionPolicy.AutoDetectMinSavings),
+			})
+	}
+
 	switch {
 	case len(p.CompressionPolicy.OnlyCompress) > 0:
 		rows = append(rows, policyTableRow{
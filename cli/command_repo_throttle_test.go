@@ -5,6 +5,7 @@
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/kopia/kopia/internal/serverapi"
 	"github.com/kopia/kopia/internal/testutil"
 	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/tests/testenv"
@@ -79,3 +80,53 @@ func TestRepoThrottle(t *testing.T) {
 		ConcurrentWrites:       400,
 	}, limits)
 }
+
+func TestRepoThrottleSchedule(t *testing.T) {
+	t.Parallel()
+
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+	defer env.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	env.RunAndExpectFailure(t, "repo", "throttle", "set", "--schedule=someday 09:00-17:00 upload=1000")
+	env.RunAndExpectFailure(t, "repo", "throttle", "set", "--schedule=09:00-09:00 upload=1000")
+
+	env.RunAndExpectSuccess(t, "repo", "throttle", "set",
+		"--upload-bytes-per-second=2000000",
+		"--schedule=00:00-24:00 upload=1000000 download=unlimited",
+		"--schedule=sat,sun 22:00-06:00 download=3000000",
+	)
+
+	require.Equal(t, []string{
+		"Max Download Speed:            (unlimited)",
+		"Max Upload Speed:              2 MB/s",
+		"Max Read Requests Per Second:  (unlimited)",
+		"Max Write Requests Per Second: (unlimited)",
+		"Max List Requests Per Second:  (unlimited)",
+		"Max Concurrent Reads:          (unlimited)",
+		"Max Concurrent Writes:         (unlimited)",
+		"",
+		"Schedule:",
+		"  daily 00:00-24:00 upload:1 MB/s download:unlimited",
+		"  sat,sun 22:00-06:00 upload:(unchanged) download:3 MB/s",
+		"Active Window:                 daily 00:00-24:00 upload:1 MB/s download:unlimited",
+	}, env.RunAndExpectSuccess(t, "repo", "throttle", "get"))
+
+	var resp serverapi.ThrottleLimitsResponse
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "repo", "throttle", "get", "--json"), &resp)
+	require.Len(t, resp.Schedule, 2)
+	require.Equal(t, []string{"sat", "sun"}, resp.Schedule[1].Days)
+	require.NotNil(t, resp.ActiveScheduleWindow)
+	require.Equal(t, "00:00", resp.ActiveScheduleWindow.Start)
+
+	env.RunAndExpectSuccess(t, "repo", "throttle", "set", "--clear-schedule")
+
+	var resp2 serverapi.ThrottleLimitsResponse
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "repo", "throttle", "get", "--json"), &resp2)
+	require.Empty(t, resp2.Schedule)
+	require.Nil(t, resp2.ActiveScheduleWindow)
+	require.InDelta(t, 2e6, resp2.UploadBytesPerSecond, 0.1)
+}
@@ -2,15 +2,21 @@
 
 type commandRepository struct {
 	connect          commandRepositoryConnect
+	convert          commandRepositoryConvert
 	create           commandRepositoryCreate
 	disconnect       commandRepositoryDisconnect
 	repair           commandRepositoryRepair
+	recoverFormat    commandRepositoryRecoverFormat
 	setClient        commandRepositorySetClient
 	setParameters    commandRepositorySetParameters
 	changePassword   commandRepositoryChangePassword
+	key              commandRepositoryKey
+	encryptionKey    commandRepositoryEncryptionKey
+	recoveryShares   commandRepositoryRecoveryShares
 	status           commandRepositoryStatus
 	syncTo           commandRepositorySyncTo
 	throttle         commandRepositoryThrottle
+	trainDictionary  commandRepositoryTrainDictionary
 	validateProvider commandRepositoryValidateProvider
 	upgrade          commandRepositoryUpgrade
 }
@@ -19,15 +25,21 @@ func (c *commandRepository) setup(svc advancedAppServices, parent commandParent)
 	cmd := parent.Command("repository", "Commands to manipulate repository.").Alias("repo")
 
 	c.connect.setup(svc, cmd)
+	c.convert.setup(svc, cmd)
 	c.create.setup(svc, cmd)
 	c.disconnect.setup(svc, cmd)
 	c.repair.setup(svc, cmd)
+	c.recoverFormat.setup(svc, cmd)
 	c.setClient.setup(svc, cmd)
 	c.setParameters.setup(svc, cmd)
 	c.status.setup(svc, cmd)
 	c.syncTo.setup(svc, cmd)
 	c.throttle.setup(svc, cmd)
+	c.trainDictionary.setup(svc, cmd)
 	c.changePassword.setup(svc, cmd)
+	c.key.setup(svc, cmd)
+	c.encryptionKey.setup(svc, cmd)
+	c.recoveryShares.setup(svc, cmd)
 	c.validateProvider.setup(svc, cmd)
 	c.upgrade.setup(svc, cmd)
 }
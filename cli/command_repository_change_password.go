@@ -9,7 +9,8 @@
 )
 
 type commandRepositoryChangePassword struct {
-	newPassword string
+	newPassword            string
+	keyDerivationAlgorithm string
 
 	svc advancedAppServices
 }
@@ -17,6 +18,7 @@ type commandRepositoryChangePassword struct {
 func (c *commandRepositoryChangePassword) setup(svc advancedAppServices, parent commandParent) {
 	cmd := parent.Command("change-password", "Change repository password")
 	cmd.Flag("new-password", "New password").Envar(svc.EnvName("KOPIA_NEW_PASSWORD")).StringVar(&c.newPassword)
+	keyDerivationAlgorithmFlag(cmd, "key-derivation-algorithm", "Switch to a different algorithm to derive the key from the new password", &c.keyDerivationAlgorithm).StringVar(&c.keyDerivationAlgorithm)
 
 	c.svc = svc
 	cmd.Action(svc.directRepositoryWriteAction(c.run))
@@ -36,7 +38,7 @@ func (c *commandRepositoryChangePassword) run(ctx context.Context, rep repo.Dire
 		newPass = c.newPassword
 	}
 
-	if err := rep.FormatManager().ChangePassword(ctx, newPass); err != nil {
+	if err := rep.FormatManager().ChangePasswordWithKeyDerivationAlgorithm(ctx, newPass, c.keyDerivationAlgorithm); err != nil {
 		return errors.Wrap(err, "unable to change password")
 	}
 
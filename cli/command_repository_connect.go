@@ -1,16 +1,22 @@
 package cli
 
 import (
+	"bufio"
 	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/passwordpersist"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/format"
 )
 
 type commandRepositoryConnect struct {
@@ -58,6 +64,13 @@ type connectOptions struct {
 
 	formatBlobCacheDuration time.Duration
 	disableFormatBlobCache  bool
+
+	faultProfileFile string
+
+	privateKeyFile string
+	writeOnly      bool
+
+	recoveryShares bool
 }
 
 func (c *connectOptions) setup(svc appServices, cmd *kingpin.CmdClause) {
@@ -79,6 +92,10 @@ func (c *connectOptions) setup(svc appServices, cmd *kingpin.CmdClause) {
 	cmd.Flag("enable-actions", "Allow snapshot actions").BoolVar(&c.connectEnableActions)
 	cmd.Flag("repository-format-cache-duration", "Duration of kopia.repository format blob cache").Hidden().DurationVar(&c.formatBlobCacheDuration)
 	cmd.Flag("disable-repository-format-cache", "Disable caching of kopia.repository format blob").Hidden().BoolVar(&c.disableFormatBlobCache)
+	cmd.Flag("fault-profile", "JSON file describing storage faults to inject, for disaster drills").PlaceHolder("FILE").StringVar(&c.faultProfileFile)
+	cmd.Flag("private-key-file", "File containing the private key of a repository using asymmetric encryption").PlaceHolder("FILE").StringVar(&c.privateKeyFile)
+	cmd.Flag("recovery-shares", "Restore access to the repository using recovery shares read from standard input and set a new password").BoolVar(&c.recoveryShares)
+	cmd.Flag("write-only", "Connect to a repository using asymmetric encryption without the private key, which allows writing new snapshots but not reading contents").BoolVar(&c.writeOnly)
 }
 
 func (c *connectOptions) getFormatBlobCacheDuration() time.Duration {
@@ -89,6 +106,28 @@ func (c *connectOptions) getFormatBlobCacheDuration() time.Duration {
 	return c.formatBlobCacheDuration
 }
 
+func (c *connectOptions) getFaultProfileFile() string {
+	return absolutePathOrEmpty(c.faultProfileFile)
+}
+
+func (c *connectOptions) getPrivateKeyFile() string {
+	return absolutePathOrEmpty(c.privateKeyFile)
+}
+
+// absolutePathOrEmpty returns the absolute path of a file that is loaded each time the repository is opened,
+// possibly from a different working directory.
+func absolutePathOrEmpty(fname string) string {
+	if fname == "" {
+		return ""
+	}
+
+	if abs, err := filepath.Abs(fname); err == nil {
+		return abs
+	}
+
+	return fname
+}
+
 func (c *connectOptions) toRepoConnectOptions() *repo.ConnectOptions {
 	return &repo.ConnectOptions{
 		CachingOptions: content.CachingOptions{
@@ -110,11 +149,18 @@ func (c *connectOptions) toRepoConnectOptions() *repo.ConnectOptions {
 			Description:             c.connectDescription,
 			EnableActions:           c.connectEnableActions,
 			FormatBlobCacheDuration: c.getFormatBlobCacheDuration(),
+			FaultProfileFile:        c.getFaultProfileFile(),
+			WriteOnly:               c.writeOnly,
+			PrivateKeyFile:          c.getPrivateKeyFile(),
 		},
 	}
 }
 
 func (c *App) runConnectCommandWithStorage(ctx context.Context, co *connectOptions, st blob.Storage) error {
+	if co.recoveryShares {
+		return c.runConnectCommandWithRecoveryShares(ctx, co, st)
+	}
+
 	pass, err := c.getPasswordFromFlags(ctx, false, false)
 	if err != nil {
 		return errors.Wrap(err, "getting password")
@@ -123,6 +169,62 @@ func (c *App) runConnectCommandWithStorage(ctx context.Context, co *connectOptio
 	return c.runConnectCommandWithStorageAndPassword(ctx, co, st, pass)
 }
 
+// runConnectCommandWithRecoveryShares restores access to the repository by combining recovery shares
+// read from stdin and adding a key slot with a new password, which is then used to connect.
+func (c *App) runConnectCommandWithRecoveryShares(ctx context.Context, co *connectOptions, st blob.Storage) error {
+	threshold, err := format.RecoveryShareThreshold(ctx, st)
+	if err != nil {
+		return errors.Wrap(err, "unable to read recovery shares configuration")
+	}
+
+	shares, err := c.readRecoveryShares(threshold)
+	if err != nil {
+		return err
+	}
+
+	log(ctx).Info("Enter the new repository password.")
+
+	pass, err := c.getPasswordFromFlags(ctx, true, false)
+	if err != nil {
+		return errors.Wrap(err, "getting password")
+	}
+
+	label := "recovered-" + clock.Now().Format("20060102-150405")
+
+	if err := format.AddKeySlotUsingRecoveryShares(ctx, st, shares, label, pass, clock.Now); err != nil {
+		return errors.Wrap(err, "unable to restore access using recovery shares")
+	}
+
+	log(ctx).Infof("Restored access to the repository, the new password has been added as key slot %q.", label)
+
+	return c.runConnectCommandWithStorageAndPassword(ctx, co, st, pass)
+}
+
+// readRecoveryShares reads the provided number of recovery shares from stdin, one per line.
+func (c *App) readRecoveryShares(threshold int) ([]string, error) {
+	var shares []string
+
+	s := bufio.NewScanner(c.stdin())
+
+	for len(shares) < threshold {
+		fmt.Fprintf(c.stdoutWriter, "Enter recovery share %v of %v: ", len(shares)+1, threshold) //nolint:errcheck
+
+		if !s.Scan() {
+			if err := s.Err(); err != nil {
+				return nil, errors.Wrap(err, "unable to read recovery share")
+			}
+
+			return nil, errors.Errorf("%v recovery shares are required, got %v", threshold, len(shares))
+		}
+
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			shares = append(shares, line)
+		}
+	}
+
+	return shares, nil
+}
+
 func (c *App) runConnectCommandWithStorageAndPassword(ctx context.Context, co *connectOptions, st blob.Storage, password string) error {
 	configFile := c.repositoryConfigFileName()
 	if err := passwordpersist.OnSuccess(
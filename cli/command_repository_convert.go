@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/ecc"
+	"github.com/kopia/kopia/repo/encryption"
+	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/repo/hashing"
+	"github.com/kopia/kopia/repo/maintenance"
+	"github.com/kopia/kopia/snapshot/snapshotconvert"
+)
+
+type commandRepositoryConvert struct {
+	hash               string
+	encryption         string
+	ecc                string
+	eccOverheadPercent int
+	parallel           int
+	checkpointInterval int
+
+	allowUnsafeUpgradeTimings bool
+
+	// lock settings
+	ioDrainTimeout         time.Duration
+	statusPollInterval     time.Duration
+	maxPermittedClockDrift time.Duration
+
+	skip bool
+
+	svc advancedAppServices
+}
+
+func (c *commandRepositoryConvert) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("convert", "Convert repository to new hash, encryption or error correction algorithms in place.\n\n"+
+		"All contents and manifests are rewritten using the new format while other clients are locked out using the upgrade lock. "+
+		"The conversion can be resumed by running the command again with the same parameters.").
+		Validate(func(_ *kingpin.CmdClause) error {
+			if v := os.Getenv(c.svc.EnvName(upgradeLockFeatureEnv)); v == "" {
+				return errors.Errorf("please set %q env variable to use this feature", upgradeLockFeatureEnv)
+			}
+
+			return nil
+		})
+
+	cmd.Flag("hash", "New content hash algorithm.").PlaceHolder("ALGO").EnumVar(&c.hash, hashing.SupportedAlgorithms()...)
+	cmd.Flag("encryption", "New content encryption algorithm.").PlaceHolder("ALGO").EnumVar(&c.encryption, encryption.SupportedAlgorithms(false)...)
+	cmd.Flag("ecc", "[EXPERIMENTAL] New error correction algorithm.").PlaceHolder("ALGO").EnumVar(&c.ecc, ecc.SupportedAlgorithms()...)
+	cmd.Flag("ecc-overhead-percent", "[EXPERIMENTAL] How much space overhead can be used for error correction, in percentage. Use 0 to disable ECC.").Default("-1").IntVar(&c.eccOverheadPercent)
+	cmd.Flag("parallel", "Number of contents converted in parallel").Default("8").IntVar(&c.parallel)
+	cmd.Flag("checkpoint-interval", "Number of converted contents and objects after which the progress is saved").Default("10000").IntVar(&c.checkpointInterval)
+	cmd.Flag("io-drain-timeout", "Max time it should take all other Kopia clients to drop repository connections").Default(format.DefaultRepositoryBlobCacheDuration.String()).DurationVar(&c.ioDrainTimeout)
+	cmd.Flag("allow-unsafe-upgrade", "Force using an unsafe io-drain-timeout for the upgrade lock").Default("false").Hidden().BoolVar(&c.allowUnsafeUpgradeTimings)
+	cmd.Flag("status-poll-interval", "An advisory polling interval to check for the status of conversion").Default("60s").DurationVar(&c.statusPollInterval)
+	cmd.Flag("max-permitted-clock-drift", "The maximum drift between repository and client clocks").Default(maxPermittedClockDriftDefault.String()).DurationVar(&c.maxPermittedClockDrift)
+
+	// conversion phases, the repository is reopened between them.
+
+	// Set the upgrade lock intent.
+	cmd.Action(svc.directRepositoryWriteAction(c.runPhase(c.setLockIntent)))
+	// Wait for all other clients to drain.
+	cmd.Action(svc.directRepositoryWriteAction(c.runPhase(c.drain)))
+	// Rewrite all contents and manifests using the new format.
+	cmd.Action(svc.directRepositoryWriteAction(c.runPhase(c.convert)))
+	// The format has been switched when reopening the repository, remove old contents and revoke the lock.
+	cmd.Action(svc.directRepositoryWriteAction(c.runPhase(c.commit)))
+
+	c.svc = svc
+}
+
+func (c *commandRepositoryConvert) runPhase(act func(context.Context, repo.DirectRepositoryWriter) error) func(context.Context, repo.DirectRepositoryWriter) error {
+	return func(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+		if c.skip {
+			return nil
+		}
+
+		err := act(ctx, rep)
+		if err != nil {
+			// skip remaining phases, see commandRepositoryUpgrade.runPhase()
+			c.skip = true
+		}
+
+		return err
+	}
+}
+
+func (c *commandRepositoryConvert) conversionOptions(ctx context.Context, rep repo.DirectRepositoryWriter) (format.ConversionOptions, error) {
+	opt, err := rep.FormatManager().ConversionOptions(ctx)
+	if err != nil {
+		return format.ConversionOptions{}, errors.Wrap(err, "unable to get repository format")
+	}
+
+	if c.hash != "" {
+		opt.Hash = c.hash
+	}
+
+	if c.encryption != "" {
+		opt.Encryption = c.encryption
+	}
+
+	if c.ecc != "" {
+		opt.ECC = c.ecc
+	}
+
+	if c.eccOverheadPercent >= 0 {
+		opt.ECCOverheadPercent = c.eccOverheadPercent
+	}
+
+	if opt.ECCOverheadPercent > 0 && opt.ECC == "" {
+		opt.ECC = ecc.DefaultAlgorithm
+	}
+
+	return opt, nil
+}
+
+// setLockIntent is the conversion phase which sets the upgrade lock intent, unless the repository already uses the requested format.
+func (c *commandRepositoryConvert) setLockIntent(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	if c.ioDrainTimeout < format.DefaultRepositoryBlobCacheDuration && !c.allowUnsafeUpgradeTimings {
+		return errors.Errorf("minimum required io-drain-timeout is %s", format.DefaultRepositoryBlobCacheDuration)
+	}
+
+	opt, err := c.conversionOptions(ctx, rep)
+	if err != nil {
+		return err
+	}
+
+	current, err := rep.FormatManager().ConversionOptions(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to get repository format")
+	}
+
+	status, err := rep.FormatManager().GetConversionStatus(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to get conversion status")
+	}
+
+	if opt == current && status == format.ConversionNone {
+		log(ctx).Info("Repository is already using the requested format.")
+
+		c.skip = true
+
+		return nil
+	}
+
+	now := rep.Time()
+
+	l := &format.UpgradeLockIntent{
+		OwnerID:                c.svc.optionsFromFlags(ctx).UpgradeOwnerID,
+		CreationTime:           now,
+		IODrainTimeout:         c.ioDrainTimeout,
+		StatusPollInterval:     c.statusPollInterval,
+		Message:                fmt.Sprintf("Converting repository format to hash %v, encryption %v", opt.Hash, opt.Encryption),
+		MaxPermittedClockDrift: c.maxPermittedClockDrift,
+	}
+
+	if _, err := rep.FormatManager().SetConversionLockIntent(ctx, *l); err != nil {
+		return errors.Wrap(err, "error setting the upgrade lock intent")
+	}
+	// we need to reopen the repository after this point
+
+	log(ctx).Info("Repository upgrade lock intent has been placed.")
+
+	return nil
+}
+
+// drain is the conversion phase which waits for all other clients to stop using the repository.
+func (c *commandRepositoryConvert) drain(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	if err := drainAllClients(ctx, c.svc, rep); err != nil {
+		return errors.Wrap(err, "failed to convert the repository, lock is not released")
+	}
+
+	log(ctx).Info("Successfully drained all repository clients, the lock has been fully-established now.")
+
+	return nil
+}
+
+// convert is the conversion phase which rewrites all contents and manifests using the new format.
+func (c *commandRepositoryConvert) convert(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	status, err := rep.FormatManager().GetConversionStatus(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to get conversion status")
+	}
+
+	if status == format.ConversionReady || status == format.ConversionCommitted {
+		// all contents have already been converted.
+		return nil
+	}
+
+	opt, err := c.conversionOptions(ctx, rep)
+	if err != nil {
+		return err
+	}
+
+	st, err := snapshotconvert.Convert(ctx, rep, snapshotconvert.Options{
+		Format:             opt,
+		Parallel:           c.parallel,
+		CheckpointInterval: c.checkpointInterval,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error converting repository, run the command again to resume")
+	}
+	// the format will be switched when the repository is reopened
+
+	log(ctx).Infof("Converted %v contents, %v objects and %v manifests.", st.Contents, st.Objects, st.Manifests)
+
+	return nil
+}
+
+// commit is the conversion phase which runs after the repository has been reopened using the new format.
+// It removes packs written using the old format, revokes the lock and removes the state of the conversion.
+func (c *commandRepositoryConvert) commit(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	held, err := maintenance.HeldBlobs(ctx, rep)
+	if err != nil {
+		return errors.Wrap(err, "unable to list blobs on hold")
+	}
+
+	if err := repo.FinishFormatConversion(ctx, rep, held); err != nil {
+		return errors.Wrap(err, "error finishing format conversion")
+	}
+
+	if err := rep.FormatManager().CommitUpgrade(ctx); err != nil {
+		return errors.Wrap(err, "error revoking the upgrade lock")
+	}
+
+	if err := rep.FormatManager().DiscardConversion(ctx); err != nil {
+		return errors.Wrap(err, "error removing conversion state")
+	}
+
+	log(ctx).Info("Repository format has been successfully converted.")
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryConvert(t *testing.T) {
+	t.Parallel()
+
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir,
+		"--block-hash", "BLAKE2B-256-128", "--encryption", "AES256-GCM-HMAC-SHA256")
+
+	keyFile := filepath.Join(testutil.TempDirectory(t), "signing.key")
+	env.RunAndExpectSuccess(t, "snapshot", "generate-signing-key", keyFile)
+	env.RunAndExpectSuccess(t, "repo", "set-client", "--snapshot-signing-key-file", keyFile)
+
+	srcDir := testutil.TempDirectory(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "a", "b"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "b", "file1.txt"), []byte("hello world"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "file2.txt"), []byte("some other contents"), 0o600))
+
+	env.RunAndExpectSuccess(t, "snapshot", "create", srcDir)
+
+	snapshotsBefore := manifestIDs(env.RunAndExpectSuccess(t, "snapshot", "list", "--manifest-id", srcDir))
+	require.Len(t, snapshotsBefore, 1)
+
+	env.RunAndExpectFailure(t, "repository", "convert", "--hash", "BLAKE3-256")
+
+	env.Environment["KOPIA_UPGRADE_LOCK_ENABLED"] = "1"
+
+	convertFlags := []string{
+		"--upgrade-owner-id", "owner",
+		"--io-drain-timeout", "1s", "--allow-unsafe-upgrade",
+		"--status-poll-interval", "1s",
+		"--max-permitted-clock-drift", "1s",
+	}
+
+	_, stderr := env.RunAndExpectSuccessWithErrOut(t, append([]string{
+		"repository", "convert", "--hash", "BLAKE3-256", "--encryption", "CHACHA20-POLY1305-HMAC-SHA256",
+	}, convertFlags...)...)
+	require.Contains(t, stderr, "Repository format has been successfully converted.")
+
+	out := env.RunAndExpectSuccess(t, "repository", "status")
+	require.Contains(t, out, "Hash:                BLAKE3-256")
+	require.Contains(t, out, "Encryption:          CHACHA20-POLY1305-HMAC-SHA256")
+
+	// snapshots keep their identity, but root object IDs change.
+	require.Equal(t, snapshotsBefore, manifestIDs(env.RunAndExpectSuccess(t, "snapshot", "list", "--manifest-id", srcDir)))
+
+	env.RunAndExpectSuccess(t, "snapshot", "verify", "--verify-files-percent=100")
+	env.RunAndExpectSuccess(t, "content", "verify", "--full")
+	env.RunAndExpectSuccess(t, "snapshot", "verify-chain")
+
+	restoreDir := testutil.TempDirectory(t)
+	env.RunAndExpectSuccess(t, "snapshot", "restore", srcDir, restoreDir)
+
+	b, err := os.ReadFile(filepath.Join(restoreDir, "a", "b", "file1.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(b))
+
+	// contents written using the previous format have been removed.
+	require.Empty(t, env.RunAndExpectSuccess(t, "blob", "list", "--prefix", "kopia.convert."))
+
+	_, stderr = env.RunAndExpectSuccessWithErrOut(t, append([]string{
+		"repository", "convert", "--hash", "BLAKE3-256",
+	}, convertFlags...)...)
+	require.Contains(t, stderr, "Repository is already using the requested format.")
+
+	env.RunAndExpectSuccess(t, "snapshot", "create", srcDir)
+	env.RunAndExpectSuccess(t, "maintenance", "run", "--full", "--safety=none")
+	env.RunAndExpectSuccess(t, "snapshot", "verify-chain")
+	env.RunAndExpectSuccess(t, "snapshot", "verify", "--verify-files-percent=100")
+}
+
+var manifestIDRegexp = regexp.MustCompile(`manifest:([0-9a-f]+)`)
+
+func manifestIDs(lines []string) []string {
+	var result []string
+
+	for _, l := range lines {
+		if m := manifestIDRegexp.FindStringSubmatch(l); m != nil {
+			result = append(result, m[1])
+		}
+	}
+
+	return result
+}
@@ -2,11 +2,14 @@
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/crypto"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/ecc"
@@ -34,6 +37,8 @@ type commandRepositoryCreate struct {
 	createFormatVersion               int
 	retentionMode                     string
 	retentionPeriod                   time.Duration
+	asymmetricEncryption              bool
+	formatReplicas                    format.ReplicaOptions
 
 	co  connectOptions
 	svc advancedAppServices
@@ -52,8 +57,11 @@ func (c *commandRepositoryCreate) setup(svc advancedAppServices, parent commandP
 	cmd.Flag("format-version", "Force a particular repository format version (1, 2 or 3, 0==default)").IntVar(&c.createFormatVersion)
 	cmd.Flag("retention-mode", "Set the blob retention-mode for supported storage backends.").EnumVar(&c.retentionMode, blob.Governance.String(), blob.Compliance.String())
 	cmd.Flag("retention-period", "Set the blob retention-period for supported storage backends.").DurationVar(&c.retentionPeriod)
+	cmd.Flag("asymmetric-encryption", "Seal contents to a public key, so that clients connected with --write-only can't read them. Indexes remain readable to all clients with the password. The private key is written to --private-key-file.").BoolVar(&c.asymmetricEncryption)
+	cmd.Flag("format-replicas", "Number of redundant copies of the format blobs, used to recover from their loss or corruption.").Default("2").IntVar(&c.formatReplicas.Count)
+	cmd.Flag("format-replica-ecc-overhead-percent", "How much space overhead can be used for error correction of format blob replicas, in percentage. Use 0 to disable ECC.").Default("0").IntVar(&c.formatReplicas.ECCOverheadPercent)
 	//nolint:lll
-	cmd.Flag("format-block-key-derivation-algorithm", "Algorithm to derive the encryption key for the format block from the repository password").Default(format.DefaultKeyDerivationAlgorithm).EnumVar(&c.createBlockKeyDerivationAlgorithm, format.SupportedFormatBlobKeyDerivationAlgorithms()...)
+	keyDerivationAlgorithmFlag(cmd, "format-block-key-derivation-algorithm", "Algorithm to derive the encryption key for the format block from the repository password", &c.createBlockKeyDerivationAlgorithm).Default(format.DefaultKeyDerivationAlgorithm).StringVar(&c.createBlockKeyDerivationAlgorithm)
 
 	c.co.setup(svc, cmd)
 	c.svc = svc
@@ -77,6 +85,16 @@ func (c *commandRepositoryCreate) setup(svc advancedAppServices, parent commandP
 	}
 }
 
+// keyDerivationAlgorithmFlag defines a flag accepting one of the supported key derivation algorithms
+// or Argon2id with custom parameters, which is validated when the flag is provided.
+func keyDerivationAlgorithmFlag(cmd *kingpin.CmdClause, name, help string, target *string) *kingpin.FlagClause {
+	help = fmt.Sprintf("%v (%v or %v<memoryKiB>-<iterations>-<parallelism>)", help, strings.Join(format.SupportedFormatBlobKeyDerivationAlgorithms(), ", "), crypto.Argon2idAlgorithmPrefix)
+
+	return cmd.Flag(name, help).PlaceHolder("ALGO").PreAction(func(_ *kingpin.ParseContext) error {
+		return format.ValidateKeyDerivationAlgorithm(*target) //nolint:wrapcheck
+	})
+}
+
 func (c *commandRepositoryCreate) newRepositoryOptionsFromFlags() *repo.NewRepositoryOptions {
 	return &repo.NewRepositoryOptions{
 		BlockFormat: format.ContentFormat{
@@ -96,7 +114,27 @@ func (c *commandRepositoryCreate) newRepositoryOptionsFromFlags() *repo.NewRepos
 		RetentionMode:                     blob.RetentionMode(c.retentionMode),
 		RetentionPeriod:                   c.retentionPeriod,
 		FormatBlockKeyDerivationAlgorithm: c.createBlockKeyDerivationAlgorithm,
+		FormatReplicas:                    c.formatReplicas,
+	}
+}
+
+// generatePrivateKeyFile generates a key pair for asymmetric encryption, writes the private key to the file
+// provided by --private-key-file and returns the public key.
+func (c *commandRepositoryCreate) generatePrivateKeyFile() ([]byte, error) {
+	if c.co.privateKeyFile == "" {
+		return nil, errors.New("--asymmetric-encryption requires --private-key-file")
+	}
+
+	publicKey, privateKey, err := encryption.NewSealedBoxKeyPair()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to generate key pair")
+	}
+
+	if err := repo.WritePrivateKeyFile(c.co.privateKeyFile, privateKey); err != nil {
+		return nil, errors.Wrap(err, "unable to write private key")
 	}
+
+	return publicKey, nil
 }
 
 func (c *commandRepositoryCreate) ensureEmpty(ctx context.Context, s blob.Storage) error {
@@ -121,6 +159,12 @@ func (c *commandRepositoryCreate) runCreateCommandWithStorage(ctx context.Contex
 
 	options := c.newRepositoryOptionsFromFlags()
 
+	if c.asymmetricEncryption {
+		if options.BlockFormat.PublicKey, err = c.generatePrivateKeyFile(); err != nil {
+			return err
+		}
+	}
+
 	pass, err := c.svc.getPasswordFromFlags(ctx, true, false)
 	if err != nil {
 		return errors.Wrap(err, "getting password")
@@ -142,6 +186,10 @@ func (c *commandRepositoryCreate) runCreateCommandWithStorage(ctx context.Contex
 
 	log(ctx).Infof("  splitter:            %v", options.ObjectFormat.Splitter)
 
+	if len(options.BlockFormat.PublicKey) > 0 {
+		log(ctx).Infof("  private key:         %v", c.co.privateKeyFile)
+	}
+
 	if err := repo.Initialize(ctx, st, options, pass); err != nil {
 		return errors.Wrap(err, "cannot initialize repository")
 	}
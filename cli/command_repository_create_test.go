@@ -61,3 +61,24 @@ func TestRepositoryCreateWithConfigFromStdin(t *testing.T) {
 
 	env.RunAndExpectSuccess(t, "repo", "create", "from-config", "--token-stdin")
 }
+
+func TestRepositoryCreateWithArgon2id(t *testing.T) {
+	t.Parallel()
+
+	env := testenv.NewCLITest(t, nil, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectFailure(t, "repo", "create", "filesystem", "--path", env.RepoDir, "--format-block-key-derivation-algorithm=argon2id-1024-0-1")
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir, "--format-block-key-derivation-algorithm=argon2id-1024-1-1")
+	env.RunAndExpectSuccess(t, "repo", "status")
+
+	env.RunAndExpectFailure(t, "repo", "change-password", "--new-password=newPass", "--key-derivation-algorithm=argon2id-1024-1-0")
+	env.RunAndExpectSuccess(t, "repo", "change-password", "--new-password=newPass", "--key-derivation-algorithm=argon2id-2048-2-2")
+
+	env2 := testenv.NewCLITest(t, nil, testenv.NewInProcRunner(t))
+	env2.Environment["KOPIA_PASSWORD"] = "newPass"
+	env2.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", env.RepoDir)
+
+	f, err := os.ReadFile(path.Join(env.RepoDir, "kopia.repository.f"))
+	require.NoError(t, err)
+	require.Contains(t, string(f), `"keyAlgo": "argon2id-2048-2-2"`)
+}
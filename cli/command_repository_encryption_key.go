@@ -0,0 +1,13 @@
+package cli
+
+type commandRepositoryEncryptionKey struct {
+	list   commandRepositoryEncryptionKeyList
+	rotate commandRepositoryEncryptionKeyRotate
+}
+
+func (c *commandRepositoryEncryptionKey) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("encryption-key", "Commands to manage content encryption keys")
+
+	c.list.setup(svc, cmd)
+	c.rotate.setup(svc, cmd)
+}
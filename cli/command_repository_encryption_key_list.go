@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/content/index"
+)
+
+type commandRepositoryEncryptionKeyList struct {
+	jo  jsonOutput
+	out textOutput
+}
+
+// EncryptionKeyInfo describes a content encryption key in JSON output.
+type EncryptionKeyInfo struct {
+	ID           byte      `json:"id"`
+	CreatedTime  time.Time `json:"created,omitempty"`
+	Active       bool      `json:"active"`
+	ContentCount int       `json:"contentCount"`
+}
+
+func (c *commandRepositoryEncryptionKeyList) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("list", "List content encryption keys and the number of contents using them").Alias("ls")
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+}
+
+func (c *commandRepositoryEncryptionKeyList) run(ctx context.Context, rep repo.DirectRepository) error {
+	keys, err := rep.FormatManager().ContentEncryptionKeys(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to list encryption keys")
+	}
+
+	active := rep.FormatManager().GetActiveEncryptionKeyID()
+	counts := map[byte]int{}
+
+	if err := rep.ContentReader().IterateContents(ctx, content.IterateOptions{
+		Range:          index.AllIDs,
+		IncludeDeleted: true,
+	}, func(ci content.Info) error {
+		counts[ci.EncryptionKeyID]++
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "error iterating contents")
+	}
+
+	masterKeyRetired, err := rep.FormatManager().IsMasterKeyRetired(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to list encryption keys")
+	}
+
+	var infos []EncryptionKeyInfo
+
+	// key 0 is the original master key, which is not part of the key ring.
+	if !masterKeyRetired {
+		infos = append(infos, EncryptionKeyInfo{ID: 0, Active: active == 0, ContentCount: counts[0]})
+	}
+
+	for _, k := range keys {
+		infos = append(infos, EncryptionKeyInfo{
+			ID:           k.ID,
+			CreatedTime:  k.CreatedTime,
+			Active:       k.ID == active,
+			ContentCount: counts[k.ID],
+		})
+	}
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(infos))
+		return nil
+	}
+
+	for _, k := range infos {
+		created := "(repository creation)"
+		if !k.CreatedTime.IsZero() {
+			created = formatTimestamp(k.CreatedTime)
+		}
+
+		var activeSuffix string
+		if k.Active {
+			activeSuffix = " (active)"
+		}
+
+		c.out.printStdout("%-5v %-25v %10v contents%v\n", k.ID, created, k.ContentCount, activeSuffix)
+	}
+
+	return nil
+}
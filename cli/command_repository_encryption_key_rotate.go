@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+)
+
+type commandRepositoryEncryptionKeyRotate struct{}
+
+func (c *commandRepositoryEncryptionKeyRotate) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("rotate", "Generate a new content encryption key used for all new contents")
+	cmd.Action(svc.directRepositoryWriteAction(c.run))
+}
+
+func (c *commandRepositoryEncryptionKeyRotate) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	keyID, err := rep.FormatManager().RotateEncryptionKey(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to rotate encryption key")
+	}
+
+	log(ctx).Infof("New contents will be encrypted using key %v.", keyID)
+	log(ctx).Info("Existing contents will be re-encrypted and previous keys retired by full maintenance.")
+
+	return nil
+}
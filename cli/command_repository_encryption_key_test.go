@@ -0,0 +1,46 @@
+package cli_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/cli"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryEncryptionKeyRotate(t *testing.T) {
+	t.Parallel()
+
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+	env.RunAndExpectSuccess(t, "snapshot", "create", testutil.TempDirectory(t))
+
+	env.RunAndExpectSuccess(t, "repo", "encryption-key", "rotate")
+	env.RunAndExpectSuccess(t, "snapshot", "create", testutil.TempDirectory(t))
+
+	var keys []cli.EncryptionKeyInfo
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "repo", "encryption-key", "list", "--json"), &keys)
+	require.Len(t, keys, 2)
+	require.False(t, keys[0].Active)
+	require.NotZero(t, keys[0].ContentCount)
+	require.True(t, keys[1].Active)
+	require.NotZero(t, keys[1].ContentCount)
+
+	// full maintenance re-encrypts contents written using older keys, including the original key, and retires them.
+	env.RunAndExpectSuccess(t, "repo", "encryption-key", "rotate")
+	env.RunAndExpectSuccess(t, "maintenance", "run", "--full", "--safety=none")
+
+	keys = nil
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "repo", "encryption-key", "list", "--json"), &keys)
+	require.Len(t, keys, 1)
+	require.Equal(t, byte(2), keys[0].ID)
+	require.True(t, keys[0].Active)
+
+	env.RunAndExpectSuccess(t, "snapshot", "verify")
+	env.RunAndExpectSuccess(t, "content", "verify", "--full")
+}
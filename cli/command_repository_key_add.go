@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/format"
+)
+
+type commandRepositoryKeyAdd struct {
+	label                  string
+	newPassword            string
+	keyDerivationAlgorithm string
+
+	svc advancedAppServices
+}
+
+func (c *commandRepositoryKeyAdd) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("add", "Add a key slot allowing the repository to be opened with another password")
+	cmd.Flag("label", "Key slot label").Required().StringVar(&c.label)
+	cmd.Flag("new-password", "Password of the new key slot").Envar(svc.EnvName("KOPIA_NEW_PASSWORD")).StringVar(&c.newPassword)
+	keyDerivationAlgorithmFlag(cmd, "key-derivation-algorithm", "Algorithm to derive the key slot key from the password", &c.keyDerivationAlgorithm).Default(format.DefaultKeyDerivationAlgorithm).StringVar(&c.keyDerivationAlgorithm)
+
+	c.svc = svc
+	cmd.Action(svc.directRepositoryWriteAction(c.run))
+}
+
+func (c *commandRepositoryKeyAdd) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	newPass := c.newPassword
+
+	if newPass == "" {
+		n, err := askForChangedRepositoryPassword(c.svc.stdout())
+		if err != nil {
+			return err
+		}
+
+		newPass = n
+	}
+
+	if err := rep.FormatManager().AddKeySlot(ctx, c.label, newPass, c.keyDerivationAlgorithm); err != nil {
+		return errors.Wrap(err, "unable to add key slot")
+	}
+
+	log(ctx).Infof("Added key slot %q.", c.label)
+
+	return nil
+}
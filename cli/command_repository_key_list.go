@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+)
+
+type commandRepositoryKeyList struct {
+	jo  jsonOutput
+	out textOutput
+}
+
+// KeySlotInfo describes a repository key slot in JSON output.
+type KeySlotInfo struct {
+	Label                  string    `json:"label"`
+	KeyDerivationAlgorithm string    `json:"keyAlgo"`
+	CreatedTime            time.Time `json:"created"`
+}
+
+func (c *commandRepositoryKeyList) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("list", "List key slots of the repository").Alias("ls")
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+}
+
+func (c *commandRepositoryKeyList) run(ctx context.Context, rep repo.DirectRepository) error {
+	slots, err := rep.FormatManager().KeySlots(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to list key slots")
+	}
+
+	var infos []KeySlotInfo
+
+	for _, ks := range slots {
+		infos = append(infos, KeySlotInfo{
+			Label:                  ks.Label,
+			KeyDerivationAlgorithm: ks.KeyDerivationAlgorithm,
+			CreatedTime:            ks.CreatedTime,
+		})
+	}
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(infos))
+		return nil
+	}
+
+	if len(infos) == 0 {
+		c.out.printStdout("Repository does not use key slots, the format encryption key is derived from the password.\n")
+		return nil
+	}
+
+	for _, ks := range infos {
+		c.out.printStdout("%-30v %-25v %v\n", ks.Label, ks.KeyDerivationAlgorithm, formatTimestamp(ks.CreatedTime))
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+)
+
+type commandRepositoryKeyRemove struct {
+	label string
+}
+
+func (c *commandRepositoryKeyRemove) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("remove", "Remove a key slot, revoking access using its password").Alias("rm")
+	cmd.Arg("label", "Key slot label").Required().StringVar(&c.label)
+	cmd.Action(svc.directRepositoryWriteAction(c.run))
+}
+
+func (c *commandRepositoryKeyRemove) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	if err := rep.FormatManager().RemoveKeySlot(ctx, c.label); err != nil {
+		return errors.Wrap(err, "unable to remove key slot")
+	}
+
+	log(ctx).Infof("Removed key slot %q.", c.label)
+
+	return nil
+}
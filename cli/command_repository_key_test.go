@@ -0,0 +1,45 @@
+package cli_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryKeySlots(t *testing.T) {
+	t.Parallel()
+
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir, "--disable-repository-format-cache")
+	require.Contains(t, env.RunAndExpectSuccess(t, "repo", "key", "list")[0], "does not use key slots")
+
+	env.RunAndExpectSuccess(t, "repo", "key", "add", "--label", "alice", "--new-password", "alice-password")
+	env.RunAndExpectFailure(t, "repo", "key", "add", "--label", "alice", "--new-password", "other-password")
+
+	var slots []string
+
+	for _, l := range env.RunAndExpectSuccess(t, "repo", "key", "list") {
+		slots = append(slots, strings.Fields(l)[0])
+	}
+
+	require.Equal(t, []string{format.DefaultKeySlotLabel, "alice"}, slots)
+
+	// original password keeps working.
+	env.RunAndExpectSuccess(t, "snapshot", "ls")
+
+	env2 := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+	env2.Environment["KOPIA_PASSWORD"] = "alice-password"
+	env2.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", env.RepoDir, "--disable-repository-format-cache")
+
+	// alice can't remove her own key slot, but can remove the original one.
+	env2.RunAndExpectFailure(t, "repo", "key", "remove", "alice")
+	env2.RunAndExpectSuccess(t, "repo", "key", "remove", format.DefaultKeySlotLabel)
+
+	env.RunAndExpectFailure(t, "snapshot", "ls")
+	env2.RunAndExpectSuccess(t, "snapshot", "ls")
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/format"
+)
+
+type commandRepositoryRecoverFormat struct {
+	cacheDirectory string
+	dryRun         bool
+
+	svc advancedAppServices
+}
+
+func (c *commandRepositoryRecoverFormat) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("recover-format", "Rebuild format blobs from their replicas or a client's cached copy.")
+
+	cmd.Flag("cache-directory", "Cache directory of a client holding a copy of the format blobs (defaults to the cache directory of the current connection)").StringVar(&c.cacheDirectory)
+	cmd.Flag("dry-run", "Do not modify repository").Short('n').BoolVar(&c.dryRun)
+
+	c.svc = svc
+
+	for _, prov := range svc.storageProviders() {
+		f := prov.NewFlags()
+		cc := cmd.Command(prov.Name, "Recover format blobs of repository in "+prov.Description)
+		f.Setup(svc, cc)
+		cc.Action(func(kpc *kingpin.ParseContext) error {
+			return svc.runAppWithContext(kpc.SelectedCommand, func(ctx context.Context) error {
+				st, err := f.Connect(ctx, false, 0)
+				if err != nil {
+					return errors.Wrap(err, "can't connect to storage")
+				}
+
+				return c.runRecoverFormatWithStorage(ctx, st)
+			})
+		})
+	}
+}
+
+func (c *commandRepositoryRecoverFormat) runRecoverFormatWithStorage(ctx context.Context, st blob.Storage) error {
+	cacheDirectory := c.cacheDirectory
+	if cacheDirectory == "" {
+		if lc, err := repo.LoadConfigFromFile(c.svc.repositoryConfigFileName()); err == nil && lc.Caching != nil {
+			cacheDirectory = lc.Caching.CacheDirectory
+		}
+	}
+
+	pass, err := c.svc.getPasswordFromFlags(ctx, false, false)
+	if err != nil {
+		return errors.Wrap(err, "getting password")
+	}
+
+	res, err := format.RecoverFormatBlobs(ctx, st, pass, cacheDirectory, c.dryRun)
+	if err != nil {
+		return errors.Wrap(err, "unable to recover format blobs")
+	}
+
+	log(ctx).Infof("Using format blob from %v.", res.Source)
+
+	if len(res.Repaired) == 0 {
+		log(ctx).Info("All format blobs and replicas are intact.")
+		return nil
+	}
+
+	for _, id := range res.Repaired {
+		if c.dryRun {
+			log(ctx).Infof("Would repair %v.", id)
+		} else {
+			log(ctx).Infof("Repaired %v.", id)
+		}
+	}
+
+	return nil
+}
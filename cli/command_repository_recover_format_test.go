@@ -0,0 +1,95 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob/sharded"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryRecoverFormat(t *testing.T) {
+	t.Parallel()
+
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir, "--format-replicas=3")
+	env.RunAndExpectSuccess(t, "snapshot", "create", testutil.TempDirectory(t))
+
+	require.Len(t, formatBlobFiles(t, env.RepoDir, "kopia.repository"), 4)
+	require.Len(t, formatBlobFiles(t, env.RepoDir, "kopia.blobcfg"), 4)
+
+	env.RunAndExpectSuccess(t, "repo", "set-parameters", "--format-replicas=1", "--format-replica-ecc-overhead-percent=20")
+	require.Len(t, formatBlobFiles(t, env.RepoDir, "kopia.repository"), 2)
+
+	// populate the format blob cache of the client.
+	env.RunAndExpectSuccess(t, "snapshot", "list")
+
+	// lose the format blob, replica is used instead.
+	removeFormatBlobFile(t, env.RepoDir, "kopia.repository")
+
+	env2 := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+	env2.Environment["KOPIA_PASSWORD"] = "wrong-password"
+	env2.RunAndExpectFailure(t, "repo", "recover-format", "filesystem", "--path", env.RepoDir)
+
+	env2.Environment["KOPIA_PASSWORD"] = env.Environment["KOPIA_PASSWORD"]
+	env2.RunAndExpectSuccess(t, "repo", "recover-format", "filesystem", "--path", env.RepoDir, "--dry-run")
+	require.Len(t, formatBlobFiles(t, env.RepoDir, "kopia.repository"), 1)
+
+	_, stderr := env2.RunAndExpectSuccessWithErrOut(t, "repo", "recover-format", "filesystem", "--path", env.RepoDir)
+	require.Contains(t, strings.Join(stderr, "\n"), "Repaired kopia.repository.")
+	require.Len(t, formatBlobFiles(t, env.RepoDir, "kopia.repository"), 2)
+
+	// lose all copies, the client cache of the first client is used.
+	removeFormatBlobFile(t, env.RepoDir, "kopia.repository")
+	removeFormatBlobFile(t, env.RepoDir, "kopia.repository.replica.1")
+
+	env2.RunAndExpectFailure(t, "repo", "recover-format", "filesystem", "--path", env.RepoDir)
+	env.RunAndExpectSuccess(t, "repo", "recover-format", "filesystem", "--path", env.RepoDir)
+	require.Len(t, formatBlobFiles(t, env.RepoDir, "kopia.repository"), 2)
+
+	env2.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", env.RepoDir)
+	env2.RunAndExpectSuccess(t, "snapshot", "verify")
+}
+
+// formatBlobFiles returns the files in the repository directory holding the provided blob or its replicas, keyed by blob ID.
+func formatBlobFiles(t *testing.T, repoDir, blobID string) map[string]string {
+	t.Helper()
+
+	result := map[string]string{}
+
+	require.NoError(t, filepath.Walk(repoDir, func(path string, info os.FileInfo, err error) error {
+		// skip directories and checksum sidecar files.
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, sharded.CompleteBlobSuffix) {
+			return err
+		}
+
+		rel, err := filepath.Rel(repoDir, path)
+		if err != nil {
+			return err
+		}
+
+		// sharded blob IDs are split into directories.
+		id := strings.TrimSuffix(strings.ReplaceAll(filepath.ToSlash(rel), "/", ""), sharded.CompleteBlobSuffix)
+		if id == blobID || strings.HasPrefix(id, blobID+".replica.") {
+			result[id] = path
+		}
+
+		return nil
+	}))
+
+	return result
+}
+
+func removeFormatBlobFile(t *testing.T, repoDir, blobID string) {
+	t.Helper()
+
+	f, ok := formatBlobFiles(t, repoDir, blobID)[blobID]
+	require.True(t, ok, blobID)
+	require.NoError(t, os.Remove(f))
+}
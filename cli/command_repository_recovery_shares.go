@@ -0,0 +1,13 @@
+package cli
+
+type commandRepositoryRecoveryShares struct {
+	create commandRepositoryRecoverySharesCreate
+	remove commandRepositoryRecoverySharesRemove
+}
+
+func (c *commandRepositoryRecoveryShares) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("recovery-shares", "Commands to manage recovery shares, which restore access to the repository if all passwords are lost")
+
+	c.create.setup(svc, cmd)
+	c.remove.setup(svc, cmd)
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+)
+
+type commandRepositoryRecoverySharesCreate struct {
+	threshold int
+	shares    int
+
+	out textOutput
+}
+
+func (c *commandRepositoryRecoverySharesCreate) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("create", "Create recovery shares, invalidating previously created ones")
+	cmd.Flag("threshold", "Number of shares required to restore access").Default("3").IntVar(&c.threshold)
+	cmd.Flag("shares", "Total number of shares").Default("5").IntVar(&c.shares)
+	cmd.Action(svc.directRepositoryWriteAction(c.run))
+
+	c.out.setup(svc)
+}
+
+func (c *commandRepositoryRecoverySharesCreate) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	shares, err := rep.FormatManager().CreateRecoveryShares(ctx, c.threshold, c.shares)
+	if err != nil {
+		return errors.Wrap(err, "unable to create recovery shares")
+	}
+
+	for _, s := range shares {
+		c.out.printStdout("%v\n", s)
+	}
+
+	log(ctx).Infof(`
+NOTE: Any %v of the %v recovery shares above can be used to restore access to the repository using:
+
+$ kopia repository connect ... --recovery-shares
+
+Store each share separately, they are not displayed again.`, c.threshold, c.shares)
+
+	return nil
+}
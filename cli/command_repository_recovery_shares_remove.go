@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+)
+
+type commandRepositoryRecoverySharesRemove struct{}
+
+func (c *commandRepositoryRecoverySharesRemove) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("remove", "Invalidate all recovery shares").Alias("rm")
+	cmd.Action(svc.directRepositoryWriteAction(c.run))
+}
+
+func (c *commandRepositoryRecoverySharesRemove) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	if err := rep.FormatManager().RemoveRecoveryShares(ctx); err != nil {
+		return errors.Wrap(err, "unable to remove recovery shares")
+	}
+
+	log(ctx).Info("Removed recovery shares.")
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package cli_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryRecoveryShares(t *testing.T) {
+	t.Parallel()
+
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+	env.RunAndExpectSuccess(t, "snapshot", "create", testutil.TempDirectory(t))
+
+	env.RunAndExpectFailure(t, "repo", "recovery-shares", "create", "--threshold=3", "--shares=2")
+
+	shares := env.RunAndExpectSuccess(t, "repo", "recovery-shares", "create", "--threshold=2", "--shares=3")
+	require.Len(t, shares, 3)
+
+	// the original password is lost.
+	runner := testenv.NewInProcRunner(t)
+	env2 := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+	env2.Environment["KOPIA_PASSWORD"] = "recovered-password"
+
+	env2.RunAndExpectFailure(t, "repo", "connect", "filesystem", "--path", env.RepoDir)
+
+	runner.SetNextStdin(strings.NewReader(shares[0] + "\n"))
+	env2.RunAndExpectFailure(t, "repo", "connect", "filesystem", "--path", env.RepoDir, "--recovery-shares")
+
+	runner.SetNextStdin(strings.NewReader(shares[2] + "\n\n" + shares[0] + "\n"))
+	env2.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", env.RepoDir, "--recovery-shares")
+	env2.RunAndExpectSuccess(t, "snapshot", "verify")
+
+	lines := env2.RunAndExpectSuccess(t, "repo", "key", "list")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[1], "recovered-")
+
+	// the original password keeps working.
+	env.RunAndExpectSuccess(t, "snapshot", "list")
+
+	env.RunAndExpectSuccess(t, "repo", "recovery-shares", "remove")
+
+	env3 := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	runner.SetNextStdin(strings.NewReader(shares[0] + "\n" + shares[1] + "\n"))
+	env3.RunAndExpectFailure(t, "repo", "connect", "filesystem", "--path", env.RepoDir, "--recovery-shares")
+}
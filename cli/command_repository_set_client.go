@@ -2,11 +2,18 @@
 
 import (
 	"context"
+	"crypto/ed25519"
+	"path/filepath"
 	"time"
 
+	atunits "github.com/alecthomas/units"
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob/faultinject"
+	"github.com/kopia/kopia/repo/blob/quota"
+	"github.com/kopia/kopia/snapshot"
 )
 
 type commandRepositorySetClient struct {
@@ -20,6 +27,14 @@ type commandRepositorySetClient struct {
 	formatBlobCacheDuration time.Duration
 	disableFormatBlobCache  bool
 
+	storageSoftLimit string
+	storageHardLimit string
+
+	faultProfileFile    string
+	faultProfileFileSet bool
+
+	snapshotSigningKeyFile []string
+
 	svc appServices
 }
 
@@ -34,6 +49,10 @@ func (c *commandRepositorySetClient) setup(svc appServices, parent commandParent
 	cmd.Flag("hostname", "Change hostname").StringsVar(&c.repoClientOptionsHostname)
 	cmd.Flag("repository-format-cache-duration", "Duration of kopia.repository format blob cache").DurationVar(&c.formatBlobCacheDuration)
 	cmd.Flag("disable-repository-format-cache", "Disable caching of kopia.repository format blob").BoolVar(&c.disableFormatBlobCache)
+	cmd.Flag("storage-soft-limit", "Warn when total size of blobs exceeds the provided size ('unlimited' to remove)").StringVar(&c.storageSoftLimit)
+	cmd.Flag("storage-hard-limit", "Refuse to upload new pack blobs when total size of blobs would exceed the provided size ('unlimited' to remove)").StringVar(&c.storageHardLimit)
+	cmd.Flag("fault-profile", "JSON file describing storage faults to inject, for disaster drills (empty to remove)").PlaceHolder("FILE").IsSetByUser(&c.faultProfileFileSet).StringVar(&c.faultProfileFile)
+	cmd.Flag("snapshot-signing-key-file", "File containing the key used to sign snapshots created by this client and link them into a verifiable chain (empty to remove)").PlaceHolder("FILE").StringsVar(&c.snapshotSigningKeyFile)
 	cmd.Action(svc.repositoryReaderAction(c.run))
 
 	c.svc = svc
@@ -112,6 +131,18 @@ func (c *commandRepositorySetClient) run(ctx context.Context, rep repo.Repositor
 		log(ctx).Info("Disabling format blob cache")
 	}
 
+	if err := c.applyStorageQuota(ctx, &opt, &anyChange); err != nil {
+		return err
+	}
+
+	if err := c.applyFaultProfile(ctx, &opt, &anyChange); err != nil {
+		return err
+	}
+
+	if err := c.applySnapshotSigningKey(ctx, &opt, &anyChange); err != nil {
+		return err
+	}
+
 	if !anyChange {
 		return errors.Errorf("no changes")
 	}
@@ -119,3 +150,131 @@ func (c *commandRepositorySetClient) run(ctx context.Context, rep repo.Repositor
 	//nolint:wrapcheck
 	return repo.SetClientOptions(ctx, c.svc.repositoryConfigFileName(), opt)
 }
+
+func (c *commandRepositorySetClient) applyStorageQuota(ctx context.Context, opt *repo.ClientOptions, anyChange *bool) error {
+	if c.storageSoftLimit == "" && c.storageHardLimit == "" {
+		return nil
+	}
+
+	var limits quota.Limits
+
+	if opt.StorageQuota != nil {
+		limits = *opt.StorageQuota
+	}
+
+	if err := setStorageLimit(ctx, "soft storage limit", &limits.SoftLimitBytes, c.storageSoftLimit); err != nil {
+		return err
+	}
+
+	if err := setStorageLimit(ctx, "hard storage limit", &limits.HardLimitBytes, c.storageHardLimit); err != nil {
+		return err
+	}
+
+	if limits.SoftLimitBytes > 0 && limits.HardLimitBytes > 0 && limits.SoftLimitBytes > limits.HardLimitBytes {
+		return errors.Errorf("soft storage limit must not exceed hard storage limit")
+	}
+
+	if limits.IsEmpty() {
+		opt.StorageQuota = nil
+	} else {
+		opt.StorageQuota = &limits
+	}
+
+	*anyChange = true
+
+	return nil
+}
+
+func setStorageLimit(ctx context.Context, desc string, val *int64, str string) error {
+	if str == "" {
+		return nil
+	}
+
+	if str == "unlimited" || str == "-" {
+		log(ctx).Infof("Removing %v.", desc)
+
+		*val = 0
+
+		return nil
+	}
+
+	v, err := atunits.ParseStrictBytes(str)
+	if err != nil {
+		return errors.Wrapf(err, "can't parse the %v %q", desc, str)
+	}
+
+	if v <= 0 {
+		return errors.Errorf("%v must be positive", desc)
+	}
+
+	log(ctx).Infof("Setting %v to %v.", desc, units.BytesString(v))
+
+	*val = v
+
+	return nil
+}
+
+func (c *commandRepositorySetClient) applyFaultProfile(ctx context.Context, opt *repo.ClientOptions, anyChange *bool) error {
+	if !c.faultProfileFileSet {
+		return nil
+	}
+
+	*anyChange = true
+
+	fname := c.faultProfileFile
+	if fname == "" {
+		opt.FaultProfileFile = ""
+
+		log(ctx).Info("Disabling storage fault injection.")
+
+		return nil
+	}
+
+	fname, err := filepath.Abs(fname)
+	if err != nil {
+		return errors.Wrap(err, "invalid fault profile path")
+	}
+
+	if _, err := faultinject.LoadProfile(fname); err != nil {
+		return errors.Wrap(err, "invalid fault profile")
+	}
+
+	opt.FaultProfileFile = fname
+
+	log(ctx).Infof("Injecting storage faults described in %v.", fname)
+
+	return nil
+}
+
+func (c *commandRepositorySetClient) applySnapshotSigningKey(ctx context.Context, opt *repo.ClientOptions, anyChange *bool) error {
+	if len(c.snapshotSigningKeyFile) == 0 {
+		return nil
+	}
+
+	*anyChange = true
+
+	fname := c.snapshotSigningKeyFile[0]
+	if fname == "" {
+		opt.SnapshotSigningKeyFile = ""
+
+		log(ctx).Info("Disabling signing of snapshots.")
+
+		return nil
+	}
+
+	fname, err := filepath.Abs(fname)
+	if err != nil {
+		return errors.Wrap(err, "invalid signing key path")
+	}
+
+	key, err := snapshot.ReadSigningKeyFile(fname)
+	if err != nil {
+		return errors.Wrap(err, "invalid signing key")
+	}
+
+	opt.SnapshotSigningKeyFile = fname
+
+	log(ctx).Infof("Signing snapshots using key %v.", snapshot.SigningKeyFingerprint(key.Public().(ed25519.PublicKey))) //nolint:forcetypeassert
+
+	return nil
+}
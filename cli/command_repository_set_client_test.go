@@ -0,0 +1,35 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositorySetClientFaultProfile(t *testing.T) {
+	t.Parallel()
+
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+
+	profile := filepath.Join(testutil.TempDirectory(t), "profile.json")
+	require.NoError(t, os.WriteFile(profile, []byte(`{"rules":[{"operations":["get"],"prefix":"zz","error":"drill"}]}`), 0o600))
+
+	env.RunAndExpectFailure(t, "repo", "set-client", "--fault-profile", filepath.Join(t.TempDir(), "no-such-file.json"))
+	env.RunAndExpectFailure(t, "repo", "set-client", "--fault-profile", profile, "--fault-profile", "")
+	env.RunAndExpectSuccess(t, "repo", "set-client", "--fault-profile", profile)
+
+	_, stderr := env.RunAndExpectFailure(t, "blob", "show", "zzz")
+	mustGetLineContaining(t, stderr, "injected fault")
+
+	env.RunAndExpectSuccess(t, "repo", "set-client", "--fault-profile", "")
+
+	_, stderr = env.RunAndExpectFailure(t, "blob", "show", "zzz")
+	mustGetLineContaining(t, stderr, "BLOB not found")
+}
@@ -31,6 +31,11 @@ type commandRepositorySetParameters struct {
 
 	upgradeRepositoryFormat bool
 
+	blobListJournal string
+
+	formatReplicas                  int
+	formatReplicaECCOverheadPercent int
+
 	addRequiredFeature           string
 	removeRequiredFeature        string
 	warnOnMissingRequiredFeature bool
@@ -56,6 +61,11 @@ func (c *commandRepositorySetParameters) setup(svc appServices, parent commandPa
 	cmd.Flag("epoch-delete-parallelism", "Epoch delete parallelism").IntVar(&c.epochDeleteParallelism)
 	cmd.Flag("epoch-checkpoint-frequency", "Checkpoint frequency").IntVar(&c.epochCheckpointFrequency)
 
+	cmd.Flag("format-replicas", "Set the number of redundant copies of the format blobs").Default("-1").IntVar(&c.formatReplicas)
+	cmd.Flag("format-replica-ecc-overhead-percent", "Set the error correction overhead of format blob replicas, in percentage").Default("-1").IntVar(&c.formatReplicaECCOverheadPercent)
+
+	cmd.Flag("blob-list-journal", "Enable or disable journal of pack blob writes used to avoid full listing of pack blobs").EnumVar(&c.blobListJournal, "true", "false")
+
 	if svc.enableTestOnlyFlags() {
 		cmd.Flag("add-required-feature", "Add required feature which must be present to open the repository").Hidden().StringVar(&c.addRequiredFeature)
 		cmd.Flag("remove-required-feature", "Remove required feature").Hidden().StringVar(&c.removeRequiredFeature)
@@ -163,6 +173,15 @@ func disableBlobRetention(ctx context.Context, blobcfg *format.BlobStorageConfig
 }
 
 func (c *commandRepositorySetParameters) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	// the blob list journal updates required features, so it's set before they are read below.
+	if c.blobListJournal != "" {
+		if err := repo.SetBlobListJournalEnabled(ctx, rep, c.blobListJournal == "true"); err != nil {
+			return errors.Wrap(err, "unable to set blob list journal")
+		}
+
+		log(ctx).Infof(" - setting blob list journal to %v.\n", c.blobListJournal)
+	}
+
 	mp, err := rep.FormatManager().GetMutableParameters(ctx)
 	if err != nil {
 		return errors.Wrap(err, "mutable parameters")
@@ -216,8 +235,22 @@ func (c *commandRepositorySetParameters) run(ctx context.Context, rep repo.Direc
 
 	requiredFeatures = c.addRemoveUpdateRequiredFeatures(requiredFeatures, &anyChange)
 
+	setFormatReplicas := c.formatReplicas >= 0 || c.formatReplicaECCOverheadPercent >= 0
+
+	if setFormatReplicas {
+		if err := c.setFormatReplicas(ctx, rep); err != nil {
+			return err
+		}
+	}
+
 	if !anyChange {
-		log(ctx).Info("no changes")
+		switch {
+		case c.blobListJournal != "":
+			log(ctx).Info("NOTE: Blob list journal updated, you must disconnect and re-connect all other Kopia clients.")
+		case !setFormatReplicas:
+			log(ctx).Info("no changes")
+		}
+
 		return nil
 	}
 
@@ -241,6 +274,29 @@ func (c *commandRepositorySetParameters) run(ctx context.Context, rep repo.Direc
 	return nil
 }
 
+func (c *commandRepositorySetParameters) setFormatReplicas(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	opt, err := rep.FormatManager().GetReplicaOptions(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to get format blob replicas")
+	}
+
+	if c.formatReplicas >= 0 {
+		opt.Count = c.formatReplicas
+	}
+
+	if c.formatReplicaECCOverheadPercent >= 0 {
+		opt.ECCOverheadPercent = c.formatReplicaECCOverheadPercent
+	}
+
+	if err := rep.FormatManager().SetReplicaOptions(ctx, opt); err != nil {
+		return errors.Wrap(err, "unable to set format blob replicas")
+	}
+
+	log(ctx).Infof(" - setting format blob replicas to %v (ECC overhead %v%%).\n", opt.Count, opt.ECCOverheadPercent)
+
+	return nil
+}
+
 func (c *commandRepositorySetParameters) addRemoveUpdateRequiredFeatures(orig []feature.Required, anyChange *bool) []feature.Required {
 	var result []feature.Required
 
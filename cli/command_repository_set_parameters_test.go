@@ -2,6 +2,9 @@
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -123,6 +126,33 @@ func (s *formatSpecificTestSuite) TestRepositorySetParametersRetention(t *testin
 	require.Contains(t, out, "Blob retention period:   168h0m0s")
 }
 
+func (s *formatSpecificTestSuite) TestRepositorySetParametersBlobListJournal(t *testing.T) {
+	env := s.setupInMemoryRepo(t)
+
+	env.RunAndExpectSuccess(t, "repository", "set-parameters", "--blob-list-journal=true")
+	require.Len(t, env.RunAndExpectSuccess(t, "blob", "list", "--prefix=_ljm"), 1)
+	require.Contains(t, strings.Join(env.RunAndExpectSuccess(t, "repository", "status"), "\n"), "Required Features:   blob-list-journal")
+	require.Len(t, env.RunAndExpectSuccess(t, "blob", "list", "--prefix=_ljc_"), 1)
+
+	dir := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte("some data"), 0o600))
+
+	env.RunAndExpectSuccess(t, "snapshot", "create", dir)
+	require.NotEmpty(t, env.RunAndExpectSuccess(t, "blob", "list", "--prefix=_ljs_"))
+
+	packs := env.RunAndExpectSuccess(t, "blob", "list", "--prefix=p")
+	require.NotEmpty(t, packs)
+
+	// pack blobs are listed using the journal during garbage collection.
+	env.RunAndExpectSuccess(t, "maintenance", "run", "--full", "--safety=none")
+	require.Contains(t, strings.Join(env.RunAndExpectSuccess(t, "maintenance", "info"), "\n"), "reconcile-blob-list-journal:")
+	require.Equal(t, packs, env.RunAndExpectSuccess(t, "blob", "list", "--prefix=p"))
+
+	env.RunAndExpectSuccess(t, "repository", "set-parameters", "--blob-list-journal=false")
+	require.Empty(t, env.RunAndExpectSuccess(t, "blob", "list", "--prefix=_lj"))
+	require.NotContains(t, strings.Join(env.RunAndExpectSuccess(t, "repository", "status"), "\n"), "blob-list-journal")
+}
+
 func (s *formatSpecificTestSuite) TestRepositorySetParametersUpgrade(t *testing.T) {
 	env := s.setupInMemoryRepo(t)
 	out := env.RunAndExpectSuccess(t, "repository", "status")
@@ -5,6 +5,7 @@
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/serverapi"
 	"github.com/kopia/kopia/repo"
 )
 
@@ -20,9 +21,15 @@ func (c *commandRepositoryThrottleGet) setup(svc appServices, parent commandPare
 }
 
 func (c *commandRepositoryThrottleGet) run(ctx context.Context, rep repo.DirectRepository) error {
-	limits := rep.Throttler().Limits()
+	resp := &serverapi.ThrottleLimitsResponse{
+		Limits: rep.Throttler().Limits(),
+	}
+
+	if w, ok := rep.Throttler().ActiveScheduleWindow(); ok {
+		resp.ActiveScheduleWindow = &w
+	}
 
-	if err := c.ctg.output(&limits); err != nil {
+	if err := c.ctg.output(resp); err != nil {
 		return errors.Wrap(err, "output")
 	}
 
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/feature"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+)
+
+type commandRepositoryTrainDictionary struct {
+	maxSizeKB            int
+	maxSamples           int
+	maxSampleSizeKB      int
+	maxTotalSampleSizeMB int
+}
+
+func (c *commandRepositoryTrainDictionary) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("train-dictionary", "Train a zstd dictionary on existing contents, used to compress metadata and files using 'zstd-dictionary' compression")
+	cmd.Flag("max-size-kb", "Maximum size of the dictionary").Default("112").IntVar(&c.maxSizeKB)
+	cmd.Flag("max-samples", "Maximum number of contents to sample").Default("10000").IntVar(&c.maxSamples)
+	cmd.Flag("max-sample-size-kb", "Do not sample contents larger than this").Default("64").IntVar(&c.maxSampleSizeKB)
+	cmd.Flag("max-total-sample-size-mb", "Maximum total size of sampled contents").Default("16").IntVar(&c.maxTotalSampleSizeMB)
+	cmd.Action(svc.directRepositoryWriteAction(c.run))
+}
+
+func (c *commandRepositoryTrainDictionary) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	id, err := rep.ContentManager().TrainZstdDictionary(ctx, content.TrainZstdDictionaryOptions{
+		MaxDictionarySize:  c.maxSizeKB << 10, //nolint:mnd
+		MaxSamples:         c.maxSamples,
+		MaxSampleSize:      c.maxSampleSizeKB << 10,      //nolint:mnd
+		MaxTotalSampleSize: c.maxTotalSampleSizeMB << 20, //nolint:mnd
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to train dictionary")
+	}
+
+	// the dictionary is only committed when the repository is flushed after the feature is required.
+	if err := c.ensureRequiredFeature(ctx, rep); err != nil {
+		return err
+	}
+
+	log(ctx).Infof("Trained zstd dictionary %08x.", id)
+	log(ctx).Info("Metadata and files using 'zstd-dictionary' compression will be compressed using the new dictionary, previous dictionaries remain available for reading.")
+
+	return nil
+}
+
+// ensureRequiredFeature prevents versions of kopia which do not support zstd dictionaries from opening the repository.
+func (c *commandRepositoryTrainDictionary) ensureRequiredFeature(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	requiredFeatures, err := rep.FormatManager().RequiredFeatures(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to get required features")
+	}
+
+	for _, f := range requiredFeatures {
+		if f.Feature == content.ZstdDictionaryFeature {
+			return nil
+		}
+	}
+
+	mp, err := rep.FormatManager().GetMutableParameters(ctx)
+	if err != nil {
+		return errors.Wrap(err, "mutable parameters")
+	}
+
+	blobcfg, err := rep.FormatManager().BlobCfgBlob(ctx)
+	if err != nil {
+		return errors.Wrap(err, "blob configuration")
+	}
+
+	requiredFeatures = append(requiredFeatures, feature.Required{
+		Feature: content.ZstdDictionaryFeature,
+		IfNotUnderstood: feature.IfNotUnderstood{
+			Message: "The repository uses zstd dictionaries trained on repository contents.",
+		},
+	})
+
+	if err := rep.FormatManager().SetParameters(ctx, mp, blobcfg, requiredFeatures); err != nil {
+		return errors.Wrap(err, "error setting required features")
+	}
+
+	log(ctx).Infof("Repository now requires feature %q, older versions of kopia will not be able to open it.", content.ZstdDictionaryFeature)
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package cli_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryTrainDictionary(t *testing.T) {
+	t.Parallel()
+
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+
+	// many similar directories produce similar directory manifests to train on.
+	dir := testutil.TempDirectory(t)
+
+	for i := range 100 {
+		sub := filepath.Join(dir, fmt.Sprintf("dir-%v", i))
+		require.NoError(t, os.Mkdir(sub, 0o755))
+
+		for j := range 5 {
+			require.NoError(t, os.WriteFile(filepath.Join(sub, fmt.Sprintf("file-%v-%v.txt", i, j)), []byte(fmt.Sprintf("contents %v %v", i, j)), 0o600))
+		}
+	}
+
+	env.RunAndExpectSuccess(t, "snapshot", "create", dir)
+
+	require.NotContains(t, env.RunAndExpectSuccess(t, "repo", "status"), "Required Features:   zstd-dictionary")
+
+	env.RunAndExpectSuccess(t, "repo", "train-dictionary", "--max-size-kb=16")
+	require.Contains(t, env.RunAndExpectSuccess(t, "repo", "status"), "Required Features:   zstd-dictionary")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dir-0", "new-file.txt"), []byte("new contents"), 0o600))
+	env.RunAndExpectSuccess(t, "snapshot", "create", dir)
+
+	// retraining keeps snapshots using previous dictionaries readable.
+	env.RunAndExpectSuccess(t, "repo", "train-dictionary", "--max-size-kb=16")
+	env.RunAndExpectSuccess(t, "snapshot", "verify", "--verify-files-percent=100")
+	env.RunAndExpectSuccess(t, "content", "verify", "--full")
+}
@@ -377,7 +377,7 @@ func (c *commandRepositoryUpgrade) drainOrCommit(ctx context.Context, rep repo.D
 		log(ctx).Info("Continuing to drain since advance notice has been set")
 	}
 
-	if err := c.drainAllClients(ctx, rep); err != nil {
+	if err := drainAllClients(ctx, c.svc, rep); err != nil {
 		return errors.Wrap(err, "failed to upgrade the repository, lock is not released")
 	}
 	// we need to reopen the repository after this point
@@ -387,13 +387,13 @@ func (c *commandRepositoryUpgrade) drainOrCommit(ctx context.Context, rep repo.D
 	return nil
 }
 
-func (c *commandRepositoryUpgrade) sleepWithContext(ctx context.Context, dur time.Duration) bool {
+func sleepWithContext(ctx context.Context, svc advancedAppServices, dur time.Duration) bool {
 	t := time.NewTimer(dur)
 	defer t.Stop()
 
 	stop := make(chan struct{})
 
-	c.svc.onTerminate(func() { close(stop) })
+	svc.onTerminate(func() { close(stop) })
 
 	select {
 	case <-ctx.Done():
@@ -405,7 +405,8 @@ func (c *commandRepositoryUpgrade) sleepWithContext(ctx context.Context, dur tim
 	}
 }
 
-func (c *commandRepositoryUpgrade) drainAllClients(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+// drainAllClients waits until the upgrade lock is fully established and all other clients have stopped writing.
+func drainAllClients(ctx context.Context, svc advancedAppServices, rep repo.DirectRepositoryWriter) error {
 	for {
 		l, err := rep.FormatManager().GetUpgradeLockIntent(ctx)
 
@@ -425,7 +426,7 @@ func (c *commandRepositoryUpgrade) drainAllClients(ctx context.Context, rep repo
 		}
 
 		// TODO: this can get stuck
-		if !c.sleepWithContext(ctx, l.StatusPollInterval) {
+		if !sleepWithContext(ctx, svc, l.StatusPollInterval) {
 			return errors.Errorf("upgrade drain interrupted")
 		}
 	}
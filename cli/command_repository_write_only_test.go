@@ -0,0 +1,46 @@
+package cli_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/cli"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryWriteOnlyClient(t *testing.T) {
+	t.Parallel()
+
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+	privateKeyFile := filepath.Join(testutil.TempDirectory(t), "repo.key")
+
+	env.RunAndExpectFailure(t, "repo", "create", "filesystem", "--path", env.RepoDir, "--asymmetric-encryption")
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir, "--asymmetric-encryption", "--private-key-file", privateKeyFile)
+	env.RunAndExpectSuccess(t, "snapshot", "create", testutil.TempDirectory(t))
+
+	writer := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	writer.RunAndExpectFailure(t, "repo", "connect", "filesystem", "--path", env.RepoDir)
+	writer.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", env.RepoDir, "--write-only")
+	writer.RunAndExpectSuccess(t, "snapshot", "create", testutil.TempDirectory(t))
+
+	// the write-only client can't read back any snapshots.
+	var snapshots []cli.SnapshotManifest
+
+	testutil.MustParseJSONLines(t, writer.RunAndExpectSuccess(t, "snapshot", "list", "--json", "--all"), &snapshots)
+	require.Empty(t, snapshots)
+
+	writer.RunAndExpectFailure(t, "maintenance", "run", "--full", "--safety=none")
+
+	snapshots = nil
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "list", "--json", "--all"), &snapshots)
+	require.Len(t, snapshots, 2)
+
+	env.RunAndExpectSuccess(t, "snapshot", "verify")
+	env.RunAndExpectSuccess(t, "maintenance", "run", "--full", "--safety=none")
+	env.RunAndExpectSuccess(t, "content", "verify", "--full")
+}
@@ -6,7 +6,7 @@
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/internal/apiclient"
-	"github.com/kopia/kopia/repo/blob/throttling"
+	"github.com/kopia/kopia/internal/serverapi"
 )
 
 type commandServerThrottleGet struct {
@@ -23,11 +23,11 @@ func (c *commandServerThrottleGet) setup(svc appServices, parent commandParent)
 }
 
 func (c *commandServerThrottleGet) run(ctx context.Context, cli *apiclient.KopiaAPIClient) error {
-	var limits throttling.Limits
+	var resp serverapi.ThrottleLimitsResponse
 
-	if err := cli.Get(ctx, "control/throttle", nil, &limits); err != nil {
+	if err := cli.Get(ctx, "control/throttle", nil, &resp); err != nil {
 		return errors.Wrap(err, "unable to get current throttle")
 	}
 
-	return c.ctg.output(&limits)
+	return c.ctg.output(&resp)
 }
@@ -8,11 +8,14 @@ type commandSnapshot struct {
 	estimate    commandSnapshotEstimate
 	expire      commandSnapshotExpire
 	fix         commandSnapshotFix
+	genKey      commandSnapshotGenerateSigningKey
+	hold        commandSnapshotHold
 	list        commandSnapshotList
 	migrate     commandSnapshotMigrate
 	pin         commandSnapshotPin
 	restore     commandSnapshotRestore
 	verify      commandSnapshotVerify
+	verifyChain commandSnapshotVerifyChain
 }
 
 func (c *commandSnapshot) setup(svc advancedAppServices, parent commandParent) {
@@ -24,9 +27,12 @@ func (c *commandSnapshot) setup(svc advancedAppServices, parent commandParent) {
 	c.estimate.setup(svc, cmd)
 	c.expire.setup(svc, cmd)
 	c.fix.setup(svc, cmd)
+	c.genKey.setup(svc, cmd)
+	c.hold.setup(svc, cmd)
 	c.list.setup(svc, cmd)
 	c.migrate.setup(svc, cmd)
 	c.pin.setup(svc, cmd)
 	c.restore.setup(svc, cmd)
 	c.verify.setup(svc, cmd)
+	c.verifyChain.setup(svc, cmd)
 }
@@ -110,7 +110,7 @@ func (c *commandSnapshotCopyMoveHistory) run(ctx context.Context, rep repo.Repos
 			if isMoveCommand && !c.snapshotCopyOrMoveDryRun {
 				log(ctx).Infof("%v (%v) already exists - deleting source", dstSource, formatTimestamp(manifest.StartTime.ToTime()))
 
-				if err := rep.DeleteManifest(ctx, manifest.ID); err != nil {
+				if err := snapshot.DeleteSnapshot(ctx, rep, manifest); err != nil {
 					return errors.Wrap(err, "unable to delete source manifest")
 				}
 			} else {
@@ -128,8 +128,17 @@ func (c *commandSnapshotCopyMoveHistory) run(ctx context.Context, rep repo.Repos
 			continue
 		}
 
+		if isMoveCommand {
+			// holds apply to the source, so moving would release them.
+			if err := snapshot.CheckNotOnHold(ctx, rep, manifest); err != nil {
+				return err //nolint:wrapcheck
+			}
+		}
+
 		manifest.ID = ""
 		manifest.Source = dstSource
+		// link the copy to the history of the destination.
+		manifest.Chain = nil
 
 		if _, err := snapshot.SaveSnapshot(ctx, rep, manifest); err != nil {
 			return errors.Wrap(err, "unable to save snapshot")
@@ -85,13 +85,18 @@ func (c *commandSnapshotDelete) deleteSnapshot(ctx context.Context, rep repo.Rep
 	desc := fmt.Sprintf("snapshot %v of %v at %v", m.ID, m.Source, formatTimestamp(m.StartTime.ToTime()))
 
 	if !c.snapshotDeleteConfirm {
+		if err := snapshot.CheckNotOnHold(ctx, rep, m); err != nil {
+			return err //nolint:wrapcheck
+		}
+
 		log(ctx).Infof("Would delete %v (pass --delete to confirm)", desc)
+
 		return nil
 	}
 
 	log(ctx).Infof("Deleting %v...", desc)
 
-	return errors.Wrap(rep.DeleteManifest(ctx, m.ID), "error deleting manifest")
+	return errors.Wrap(snapshot.DeleteSnapshot(ctx, rep, m), "error deleting snapshot")
 }
 
 func (c *commandSnapshotDelete) deleteSnapshotsByRootObjectID(ctx context.Context, rep repo.RepositoryWriter, rootID string) error {
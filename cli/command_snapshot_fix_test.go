@@ -292,6 +292,10 @@ func TestSnapshotFix(t *testing.T) {
 
 			env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
 
+			keyFile := filepath.Join(testutil.TempDirectory(t), "signing.key")
+			env.RunAndExpectSuccess(t, "snapshot", "generate-signing-key", keyFile)
+			env.RunAndExpectSuccess(t, "repo", "set-client", "--snapshot-signing-key-file", keyFile)
+
 			var man1, man2 snapshot.Manifest
 
 			testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "create", srcDir1, "--json"), &man1)
@@ -326,6 +330,9 @@ func TestSnapshotFix(t *testing.T) {
 
 			env.RunAndExpectSuccess(t, append(append([]string{"snapshot", "fix"}, tc.flags...), "--commit")...)
 
+			// fixed snapshots remain in the chain.
+			env.RunAndExpectSuccess(t, "snapshot", "verify-chain")
+
 			if tc.wantFailVerify {
 				env.RunAndExpectFailure(t, "snapshot", "verify")
 				return
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/snapshot"
+)
+
+type commandSnapshotGenerateSigningKey struct {
+	file string
+
+	out textOutput
+}
+
+func (c *commandSnapshotGenerateSigningKey) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("generate-signing-key", "Generate a key for signing snapshots, use 'repository set-client --snapshot-signing-key-file' to enable it.")
+	cmd.Arg("file", "File to write the signing key to").Required().StringVar(&c.file)
+	cmd.Action(svc.noRepositoryAction(c.run))
+
+	c.out.setup(svc)
+}
+
+func (c *commandSnapshotGenerateSigningKey) run(ctx context.Context) error {
+	pub, err := snapshot.GenerateSigningKeyFile(c.file)
+	if err != nil {
+		return errors.Wrap(err, "unable to generate signing key")
+	}
+
+	log(ctx).Infof("Signing key with fingerprint %v written to %v.", snapshot.SigningKeyFingerprint(pub), c.file)
+	log(ctx).Info("Pass the following public key to 'kopia snapshot verify-chain --trusted-key' to verify snapshots signed with it:")
+
+	c.out.printStdout("%v\n", base64.StdEncoding.EncodeToString(pub))
+
+	return nil
+}
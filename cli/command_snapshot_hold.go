@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+)
+
+type commandSnapshotHold struct {
+	add    commandSnapshotHoldAdd
+	list   commandSnapshotHoldList
+	remove commandSnapshotHoldRemove
+}
+
+func (c *commandSnapshotHold) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("hold", "Commands to place snapshots on legal hold or extended retention.")
+
+	c.add.setup(svc, cmd)
+	c.list.setup(svc, cmd)
+	c.remove.setup(svc, cmd)
+}
+
+// loadHoldSnapshots loads snapshots identified by manifest ID or root object ID.
+func loadHoldSnapshots(ctx context.Context, rep repo.Repository, id string) ([]*snapshot.Manifest, error) {
+	m, err := snapshot.LoadSnapshot(ctx, rep, manifest.ID(id))
+	if err == nil {
+		return []*snapshot.Manifest{m}, nil
+	}
+
+	if !errors.Is(err, snapshot.ErrSnapshotNotFound) {
+		return nil, errors.Wrapf(err, "error loading snapshot %v", id)
+	}
+
+	rootOID, err := object.ParseID(id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%v is neither a snapshot ID nor a valid object ID", id)
+	}
+
+	manifests, err := snapshot.FindSnapshotsByRootObjectID(ctx, rep, rootOID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to find snapshots by root %v", id)
+	}
+
+	if len(manifests) == 0 {
+		return nil, errors.Errorf("no snapshots matched %v", id)
+	}
+
+	return manifests, nil
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/snapshot/snapshothold"
+)
+
+type commandSnapshotHoldAdd struct {
+	snapshotIDs   []string
+	legalHold     bool
+	retainUntil   string
+	retainFor     time.Duration
+	retentionMode string
+	reason        string
+	parallel      int
+}
+
+func (c *commandSnapshotHoldAdd) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("add", "Place snapshots on hold, protecting the blobs holding them from modification and deletion.")
+	cmd.Arg("id", "Snapshot ID or root object ID").Required().StringsVar(&c.snapshotIDs)
+	cmd.Flag("legal-hold", "Place a legal hold lasting until the hold is removed").BoolVar(&c.legalHold)
+	cmd.Flag("retain-until", "Extend retention until the provided date (YYYY-MM-DD or RFC3339)").StringVar(&c.retainUntil)
+	cmd.Flag("retain-for", "Extend retention for the provided duration").DurationVar(&c.retainFor)
+	cmd.Flag("retention-mode", "Retention mode (defaults to the retention mode of the repository)").EnumVar(&c.retentionMode, blob.Governance.String(), blob.Compliance.String())
+	cmd.Flag("reason", "Reason for placing the hold").StringVar(&c.reason)
+	cmd.Flag("parallel", "Number of blobs protected in parallel").Default("16").IntVar(&c.parallel)
+	cmd.Action(svc.directRepositoryWriteAction(c.run))
+}
+
+func (c *commandSnapshotHoldAdd) options(rep repo.DirectRepository) (snapshothold.Options, error) {
+	opt := snapshothold.Options{
+		LegalHold:     c.legalHold,
+		RetentionMode: blob.RetentionMode(c.retentionMode),
+		Reason:        c.reason,
+		Parallel:      c.parallel,
+	}
+
+	specified := 0
+
+	if c.legalHold {
+		specified++
+	}
+
+	if c.retainFor != 0 {
+		specified++
+
+		opt.RetainUntil = rep.Time().Add(c.retainFor)
+	}
+
+	if c.retainUntil != "" {
+		specified++
+
+		t, err := parseHoldTime(c.retainUntil)
+		if err != nil {
+			return opt, err
+		}
+
+		opt.RetainUntil = t
+	}
+
+	if specified != 1 {
+		return opt, errors.New("exactly one of --legal-hold, --retain-until or --retain-for must be specified")
+	}
+
+	return opt, nil
+}
+
+func parseHoldTime(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid time %q, expected YYYY-MM-DD or RFC3339", s)
+	}
+
+	return t, nil
+}
+
+func (c *commandSnapshotHoldAdd) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	opt, err := c.options(rep)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range c.snapshotIDs {
+		manifests, err := loadHoldSnapshots(ctx, rep, id)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range manifests {
+			log(ctx).Infof("Placing snapshot at %v of %v on hold...", formatTimestamp(m.StartTime.ToTime()), m.Source)
+
+			h, err := snapshothold.Add(ctx, rep, m, opt)
+			if err != nil {
+				if h != nil {
+					return errors.Wrapf(err, "hold %v has been recorded, but protecting its blobs failed, run the command again", h.ID)
+				}
+
+				return errors.Wrapf(err, "error placing %v on hold", m.ID)
+			}
+
+			log(ctx).Infof("Placed hold %v on %v blobs.", h.ID, len(h.Blobs))
+		}
+	}
+
+	return nil
+}
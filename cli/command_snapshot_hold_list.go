@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+type commandSnapshotHoldList struct {
+	out textOutput
+}
+
+func (c *commandSnapshotHoldList) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("list", "List snapshots on hold.").Alias("ls")
+	cmd.Action(svc.repositoryReaderAction(c.run))
+
+	c.out.setup(svc)
+}
+
+func (c *commandSnapshotHoldList) run(ctx context.Context, rep repo.Repository) error {
+	holds, err := snapshot.ListHolds(ctx, rep, nil)
+	if err != nil {
+		return errors.Wrap(err, "unable to list holds")
+	}
+
+	sort.Slice(holds, func(i, j int) bool {
+		if holds[i].Source.String() != holds[j].Source.String() {
+			return holds[i].Source.String() < holds[j].Source.String()
+		}
+
+		return holds[i].StartTime < holds[j].StartTime
+	})
+
+	for _, h := range holds {
+		kind := "legal hold"
+		if !h.LegalHold {
+			kind = "retained until " + formatTimestamp(h.RetainUntil)
+		}
+
+		reason := ""
+		if h.Reason != "" {
+			reason = " (" + h.Reason + ")"
+		}
+
+		c.out.printStdout("%v %v %v root:%v %v, %v blobs, by %v at %v%v\n",
+			h.ID,
+			h.Source,
+			formatTimestamp(h.StartTime.ToTime()),
+			h.RootObjectID,
+			kind,
+			len(h.Blobs),
+			h.CreatedBy,
+			formatTimestamp(h.CreateTime.ToTime()),
+			reason)
+	}
+
+	return nil
+}
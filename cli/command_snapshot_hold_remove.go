@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshothold"
+)
+
+type commandSnapshotHoldRemove struct {
+	snapshotIDs []string
+	parallel    int
+}
+
+func (c *commandSnapshotHoldRemove) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("remove", "Remove holds from snapshots, releasing legal holds. Extended retention remains in effect until it expires.").Alias("rm")
+	cmd.Arg("id", "Snapshot ID or root object ID").Required().StringsVar(&c.snapshotIDs)
+	cmd.Flag("parallel", "Number of blobs released in parallel").Default("16").IntVar(&c.parallel)
+	cmd.Action(svc.directRepositoryWriteAction(c.run))
+}
+
+func (c *commandSnapshotHoldRemove) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	for _, id := range c.snapshotIDs {
+		manifests, err := loadHoldSnapshots(ctx, rep, id)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range manifests {
+			holds, err := snapshot.FindHolds(ctx, rep, m)
+			if err != nil {
+				return errors.Wrap(err, "unable to find holds")
+			}
+
+			if len(holds) == 0 {
+				log(ctx).Infof("Snapshot at %v of %v is not on hold.", formatTimestamp(m.StartTime.ToTime()), m.Source)
+				continue
+			}
+
+			for _, h := range holds {
+				log(ctx).Infof("Removing hold %v from snapshot at %v of %v...", h.ID, formatTimestamp(m.StartTime.ToTime()), m.Source)
+
+				if err := snapshothold.Remove(ctx, rep, h, c.parallel); err != nil {
+					return errors.Wrapf(err, "error removing hold %v", h.ID)
+				}
+			}
+		}
+	}
+
+	return nil
+}
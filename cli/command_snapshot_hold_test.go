@@ -0,0 +1,46 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestSnapshotHold_UnsupportedStorage(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	srcdir := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(srcdir, "some-file"), []byte{1, 2, 3}, 0o600))
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", srcdir)
+
+	snapshots := mustListSnapshots(t, e)
+	require.Len(t, snapshots, 1)
+
+	id := string(snapshots[0].ID)
+
+	// exactly one kind of hold must be requested.
+	e.RunAndExpectFailure(t, "snapshot", "hold", "add", id)
+	e.RunAndExpectFailure(t, "snapshot", "hold", "add", id, "--legal-hold", "--retain-for=24h")
+	e.RunAndExpectFailure(t, "snapshot", "hold", "add", id, "--retain-until=not-a-date")
+
+	// filesystem storage does not support object locks, so no hold is recorded.
+	e.RunAndExpectFailure(t, "snapshot", "hold", "add", id, "--legal-hold")
+	e.RunAndExpectFailure(t, "snapshot", "hold", "add", id, "--retain-for=24h", "--retention-mode=GOVERNANCE")
+
+	require.Empty(t, e.RunAndExpectSuccess(t, "snapshot", "hold", "list"))
+
+	e.RunAndExpectSuccess(t, "snapshot", "hold", "remove", id)
+	e.RunAndExpectSuccess(t, "snapshot", "delete", id, "--delete")
+}
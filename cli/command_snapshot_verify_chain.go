@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+type commandSnapshotVerifyChain struct {
+	source           string
+	trustedKeys      []string
+	requireSignature bool
+	allowMissing     bool
+
+	out textOutput
+}
+
+func (c *commandSnapshotVerifyChain) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("verify-chain", "Verify that snapshot history has not been modified, reordered or deleted and report who signed each snapshot. Only snapshots created by clients with a signing key are chained. Deletion of the latest snapshots of a source can't be detected.")
+	cmd.Arg("source", "Source to verify (defaults to all sources)").StringVar(&c.source)
+	cmd.Flag("trusted-key", "Public key of a trusted signer (base64), as printed by 'snapshot generate-signing-key'. Without it, signer names are only claimed by the signing clients").StringsVar(&c.trustedKeys)
+	cmd.Flag("require-signature", "Fail if a snapshot is not signed by a trusted signer").BoolVar(&c.requireSignature)
+	cmd.Flag("allow-missing", "Do not fail when snapshots have been deleted, for example by retention policy").BoolVar(&c.allowMissing)
+	cmd.Action(svc.repositoryReaderAction(c.run))
+
+	c.out.setup(svc)
+}
+
+func (c *commandSnapshotVerifyChain) run(ctx context.Context, rep repo.Repository) error {
+	trusted := map[string]bool{}
+
+	for _, k := range c.trustedKeys {
+		b, err := base64.StdEncoding.DecodeString(k)
+		if err != nil {
+			return errors.Wrapf(err, "invalid trusted key %q", k)
+		}
+
+		trusted[string(b)] = true
+	}
+
+	sources, err := c.sources(ctx, rep)
+	if err != nil {
+		return err
+	}
+
+	var problems int
+
+	for _, si := range sources {
+		entries, err := snapshot.VerifyChain(ctx, rep, si)
+		if err != nil {
+			return errors.Wrapf(err, "unable to verify snapshots of %v", si)
+		}
+
+		c.out.printStdout("%v\n", si)
+
+		for _, e := range entries {
+			if e.Missing > 0 {
+				c.out.printStdout("  %v snapshot(s) deleted\n", e.Missing)
+			}
+
+			signer, signerOK := c.describeSigner(e, trusted)
+			ok := c.isValid(e) && signerOK
+
+			if !ok {
+				problems++
+			}
+
+			seq := "-"
+			if e.Manifest.Chain != nil {
+				seq = strconv.FormatInt(e.Manifest.Chain.Sequence, 10)
+			}
+
+			c.out.printStdout("  %v %v seq:%v %v %v\n",
+				formatTimestamp(e.Manifest.StartTime.ToTime()),
+				e.Manifest.ID,
+				seq,
+				e.Status,
+				signer)
+		}
+	}
+
+	if problems > 0 {
+		return errors.Errorf("found %v snapshot(s) failing verification", problems)
+	}
+
+	return nil
+}
+
+func (c *commandSnapshotVerifyChain) sources(ctx context.Context, rep repo.Repository) ([]snapshot.SourceInfo, error) {
+	if c.source == "" {
+		sources, err := snapshot.ListSources(ctx, rep)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to list sources")
+		}
+
+		return sources, nil
+	}
+
+	si, err := snapshot.ParseSourceInfo(c.source, rep.ClientOptions().Hostname, rep.ClientOptions().Username)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid source: '%s'", c.source)
+	}
+
+	return []snapshot.SourceInfo{si}, nil
+}
+
+func (c *commandSnapshotVerifyChain) isValid(e *snapshot.ChainEntry) bool {
+	switch e.Status {
+	case snapshot.ChainStatusOK, snapshot.ChainStatusNotChained:
+		return true
+	case snapshot.ChainStatusMissingPredecessor:
+		return c.allowMissing
+	default:
+		return false
+	}
+}
+
+// describeSigner returns the description of the signer of the snapshot and whether it satisfies the trust requirements.
+func (c *commandSnapshotVerifyChain) describeSigner(e *snapshot.ChainEntry, trusted map[string]bool) (string, bool) {
+	if !e.Signed() {
+		return "unsigned", !c.requireSignature
+	}
+
+	ch := e.Manifest.Chain
+	desc := "signed by " + ch.Signer + " (key " + snapshot.SigningKeyFingerprint(ch.SignerKey)
+
+	switch {
+	case trusted[string(ch.SignerKey)]:
+		return desc + ", trusted)", true
+	case len(trusted) > 0:
+		return desc + ", untrusted)", false
+	default:
+		// without trusted keys anyone can sign using any name.
+		return desc + ", unverified)", !c.requireSignature
+	}
+}
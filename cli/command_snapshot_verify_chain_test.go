@@ -0,0 +1,77 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestSnapshotVerifyChain(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	keyFile := filepath.Join(testutil.TempDirectory(t), "signing.key")
+	pub := strings.TrimSpace(e.RunAndExpectSuccess(t, "snapshot", "generate-signing-key", keyFile)[0])
+
+	otherKeyFile := filepath.Join(testutil.TempDirectory(t), "other.key")
+	otherPub := strings.TrimSpace(e.RunAndExpectSuccess(t, "snapshot", "generate-signing-key", otherKeyFile)[0])
+
+	// existing key files are never overwritten.
+	e.RunAndExpectFailure(t, "snapshot", "generate-signing-key", keyFile)
+
+	srcdir := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(srcdir, "some-file"), []byte{1, 2, 3}, 0o600))
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", srcdir)
+
+	// snapshots are not chained without a signing key.
+	lines := e.RunAndExpectSuccess(t, "snapshot", "verify-chain")
+	require.Contains(t, lines[len(lines)-1], " seq:- not-chained unsigned")
+	e.RunAndExpectFailure(t, "snapshot", "verify-chain", "--require-signature")
+
+	e.RunAndExpectFailure(t, "repo", "set-client", "--snapshot-signing-key-file", srcdir+"/some-file")
+	e.RunAndExpectSuccess(t, "repo", "set-client", "--snapshot-signing-key-file", keyFile)
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", srcdir)
+	e.RunAndExpectSuccess(t, "snapshot", "create", srcdir)
+	e.RunAndExpectSuccess(t, "snapshot", "create", srcdir)
+
+	lines = e.RunAndExpectSuccess(t, "snapshot", "verify-chain", srcdir, "--trusted-key", pub)
+	require.Len(t, lines, 5)
+	require.Contains(t, lines[1], " seq:1 ok signed by ")
+	require.Contains(t, lines[4], " seq:- not-chained unsigned")
+
+	for _, l := range lines[1:4] {
+		require.Contains(t, l, " ok signed by ")
+		require.Contains(t, l, ", trusted)")
+	}
+
+	e.RunAndExpectFailure(t, "snapshot", "verify-chain", srcdir, "--trusted-key", otherPub)
+
+	// deleting a snapshot from the middle of the chain is detected.
+	snapshots := mustListSnapshots(t, e)
+	require.Len(t, snapshots, 4)
+
+	e.RunAndExpectSuccess(t, "snapshot", "delete", string(snapshots[2].ID), "--delete")
+
+	lines, _ = e.RunAndExpectFailure(t, "snapshot", "verify-chain", srcdir)
+	require.Contains(t, lines, "  1 snapshot(s) deleted")
+
+	e.RunAndExpectSuccess(t, "snapshot", "verify-chain", srcdir, "--allow-missing")
+
+	// removing the key stops signing.
+	e.RunAndExpectSuccess(t, "repo", "set-client", "--snapshot-signing-key-file", "")
+	e.RunAndExpectSuccess(t, "snapshot", "create", srcdir)
+	e.RunAndExpectFailure(t, "snapshot", "verify-chain", srcdir, "--allow-missing", "--require-signature")
+}
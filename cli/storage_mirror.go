@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/alecthomas/kingpin/v2"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/mirror"
+)
+
+type storageMirrorFlags struct {
+	options mirror.Options
+
+	storageConfigFiles []string
+}
+
+func (c *storageMirrorFlags) Setup(_ StorageProviderServices, cmd *kingpin.CmdClause) {
+	cmd.Flag("storage-config-file", "Path to JSON file with storage connection info of a mirror (repeat for each mirror)").Required().ExistingFilesVar(&c.storageConfigFiles)
+	cmd.Flag("write-quorum", "Number of mirrors that must acknowledge each write (0 = all)").IntVar(&c.options.WriteQuorum)
+}
+
+func (c *storageMirrorFlags) Connect(ctx context.Context, isCreate bool, formatVersion int) (blob.Storage, error) {
+	_ = formatVersion
+
+	opt := c.options
+	opt.Storages = nil
+
+	for _, fname := range c.storageConfigFiles {
+		ci, err := readStorageConnectionInfo(fname)
+		if err != nil {
+			return nil, err
+		}
+
+		opt.Storages = append(opt.Storages, ci)
+	}
+
+	//nolint:wrapcheck
+	return mirror.New(ctx, &opt, isCreate)
+}
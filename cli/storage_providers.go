@@ -2,9 +2,12 @@
 
 import (
 	"context"
+	"encoding/json"
 	"io"
+	"os"
 
 	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/blob/throttling"
@@ -40,6 +43,23 @@ func commonThrottlingFlags(cmd *kingpin.CmdClause, limits *throttling.Limits) {
 	cmd.Flag("max-upload-speed", "Limit the upload speed.").PlaceHolder("BYTES_PER_SEC").FloatVar(&limits.UploadBytesPerSecond)
 }
 
+// readStorageConnectionInfo reads JSON-encoded blob.ConnectionInfo from the provided file,
+// used by providers that are composed of other storages.
+func readStorageConnectionInfo(fname string) (blob.ConnectionInfo, error) {
+	var ci blob.ConnectionInfo
+
+	data, err := os.ReadFile(fname) //nolint:gosec
+	if err != nil {
+		return ci, errors.Wrap(err, "unable to read storage config file")
+	}
+
+	if err := json.Unmarshal(data, &ci); err != nil {
+		return ci, errors.Wrapf(err, "invalid storage config file %v", fname)
+	}
+
+	return ci, nil
+}
+
 // AddStorageProvider adds a new StorageProvider at runtime after the App has
 // been initialized with the default providers. This is used in tests which
 // require custom storage providers to simulate various edge cases.
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"context"
+	"os"
+
+	"github.com/alecthomas/kingpin/v2"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/rest"
+)
+
+type storageRESTFlags struct {
+	options rest.Options
+}
+
+func (c *storageRESTFlags) Setup(svc StorageProviderServices, cmd *kingpin.CmdClause) {
+	cmd.Flag("url", "URL of REST blob server").Required().StringVar(&c.options.URL)
+	cmd.Flag("rest-username", "REST blob server username").Envar(svc.EnvName("KOPIA_REST_USERNAME")).StringVar(&c.options.Username)
+	cmd.Flag("rest-password", "REST blob server password").Envar(svc.EnvName("KOPIA_REST_PASSWORD")).StringVar(&c.options.Password)
+	cmd.Flag("server-cert-fingerprint", "SHA256 fingerprint of the server's TLS certificate").StringVar(&c.options.TrustedServerCertificateFingerprint)
+	cmd.Flag("list-page-size", "Maximum number of blobs returned by a single list request").Hidden().IntVar(&c.options.ListPageSize)
+
+	commonThrottlingFlags(cmd, &c.options.Limits)
+}
+
+func (c *storageRESTFlags) Connect(ctx context.Context, isCreate bool, formatVersion int) (blob.Storage, error) {
+	_ = formatVersion
+
+	ro := c.options
+
+	if ro.Username != "" && ro.Password == "" {
+		pass, err := askPass(os.Stdout, "Enter REST blob server password: ")
+		if err != nil {
+			return nil, err
+		}
+
+		ro.Password = pass
+	}
+
+	//nolint:wrapcheck
+	return rest.New(ctx, &ro, isCreate)
+}
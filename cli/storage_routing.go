@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"context"
+	"sort"
+
+	"github.com/alecthomas/kingpin/v2"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/routing"
+)
+
+type storageRoutingFlags struct {
+	defaultStorageConfigFile string
+	routeConfigFiles         map[string]string
+}
+
+func (c *storageRoutingFlags) Setup(_ StorageProviderServices, cmd *kingpin.CmdClause) {
+	cmd.Flag("default-storage-config-file", "Path to JSON file with connection info of the storage for blobs not matching any route").Required().ExistingFileVar(&c.defaultStorageConfigFile)
+	cmd.Flag("route", "Route blobs with the given prefix to the storage described in a JSON file (e.g. p=/path/to/packs.json)").PlaceHolder("PREFIX=FILE").StringMapVar(&c.routeConfigFiles)
+}
+
+func (c *storageRoutingFlags) Connect(ctx context.Context, isCreate bool, formatVersion int) (blob.Storage, error) {
+	_ = formatVersion
+
+	var opt routing.Options
+
+	def, err := readStorageConnectionInfo(c.defaultStorageConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	opt.Default = def
+
+	for prefix, fname := range c.routeConfigFiles {
+		ci, err := readStorageConnectionInfo(fname)
+		if err != nil {
+			return nil, err
+		}
+
+		opt.Routes = append(opt.Routes, routing.Route{Prefix: blob.ID(prefix), Storage: ci})
+	}
+
+	// make the stored configuration deterministic.
+	sort.Slice(opt.Routes, func(i, j int) bool {
+		return opt.Routes[i].Prefix < opt.Routes[j].Prefix
+	})
+
+	//nolint:wrapcheck
+	return routing.New(ctx, &opt, isCreate)
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/ospath"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/singlefile"
+)
+
+type storageSingleFileFlags struct {
+	options singlefile.Options
+}
+
+func (c *storageSingleFileFlags) Setup(_ StorageProviderServices, cmd *kingpin.CmdClause) {
+	cmd.Flag("path", "Path to the repository container file").Required().StringVar(&c.options.Path)
+	cmd.Flag("auto-compact-percent", "Compact the container file on close when this percentage of it is unused (-1 to disable)").Hidden().IntVar(&c.options.AutoCompactPercent)
+	cmd.Flag("auto-compact-wasted-bytes", "Also compact the container file while in use when this many bytes of it are unused (-1 to disable)").Hidden().Int64Var(&c.options.AutoCompactWastedBytes)
+
+	commonThrottlingFlags(cmd, &c.options.Limits)
+}
+
+func (c *storageSingleFileFlags) Connect(ctx context.Context, isCreate bool, formatVersion int) (blob.Storage, error) {
+	_ = formatVersion
+
+	opt := c.options
+
+	opt.Path = ospath.ResolveUserFriendlyPath(opt.Path, false)
+
+	if !ospath.IsAbs(opt.Path) {
+		return nil, errors.Errorf("container file path must be absolute")
+	}
+
+	//nolint:wrapcheck
+	return singlefile.New(ctx, &opt, isCreate)
+}
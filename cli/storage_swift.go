@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/swift"
+)
+
+type storageSwiftFlags struct {
+	options swift.Options
+}
+
+func (c *storageSwiftFlags) Setup(svc StorageProviderServices, cmd *kingpin.CmdClause) {
+	cmd.Flag("container", "Name of the Swift container").Required().StringVar(&c.options.Container)
+	cmd.Flag("prefix", "Prefix to use for objects in the container").StringVar(&c.options.Prefix)
+	cmd.Flag("auth-url", "Keystone v3 identity service URL (overrides OS_AUTH_URL environment variable)").Required().Envar(svc.EnvName("OS_AUTH_URL")).StringVar(&c.options.AuthURL)
+	cmd.Flag("username", "OpenStack user name (overrides OS_USERNAME environment variable)").Envar(svc.EnvName("OS_USERNAME")).StringVar(&c.options.Username)
+	cmd.Flag("swift-password", "OpenStack password (overrides OS_PASSWORD environment variable)").Envar(svc.EnvName("OS_PASSWORD")).StringVar(&c.options.Password)
+	cmd.Flag("user-domain", "Domain of the OpenStack user (overrides OS_USER_DOMAIN_NAME environment variable)").Envar(svc.EnvName("OS_USER_DOMAIN_NAME")).StringVar(&c.options.UserDomainName)
+	cmd.Flag("project", "OpenStack project name (overrides OS_PROJECT_NAME environment variable)").Envar(svc.EnvName("OS_PROJECT_NAME")).StringVar(&c.options.ProjectName)
+	cmd.Flag("project-domain", "Domain of the OpenStack project (overrides OS_PROJECT_DOMAIN_NAME environment variable)").Envar(svc.EnvName("OS_PROJECT_DOMAIN_NAME")).StringVar(&c.options.ProjectDomainName)
+	cmd.Flag("application-credential-id", "Application credential ID (overrides OS_APPLICATION_CREDENTIAL_ID environment variable)").Envar(svc.EnvName("OS_APPLICATION_CREDENTIAL_ID")).StringVar(&c.options.ApplicationCredentialID)
+	cmd.Flag("application-credential-secret", "Application credential secret (overrides OS_APPLICATION_CREDENTIAL_SECRET environment variable)").Envar(svc.EnvName("OS_APPLICATION_CREDENTIAL_SECRET")).StringVar(&c.options.ApplicationCredentialSecret)
+	cmd.Flag("region", "OpenStack region (overrides OS_REGION_NAME environment variable)").Envar(svc.EnvName("OS_REGION_NAME")).StringVar(&c.options.Region)
+	cmd.Flag("list-page-size", "Maximum number of objects returned by a single list request").Hidden().IntVar(&c.options.ListPageSize)
+
+	commonThrottlingFlags(cmd, &c.options.Limits)
+}
+
+func (c *storageSwiftFlags) Connect(ctx context.Context, isCreate bool, formatVersion int) (blob.Storage, error) {
+	_ = formatVersion
+
+	if c.options.Username == "" && c.options.ApplicationCredentialID == "" {
+		return nil, errors.New("either --username or --application-credential-id must be specified")
+	}
+
+	//nolint:wrapcheck
+	return swift.New(ctx, &c.options, isCreate)
+}
@@ -5,8 +5,8 @@
 
 	"github.com/alecthomas/kingpin/v2"
 
+	"github.com/kopia/kopia/internal/serverapi"
 	"github.com/kopia/kopia/internal/units"
-	"github.com/kopia/kopia/repo/blob/throttling"
 )
 
 type commonThrottleGet struct {
@@ -19,12 +19,14 @@ func (c *commonThrottleGet) setup(svc appServices, cmd *kingpin.CmdClause) {
 	c.jo.setup(svc, cmd)
 }
 
-func (c *commonThrottleGet) output(limits *throttling.Limits) error {
+func (c *commonThrottleGet) output(resp *serverapi.ThrottleLimitsResponse) error {
 	if c.jo.jsonOutput {
-		c.out.printStdout("%s\n", c.jo.jsonBytes(limits))
+		c.out.printStdout("%s\n", c.jo.jsonBytes(resp))
 		return nil
 	}
 
+	limits := &resp.Limits
+
 	c.printValueOrUnlimited("Max Download Speed:", limits.DownloadBytesPerSecond, units.BytesPerSecondsString)
 	c.printValueOrUnlimited("Max Upload Speed:", limits.UploadBytesPerSecond, units.BytesPerSecondsString)
 	c.printValueOrUnlimited("Max Read Requests Per Second:", limits.ReadsPerSecond, c.floatToString)
@@ -33,6 +35,22 @@ func (c *commonThrottleGet) output(limits *throttling.Limits) error {
 	c.printValueOrUnlimited("Max Concurrent Reads:", float64(limits.ConcurrentReads), c.floatToString)
 	c.printValueOrUnlimited("Max Concurrent Writes:", float64(limits.ConcurrentWrites), c.floatToString)
 
+	if len(limits.Schedule) == 0 {
+		return nil
+	}
+
+	c.out.printStdout("\nSchedule:\n")
+
+	for _, w := range limits.Schedule {
+		c.out.printStdout("  %v\n", w)
+	}
+
+	if w := resp.ActiveScheduleWindow; w != nil {
+		c.out.printStdout("%-30v %v\n", "Active Window:", w)
+	} else {
+		c.out.printStdout("%-30v (none)\n", "Active Window:")
+	}
+
 	return nil
 }
 
@@ -19,6 +19,8 @@ type commonThrottleSet struct {
 	setListsPerSecond         string
 	setConcurrentReads        string
 	setConcurrentWrites       string
+	setSchedule               []string
+	clearSchedule             bool
 }
 
 func (c *commonThrottleSet) setup(cmd *kingpin.CmdClause) {
@@ -29,6 +31,8 @@ func (c *commonThrottleSet) setup(cmd *kingpin.CmdClause) {
 	cmd.Flag("list-requests-per-second", "Set max lists per second").StringVar(&c.setListsPerSecond)
 	cmd.Flag("concurrent-reads", "Set max concurrent reads").StringVar(&c.setConcurrentReads)
 	cmd.Flag("concurrent-writes", "Set max concurrent writes").StringVar(&c.setConcurrentWrites)
+	cmd.Flag("schedule", "Replace schedule of upload/download limits with the provided windows, e.g. 'weekdays 09:00-17:00 upload=5000000 download=unlimited'").StringsVar(&c.setSchedule)
+	cmd.Flag("clear-schedule", "Remove schedule of upload/download limits").BoolVar(&c.clearSchedule)
 }
 
 func (c *commonThrottleSet) apply(ctx context.Context, limits *throttling.Limits, changeCount *int) error {
@@ -56,7 +60,51 @@ func (c *commonThrottleSet) apply(ctx context.Context, limits *throttling.Limits
 		return err
 	}
 
-	return c.setThrottleInt(ctx, "concurrent writes", &limits.ConcurrentWrites, c.setConcurrentWrites, changeCount)
+	if err := c.setThrottleInt(ctx, "concurrent writes", &limits.ConcurrentWrites, c.setConcurrentWrites, changeCount); err != nil {
+		return err
+	}
+
+	return c.applySchedule(ctx, limits, changeCount)
+}
+
+func (c *commonThrottleSet) applySchedule(ctx context.Context, limits *throttling.Limits, changeCount *int) error {
+	if c.clearSchedule {
+		if len(c.setSchedule) > 0 {
+			return errors.New("--schedule and --clear-schedule are mutually exclusive")
+		}
+
+		*changeCount++
+
+		log(ctx).Info("Removing throttling schedule.")
+
+		limits.Schedule = nil
+
+		return nil
+	}
+
+	if len(c.setSchedule) == 0 {
+		// not changed
+		return nil
+	}
+
+	var schedule []throttling.ScheduleWindow
+
+	for _, s := range c.setSchedule {
+		w, err := throttling.ParseScheduleWindow(s)
+		if err != nil {
+			return errors.Wrapf(err, "can't parse the schedule window %q", s)
+		}
+
+		log(ctx).Infof("Adding schedule window %v.", w)
+
+		schedule = append(schedule, w)
+	}
+
+	*changeCount++
+
+	limits.Schedule = schedule
+
+	return nil
 }
 
 func (c *commonThrottleSet) setThrottleFloat64(ctx context.Context, desc string, bps bool, val *float64, str string, changeCount *int) error {
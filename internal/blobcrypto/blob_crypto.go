@@ -81,3 +81,27 @@ func Decrypt(c Crypter, payload gather.Bytes, blobID blob.ID, output *gather.Wri
 
 	return nil
 }
+
+// Reencrypt decrypts the provided blob and encrypts it again using the current crypter key.
+// The blob ID is derived from the plaintext, so it does not change.
+func Reencrypt(c Crypter, payload gather.Bytes, blobID blob.ID, output *gather.WriteBuffer) error {
+	var decrypted gather.WriteBuffer
+	defer decrypted.Close()
+
+	if err := Decrypt(c, payload, blobID, &decrypted); err != nil {
+		return err
+	}
+
+	iv, err := getIndexBlobIV(blobID)
+	if err != nil {
+		return errors.Wrap(err, "unable to get index blob IV")
+	}
+
+	output.Reset()
+
+	if err := c.Encryptor().Encrypt(decrypted.Bytes(), iv, output); err != nil {
+		return errors.Wrapf(err, "error encrypting BLOB %v", blobID)
+	}
+
+	return nil
+}
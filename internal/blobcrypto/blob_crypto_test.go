@@ -100,3 +100,51 @@ func(output []byte, data gather.Bytes) []byte {
 	_, err = Encrypt(cr, gather.FromSlice([]byte{1, 2, 3}), "n", "mysessionid", &tmp)
 	require.Error(t, err)
 }
+
+// keyChangingEncryptor decrypts using the old key and encrypts using the new one.
+type keyChangingEncryptor struct {
+	oldKey, newKey encryption.Encryptor
+}
+
+func (e keyChangingEncryptor) Encrypt(input gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	return e.newKey.Encrypt(input, contentID, output)
+}
+
+func (e keyChangingEncryptor) Decrypt(input gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	return e.oldKey.Decrypt(input, contentID, output)
+}
+
+func (e keyChangingEncryptor) Overhead() int { return e.newKey.Overhead() }
+
+func TestBlobCrypto_Reencrypt(t *testing.T) {
+	f := &format.ContentFormat{
+		Hash:       hashing.DefaultAlgorithm,
+		Encryption: encryption.DefaultAlgorithm,
+		MasterKey:  []byte(strings.Repeat("a", 32)),
+	}
+	hf, err := hashing.CreateHashFunc(f)
+	require.NoError(t, err)
+	oldKey, err := encryption.CreateEncryptor(f)
+	require.NoError(t, err)
+
+	f.MasterKey = []byte(strings.Repeat("b", 32))
+	newKey, err := encryption.CreateEncryptor(f)
+	require.NoError(t, err)
+
+	var tmp, tmp2, tmp3 gather.WriteBuffer
+	defer tmp.Close()
+	defer tmp2.Close()
+	defer tmp3.Close()
+
+	id, err := Encrypt(StaticCrypter{hf, oldKey}, gather.FromSlice([]byte{1, 2, 3}), "n", "mysessionid", &tmp)
+	require.NoError(t, err)
+
+	require.NoError(t, Reencrypt(StaticCrypter{hf, keyChangingEncryptor{oldKey, newKey}}, tmp.Bytes(), id, &tmp2))
+
+	require.Error(t, Decrypt(StaticCrypter{hf, oldKey}, tmp2.Bytes(), id, &tmp3))
+	require.NoError(t, Decrypt(StaticCrypter{hf, newKey}, tmp2.Bytes(), id, &tmp3))
+	require.Equal(t, []byte{1, 2, 3}, tmp3.ToByteSlice())
+
+	// blobs which can't be decrypted are not re-encrypted.
+	require.Error(t, Reencrypt(StaticCrypter{hf, newKey}, tmp.Bytes(), id, &tmp2))
+}
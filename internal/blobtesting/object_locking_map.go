@@ -21,6 +21,7 @@ type entry struct {
 	mtime          time.Time
 	retentionTime  time.Time
 	retentionMode  blob.RetentionMode
+	legalHold      bool
 	isDeleteMarker bool
 }
 
@@ -67,6 +68,10 @@ func (s *objectLockingMap) getLatestForMutationLocked(id blob.ID) (*entry, error
 		return nil, errors.WithStack(ErrBlobLocked)
 	}
 
+	if e.legalHold {
+		return nil, errors.WithStack(ErrBlobLocked)
+	}
+
 	return e, nil
 }
 
@@ -139,6 +144,19 @@ func (s *objectLockingMap) GetRetention(ctx context.Context, id blob.ID) (blob.R
 	return e.retentionMode, e.retentionTime, nil
 }
 
+// GetLegalHold returns true if the latest version of the blob is under legal hold.
+func (s *objectLockingMap) GetLegalHold(ctx context.Context, id blob.ID) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	e, err := s.getLatestByID(id)
+	if err != nil {
+		return false, errors.Wrap(err, "getting blob")
+	}
+
+	return e.legalHold, nil
+}
+
 // PutBlob works the same as map-storage PutBlob except that if the latest
 // version is a delete-marker then it will return ErrBlobNotFound. The
 // PutOptions retention parameters will be respected when storing the object.
@@ -200,7 +218,7 @@ func (s *objectLockingMap) DeleteBlob(ctx context.Context, id blob.ID) error {
 	return nil
 }
 
-// ExtendBlobRetention will alter the retention time on a blob if it exists.
+// ExtendBlobRetention will alter the retention time or the legal hold on a blob if it exists.
 func (s *objectLockingMap) ExtendBlobRetention(ctx context.Context, id blob.ID, opts blob.ExtendOptions) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -210,6 +228,11 @@ func (s *objectLockingMap) ExtendBlobRetention(ctx context.Context, id blob.ID,
 		return blob.ErrBlobNotFound
 	}
 
+	if opts.LegalHold != "" {
+		e.legalHold = opts.LegalHold == blob.LegalHoldOn
+		return nil
+	}
+
 	// Update the retention time from now to the given retention period in the
 	// future. Note that we do not bump the existing time on the element `e.mtime`
 	// by the given delta because we'd like to align with the S3 storage's current
@@ -14,4 +14,5 @@ type RetentionStorage interface {
 	blob.Storage
 	TouchBlob(ctx context.Context, id blob.ID, threshold time.Duration) (time.Time, error)
 	GetRetention(ctx context.Context, id blob.ID) (blob.RetentionMode, time.Time, error)
+	GetLegalHold(ctx context.Context, id blob.ID) (bool, error)
 }
@@ -0,0 +1,103 @@
+package crypto
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// Argon2idAlgorithmPrefix is the prefix of Argon2id algorithm names, which are followed
+	// by the memory size in KiB, the number of iterations and the degree of parallelism,
+	// for example "argon2id-65536-3-4".
+	Argon2idAlgorithmPrefix = "argon2id-"
+
+	// Argon2idAlgorithm is the registration name for the default Argon2id parameters,
+	// which use 64 MiB of memory, 3 iterations and 4 threads.
+	Argon2idAlgorithm = Argon2idAlgorithmPrefix + "65536-3-4"
+
+	// The recommended minimum size for a salt to be used for Argon2 is 16 bytes.
+	// See: https://www.rfc-editor.org/rfc/rfc9106.html#section-3.1
+	argon2idMinSaltLength = 16 // 128 bits
+
+	// upper bound of memory parameter, to prevent malformed format blobs from exhausting memory.
+	argon2idMaxMemoryKiB = 4 << 20 // 4 GiB
+)
+
+func init() {
+	registerPBKeyDeriver(Argon2idAlgorithm, &argon2idKeyDeriver{
+		memoryKiB:     65536, //nolint:mnd
+		iterations:    3,     //nolint:mnd
+		parallelism:   4,     //nolint:mnd
+		minSaltLength: argon2idMinSaltLength,
+	})
+
+	registerParametricPBKeyDeriver(Argon2idAlgorithmPrefix, newArgon2idKeyDeriver)
+}
+
+type argon2idKeyDeriver struct {
+	// memoryKiB is the amount of memory used by the algorithm, in KiB.
+	memoryKiB uint32
+	// iterations is the number of passes over the memory.
+	iterations uint32
+	// parallelism is the number of threads used by the algorithm.
+	parallelism uint8
+
+	minSaltLength int
+}
+
+// newArgon2idKeyDeriver parses Argon2id parameters in the form "<memoryKiB>-<iterations>-<parallelism>".
+func newArgon2idKeyDeriver(params string) (passwordBasedKeyDeriver, error) {
+	parts := strings.Split(params, "-")
+	if len(parts) != 3 { //nolint:mnd
+		return nil, errors.Errorf("expected <memoryKiB>-<iterations>-<parallelism>")
+	}
+
+	var v [3]uint64
+
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil || strconv.FormatUint(n, 10) != p {
+			return nil, errors.Errorf("invalid parameter %q", p)
+		}
+
+		v[i] = n
+	}
+
+	memoryKiB, iterations, parallelism := v[0], v[1], v[2]
+
+	switch {
+	case iterations < 1:
+		return nil, errors.Errorf("number of iterations must be at least 1")
+	case parallelism < 1 || parallelism > math.MaxUint8:
+		return nil, errors.Errorf("parallelism must be between 1 and %v", math.MaxUint8)
+	case memoryKiB < 8*parallelism:
+		return nil, errors.Errorf("memory must be at least 8 KiB per thread")
+	case memoryKiB > argon2idMaxMemoryKiB:
+		return nil, errors.Errorf("memory must not exceed %v KiB", argon2idMaxMemoryKiB)
+	}
+
+	return &argon2idKeyDeriver{
+		memoryKiB:     uint32(memoryKiB),
+		iterations:    uint32(iterations),
+		parallelism:   uint8(parallelism),
+		minSaltLength: argon2idMinSaltLength,
+	}, nil
+}
+
+func (s *argon2idKeyDeriver) deriveKeyFromPassword(password string, salt []byte, keySize int) ([]byte, error) {
+	if len(salt) < s.minSaltLength {
+		return nil, errors.Errorf("required salt size is at least %d bytes", s.minSaltLength)
+	}
+
+	return argon2.IDKey([]byte(password), salt, s.iterations, s.memoryKiB, s.parallelism, uint32(keySize)), nil //nolint:gosec
+}
+
+// Argon2idAlgorithmName returns the name of the Argon2id algorithm with the provided parameters.
+func Argon2idAlgorithmName(memoryKiB, iterations, parallelism int) string {
+	return fmt.Sprintf("%v%v-%v-%v", Argon2idAlgorithmPrefix, memoryKiB, iterations, parallelism)
+}
@@ -2,6 +2,7 @@
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -14,6 +15,11 @@ type passwordBasedKeyDeriver interface {
 //nolint:gochecknoglobals
 var keyDerivers = map[string]passwordBasedKeyDeriver{}
 
+// parametricKeyDerivers creates key derivers whose parameters are encoded in the algorithm name after the prefix.
+//
+//nolint:gochecknoglobals
+var parametricKeyDerivers = map[string]func(params string) (passwordBasedKeyDeriver, error){}
+
 // registerPBKeyDeriver registers a password-based key deriver.
 func registerPBKeyDeriver(name string, keyDeriver passwordBasedKeyDeriver) {
 	if _, ok := keyDerivers[name]; ok {
@@ -23,11 +29,48 @@ func registerPBKeyDeriver(name string, keyDeriver passwordBasedKeyDeriver) {
 	keyDerivers[name] = keyDeriver
 }
 
+// registerParametricPBKeyDeriver registers a function creating password-based key derivers
+// for algorithm names starting with the provided prefix.
+func registerParametricPBKeyDeriver(prefix string, newKeyDeriver func(params string) (passwordBasedKeyDeriver, error)) {
+	if _, ok := parametricKeyDerivers[prefix]; ok {
+		panic(fmt.Sprintf("key deriver prefix (%s) is already registered", prefix))
+	}
+
+	parametricKeyDerivers[prefix] = newKeyDeriver
+}
+
+func getPBKeyDeriver(algorithm string) (passwordBasedKeyDeriver, error) {
+	if kd, ok := keyDerivers[algorithm]; ok {
+		return kd, nil
+	}
+
+	for prefix, newKeyDeriver := range parametricKeyDerivers {
+		if params, ok := strings.CutPrefix(algorithm, prefix); ok {
+			kd, err := newKeyDeriver(params)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid key derivation algorithm %v", algorithm)
+			}
+
+			return kd, nil
+		}
+	}
+
+	return nil, errors.Errorf("unsupported key derivation algorithm: %v, supported algorithms %v", algorithm, supportedPBKeyDerivationAlgorithms())
+}
+
+// ValidatePBKeyDerivationAlgorithm returns an error if the provided password-based key derivation algorithm
+// or its parameters are not supported.
+func ValidatePBKeyDerivationAlgorithm(algorithm string) error {
+	_, err := getPBKeyDeriver(algorithm)
+
+	return err
+}
+
 // DeriveKeyFromPassword derives encryption key using the provided password and per-repository unique ID.
 func DeriveKeyFromPassword(password string, salt []byte, keySize int, algorithm string) ([]byte, error) {
-	kd, ok := keyDerivers[algorithm]
-	if !ok {
-		return nil, errors.Errorf("unsupported key derivation algorithm: %v, supported algorithms %v", algorithm, supportedPBKeyDerivationAlgorithms())
+	kd, err := getPBKeyDeriver(algorithm)
+	if err != nil {
+		return nil, err
 	}
 
 	//nolint:wrapcheck
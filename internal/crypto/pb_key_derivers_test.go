@@ -0,0 +1,47 @@
+package crypto_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/crypto"
+)
+
+func TestDeriveKeyFromPasswordArgon2id(t *testing.T) {
+	k1, err := crypto.DeriveKeyFromPassword("password", TestSalt, 32, "argon2id-1024-1-1")
+	require.NoError(t, err)
+	require.Len(t, k1, 32)
+
+	k2, err := crypto.DeriveKeyFromPassword("password", TestSalt, 32, crypto.Argon2idAlgorithmName(1024, 1, 1))
+	require.NoError(t, err)
+	require.Equal(t, k1, k2)
+
+	// parameters affect the derived key.
+	k3, err := crypto.DeriveKeyFromPassword("password", TestSalt, 32, "argon2id-1024-2-1")
+	require.NoError(t, err)
+	require.NotEqual(t, k1, k3)
+
+	_, err = crypto.DeriveKeyFromPassword("password", []byte("short"), 32, "argon2id-1024-1-1")
+	require.ErrorContains(t, err, "salt")
+
+	require.NoError(t, crypto.ValidatePBKeyDerivationAlgorithm(crypto.Argon2idAlgorithm))
+
+	for _, invalid := range []string{
+		"argon2id-",
+		"argon2id-1024",
+		"argon2id-1024-1",
+		"argon2id-1024-1-1-1",
+		"argon2id-1024-0-1",
+		"argon2id-1024-1-0",
+		"argon2id-1024-1-256",
+		"argon2id-8-1-2",
+		"argon2id-99999999-1-1",
+		"argon2id-01024-1-1",
+		"argon2id--1024-1-1",
+		"argon2id-x-1-1",
+		"argon2-1024-1-1",
+	} {
+		require.Error(t, crypto.ValidatePBKeyDerivationAlgorithm(invalid), invalid)
+	}
+}
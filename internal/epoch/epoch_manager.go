@@ -367,7 +367,8 @@ func (e *Manager) cleanupWatermarks(ctx context.Context, cs CurrentSnapshot, p *
 }
 
 // CleanupSupersededIndexes cleans up the indexes which have been superseded by compacted ones.
-func (e *Manager) CleanupSupersededIndexes(ctx context.Context) error {
+// Blobs for which the optional isRetained function returns true are left in place.
+func (e *Manager) CleanupSupersededIndexes(ctx context.Context, isRetained func(id blob.ID) bool) error {
 	cs, err := e.committedState(ctx, 0)
 	if err != nil {
 		return err
@@ -404,6 +405,10 @@ func (e *Manager) CleanupSupersededIndexes(ctx context.Context) error {
 	var toDelete []blob.ID
 
 	for _, bm := range blobs {
+		if isRetained != nil && isRetained(bm.BlobID) {
+			continue
+		}
+
 		if epoch, ok := epochNumberFromBlobID(bm.BlobID); ok {
 			if blobSetWrittenEarlyEnough(cs.SingleEpochCompactionSets[epoch], maxReplacementTime) {
 				toDelete = append(toDelete, bm.BlobID)
@@ -266,7 +266,7 @@ func TestIndexEpochManager_RogueBlobs(t *testing.T) {
 	te.data[DeletionWatermarkBlobPrefix+"zzzz"] = []byte{1}
 
 	verifySequentialWrites(t, te)
-	te.mgr.CleanupSupersededIndexes(testlogging.Context(t))
+	te.mgr.CleanupSupersededIndexes(testlogging.Context(t), nil)
 }
 
 func TestIndexEpochManager_CompactionSilentlyDoesNothing(t *testing.T) {
@@ -806,7 +806,7 @@ func TestInvalid_Cleanup(t *testing.T) {
 	ctx, cancel := context.WithCancel(testlogging.Context(t))
 	cancel()
 
-	err := te.mgr.CleanupSupersededIndexes(ctx)
+	err := te.mgr.CleanupSupersededIndexes(ctx, nil)
 	require.ErrorIs(t, err, ctx.Err())
 }
 
@@ -838,7 +838,7 @@ func verifySequentialWrites(t *testing.T, te *epochManagerTestEnv) {
 
 		if indexNum%27 == 0 {
 			// do not require.NoError because we'll be sometimes inducing faults
-			te.mgr.CleanupSupersededIndexes(ctx)
+			te.mgr.CleanupSupersededIndexes(ctx, nil)
 		}
 
 		if indexNum%13 == 0 {
@@ -1022,6 +1022,49 @@ func TestMaybeCompactSingleEpoch(t *testing.T) {
 	require.Len(t, cs.SingleEpochCompactionSets, newestEpochToCompact)
 }
 
+func TestCleanupSupersededIndexes_Retained(t *testing.T) {
+	t.Parallel()
+
+	te := newTestEnv(t)
+	ctx := testlogging.Context(t)
+
+	for i := range 3 {
+		te.mustWriteIndexFiles(ctx, t, newFakeIndexWithEntries(i))
+	}
+
+	uncompacted, err := blob.ListAllBlobs(ctx, te.st, UncompactedIndexBlobPrefix+"0_")
+	require.NoError(t, err)
+	require.Len(t, uncompacted, 3)
+
+	for range numUnsettledEpochs + 1 {
+		require.NoError(t, te.mgr.forceAdvanceEpoch(ctx))
+	}
+
+	require.NoError(t, te.mgr.MaybeCompactSingleEpoch(ctx))
+
+	// write another index after the safety margin, which establishes the storage clock.
+	te.ft.Advance(49 * time.Hour)
+	te.mustWriteIndexFiles(ctx, t, newFakeIndexWithEntries(100))
+	require.NoError(t, te.mgr.Refresh(ctx))
+
+	retained := uncompacted[0].BlobID
+
+	require.NoError(t, te.mgr.CleanupSupersededIndexes(ctx, func(id blob.ID) bool {
+		return id == retained
+	}))
+
+	remaining, err := blob.ListAllBlobs(ctx, te.st, UncompactedIndexBlobPrefix+"0_")
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	require.Equal(t, retained, remaining[0].BlobID)
+
+	require.NoError(t, te.mgr.CleanupSupersededIndexes(ctx, nil))
+
+	remaining, err = blob.ListAllBlobs(ctx, te.st, UncompactedIndexBlobPrefix+"0_")
+	require.NoError(t, err)
+	require.Empty(t, remaining)
+}
+
 func TestMaybeGenerateRangeCheckpoint_Empty(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,754 @@
+// Package listjournal implements a blob.Storage wrapper that maintains a persistent journal
+// of blob writes and deletions in the repository itself, so that listings of journaled prefixes
+// can be reconstructed incrementally without listing the underlying storage.
+//
+// Each writer appends small segment blobs describing blobs it has written or deleted.
+// Readers start from the most recent checkpoint (a full listing) and apply segments written since.
+// Checkpoints are produced by Reconcile(), which lists the underlying storage, reports any drift
+// between the journal and reality and discards segments covered by the new checkpoint.
+package listjournal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/hmac"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.Module("listjournal")
+
+const (
+	// MarkerBlobID is the ID of the blob whose presence enables the journal for all repository clients.
+	MarkerBlobID blob.ID = "_ljm"
+
+	// SegmentPrefix is the prefix of blobs containing journal entries.
+	SegmentPrefix blob.ID = "_ljs_"
+
+	// CheckpointPrefix is the prefix of blobs containing full listings of journaled blobs.
+	CheckpointPrefix blob.ID = "_ljc_"
+
+	// maximum number of entries buffered in memory before they are written out as a segment.
+	maxPendingEntries = 1000
+
+	// maximum age of buffered entries before they are written out as a segment.
+	maxPendingAge = time.Minute
+
+	// segments written up to this long before a checkpoint are still applied on top of it
+	// and are not deleted, to account for clock skew and writes in progress during reconciliation.
+	clockSkewMargin = time.Hour
+
+	localStateBlobID blob.ID = "state"
+
+	// listings are not refreshed more often than this unless this writer has written a segment.
+	minRefreshInterval = 5 * time.Second
+
+	randomSuffixBytes = 4
+)
+
+type entry struct {
+	BlobID    blob.ID   `json:"id"`
+	Deleted   bool      `json:"del,omitempty"`
+	Length    int64     `json:"len,omitempty"`
+	Timestamp time.Time `json:"ts"`
+}
+
+type segment struct {
+	Entries []entry `json:"entries"`
+}
+
+type checkpoint struct {
+	CreatedAt time.Time       `json:"createdAt"`
+	Blobs     []blob.Metadata `json:"blobs"`
+}
+
+// listing is the set of journaled blobs reconstructed from a checkpoint and segments applied on top of it.
+type listing struct {
+	Checkpoint blob.ID                   `json:"checkpoint"`
+	Applied    map[blob.ID]bool          `json:"applied"`
+	Blobs      map[blob.ID]blob.Metadata `json:"blobs"`
+	Tombstones map[blob.ID]time.Time     `json:"tombstones,omitempty"`
+}
+
+func newListing(checkpointID blob.ID, blobs []blob.Metadata) *listing {
+	l := &listing{
+		Checkpoint: checkpointID,
+		Applied:    map[blob.ID]bool{},
+		Blobs:      map[blob.ID]blob.Metadata{},
+		Tombstones: map[blob.ID]time.Time{},
+	}
+
+	for _, bm := range blobs {
+		l.Blobs[bm.BlobID] = bm
+	}
+
+	return l
+}
+
+// apply applies the journal entry using timestamps, so that the order in which segments
+// from different writers are applied does not matter.
+func (l *listing) apply(e entry) {
+	if e.Deleted {
+		if existing, ok := l.Blobs[e.BlobID]; ok && existing.Timestamp.After(e.Timestamp) {
+			return
+		}
+
+		delete(l.Blobs, e.BlobID)
+
+		if e.Timestamp.After(l.Tombstones[e.BlobID]) {
+			l.Tombstones[e.BlobID] = e.Timestamp
+		}
+
+		return
+	}
+
+	if deletedAt, ok := l.Tombstones[e.BlobID]; ok && !e.Timestamp.After(deletedAt) {
+		return
+	}
+
+	l.Blobs[e.BlobID] = blob.Metadata{BlobID: e.BlobID, Length: e.Length, Timestamp: e.Timestamp}
+}
+
+// ReconcileStats describes the result of reconciling the journal with the underlying storage.
+type ReconcileStats struct {
+	Blobs           int `json:"blobs"`
+	Missing         int `json:"missing"`
+	Extra           int `json:"extra"`
+	DeletedSegments int `json:"deletedSegments"`
+}
+
+// Reconciler is implemented by storage that maintains a blob listing journal.
+type Reconciler interface {
+	ReconcileJournal(ctx context.Context) (ReconcileStats, error)
+}
+
+type journalStorage struct {
+	blob.Storage
+
+	cacheStorage blob.Storage
+	hmacSecret   []byte
+	prefixes     []blob.ID
+	timeNow      func() time.Time
+
+	pendingMu sync.Mutex
+	// +checklocks:pendingMu
+	pending []entry
+	// +checklocks:pendingMu
+	pendingSince time.Time
+
+	// mu serializes refreshes and reconciliations.
+	mu sync.Mutex
+	// +checklocks:mu
+	current *listing
+	// +checklocks:mu
+	nextRefresh time.Time
+}
+
+// ListBlobs implements blob.Storage and returns journaled blobs without listing the underlying storage when possible.
+func (s *journalStorage) ListBlobs(ctx context.Context, prefix blob.ID, cb func(blob.Metadata) error) error {
+	if !s.isJournaledPrefix(prefix) {
+		//nolint:wrapcheck
+		return s.Storage.ListBlobs(ctx, prefix, cb)
+	}
+
+	if err := s.flush(ctx); err != nil {
+		log(ctx).Warnf("unable to write blob list journal: %v", err)
+	}
+
+	matching, err := s.journaledBlobs(ctx, prefix)
+	if err != nil {
+		log(ctx).Warnf("unable to use blob list journal for %v, listing storage: %v", prefix, err)
+
+		//nolint:wrapcheck
+		return s.Storage.ListBlobs(ctx, prefix, cb)
+	}
+
+	if matching == nil {
+		// no checkpoint yet, journal can't be used until reconciled.
+		//nolint:wrapcheck
+		return s.Storage.ListBlobs(ctx, prefix, cb)
+	}
+
+	for _, bm := range matching {
+		if err := cb(bm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *journalStorage) journaledBlobs(ctx context.Context, prefix blob.ID) ([]blob.Metadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(ctx); err != nil {
+		return nil, err
+	}
+
+	if s.current == nil {
+		return nil, nil
+	}
+
+	result := []blob.Metadata{}
+
+	for id, bm := range s.current.Blobs {
+		if strings.HasPrefix(string(id), string(prefix)) {
+			result = append(result, bm)
+		}
+	}
+
+	return result, nil
+}
+
+// PutBlob implements blob.Storage and records successful writes of journaled blobs.
+func (s *journalStorage) PutBlob(ctx context.Context, blobID blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	if !s.isJournaledPrefix(blobID) {
+		// make sure journaled blobs are visible to others before other blobs (such as indexes) referencing them.
+		if err := s.flush(ctx); err != nil {
+			log(ctx).Warnf("unable to write blob list journal: %v", err)
+		}
+
+		//nolint:wrapcheck
+		return s.Storage.PutBlob(ctx, blobID, data, opts)
+	}
+
+	var modTime time.Time
+
+	if opts.GetModTime == nil {
+		opts.GetModTime = &modTime
+	}
+
+	if err := s.Storage.PutBlob(ctx, blobID, data, opts); err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	ts := *opts.GetModTime
+	if ts.IsZero() {
+		ts = s.timeNow()
+	}
+
+	s.append(ctx, entry{BlobID: blobID, Length: int64(data.Length()), Timestamp: ts})
+
+	return nil
+}
+
+// DeleteBlob implements blob.Storage and records successful deletions of journaled blobs.
+func (s *journalStorage) DeleteBlob(ctx context.Context, blobID blob.ID) error {
+	if err := s.Storage.DeleteBlob(ctx, blobID); err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	if s.isJournaledPrefix(blobID) {
+		s.append(ctx, entry{BlobID: blobID, Deleted: true, Timestamp: s.timeNow()})
+	}
+
+	return nil
+}
+
+// FlushCaches implements blob.Storage and writes out buffered journal entries.
+func (s *journalStorage) FlushCaches(ctx context.Context) error {
+	if err := s.flush(ctx); err != nil {
+		return err
+	}
+
+	return errors.Wrap(s.Storage.FlushCaches(ctx), "error flushing caches")
+}
+
+// Close implements blob.Storage and writes out buffered journal entries.
+func (s *journalStorage) Close(ctx context.Context) error {
+	if err := s.flush(ctx); err != nil {
+		log(ctx).Warnf("unable to write blob list journal: %v", err)
+	}
+
+	//nolint:wrapcheck
+	return s.Storage.Close(ctx)
+}
+
+func (s *journalStorage) isJournaledPrefix(id blob.ID) bool {
+	for _, p := range s.prefixes {
+		if strings.HasPrefix(string(id), string(p)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *journalStorage) append(ctx context.Context, e entry) {
+	s.pendingMu.Lock()
+
+	if len(s.pending) == 0 {
+		s.pendingSince = s.timeNow()
+	}
+
+	s.pending = append(s.pending, e)
+	shouldFlush := len(s.pending) >= maxPendingEntries || s.timeNow().Sub(s.pendingSince) >= maxPendingAge
+
+	s.pendingMu.Unlock()
+
+	if shouldFlush {
+		if err := s.flush(ctx); err != nil {
+			log(ctx).Warnf("unable to write blob list journal: %v", err)
+		}
+	}
+}
+
+// flush writes buffered entries as a new segment, on failure the entries are kept and retried later.
+func (s *journalStorage) flush(ctx context.Context) error {
+	s.pendingMu.Lock()
+	entries := s.pending
+	since := s.pendingSince
+	s.pending = nil
+	s.pendingMu.Unlock()
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := s.writeSegment(ctx, entries); err != nil {
+		s.pendingMu.Lock()
+		s.pending = append(entries, s.pending...)
+		s.pendingSince = since
+		s.pendingMu.Unlock()
+
+		return err
+	}
+
+	// make sure own writes are visible in the next listing.
+	s.mu.Lock()
+	s.nextRefresh = time.Time{}
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *journalStorage) writeSegment(ctx context.Context, entries []entry) error {
+	var suffix [randomSuffixBytes]byte
+
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return errors.Wrap(err, "unable to generate segment ID")
+	}
+
+	id := SegmentPrefix + blob.ID(timePrefix(s.timeNow())+"_"+hex.EncodeToString(suffix[:]))
+
+	return s.putJSON(ctx, id, &segment{Entries: entries})
+}
+
+// ReconcileJournal lists the underlying storage, reports differences between the journal and actual
+// blobs, writes a new checkpoint and deletes journal blobs covered by it.
+func (s *journalStorage) ReconcileJournal(ctx context.Context) (ReconcileStats, error) {
+	var stats ReconcileStats
+
+	if err := s.flush(ctx); err != nil {
+		return stats, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timeNow()
+
+	if err := s.refreshLocked(ctx); err != nil {
+		log(ctx).Warnf("unable to load blob list journal, rebuilding: %v", err)
+
+		s.current = nil
+	}
+
+	var actual []blob.Metadata
+
+	for _, p := range s.prefixes {
+		bms, err := blob.ListAllBlobs(ctx, s.Storage, p)
+		if err != nil {
+			return stats, errors.Wrapf(err, "error listing %v", p)
+		}
+
+		actual = append(actual, bms...)
+	}
+
+	stats.Blobs = len(actual)
+
+	if s.current != nil {
+		actualIDs := map[blob.ID]bool{}
+
+		for _, bm := range actual {
+			actualIDs[bm.BlobID] = true
+
+			if _, ok := s.current.Blobs[bm.BlobID]; !ok {
+				stats.Missing++
+			}
+		}
+
+		for id := range s.current.Blobs {
+			if !actualIDs[id] {
+				stats.Extra++
+			}
+		}
+
+		if stats.Missing > 0 || stats.Extra > 0 {
+			log(ctx).Infof("Blob list journal drifted from storage: %v blobs missing, %v extra.", stats.Missing, stats.Extra)
+		}
+	}
+
+	sort.Slice(actual, func(i, j int) bool {
+		return actual[i].BlobID < actual[j].BlobID
+	})
+
+	checkpointID := CheckpointPrefix + blob.ID(timePrefix(now))
+
+	if err := s.putJSON(ctx, checkpointID, &checkpoint{CreatedAt: now, Blobs: actual}); err != nil {
+		return stats, errors.Wrap(err, "error writing checkpoint")
+	}
+
+	s.current = newListing(checkpointID, actual)
+
+	deleted, err := s.deleteObsolete(ctx, checkpointID, now.Add(-clockSkewMargin))
+	stats.DeletedSegments = deleted
+
+	s.saveLocalLocked(ctx)
+
+	return stats, err
+}
+
+func (s *journalStorage) deleteObsolete(ctx context.Context, checkpointID blob.ID, cutoff time.Time) (int, error) {
+	var toDelete []blob.ID
+
+	deletedSegments := 0
+
+	if err := s.Storage.ListBlobs(ctx, SegmentPrefix, func(bm blob.Metadata) error {
+		if t, ok := timeFromID(bm.BlobID, SegmentPrefix); ok && t.Before(cutoff) {
+			toDelete = append(toDelete, bm.BlobID)
+			deletedSegments++
+		}
+
+		return nil
+	}); err != nil {
+		return 0, errors.Wrap(err, "error listing segments")
+	}
+
+	if err := s.Storage.ListBlobs(ctx, CheckpointPrefix, func(bm blob.Metadata) error {
+		if t, ok := timeFromID(bm.BlobID, CheckpointPrefix); ok && t.Before(cutoff) && bm.BlobID != checkpointID {
+			toDelete = append(toDelete, bm.BlobID)
+		}
+
+		return nil
+	}); err != nil {
+		return 0, errors.Wrap(err, "error listing checkpoints")
+	}
+
+	for _, id := range toDelete {
+		if err := s.Storage.DeleteBlob(ctx, id); err != nil {
+			return 0, errors.Wrapf(err, "error deleting %v", id)
+		}
+	}
+
+	return deletedSegments, nil
+}
+
+// refreshLocked brings the current listing up to date with the latest checkpoint and segments.
+//
+// +checklocks:s.mu
+func (s *journalStorage) refreshLocked(ctx context.Context) error {
+	now := s.timeNow()
+	if now.Before(s.nextRefresh) {
+		return nil
+	}
+
+	checkpoints, err := blob.ListAllBlobs(ctx, s.Storage, CheckpointPrefix)
+	if err != nil {
+		return errors.Wrap(err, "error listing checkpoints")
+	}
+
+	var latest blob.ID
+
+	for _, bm := range checkpoints {
+		if bm.BlobID > latest {
+			latest = bm.BlobID
+		}
+	}
+
+	if latest == "" {
+		s.current = nil
+		return nil
+	}
+
+	if s.current == nil {
+		s.current = s.loadLocal(ctx)
+	}
+
+	if s.current == nil || s.current.Checkpoint != latest {
+		var cp checkpoint
+
+		if err := s.getJSON(ctx, latest, &cp); err != nil {
+			return errors.Wrapf(err, "error reading checkpoint %v", latest)
+		}
+
+		s.current = newListing(latest, cp.Blobs)
+	}
+
+	checkpointTime, _ := timeFromID(latest, CheckpointPrefix)
+
+	segments, err := blob.ListAllBlobs(ctx, s.Storage, SegmentPrefix)
+	if err != nil {
+		return errors.Wrap(err, "error listing segments")
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].BlobID < segments[j].BlobID
+	})
+
+	changed := false
+	present := map[blob.ID]bool{}
+
+	for _, bm := range segments {
+		present[bm.BlobID] = true
+
+		if s.current.Applied[bm.BlobID] {
+			continue
+		}
+
+		if t, ok := timeFromID(bm.BlobID, SegmentPrefix); !ok || t.Before(checkpointTime.Add(-clockSkewMargin)) {
+			continue
+		}
+
+		var seg segment
+
+		if err := s.getJSON(ctx, bm.BlobID, &seg); err != nil {
+			if errors.Is(err, blob.ErrBlobNotFound) {
+				// deleted by concurrent reconciliation.
+				continue
+			}
+
+			return errors.Wrapf(err, "error reading segment %v", bm.BlobID)
+		}
+
+		for _, e := range seg.Entries {
+			s.current.apply(e)
+		}
+
+		s.current.Applied[bm.BlobID] = true
+		changed = true
+	}
+
+	for id := range s.current.Applied {
+		if !present[id] {
+			delete(s.current.Applied, id)
+		}
+	}
+
+	if changed {
+		s.saveLocalLocked(ctx)
+	}
+
+	s.nextRefresh = now.Add(minRefreshInterval)
+
+	return nil
+}
+
+func (s *journalStorage) loadLocal(ctx context.Context) *listing {
+	if s.cacheStorage == nil {
+		return nil
+	}
+
+	var data gather.WriteBuffer
+	defer data.Close()
+
+	if err := s.cacheStorage.GetBlob(ctx, localStateBlobID, 0, -1, &data); err != nil {
+		return nil
+	}
+
+	var verified gather.WriteBuffer
+	defer verified.Close()
+
+	if err := hmac.VerifyAndStrip(data.Bytes(), s.hmacSecret, &verified); err != nil {
+		log(ctx).Warnf("invalid blob list journal cache HMAC, ignoring")
+		return nil
+	}
+
+	l := &listing{}
+	if err := json.NewDecoder(verified.Bytes().Reader()).Decode(l); err != nil {
+		log(ctx).Warnf("can't unmarshal cached blob list journal, ignoring")
+		return nil
+	}
+
+	if l.Applied == nil || l.Blobs == nil {
+		return nil
+	}
+
+	if l.Tombstones == nil {
+		l.Tombstones = map[blob.ID]time.Time{}
+	}
+
+	return l
+}
+
+// +checklocks:s.mu
+func (s *journalStorage) saveLocalLocked(ctx context.Context) {
+	if s.cacheStorage == nil || s.current == nil {
+		return
+	}
+
+	data, err := json.Marshal(s.current)
+	if err != nil {
+		log(ctx).Debugf("unable to marshal blob list journal state: %v", err)
+		return
+	}
+
+	var b gather.WriteBuffer
+	defer b.Close()
+
+	hmac.Append(gather.FromSlice(data), s.hmacSecret, &b)
+
+	if err := s.cacheStorage.PutBlob(ctx, localStateBlobID, b.Bytes(), blob.PutOptions{}); err != nil {
+		log(ctx).Debugf("unable to persist blob list journal state: %v", err)
+	}
+}
+
+// putJSON writes the provided value as compressed JSON protected with HMAC.
+func (s *journalStorage) putJSON(ctx context.Context, id blob.ID, v any) error {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+
+	if err := json.NewEncoder(zw).Encode(v); err != nil {
+		return errors.Wrap(err, "unable to encode JSON")
+	}
+
+	if err := zw.Close(); err != nil {
+		return errors.Wrap(err, "unable to compress JSON")
+	}
+
+	var b gather.WriteBuffer
+	defer b.Close()
+
+	hmac.Append(gather.FromSlice(buf.Bytes()), s.hmacSecret, &b)
+
+	return errors.Wrapf(s.Storage.PutBlob(ctx, id, b.Bytes(), blob.PutOptions{}), "error writing %v", id)
+}
+
+func (s *journalStorage) getJSON(ctx context.Context, id blob.ID, v any) error {
+	var data gather.WriteBuffer
+	defer data.Close()
+
+	if err := s.Storage.GetBlob(ctx, id, 0, -1, &data); err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	var verified gather.WriteBuffer
+	defer verified.Close()
+
+	if err := hmac.VerifyAndStrip(data.Bytes(), s.hmacSecret, &verified); err != nil {
+		return errors.Wrap(err, "invalid HMAC")
+	}
+
+	zr, err := gzip.NewReader(verified.Bytes().Reader())
+	if err != nil {
+		return errors.Wrap(err, "unable to decompress")
+	}
+
+	defer zr.Close() //nolint:errcheck
+
+	return errors.Wrap(json.NewDecoder(zr).Decode(v), "unable to decode JSON")
+}
+
+// timePrefix returns fixed-width hexadecimal timestamp, so that blob IDs sort chronologically.
+func timePrefix(t time.Time) string {
+	return fmt.Sprintf("%016x", t.UnixNano())
+}
+
+func timeFromID(id, prefix blob.ID) (time.Time, bool) {
+	s := strings.TrimPrefix(string(id), string(prefix))
+	s, _, _ = strings.Cut(s, "_")
+
+	v, err := strconv.ParseInt(s, 16, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, v), true
+}
+
+// Reconcile reconciles the journal maintained by the provided storage, returns false if the storage
+// does not maintain a journal.
+func Reconcile(ctx context.Context, st blob.Storage) (ReconcileStats, bool, error) {
+	r, ok := st.(Reconciler)
+	if !ok {
+		return ReconcileStats{}, false, nil
+	}
+
+	stats, err := r.ReconcileJournal(ctx)
+
+	return stats, true, err
+}
+
+// IsEnabled determines whether the journal is enabled for the repository stored in the provided storage.
+func IsEnabled(ctx context.Context, st blob.Reader) (bool, error) {
+	_, err := st.GetMetadata(ctx, MarkerBlobID)
+	if errors.Is(err, blob.ErrBlobNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, errors.Wrap(err, "error checking blob list journal marker")
+	}
+
+	return true, nil
+}
+
+// DeleteAll deletes the marker and all journal blobs.
+func DeleteAll(ctx context.Context, st blob.Storage) error {
+	ids := []blob.ID{MarkerBlobID}
+
+	for _, p := range []blob.ID{SegmentPrefix, CheckpointPrefix} {
+		if err := st.ListBlobs(ctx, p, func(bm blob.Metadata) error {
+			ids = append(ids, bm.BlobID)
+			return nil
+		}); err != nil {
+			return errors.Wrapf(err, "error listing %v", p)
+		}
+	}
+
+	for _, id := range ids {
+		if err := st.DeleteBlob(ctx, id); err != nil {
+			return errors.Wrapf(err, "error deleting %v", id)
+		}
+	}
+
+	return nil
+}
+
+// NewWrapper returns a wrapper that journals writes and deletions of blobs with the provided prefixes and uses
+// the journal to serve their listings. The optional cache storage is used to persist the reconstructed listing locally,
+// so that subsequent sessions only need to read segments written since.
+func NewWrapper(st, cacheStorage blob.Storage, prefixes []blob.ID, hmacSecret []byte) blob.Storage {
+	return &journalStorage{
+		Storage:      st,
+		cacheStorage: cacheStorage,
+		prefixes:     prefixes,
+		hmacSecret:   hmacSecret,
+		timeNow:      clock.Now,
+	}
+}
+
+var (
+	_ blob.Storage = (*journalStorage)(nil)
+	_ Reconciler   = (*journalStorage)(nil)
+)
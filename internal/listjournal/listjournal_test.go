@@ -0,0 +1,208 @@
+package listjournal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+var journaledPrefixes = []blob.ID{"p", "q"}
+
+func newTestWrapper(st, cacheStorage blob.Storage, ta *faketime.TimeAdvance, secret string) *journalStorage {
+	w := NewWrapper(st, cacheStorage, journaledPrefixes, []byte(secret)).(*journalStorage)
+	w.timeNow = ta.NowFunc()
+
+	return w
+}
+
+func listIDs(t *testing.T, st blob.Storage, prefix blob.ID) []blob.ID {
+	t.Helper()
+
+	var ids []blob.ID
+
+	require.NoError(t, st.ListBlobs(testlogging.Context(t), prefix, func(bm blob.Metadata) error {
+		ids = append(ids, bm.BlobID)
+		return nil
+	}))
+
+	return ids
+}
+
+func TestListJournal(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	ta := faketime.NewTimeAdvance(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	data := blobtesting.DataMap{}
+	base := blobtesting.NewMapStorage(data, nil, ta.NowFunc())
+
+	require.NoError(t, base.PutBlob(ctx, "p1", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+	require.NoError(t, base.PutBlob(ctx, "q1", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+
+	cache1 := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	cache2 := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+
+	w1 := newTestWrapper(base, cache1, ta, "secret")
+	w2 := newTestWrapper(base, cache2, ta, "secret")
+
+	// without a checkpoint, the underlying storage is listed.
+	require.ElementsMatch(t, []blob.ID{"p1"}, listIDs(t, w1, "p"))
+
+	stats, err := w1.ReconcileJournal(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ReconcileStats{Blobs: 2}, stats)
+
+	// blobs written directly to the underlying storage are not visible in journaled listings.
+	require.NoError(t, base.PutBlob(ctx, "p9", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+	require.ElementsMatch(t, []blob.ID{"p1"}, listIDs(t, w2, "p"))
+	require.ElementsMatch(t, []blob.ID{"_ljc_", "p1", "p9", "q1"}, trimCheckpoints(listIDs(t, w2, "")))
+
+	// own writes are visible immediately.
+	require.NoError(t, w1.PutBlob(ctx, "p2", gather.FromSlice([]byte{1, 2}), blob.PutOptions{}))
+	require.ElementsMatch(t, []blob.ID{"p1", "p2"}, listIDs(t, w1, "p"))
+
+	// writing a non-journaled blob makes pending entries visible to other writers.
+	require.NoError(t, w1.PutBlob(ctx, "p3", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+	require.NoError(t, w1.PutBlob(ctx, "xindex", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+
+	ta.Advance(minRefreshInterval)
+	require.ElementsMatch(t, []blob.ID{"p1", "p2", "p3"}, listIDs(t, w2, "p"))
+
+	// lengths and timestamps are preserved.
+	var p3 blob.Metadata
+
+	require.NoError(t, w2.ListBlobs(ctx, "p3", func(bm blob.Metadata) error {
+		p3 = bm
+		return nil
+	}))
+
+	bm, err := base.GetMetadata(ctx, "p3")
+	require.NoError(t, err)
+	require.Equal(t, bm.Length, p3.Length)
+	require.True(t, bm.Timestamp.Equal(p3.Timestamp))
+
+	// deletions are propagated.
+	require.NoError(t, w2.DeleteBlob(ctx, "p1"))
+	require.NoError(t, w2.FlushCaches(ctx))
+
+	ta.Advance(minRefreshInterval)
+	require.ElementsMatch(t, []blob.ID{"p2", "p3"}, listIDs(t, w1, "p"))
+	require.ElementsMatch(t, []blob.ID{"q1"}, listIDs(t, w1, "q"))
+
+	// new session reuses the locally persisted listing.
+	w3 := newTestWrapper(base, cache2, ta, "secret")
+	w3.mu.Lock()
+	w3.current = w3.loadLocal(ctx)
+	require.NotNil(t, w3.current)
+	require.True(t, w3.current.Applied[firstSegment(t, base)])
+	w3.mu.Unlock()
+	require.ElementsMatch(t, []blob.ID{"p2", "p3"}, listIDs(t, w3, "p"))
+
+	// reconciliation detects blobs written around the journal and removes old segments.
+	require.NoError(t, base.DeleteBlob(ctx, "p2"))
+	ta.Advance(2 * clockSkewMargin)
+
+	stats, err = w3.ReconcileJournal(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ReconcileStats{Blobs: 3, Missing: 1, Extra: 1, DeletedSegments: 3}, stats)
+	require.Empty(t, listIDs(t, base, SegmentPrefix))
+	require.Len(t, listIDs(t, base, CheckpointPrefix), 1)
+
+	ta.Advance(minRefreshInterval)
+	require.ElementsMatch(t, []blob.ID{"p3", "p9"}, listIDs(t, w1, "p"))
+}
+
+func firstSegment(t *testing.T, st blob.Storage) blob.ID {
+	t.Helper()
+
+	ids := listIDs(t, st, SegmentPrefix)
+	require.NotEmpty(t, ids)
+
+	return ids[0]
+}
+
+func TestListJournalOutOfOrderSegments(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	l := newListing("c", nil)
+
+	// deletion applied before the put it follows.
+	l.apply(entry{BlobID: "p1", Deleted: true, Timestamp: ts.Add(time.Second)})
+	l.apply(entry{BlobID: "p1", Length: 1, Timestamp: ts})
+	require.NotContains(t, l.Blobs, blob.ID("p1"))
+
+	// blob re-created after deletion.
+	l.apply(entry{BlobID: "p1", Length: 2, Timestamp: ts.Add(2 * time.Second)})
+	require.Equal(t, int64(2), l.Blobs["p1"].Length)
+
+	// stale deletion does not remove newer blob.
+	l.apply(entry{BlobID: "p1", Deleted: true, Timestamp: ts.Add(time.Second)})
+	require.Contains(t, l.Blobs, blob.ID("p1"))
+}
+
+func TestListJournalInvalidHMAC(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	ta := faketime.NewTimeAdvance(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	base := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, ta.NowFunc())
+
+	w1 := newTestWrapper(base, nil, ta, "secret")
+	require.NoError(t, w1.PutBlob(ctx, "p1", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+
+	_, err := w1.ReconcileJournal(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, base.PutBlob(ctx, "p2", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+
+	// journal written with a different secret is ignored and storage is listed instead.
+	w2 := newTestWrapper(base, nil, ta, "other-secret")
+	require.ElementsMatch(t, []blob.ID{"p1", "p2"}, listIDs(t, w2, "p"))
+	require.ElementsMatch(t, []blob.ID{"p1"}, listIDs(t, w1, "p"))
+}
+
+func TestReconcileAndDeleteAll(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	base := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+
+	_, ok, err := Reconcile(ctx, base)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	enabled, err := IsEnabled(ctx, base)
+	require.NoError(t, err)
+	require.False(t, enabled)
+
+	require.NoError(t, base.PutBlob(ctx, MarkerBlobID, gather.FromSlice([]byte{}), blob.PutOptions{}))
+
+	enabled, err = IsEnabled(ctx, base)
+	require.NoError(t, err)
+	require.True(t, enabled)
+
+	w := NewWrapper(base, nil, journaledPrefixes, []byte("secret"))
+	require.NoError(t, w.PutBlob(ctx, "p1", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+
+	stats, ok, err := Reconcile(ctx, w)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 1, stats.Blobs)
+
+	require.NoError(t, DeleteAll(ctx, base))
+	require.ElementsMatch(t, []blob.ID{"p1"}, listIDs(t, base, ""))
+}
+
+func trimCheckpoints(ids []blob.ID) []blob.ID {
+	for i, id := range ids {
+		if _, ok := timeFromID(id, CheckpointPrefix); ok {
+			ids[i] = CheckpointPrefix
+		}
+	}
+
+	return ids
+}
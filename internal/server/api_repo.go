@@ -305,7 +305,15 @@ func handleRepoGetThrottle(ctx context.Context, rc requestContext) (interface{},
 		return nil, requestError(serverapi.ErrorStorageConnection, "no direct storage connection")
 	}
 
-	return dr.Throttler().Limits(), nil
+	resp := &serverapi.ThrottleLimitsResponse{
+		Limits: dr.Throttler().Limits(),
+	}
+
+	if w, ok := dr.Throttler().ActiveScheduleWindow(); ok {
+		resp.ActiveScheduleWindow = &w
+	}
+
+	return resp, nil
 }
 
 func handleRepoSetThrottle(ctx context.Context, rc requestContext) (interface{}, *apiError) {
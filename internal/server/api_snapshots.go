@@ -101,7 +101,7 @@ func handleDeleteSnapshots(ctx context.Context, rc requestContext) (interface{},
 		}
 
 		for _, m := range manifestIDs {
-			if err := w.DeleteManifest(ctx, m); err != nil {
+			if err := snapshot.DeleteManifest(ctx, w, m); err != nil {
 				return errors.Wrap(err, "uanble to delete snapshot")
 			}
 		}
@@ -179,6 +179,65 @@ func TestListAndDeleteSnapshots(t *testing.T) {
 	require.Empty(t, sourceList.Sources)
 }
 
+func TestDeleteSnapshotOnHold(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	si1 := env.LocalPathSourceInfo("/dummy/path")
+
+	var id11 manifest.ID
+
+	require.NoError(t, repo.WriteSession(ctx, env.Repository, repo.WriteSessionOptions{Purpose: "Test"}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		u := snapshotfs.NewUploader(w)
+
+		dir1 := mockfs.NewDirectory()
+
+		dir1.AddFile("file1", []byte{1, 2, 3}, 0o644)
+
+		man11, err := u.Upload(ctx, dir1, nil, si1)
+		require.NoError(t, err)
+		id11, err = snapshot.SaveSnapshot(ctx, w, man11)
+		require.NoError(t, err)
+
+		_, err = snapshot.SaveHold(ctx, w, &snapshot.Hold{
+			Source:       man11.Source,
+			StartTime:    man11.StartTime,
+			RootObjectID: man11.RootObjectID(),
+			Reason:       "audit",
+		})
+		require.NoError(t, err)
+
+		return nil
+	}))
+
+	srvInfo := servertesting.StartServer(t, env, false)
+
+	cli, err := apiclient.NewKopiaAPIClient(apiclient.Options{
+		BaseURL:                             srvInfo.BaseURL,
+		TrustedServerCertificateFingerprint: srvInfo.TrustedServerCertificateFingerprint,
+		Username:                            servertesting.TestUIUsername,
+		Password:                            servertesting.TestUIPassword,
+	})
+
+	require.NoError(t, err)
+	require.NoError(t, cli.FetchCSRFTokenForTesting(ctx))
+
+	err = cli.Post(ctx, "snapshots/delete", &serverapi.DeleteSnapshotsRequest{
+		SourceInfo:          si1,
+		SnapshotManifestIDs: []manifest.ID{id11},
+	}, &serverapi.Empty{})
+	require.ErrorContains(t, err, "snapshot is on hold")
+
+	err = cli.Post(ctx, "snapshots/delete", &serverapi.DeleteSnapshotsRequest{
+		SourceInfo:            si1,
+		DeleteSourceAndPolicy: true,
+	}, &serverapi.Empty{})
+	require.ErrorContains(t, err, "snapshot is on hold")
+
+	resp, err := serverapi.ListSnapshots(ctx, cli, si1, true)
+	require.NoError(t, err)
+	require.Len(t, resp.Snapshots, 1)
+}
+
 func TestEditSnapshots(t *testing.T) {
 	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
 
@@ -408,7 +408,8 @@ func handleDeleteManifestRequest(ctx context.Context, dw repo.DirectRepositoryWr
 		return accessDeniedResponse()
 	}
 
-	if err := dw.DeleteManifest(ctx, manifest.ID(req.GetManifestId())); err != nil {
+	// snapshots on hold can't be deleted.
+	if err := snapshot.DeleteManifest(ctx, dw, manifest.ID(req.GetManifestId())); err != nil {
 		return errorResponse(err)
 	}
 
@@ -52,6 +52,47 @@ func TestServer(t *testing.T) {
 	remoteRepositoryTest(ctx, t, rep)
 }
 
+func TestGRPCServer_DeleteSnapshotOnHold(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	man := &snapshot.Manifest{
+		Source: snapshot.SourceInfo{
+			Host:     servertesting.TestHostname,
+			UserName: servertesting.TestUsername,
+			Path:     testPathname,
+		},
+		Description: "held",
+	}
+
+	manifestID, err := snapshot.SaveSnapshot(ctx, env.RepositoryWriter, man)
+	require.NoError(t, err)
+
+	_, err = snapshot.SaveHold(ctx, env.RepositoryWriter, &snapshot.Hold{
+		Source:    man.Source,
+		StartTime: man.StartTime,
+	})
+	require.NoError(t, err)
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	apiServerInfo := servertesting.StartServer(t, env, true)
+
+	rep, err := servertesting.ConnectAndOpenAPIServer(t, ctx, apiServerInfo, repo.ClientOptions{
+		Username: servertesting.TestUsername,
+		Hostname: servertesting.TestHostname,
+	}, content.CachingOptions{
+		CacheDirectory: testutil.TempDirectory(t),
+	}, servertesting.TestPassword, &repo.Options{})
+	require.NoError(t, err)
+
+	defer rep.Close(ctx)
+
+	require.ErrorContains(t, repo.WriteSession(ctx, rep, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		return w.DeleteManifest(ctx, manifestID)
+	}), "snapshot is on hold")
+
+	mustListSnapshotCount(ctx, t, rep, 1)
+}
+
 func TestGRPCServer_AuthenticationError(t *testing.T) {
 	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
 	apiServerInfo := servertesting.StartServer(t, env, true)
@@ -9,6 +9,7 @@
 	"github.com/kopia/kopia/internal/uitask"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/repo/format"
 	"github.com/kopia/kopia/repo/manifest"
 	"github.com/kopia/kopia/repo/object"
@@ -39,6 +40,13 @@ type StatusResponse struct {
 	InitRepoTaskID string `json:"initTaskID,omitempty"`
 }
 
+// ThrottleLimitsResponse contains throttling limits along with the schedule window currently in effect.
+type ThrottleLimitsResponse struct {
+	throttling.Limits
+
+	ActiveScheduleWindow *throttling.ScheduleWindow `json:"activeScheduleWindow,omitempty"`
+}
+
 // SourcesResponse is the response of 'sources' HTTP API command.
 type SourcesResponse struct {
 	LocalUsername string `json:"localUsername"`
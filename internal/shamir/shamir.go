@@ -0,0 +1,163 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8).
+package shamir
+
+import (
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+)
+
+// MaxShares is the maximum number of shares a secret can be split into.
+const MaxShares = 255
+
+// Split splits the secret into n shares, any k of which can be combined to recover it.
+// Each share is one byte longer than the secret, the last byte holding the x coordinate of the share.
+func Split(secret []byte, n, k int) ([][]byte, error) {
+	switch {
+	case len(secret) == 0:
+		return nil, errors.New("secret must not be empty")
+	case k < 2: //nolint:mnd
+		return nil, errors.New("threshold must be at least 2")
+	case n < k:
+		return nil, errors.New("number of shares must not be less than the threshold")
+	case n > MaxShares:
+		return nil, errors.Errorf("number of shares must not exceed %v", MaxShares)
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	// random coefficients of the polynomial for each byte, the constant term being the byte of the secret.
+	coefficients := make([]byte, k)
+
+	for pos, b := range secret {
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, errors.Wrap(err, "unable to generate coefficients")
+		}
+
+		coefficients[0] = b
+
+		for _, s := range shares {
+			s[pos] = evaluate(coefficients, s[len(secret)])
+		}
+	}
+
+	return shares, nil
+}
+
+// Combine recovers the secret from the provided shares. When fewer shares than the threshold
+// used to split the secret are provided, the result is indistinguishable from a random value.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 { //nolint:mnd
+		return nil, errors.New("at least 2 shares are required")
+	}
+
+	l := len(shares[0])
+	if l < 2 { //nolint:mnd
+		return nil, errors.New("invalid share length")
+	}
+
+	xs := make([]byte, len(shares))
+	seen := map[byte]bool{}
+
+	for i, s := range shares {
+		if len(s) != l {
+			return nil, errors.New("all shares must have the same length")
+		}
+
+		x := s[l-1]
+		if x == 0 || seen[x] {
+			return nil, errors.New("invalid or duplicate share")
+		}
+
+		seen[x] = true
+		xs[i] = x
+	}
+
+	secret := make([]byte, l-1)
+	ys := make([]byte, len(shares))
+
+	for pos := range secret {
+		for i, s := range shares {
+			ys[i] = s[pos]
+		}
+
+		secret[pos] = interpolateAtZero(xs, ys)
+	}
+
+	return secret, nil
+}
+
+// evaluate returns the value of the polynomial with the provided coefficients at x using Horner's method.
+func evaluate(coefficients []byte, x byte) byte {
+	var result byte
+
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = mul(result, x) ^ coefficients[i]
+	}
+
+	return result
+}
+
+// interpolateAtZero returns the value at 0 of the Lagrange polynomial passing through the provided points.
+func interpolateAtZero(xs, ys []byte) byte {
+	var result byte
+
+	for i := range xs {
+		basis := byte(1)
+
+		for j := range xs {
+			if i != j {
+				// in GF(2^8) subtraction is xor, so (0 - x_j) / (x_i - x_j) == x_j / (x_i ^ x_j)
+				basis = mul(basis, div(xs[j], xs[i]^xs[j]))
+			}
+		}
+
+		result ^= mul(ys[i], basis)
+	}
+
+	return result
+}
+
+//nolint:gochecknoglobals
+var expTable, logTable = func() (exp [510]byte, log [256]byte) {
+	x := byte(1)
+
+	for i := range 255 {
+		exp[i] = x
+		exp[i+255] = x
+		log[x] = byte(i)
+
+		// multiply by the generator 3 modulo the AES polynomial x^8 + x^4 + x^3 + x + 1.
+		x ^= xtime(x)
+	}
+
+	return exp, log
+}()
+
+func xtime(x byte) byte {
+	if x&0x80 != 0 {
+		return x<<1 ^ 0x1b //nolint:mnd
+	}
+
+	return x << 1
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
@@ -0,0 +1,71 @@
+package shamir_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/shamir"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := make([]byte, 32)
+
+	_, err := rand.Read(secret)
+	require.NoError(t, err)
+
+	shares, err := shamir.Split(secret, 5, 3)
+	require.NoError(t, err)
+	require.Len(t, shares, 5)
+
+	for _, s := range shares {
+		require.Len(t, s, len(secret)+1)
+	}
+
+	// any 3 shares recover the secret, in any order.
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {3, 4, 0, 1}, {0, 1, 2, 3, 4}} {
+		var selected [][]byte
+
+		for _, i := range subset {
+			selected = append(selected, shares[i])
+		}
+
+		got, err := shamir.Combine(selected)
+		require.NoError(t, err)
+		require.Equal(t, secret, got, "subset %v", subset)
+	}
+
+	// 2 shares are not enough.
+	got, err := shamir.Combine([][]byte{shares[0], shares[1]})
+	require.NoError(t, err)
+	require.False(t, bytes.Equal(secret, got))
+
+	_, err = shamir.Combine([][]byte{shares[0], shares[0], shares[1]})
+	require.Error(t, err)
+
+	_, err = shamir.Combine([][]byte{shares[0], shares[1][1:], shares[2]})
+	require.Error(t, err)
+}
+
+func TestSplitInvalidParameters(t *testing.T) {
+	_, err := shamir.Split(nil, 5, 3)
+	require.Error(t, err)
+
+	_, err = shamir.Split([]byte("secret"), 5, 1)
+	require.Error(t, err)
+
+	_, err = shamir.Split([]byte("secret"), 2, 3)
+	require.Error(t, err)
+
+	_, err = shamir.Split([]byte("secret"), 256, 3)
+	require.Error(t, err)
+
+	shares, err := shamir.Split([]byte("secret"), shamir.MaxShares, shamir.MaxShares)
+	require.NoError(t, err)
+
+	got, err := shamir.Combine(shares)
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), got)
+}
@@ -0,0 +1,140 @@
+package azure
+
+import (
+	"bytes"
+	"crypto/md5" //nolint:gosec
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const fakeAzureContainer = "some-container"
+
+// fakeAzureObject is a blob stored by fakeAzure.
+type fakeAzureObject struct {
+	data       []byte
+	contentMD5 string
+	modTime    time.Time
+}
+
+// fakeAzure implements minimal subset of Azure Blob Storage API sufficient to verify checksums,
+// which allows tampering with stored data.
+type fakeAzure struct {
+	mu      sync.Mutex
+	objects map[string]fakeAzureObject
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name, ok := strings.CutPrefix(r.URL.Path, "/"+fakeAzureContainer+"/")
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		h := md5.Sum(data) //nolint:gosec
+		actual := base64.StdEncoding.EncodeToString(h[:])
+
+		// transactional checksum of the request must match.
+		if r.Header.Get("Content-MD5") != actual {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		o := fakeAzureObject{data, r.Header.Get("X-Ms-Blob-Content-Md5"), time.Now().Truncate(time.Second)}
+		f.objects[name] = o
+
+		w.Header().Set("Last-Modified", o.modTime.Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusCreated)
+
+	case http.MethodGet:
+		o, ok := f.objects[name]
+		if !ok {
+			w.Header().Set("X-Ms-Error-Code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		if rng := r.Header.Get("X-Ms-Range"); rng != "" {
+			r.Header.Set("Range", rng)
+		} else if o.contentMD5 != "" {
+			// checksum recorded at upload time is only returned when downloading entire blob.
+			w.Header().Set("Content-MD5", o.contentMD5)
+		}
+
+		http.ServeContent(w, r, "", o.modTime, bytes.NewReader(o.data))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// corrupt replaces stored blob contents without updating its checksum.
+func (f *fakeAzure) corrupt(name string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	o := f.objects[name]
+	o.data = data
+	f.objects[name] = o
+}
+
+func TestAzureStorageChecksumMismatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	f := &fakeAzure{objects: map[string]fakeAzureObject{}}
+
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	service, err := azblob.NewClientWithNoCredential(server.URL+"/", nil)
+	require.NoError(t, err)
+
+	st := &azStorage{
+		Options:   Options{Container: fakeAzureContainer},
+		container: fakeAzureContainer,
+		service:   service,
+	}
+
+	require.NoError(t, st.PutBlob(ctx, "abcd", gather.FromSlice([]byte{1, 2, 3, 4}), blob.PutOptions{}))
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.NoError(t, st.GetBlob(ctx, "abcd", 0, -1, &tmp))
+	require.Equal(t, []byte{1, 2, 3, 4}, tmp.ToByteSlice())
+
+	f.corrupt("abcd", []byte{1, 2, 3, 5})
+
+	tmp.Reset()
+	require.ErrorIs(t, st.GetBlob(ctx, "abcd", 0, -1, &tmp), blob.ErrChecksumMismatch)
+
+	// partial reads can't be verified.
+	tmp.Reset()
+	require.NoError(t, st.GetBlob(ctx, "abcd", 0, 2, &tmp))
+}
@@ -2,8 +2,12 @@
 package azure
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5" //nolint:gosec
+	"encoding/hex"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
@@ -83,11 +87,27 @@ func (az *azStorage) getBlobWithVersion(ctx context.Context, b blob.ID, versionI
 		return nil
 	}
 
-	if err := iocopy.JustCopy(output, body); err != nil {
+	if !blob.IsFullRead(offset, length) || resp.ContentMD5 == nil {
+		if err := iocopy.JustCopy(output, body); err != nil {
+			return translateError(err)
+		}
+
+		//nolint:wrapcheck
+		return blob.EnsureLengthExactly(output.Length(), length)
+	}
+
+	// when downloading entire blob, Content-MD5 recorded at upload time is returned.
+	h := md5.New() //nolint:gosec
+
+	if err := iocopy.JustCopy(io.MultiWriter(output, h), body); err != nil {
 		return translateError(err)
 	}
-	//nolint:wrapcheck
-	return blob.EnsureLengthExactly(output.Length(), length)
+
+	if actual := h.Sum(nil); !bytes.Equal(actual, resp.ContentMD5) {
+		return blob.ChecksumMismatchError(b, hex.EncodeToString(resp.ContentMD5), hex.EncodeToString(actual))
+	}
+
+	return nil
 }
 
 func (az *azStorage) GetMetadata(ctx context.Context, b blob.ID) (blob.Metadata, error) {
@@ -174,6 +194,18 @@ func (az *azStorage) DeleteBlob(ctx context.Context, b blob.ID) error {
 
 // ExtendBlobRetention extends a blob retention period.
 func (az *azStorage) ExtendBlobRetention(ctx context.Context, b blob.ID, opts blob.ExtendOptions) error {
+	if opts.LegalHold != "" {
+		_, err := az.service.ServiceClient().
+			NewContainerClient(az.Container).
+			NewBlobClient(az.getObjectNameString(b)).
+			SetLegalHold(ctx, opts.LegalHold == blob.LegalHoldOn, nil)
+		if err != nil {
+			return errors.Wrap(err, "unable to set legal hold")
+		}
+
+		return nil
+	}
+
 	retainUntilDate := clock.Now().Add(opts.RetentionPeriod).UTC()
 	mode := azblobblob.ImmutabilityPolicySetting(blob.Locked) // overwrite the S3 values
 
@@ -275,8 +307,19 @@ func (az *azStorage) putBlob(ctx context.Context, b blob.ID, data blob.Bytes, op
 		metadata[k] = to.Ptr(v)
 	}
 
+	var contentMD5 [md5.Size]byte
+
+	h := md5.New()  //nolint:gosec
+	data.WriteTo(h) //nolint:errcheck
+	h.Sum(contentMD5[:0])
+
 	uo := &azblockblob.UploadOptions{
 		Metadata: metadata,
+		// have Azure verify the uploaded data and record its checksum, which is returned when downloading entire blob.
+		TransactionalValidation: azblobblob.TransferValidationTypeMD5(contentMD5[:]),
+		HTTPHeaders: &azblobblob.HTTPHeaders{
+			BlobContentMD5: contentMD5[:],
+		},
 	}
 
 	if opts.HasRetentionOptions() {
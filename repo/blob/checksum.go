@@ -0,0 +1,48 @@
+package blob
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+
+	"github.com/pkg/errors"
+)
+
+//nolint:gochecknoglobals
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// IsFullRead returns true if the provided GetBlob() range covers the entire blob, in which case
+// providers are able to verify the checksum of the contents.
+func IsFullRead(offset, length int64) bool {
+	return offset == 0 && length < 0
+}
+
+// NewCRC32C returns a hash computing CRC32 checksum using the Castagnoli polynomial,
+// which is natively supported by many storage providers.
+func NewCRC32C() hash.Hash32 {
+	return crc32.New(crc32cTable)
+}
+
+// CRC32C returns the CRC32C checksum of the provided bytes.
+func CRC32C(b Bytes) uint32 {
+	h := NewCRC32C()
+	b.WriteTo(h) //nolint:errcheck
+
+	return h.Sum32()
+}
+
+// EncodeCRC32C returns base64-encoded big-endian representation of CRC32C checksum, as used in HTTP headers.
+func EncodeCRC32C(v uint32) string {
+	var b [4]byte
+
+	binary.BigEndian.PutUint32(b[:], v)
+
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+// ChecksumMismatchError returns an error wrapping ErrChecksumMismatch, which describes the expected
+// and actual checksums of the provided blob.
+func ChecksumMismatchError(id ID, expected, actual string) error {
+	return errors.Wrapf(ErrChecksumMismatch, "blob %v has checksum %v, expected %v", id, actual, expected)
+}
@@ -0,0 +1,30 @@
+package blob_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestCRC32C(t *testing.T) {
+	// well-known check value of CRC-32C.
+	require.Equal(t, uint32(0xe3069283), blob.CRC32C(gather.FromSlice([]byte("123456789"))))
+	require.Equal(t, "4waSgw==", blob.EncodeCRC32C(0xe3069283))
+}
+
+func TestIsFullRead(t *testing.T) {
+	require.True(t, blob.IsFullRead(0, -1))
+	require.False(t, blob.IsFullRead(0, 10))
+	require.False(t, blob.IsFullRead(1, -1))
+}
+
+func TestChecksumMismatchError(t *testing.T) {
+	err := blob.ChecksumMismatchError("abc", "aaa", "bbb")
+
+	require.True(t, errors.Is(err, blob.ErrChecksumMismatch))
+	require.ErrorContains(t, err, "blob abc has checksum bbb, expected aaa")
+}
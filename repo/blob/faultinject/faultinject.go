@@ -0,0 +1,354 @@
+// Package faultinject implements wrapper around blob.Storage that injects faults described by a profile,
+// which allows rehearsing failure handling against real storage without damaging it.
+package faultinject
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// Operation names used in fault rules.
+const (
+	OperationGetBlob     = "get"
+	OperationGetMetadata = "metadata"
+	OperationPutBlob     = "put"
+	OperationDeleteBlob  = "delete"
+	OperationListBlobs   = "list"
+)
+
+//nolint:gochecknoglobals
+var allOperations = []string{OperationGetBlob, OperationGetMetadata, OperationPutBlob, OperationDeleteBlob, OperationListBlobs}
+
+// ErrInjected is wrapped by all errors returned by injected faults.
+var ErrInjected = errors.New("injected fault")
+
+// Rule describes faults injected into matching storage operations.
+type Rule struct {
+	// Operations to which the rule applies, all operations if empty.
+	Operations []string `json:"operations,omitempty"`
+
+	// Prefix of blob IDs to which the rule applies. Listings match when the listed prefix overlaps it.
+	Prefix blob.ID `json:"prefix,omitempty"`
+
+	// Probability of injecting the fault into each matching operation, 1 if not specified.
+	Probability float64 `json:"probability,omitempty"`
+
+	// MaxCount limits the number of times latency, errors and partial reads are injected, unlimited if zero.
+	MaxCount int `json:"maxCount,omitempty"`
+
+	// Latency is added before performing the operation, e.g. "250ms".
+	Latency string `json:"latency,omitempty"`
+
+	// Error causes the operation to fail with the provided message instead of being performed.
+	Error string `json:"error,omitempty"`
+
+	// PartialRead causes GetBlob to return truncated data followed by an error.
+	PartialRead bool `json:"partialRead,omitempty"`
+
+	// Missing causes matching blobs to be reported as not found and omitted from listings.
+	// The subset of missing blobs is determined by Probability and is stable for the lifetime of the process.
+	Missing bool `json:"missing,omitempty"`
+
+	// ListingDelay omits blobs modified more recently than the provided duration from listings,
+	// emulating eventually-consistent storage, e.g. "30s".
+	ListingDelay string `json:"listingDelay,omitempty"`
+
+	latency      time.Duration
+	listingDelay time.Duration
+}
+
+func (r *Rule) appliesTo(op string) bool {
+	return len(r.Operations) == 0 || slices.Contains(r.Operations, op)
+}
+
+func (r *Rule) matchesBlob(id blob.ID) bool {
+	return strings.HasPrefix(string(id), string(r.Prefix))
+}
+
+func (r *Rule) matchesPrefix(prefix blob.ID) bool {
+	return r.matchesBlob(prefix) || strings.HasPrefix(string(r.Prefix), string(prefix))
+}
+
+func (r *Rule) probability() float64 {
+	if r.Probability == 0 {
+		return 1
+	}
+
+	return r.Probability
+}
+
+// isMissing deterministically selects the fraction of blobs given by probability.
+func (r *Rule) isMissing(id blob.ID) bool {
+	h := fnv.New32a()
+	h.Write([]byte(id)) //nolint:errcheck
+
+	return float64(h.Sum32())/(1<<32) < r.probability()
+}
+
+func (r *Rule) parse() error {
+	for _, op := range r.Operations {
+		if !slices.Contains(allOperations, op) {
+			return errors.Errorf("invalid operation %q, must be one of %v", op, strings.Join(allOperations, ", "))
+		}
+	}
+
+	if r.Probability < 0 || r.Probability > 1 {
+		return errors.Errorf("invalid probability %v, must be between 0 and 1", r.Probability)
+	}
+
+	var err error
+
+	if r.Latency != "" {
+		if r.latency, err = time.ParseDuration(r.Latency); err != nil {
+			return errors.Wrap(err, "invalid latency")
+		}
+	}
+
+	if r.ListingDelay != "" {
+		if r.listingDelay, err = time.ParseDuration(r.ListingDelay); err != nil {
+			return errors.Wrap(err, "invalid listing delay")
+		}
+	}
+
+	return nil
+}
+
+// Profile describes a set of faults to be injected.
+type Profile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// ParseProfile parses and validates the JSON representation of a fault profile.
+func ParseProfile(b []byte) (*Profile, error) {
+	p := &Profile{}
+
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, errors.Wrap(err, "invalid fault profile")
+	}
+
+	if _, err := p.parsedRules(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *Profile) parsedRules() ([]Rule, error) {
+	rules := slices.Clone(p.Rules)
+
+	for i := range rules {
+		if err := rules[i].parse(); err != nil {
+			return nil, errors.Wrapf(err, "invalid fault profile rule #%v", i)
+		}
+	}
+
+	return rules, nil
+}
+
+// LoadProfile loads the fault profile from the provided JSON file.
+func LoadProfile(fname string) (*Profile, error) {
+	b, err := os.ReadFile(fname) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read fault profile")
+	}
+
+	return ParseProfile(b)
+}
+
+type faultStorage struct {
+	blob.Storage
+
+	rules   []Rule
+	timeNow func() time.Time
+
+	mu sync.Mutex
+	// +checklocks:mu
+	injectedCount []int
+}
+
+// inject injects latency and errors of rules matching the provided operation and returns
+// true if the caller should perform partial read.
+func (s *faultStorage) inject(ctx context.Context, op string, matches func(r *Rule) bool) (partialRead bool, err error) {
+	for i := range s.rules {
+		r := &s.rules[i]
+
+		if r.latency == 0 && r.Error == "" && !r.PartialRead {
+			continue
+		}
+
+		if !r.appliesTo(op) || !matches(r) || !s.shouldInject(i) {
+			continue
+		}
+
+		if r.latency > 0 {
+			select {
+			case <-ctx.Done():
+				return false, errors.Wrap(ctx.Err(), "injected latency")
+			case <-time.After(r.latency):
+			}
+		}
+
+		if r.Error != "" {
+			return false, errors.Wrapf(ErrInjected, "%v: %v", op, r.Error)
+		}
+
+		if r.PartialRead && op == OperationGetBlob {
+			partialRead = true
+		}
+	}
+
+	return partialRead, nil
+}
+
+func (s *faultStorage) shouldInject(i int) bool {
+	r := &s.rules[i]
+
+	//nolint:gosec
+	if rand.Float64() >= r.probability() {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.MaxCount > 0 && s.injectedCount[i] >= r.MaxCount {
+		return false
+	}
+
+	s.injectedCount[i]++
+
+	return true
+}
+
+func (s *faultStorage) isMissing(op string, id blob.ID) bool {
+	for i := range s.rules {
+		r := &s.rules[i]
+
+		if r.Missing && r.appliesTo(op) && r.matchesBlob(id) && r.isMissing(id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *faultStorage) isDelayedInListing(bm blob.Metadata) bool {
+	for i := range s.rules {
+		r := &s.rules[i]
+
+		if r.listingDelay > 0 && r.appliesTo(OperationListBlobs) && r.matchesBlob(bm.BlobID) && s.timeNow().Sub(bm.Timestamp) < r.listingDelay {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *faultStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	partialRead, err := s.inject(ctx, OperationGetBlob, func(r *Rule) bool { return r.matchesBlob(id) })
+	if err != nil {
+		return err
+	}
+
+	if s.isMissing(OperationGetBlob, id) {
+		return errors.Wrapf(blob.ErrBlobNotFound, "injected missing blob %v", id)
+	}
+
+	if !partialRead {
+		//nolint:wrapcheck
+		return s.Storage.GetBlob(ctx, id, offset, length, output)
+	}
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	if err := s.Storage.GetBlob(ctx, id, offset, length, &tmp); err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	b := tmp.ToByteSlice()
+
+	output.Reset()
+
+	if _, err := output.Write(b[0 : len(b)/2]); err != nil {
+		return errors.Wrap(err, "error writing output")
+	}
+
+	return errors.Wrapf(io.ErrUnexpectedEOF, "injected partial read of %v", id)
+}
+
+func (s *faultStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	if _, err := s.inject(ctx, OperationGetMetadata, func(r *Rule) bool { return r.matchesBlob(id) }); err != nil {
+		return blob.Metadata{}, err
+	}
+
+	if s.isMissing(OperationGetMetadata, id) {
+		return blob.Metadata{}, errors.Wrapf(blob.ErrBlobNotFound, "injected missing blob %v", id)
+	}
+
+	//nolint:wrapcheck
+	return s.Storage.GetMetadata(ctx, id)
+}
+
+func (s *faultStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	if _, err := s.inject(ctx, OperationPutBlob, func(r *Rule) bool { return r.matchesBlob(id) }); err != nil {
+		return err
+	}
+
+	//nolint:wrapcheck
+	return s.Storage.PutBlob(ctx, id, data, opts)
+}
+
+func (s *faultStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	if _, err := s.inject(ctx, OperationDeleteBlob, func(r *Rule) bool { return r.matchesBlob(id) }); err != nil {
+		return err
+	}
+
+	//nolint:wrapcheck
+	return s.Storage.DeleteBlob(ctx, id)
+}
+
+func (s *faultStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	if _, err := s.inject(ctx, OperationListBlobs, func(r *Rule) bool { return r.matchesPrefix(prefix) }); err != nil {
+		return err
+	}
+
+	//nolint:wrapcheck
+	return s.Storage.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+		if s.isMissing(OperationListBlobs, bm.BlobID) || s.isDelayedInListing(bm) {
+			return nil
+		}
+
+		return callback(bm)
+	})
+}
+
+// NewWrapper returns a Storage wrapper that injects faults described by the provided profile.
+func NewWrapper(wrapped blob.Storage, p *Profile) (blob.Storage, error) {
+	rules, err := p.parsedRules()
+	if err != nil {
+		return nil, err
+	}
+
+	return &faultStorage{
+		Storage:       wrapped,
+		rules:         rules,
+		timeNow:       clock.Now,
+		injectedCount: make([]int, len(rules)),
+	}, nil
+}
@@ -0,0 +1,134 @@
+package faultinject_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/faultinject"
+)
+
+func newWrapper(t *testing.T, data blobtesting.DataMap, profile string) blob.Storage {
+	t.Helper()
+
+	p, err := faultinject.ParseProfile([]byte(profile))
+	require.NoError(t, err)
+
+	st, err := faultinject.NewWrapper(blobtesting.NewMapStorage(data, nil, nil), p)
+	require.NoError(t, err)
+
+	return st
+}
+
+func listIDs(t *testing.T, st blob.Storage, prefix blob.ID) []blob.ID {
+	t.Helper()
+
+	mds, err := blob.ListAllBlobs(testlogging.Context(t), st, prefix)
+	require.NoError(t, err)
+
+	return blob.IDsFromMetadata(mds)
+}
+
+func TestErrors(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	st := newWrapper(t, blobtesting.DataMap{}, `{"rules":[
+		{"operations":["put"], "prefix":"p", "error":"drill", "maxCount":2},
+		{"operations":["list"], "prefix":"q", "error":"drill"}
+	]}`)
+
+	// faults are only injected into matching operations, up to maxCount times.
+	require.NoError(t, st.PutBlob(ctx, "q1", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+	require.ErrorIs(t, st.PutBlob(ctx, "p1", gather.FromSlice([]byte{1}), blob.PutOptions{}), faultinject.ErrInjected)
+	require.ErrorIs(t, st.PutBlob(ctx, "p1", gather.FromSlice([]byte{1}), blob.PutOptions{}), faultinject.ErrInjected)
+	require.NoError(t, st.PutBlob(ctx, "p1", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+
+	// listings are affected when the listed prefix overlaps the rule prefix.
+	require.Equal(t, []blob.ID{"p1"}, listIDs(t, st, "p"))
+	require.ErrorIs(t, st.ListBlobs(ctx, "", func(blob.Metadata) error { return nil }), faultinject.ErrInjected)
+	require.ErrorIs(t, st.ListBlobs(ctx, "q1", func(blob.Metadata) error { return nil }), faultinject.ErrInjected)
+}
+
+func TestPartialReadAndMissing(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	st := newWrapper(t, blobtesting.DataMap{
+		"p1": {1, 2, 3, 4},
+		"q1": {1, 2, 3, 4},
+	}, `{"rules":[
+		{"prefix":"p", "partialRead":true},
+		{"prefix":"q", "missing":true}
+	]}`)
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.ErrorIs(t, st.GetBlob(ctx, "p1", 0, -1, &tmp), io.ErrUnexpectedEOF)
+	require.Equal(t, []byte{1, 2}, tmp.ToByteSlice())
+
+	require.ErrorIs(t, st.GetBlob(ctx, "q1", 0, -1, &tmp), blob.ErrBlobNotFound)
+
+	_, err := st.GetMetadata(ctx, "q1")
+	require.ErrorIs(t, err, blob.ErrBlobNotFound)
+
+	require.Equal(t, []blob.ID{"p1"}, listIDs(t, st, ""))
+}
+
+func TestLatencyAndListingDelay(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	st := newWrapper(t, blobtesting.DataMap{}, `{"rules":[
+		{"operations":["delete"], "latency":"1h"},
+		{"prefix":"p", "listingDelay":"1h"}
+	]}`)
+
+	require.NoError(t, st.PutBlob(ctx, "p1", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+	require.NoError(t, st.PutBlob(ctx, "q1", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+
+	// recently written blobs are not listed yet, but can be read.
+	require.Equal(t, []blob.ID{"q1"}, listIDs(t, st, ""))
+
+	_, err := st.GetMetadata(ctx, "p1")
+	require.NoError(t, err)
+
+	// injected latency respects context cancellation.
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, st.DeleteBlob(ctx2, "q1"), context.DeadlineExceeded)
+}
+
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, invalid := range []string{
+		`{"rules":[{"operations":["bad"]}]}`,
+		`{"rules":[{"probability":2}]}`,
+		`{"rules":[{"latency":"xyz"}]}`,
+		`{"rules":[{"listingDelay":"xyz"}]}`,
+		`not-json`,
+	} {
+		_, err := faultinject.ParseProfile([]byte(invalid))
+		require.Error(t, err, invalid)
+	}
+
+	fname := filepath.Join(dir, "profile.json")
+	require.NoError(t, os.WriteFile(fname, []byte(`{"rules":[{"prefix":"p","error":"x","probability":0.5}]}`), 0o600))
+
+	p, err := faultinject.LoadProfile(fname)
+	require.NoError(t, err)
+	require.Len(t, p.Rules, 1)
+	require.Equal(t, blob.ID("p"), p.Rules[0].Prefix)
+
+	_, err = faultinject.LoadProfile(filepath.Join(dir, "no-such-file.json"))
+	require.Error(t, err)
+}
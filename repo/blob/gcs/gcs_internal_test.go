@@ -2,13 +2,28 @@
 package gcs
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"io"
 	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	gcsclient "cloud.google.com/go/storage"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
 )
 
 func TestGCSStorageCredentialsHelpers(t *testing.T) {
@@ -78,3 +93,134 @@ func TestGCSStorageCredentialsHelpers(t *testing.T) {
 		require.NotNil(t, ts)
 	})
 }
+
+const fakeGCSBucket = "some-bucket"
+
+// fakeGCSObject is an object stored by fakeGCS.
+type fakeGCSObject struct {
+	data   []byte
+	crc32c string
+}
+
+// fakeGCS implements minimal subset of GCS JSON and XML APIs sufficient to verify checksums,
+// which allows tampering with stored data.
+type fakeGCS struct {
+	mu      sync.Mutex
+	objects map[string]fakeGCSObject
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/"+fakeGCSBucket+"/o":
+		f.upload(w, r)
+
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/"+fakeGCSBucket+"/"):
+		o, ok := f.objects[strings.TrimPrefix(r.URL.Path, "/"+fakeGCSBucket+"/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("X-Goog-Hash", "crc32c="+o.crc32c)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(o.data))
+
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// upload handles multipart upload consisting of JSON object metadata followed by the contents.
+func (f *fakeGCS) upload(w http.ResponseWriter, r *http.Request) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	mr := multipart.NewReader(r.Body, params["boundary"])
+
+	var attrs struct {
+		Name   string `json:"name"`
+		CRC32C string `json:"crc32c"`
+	}
+
+	p, err := mr.NextPart()
+	if err != nil || json.NewDecoder(p).Decode(&attrs) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	p, err = mr.NextPart()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(p)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if attrs.CRC32C != blob.EncodeCRC32C(blob.CRC32C(gather.FromSlice(data))) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.objects[attrs.Name] = fakeGCSObject{data, attrs.CRC32C}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"bucket": fakeGCSBucket,
+		"name":   attrs.Name,
+		"crc32c": attrs.CRC32C,
+	})
+}
+
+// corrupt replaces stored object contents without updating its checksum.
+func (f *fakeGCS) corrupt(name string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	o := f.objects[name]
+	o.data = data
+	f.objects[name] = o
+}
+
+func TestGCSStorageChecksumMismatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	f := &fakeGCS{objects: map[string]fakeGCSObject{}}
+
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	cli, err := gcsclient.NewClient(ctx, option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	st := &gcsStorage{
+		Options:       Options{BucketName: fakeGCSBucket},
+		storageClient: cli,
+		bucket:        cli.Bucket(fakeGCSBucket),
+	}
+
+	require.NoError(t, st.PutBlob(ctx, "abcd", gather.FromSlice([]byte{1, 2, 3, 4}), blob.PutOptions{}))
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.NoError(t, st.GetBlob(ctx, "abcd", 0, -1, &tmp))
+	require.Equal(t, []byte{1, 2, 3, 4}, tmp.ToByteSlice())
+
+	f.corrupt("abcd", []byte{1, 2, 3, 5})
+
+	tmp.Reset()
+	require.ErrorIs(t, st.GetBlob(ctx, "abcd", 0, -1, &tmp), blob.ErrChecksumMismatch)
+
+	// partial reads can't be verified.
+	tmp.Reset()
+	require.NoError(t, st.GetBlob(ctx, "abcd", 0, 2, &tmp))
+}
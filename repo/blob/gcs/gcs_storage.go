@@ -7,6 +7,7 @@
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	gcsclient "cloud.google.com/go/storage"
 	"github.com/pkg/errors"
@@ -28,6 +29,8 @@
 	writerChunkSize = 1 << 20
 
 	timeMapKey = "Kopia-Mtime" // case is important, first letter must be capitalized.
+
+	badCRCErrorMessage = "bad CRC on read"
 )
 
 type gcsStorage struct {
@@ -97,6 +100,9 @@ func translateError(err error) error {
 		return nil
 	case errors.Is(err, gcsclient.ErrObjectNotExist):
 		return blob.ErrBlobNotFound
+	case strings.Contains(err.Error(), badCRCErrorMessage):
+		// the client verifies CRC32C checksum when reading entire objects.
+		return errors.Wrap(blob.ErrChecksumMismatch, err.Error())
 	default:
 		return errors.Wrap(err, "unexpected GCS error")
 	}
@@ -121,6 +127,10 @@ func (gcs *gcsStorage) PutBlob(ctx context.Context, b blob.ID, data blob.Bytes,
 	writer.ContentType = "application/x-kopia"
 	writer.ObjectAttrs.Metadata = timestampmeta.ToMap(opts.SetModTime, timeMapKey)
 
+	// have GCS reject the upload if the data it received does not match the checksum.
+	writer.CRC32C = blob.CRC32C(data)
+	writer.SendCRC32C = true
+
 	err := iocopy.JustCopy(writer, data.Reader())
 	if err != nil {
 		// cancel context before closing the writer causes it to abandon the upload.
@@ -5,6 +5,7 @@
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"strings"
@@ -39,6 +40,10 @@
 	metadataFields     = "name,id,mimeType,size,modifiedTime"
 	listIDFields       = "files(name,id)"
 	listMetadataFields = "files(name,id,mimeType,size,modifiedTime)"
+	checksumFields     = "appProperties"
+
+	// app property holding CRC32C checksum of the file contents.
+	checksumPropertyKey = "kopia-crc32c"
 )
 
 var log = logging.Module("gdrive")
@@ -92,6 +97,10 @@ func (gdrive *gdriveStorage) GetBlob(ctx context.Context, b blob.ID, offset, len
 	}
 	defer res.Body.Close() //nolint:errcheck
 
+	if blob.IsFullRead(offset, length) {
+		return gdrive.readAndVerifyChecksum(ctx, b, fileID, res.Body, output)
+	}
+
 	if length != 0 {
 		if err := iocopy.JustCopy(output, res.Body); err != nil {
 			return errors.Wrapf(translateError(err), "Reading blob in GetBlob(%s)", b)
@@ -101,6 +110,32 @@ func (gdrive *gdriveStorage) GetBlob(ctx context.Context, b blob.ID, offset, len
 	return blob.EnsureLengthExactly(output.Length(), length) //nolint:wrapcheck
 }
 
+// readAndVerifyChecksum reads the entire file and compares its checksum with the one recorded in app properties, if any.
+func (gdrive *gdriveStorage) readAndVerifyChecksum(ctx context.Context, b blob.ID, fileID string, body io.Reader, output blob.OutputBuffer) error {
+	h := blob.NewCRC32C()
+
+	if err := iocopy.JustCopy(io.MultiWriter(output, h), body); err != nil {
+		return errors.Wrapf(translateError(err), "Reading blob in GetBlob(%s)", b)
+	}
+
+	file, err := gdrive.getFileByFileID(ctx, fileID, checksumFields)
+	if err != nil {
+		return errors.Wrapf(err, "get checksum in GetBlob(%s)", b)
+	}
+
+	expected := file.AppProperties[checksumPropertyKey]
+	if expected == "" {
+		// written without checksum.
+		return nil
+	}
+
+	if actual := blob.EncodeCRC32C(h.Sum32()); actual != expected {
+		return blob.ChecksumMismatchError(b, expected, actual)
+	}
+
+	return nil
+}
+
 func (gdrive *gdriveStorage) GetMetadata(ctx context.Context, blobID blob.ID) (blob.Metadata, error) {
 	f, err := gdrive.fileIDCache.Lookup(blobID, func(entry *cacheEntry) (interface{}, error) {
 		if entry.FileID != "" {
@@ -166,12 +201,18 @@ func (gdrive *gdriveStorage) PutBlob(ctx context.Context, blobID blob.ID, data b
 			mtime = opts.SetModTime.Format(time.RFC3339)
 		}
 
+		// Drive does not verify uploads, record the checksum so that downloads can be verified.
+		appProperties := map[string]string{
+			checksumPropertyKey: blob.EncodeCRC32C(blob.CRC32C(data)),
+		}
+
 		if !existingFile {
 			file, err = gdrive.client.Create(&drive.File{
-				Name:         toFileName(blobID),
-				Parents:      []string{gdrive.folderID},
-				MimeType:     blobMimeType,
-				ModifiedTime: mtime,
+				Name:          toFileName(blobID),
+				Parents:       []string{gdrive.folderID},
+				MimeType:      blobMimeType,
+				ModifiedTime:  mtime,
+				AppProperties: appProperties,
 			}).
 				SupportsAllDrives(true).
 				Fields(metadataFields).
@@ -189,7 +230,8 @@ func (gdrive *gdriveStorage) PutBlob(ctx context.Context, blobID blob.ID, data b
 			gdrive.fileIDCache.RecordBlobChange(blobID, file.Id)
 		} else {
 			file, err = gdrive.client.Update(fileID, &drive.File{
-				ModifiedTime: mtime,
+				ModifiedTime:  mtime,
+				AppProperties: appProperties,
 			}).
 				SupportsAllDrives(true).
 				Fields(metadataFields).
@@ -0,0 +1,15 @@
+package mirror
+
+import (
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// Options defines options for mirrored storage.
+type Options struct {
+	// Storages is the list of child storages that hold identical copies of all blobs.
+	Storages []blob.ConnectionInfo `json:"storages"`
+
+	// WriteQuorum is the number of child storages that must acknowledge PutBlob and DeleteBlob
+	// for the operation to succeed. Zero means all child storages.
+	WriteQuorum int `json:"writeQuorum,omitempty"`
+}
@@ -0,0 +1,550 @@
+// Package mirror implements a storage that keeps identical copies of all blobs in several
+// child storages, writing to all of them and reading from the fastest healthy one.
+package mirror
+
+import (
+	"context"
+	stderrors "errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.Module("mirror")
+
+const (
+	mirrorStorageType = "mirror"
+
+	// replicas that failed recently are tried after all healthy ones, until this much time passes.
+	unhealthyReplicaPenalty = 5 * time.Minute
+
+	// weight of the most recent latency sample in the moving average.
+	latencyDecay = 0.2
+)
+
+// ErrQuorumNotReached is returned when a mutation did not succeed on the required number of replicas.
+var ErrQuorumNotReached = errors.New("write quorum not reached")
+
+// replica tracks health and latency of a single child storage.
+type replica struct {
+	index   int
+	storage blob.Storage
+
+	mu sync.Mutex
+	// +checklocks:mu
+	avgLatency time.Duration
+	// +checklocks:mu
+	lastFailure time.Time
+}
+
+func (r *replica) recordSuccess(dur time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.avgLatency == 0 {
+		r.avgLatency = dur
+	} else {
+		r.avgLatency = time.Duration(latencyDecay*float64(dur) + (1-latencyDecay)*float64(r.avgLatency))
+	}
+
+	r.lastFailure = time.Time{}
+}
+
+func (r *replica) recordFailure() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastFailure = clock.Now()
+}
+
+// healthScore returns values used for ordering replicas - healthy first, then fastest first.
+func (r *replica) healthScore(now time.Time) (healthy bool, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lastFailure.IsZero() || now.Sub(r.lastFailure) > unhealthyReplicaPenalty, r.avgLatency
+}
+
+type mirrorStorage struct {
+	Options
+
+	replicas    []*replica
+	writeQuorum int
+}
+
+// readOrder returns replicas ordered by preference for reading.
+func (s *mirrorStorage) readOrder() []*replica {
+	type scored struct {
+		r       *replica
+		healthy bool
+		latency time.Duration
+	}
+
+	now := clock.Now()
+
+	var sc []scored
+
+	for _, r := range s.replicas {
+		h, l := r.healthScore(now)
+		sc = append(sc, scored{r, h, l})
+	}
+
+	sort.SliceStable(sc, func(i, j int) bool {
+		if sc[i].healthy != sc[j].healthy {
+			return sc[i].healthy
+		}
+
+		return sc[i].latency < sc[j].latency
+	})
+
+	result := make([]*replica, len(sc))
+	for i, v := range sc {
+		result[i] = v.r
+	}
+
+	return result
+}
+
+// isReplicaFailure determines whether the error indicates a problem with the replica itself
+// as opposed to a legitimate result of the operation.
+func isReplicaFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return !errors.Is(err, blob.ErrBlobNotFound) && !errors.Is(err, blob.ErrInvalidRange) && !errors.Is(err, context.Canceled)
+}
+
+// readFromReplicas invokes the provided function on replicas in the order of preference until one of them
+// succeeds or returns a definitive error. Not-found errors fall back to other replicas, since a replica
+// may have missed a write that did not require it for quorum.
+func (s *mirrorStorage) readFromReplicas(ctx context.Context, desc string, blobID blob.ID, f func(r *replica) error) error {
+	var lastErr error
+
+	for _, r := range s.readOrder() {
+		t0 := clock.Now()
+		err := f(r)
+
+		switch {
+		case err == nil:
+			r.recordSuccess(clock.Now().Sub(t0))
+			return nil
+
+		case errors.Is(err, blob.ErrBlobNotFound):
+			r.recordSuccess(clock.Now().Sub(t0))
+
+			if lastErr == nil {
+				lastErr = err
+			}
+
+		case errors.Is(err, blob.ErrInvalidRange):
+			return err
+
+		default:
+			if ctx.Err() != nil {
+				return errors.Wrapf(ctx.Err(), "%v %v", desc, blobID)
+			}
+
+			log(ctx).Warnf("%v %v failed on replica %v, trying next one: %v", desc, blobID, r.storage.DisplayName(), err)
+			r.recordFailure()
+
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+func (s *mirrorStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	return s.readFromReplicas(ctx, "GetBlob", id, func(r *replica) error {
+		output.Reset()
+
+		//nolint:wrapcheck
+		return r.storage.GetBlob(ctx, id, offset, length, output)
+	})
+}
+
+func (s *mirrorStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	var result blob.Metadata
+
+	err := s.readFromReplicas(ctx, "GetMetadata", id, func(r *replica) error {
+		m, err := r.storage.GetMetadata(ctx, id)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		result = m
+
+		return nil
+	})
+
+	return result, err
+}
+
+// writeToReplicas invokes the provided mutation on all replicas in parallel and returns
+// an error unless at least writeQuorum of them succeeded.
+func (s *mirrorStorage) writeToReplicas(ctx context.Context, desc string, blobID blob.ID, f func(r *replica) error) error {
+	errs := make([]error, len(s.replicas))
+
+	var wg sync.WaitGroup
+
+	for i, r := range s.replicas {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			t0 := clock.Now()
+			errs[i] = f(r)
+
+			if isReplicaFailure(errs[i]) {
+				r.recordFailure()
+			} else {
+				r.recordSuccess(clock.Now().Sub(t0))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	succeeded := 0
+
+	var failures []error
+
+	for i, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+
+		if errors.Is(err, blob.ErrBlobAlreadyExists) {
+			return err
+		}
+
+		failures = append(failures, errors.Wrapf(err, "replica %v", s.replicas[i].storage.DisplayName()))
+	}
+
+	if succeeded >= s.writeQuorum {
+		if len(failures) > 0 {
+			log(ctx).Warnf("%v %v succeeded on %v of %v replicas: %v", desc, blobID, succeeded, len(s.replicas), stderrors.Join(failures...))
+		}
+
+		return nil
+	}
+
+	if succeeded == 0 && len(failures) == len(s.replicas) {
+		// when all replicas agree on the failure, report it as-is so that callers can inspect it.
+		return errors.Wrapf(failures[0], "%v %v", desc, blobID)
+	}
+
+	return errors.Wrapf(ErrQuorumNotReached, "%v %v succeeded on %v of %v replicas (required %v): %v", desc, blobID, succeeded, len(s.replicas), s.writeQuorum, stderrors.Join(failures...))
+}
+
+func (s *mirrorStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	modTimes := make([]time.Time, len(s.replicas))
+
+	err := s.writeToReplicas(ctx, "PutBlob", id, func(r *replica) error {
+		o := opts
+		if o.GetModTime != nil {
+			o.GetModTime = &modTimes[r.index]
+		}
+
+		//nolint:wrapcheck
+		return r.storage.PutBlob(ctx, id, data, o)
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.GetModTime != nil {
+		// report the latest modification time among replicas.
+		for _, t := range modTimes {
+			if t.After(*opts.GetModTime) {
+				*opts.GetModTime = t
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *mirrorStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	return s.writeToReplicas(ctx, "DeleteBlob", id, func(r *replica) error {
+		err := r.storage.DeleteBlob(ctx, id)
+		if errors.Is(err, blob.ErrBlobNotFound) {
+			return nil
+		}
+
+		return err //nolint:wrapcheck
+	})
+}
+
+func (s *mirrorStorage) ExtendBlobRetention(ctx context.Context, id blob.ID, opts blob.ExtendOptions) error {
+	return s.writeToReplicas(ctx, "ExtendBlobRetention", id, func(r *replica) error {
+		//nolint:wrapcheck
+		return r.storage.ExtendBlobRetention(ctx, id, opts)
+	})
+}
+
+// ListBlobs lists blobs in all replicas and reports the union of the results.
+// Listing succeeds as long as enough replicas were listed to guarantee that every blob written
+// with the write quorum is included. Blobs that are missing or different on some replicas are logged.
+func (s *mirrorStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	if len(s.replicas) == 1 {
+		//nolint:wrapcheck
+		return s.replicas[0].storage.ListBlobs(ctx, prefix, callback)
+	}
+
+	listings := make([]map[blob.ID]blob.Metadata, len(s.replicas))
+	errs := make([]error, len(s.replicas))
+
+	var wg sync.WaitGroup
+
+	for i, r := range s.replicas {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			m := map[blob.ID]blob.Metadata{}
+
+			errs[i] = r.storage.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+				m[bm.BlobID] = bm
+				return nil
+			})
+
+			if errs[i] != nil {
+				r.recordFailure()
+				return
+			}
+
+			listings[i] = m
+		}()
+	}
+
+	wg.Wait()
+
+	var failures []error
+
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, errors.Wrapf(err, "replica %v", s.replicas[i].storage.DisplayName()))
+		}
+	}
+
+	// any read quorum of this size is guaranteed to overlap with every write quorum.
+	readQuorum := len(s.replicas) - s.writeQuorum + 1
+
+	if succeeded := len(s.replicas) - len(failures); succeeded < readQuorum {
+		return errors.Wrapf(stderrors.Join(failures...), "ListBlobs(%v) succeeded on %v of %v replicas (required %v)", prefix, succeeded, len(s.replicas), readQuorum)
+	}
+
+	merged, divergent := mergeListings(listings)
+	if divergent > 0 {
+		log(ctx).Warnf("mirror replicas diverged on %v blob(s) with prefix %q", divergent, prefix)
+	}
+
+	for _, bm := range merged {
+		if err := callback(bm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeListings returns the union of the provided listings (nil entries are skipped), preferring the
+// most recent version of each blob, and the number of blobs that are not identical in all listings.
+func mergeListings(listings []map[blob.ID]blob.Metadata) (merged []blob.Metadata, divergent int) {
+	var listed int
+
+	union := map[blob.ID]blob.Metadata{}
+	counts := map[blob.ID]int{}
+	mismatched := map[blob.ID]bool{}
+
+	for _, l := range listings {
+		if l == nil {
+			continue
+		}
+
+		listed++
+
+		for id, bm := range l {
+			counts[id]++
+
+			prev, ok := union[id]
+			if !ok {
+				union[id] = bm
+				continue
+			}
+
+			if prev.Length != bm.Length {
+				mismatched[id] = true
+			}
+
+			if bm.Timestamp.After(prev.Timestamp) {
+				union[id] = bm
+			}
+		}
+	}
+
+	for id, bm := range union {
+		if counts[id] != listed || mismatched[id] {
+			divergent++
+		}
+
+		merged = append(merged, bm)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].BlobID < merged[j].BlobID
+	})
+
+	return merged, divergent
+}
+
+// GetCapacity returns the smallest capacity among replicas that are volumes.
+func (s *mirrorStorage) GetCapacity(ctx context.Context) (blob.Capacity, error) {
+	var (
+		result blob.Capacity
+		found  bool
+	)
+
+	for _, r := range s.replicas {
+		c, err := r.storage.GetCapacity(ctx)
+		if errors.Is(err, blob.ErrNotAVolume) {
+			continue
+		}
+
+		if err != nil {
+			return blob.Capacity{}, errors.Wrapf(err, "replica %v", r.storage.DisplayName())
+		}
+
+		if !found || c.FreeB < result.FreeB {
+			result = c
+			found = true
+		}
+	}
+
+	if !found {
+		return blob.Capacity{}, blob.ErrNotAVolume
+	}
+
+	return result, nil
+}
+
+// IsReadOnly returns true when the number of writable replicas is below the write quorum.
+func (s *mirrorStorage) IsReadOnly() bool {
+	writable := 0
+
+	for _, r := range s.replicas {
+		if !r.storage.IsReadOnly() {
+			writable++
+		}
+	}
+
+	return writable < s.writeQuorum
+}
+
+func (s *mirrorStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   mirrorStorageType,
+		Config: &s.Options,
+	}
+}
+
+func (s *mirrorStorage) DisplayName() string {
+	var names []string
+
+	for _, r := range s.replicas {
+		names = append(names, r.storage.DisplayName())
+	}
+
+	return "Mirror: " + strings.Join(names, ", ")
+}
+
+func (s *mirrorStorage) Close(ctx context.Context) error {
+	var err error
+
+	for _, r := range s.replicas {
+		err = stderrors.Join(err, r.storage.Close(ctx))
+	}
+
+	return errors.Wrap(err, "error closing replicas")
+}
+
+func (s *mirrorStorage) FlushCaches(ctx context.Context) error {
+	var err error
+
+	for _, r := range s.replicas {
+		err = stderrors.Join(err, r.storage.FlushCaches(ctx))
+	}
+
+	return errors.Wrap(err, "error flushing replica caches")
+}
+
+func newMirrorStorage(opt *Options, children []blob.Storage) (*mirrorStorage, error) {
+	if len(children) == 0 {
+		return nil, errors.New("at least one storage must be specified")
+	}
+
+	q := opt.WriteQuorum
+	if q == 0 {
+		q = len(children)
+	}
+
+	if q < 0 || q > len(children) {
+		return nil, errors.Errorf("invalid write quorum %v, must be between 1 and %v", q, len(children))
+	}
+
+	s := &mirrorStorage{
+		Options:     *opt,
+		writeQuorum: q,
+	}
+
+	for i, c := range children {
+		s.replicas = append(s.replicas, &replica{index: i, storage: c})
+	}
+
+	return s, nil
+}
+
+// New creates new mirrored storage with the specified child storages.
+func New(ctx context.Context, opt *Options, isCreate bool) (blob.Storage, error) {
+	var children []blob.Storage
+
+	closeAll := func() {
+		for _, c := range children {
+			c.Close(ctx) //nolint:errcheck
+		}
+	}
+
+	for i, ci := range opt.Storages {
+		st, err := blob.NewStorage(ctx, ci, isCreate)
+		if err != nil {
+			closeAll()
+			return nil, errors.Wrapf(err, "unable to open mirror storage #%v", i)
+		}
+
+		children = append(children, st)
+	}
+
+	s, err := newMirrorStorage(opt, children)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func init() {
+	blob.AddSupportedStorage(mirrorStorageType, Options{}, New)
+}
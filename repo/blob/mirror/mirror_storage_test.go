@@ -0,0 +1,136 @@
+package mirror
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+)
+
+func TestMirrorStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	var opt Options
+
+	for range 3 {
+		opt.Storages = append(opt.Storages, blob.ConnectionInfo{
+			Type:   "filesystem",
+			Config: &filesystem.Options{Path: testutil.TempDirectory(t)},
+		})
+	}
+
+	st, err := New(ctx, &opt, true)
+	require.NoError(t, err)
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+
+	require.NoError(t, st.Close(ctx))
+}
+
+func TestMirrorStorageInvalidQuorum(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	_, err := New(ctx, &Options{}, true)
+	require.Error(t, err)
+
+	_, err = newMirrorStorage(&Options{WriteQuorum: 3}, []blob.Storage{
+		blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil),
+		blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil),
+	})
+	require.Error(t, err)
+}
+
+func TestMirrorStorageWriteQuorum(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	d1, d2, d3 := blobtesting.DataMap{}, blobtesting.DataMap{}, blobtesting.DataMap{}
+
+	fs1 := blobtesting.NewFaultyStorage(blobtesting.NewMapStorage(d1, nil, nil))
+	fs2 := blobtesting.NewFaultyStorage(blobtesting.NewMapStorage(d2, nil, nil))
+	fs3 := blobtesting.NewFaultyStorage(blobtesting.NewMapStorage(d3, nil, nil))
+
+	st, err := newMirrorStorage(&Options{WriteQuorum: 2}, []blob.Storage{fs1, fs2, fs3})
+	require.NoError(t, err)
+
+	someErr := errors.New("some error")
+
+	// one failure is tolerated.
+	fs1.AddFault(blobtesting.MethodPutBlob).ErrorInstead(someErr)
+	require.NoError(t, st.PutBlob(ctx, "blob1", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+	require.NotContains(t, d1, blob.ID("blob1"))
+	require.Contains(t, d2, blob.ID("blob1"))
+	require.Contains(t, d3, blob.ID("blob1"))
+
+	// two failures are not.
+	fs1.AddFault(blobtesting.MethodPutBlob).ErrorInstead(someErr)
+	fs2.AddFault(blobtesting.MethodPutBlob).ErrorInstead(someErr)
+	require.ErrorIs(t, st.PutBlob(ctx, "blob2", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}), ErrQuorumNotReached)
+
+	// the blob missing on the first replica is read from another one.
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.NoError(t, st.GetBlob(ctx, "blob1", 0, -1, &tmp))
+	require.Equal(t, []byte{1, 2, 3}, tmp.ToByteSlice())
+
+	// listing reports the union of all replicas.
+	blobtesting.AssertListResults(ctx, t, st, "blob", "blob1", "blob2")
+}
+
+func TestMirrorStorageReadFallback(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	// populate replicas directly, so that neither has latency statistics and they are tried in order.
+	fs1 := blobtesting.NewFaultyStorage(blobtesting.NewMapStorage(blobtesting.DataMap{"blob1": {1, 2, 3}}, nil, nil))
+	fs2 := blobtesting.NewFaultyStorage(blobtesting.NewMapStorage(blobtesting.DataMap{"blob1": {1, 2, 3}}, nil, nil))
+
+	st, err := newMirrorStorage(&Options{}, []blob.Storage{fs1, fs2})
+	require.NoError(t, err)
+
+	someErr := errors.New("some error")
+
+	fs1.AddFault(blobtesting.MethodGetBlob).ErrorInstead(someErr)
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	// first read fails on one replica and falls back to the other.
+	require.NoError(t, st.GetBlob(ctx, "blob1", 0, -1, &tmp))
+	require.Equal(t, []byte{1, 2, 3}, tmp.ToByteSlice())
+
+	// the failed replica is now ordered last.
+	order := st.readOrder()
+	require.Len(t, order, 2)
+	require.Equal(t, fs1, order[1].storage)
+
+	healthy, _ := order[1].healthScore(clock.Now())
+	require.False(t, healthy)
+
+	// with write quorum of all replicas, listing a single replica is sufficient.
+	fs2.AddFault(blobtesting.MethodListBlobs).ErrorInstead(someErr)
+	blobtesting.AssertListResults(ctx, t, st, "", "blob1")
+
+	// with write quorum of one replica, all replicas must be listed.
+	st1, err := newMirrorStorage(&Options{WriteQuorum: 1}, []blob.Storage{fs1, fs2})
+	require.NoError(t, err)
+
+	fs2.AddFault(blobtesting.MethodListBlobs).ErrorInstead(someErr)
+	require.ErrorIs(t, st1.ListBlobs(ctx, "", func(blob.Metadata) error { return nil }), someErr)
+}
@@ -0,0 +1,457 @@
+// Package quota implements wrapper around blob.Storage that enforces limits on total size of stored blobs.
+package quota
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/atomicfile"
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.Module("quota")
+
+// Limits describes storage quota limits.
+type Limits struct {
+	// SoftLimitBytes causes a warning to be logged when total size of blobs exceeds it.
+	SoftLimitBytes int64 `json:"softLimitBytes,omitempty"`
+
+	// HardLimitBytes causes writes of restricted blobs to fail when they would cause total size of blobs to exceed it.
+	HardLimitBytes int64 `json:"hardLimitBytes,omitempty"`
+}
+
+// IsEmpty returns true if no limits are set.
+func (l Limits) IsEmpty() bool {
+	return l.SoftLimitBytes <= 0 && l.HardLimitBytes <= 0
+}
+
+// LimitExceededError is returned by PutBlob when writing a restricted blob would exceed the hard limit.
+type LimitExceededError struct {
+	BlobID         blob.ID
+	BlobLength     int64
+	UsedBytes      int64
+	HardLimitBytes int64
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("storage quota exceeded: writing %v (%v) would exceed hard limit of %v (currently used %v)",
+		e.BlobID, units.BytesString(e.BlobLength), units.BytesString(e.HardLimitBytes), units.BytesString(e.UsedBytes))
+}
+
+// IsLimitExceeded returns true if the provided error indicates that the hard storage quota has been exceeded.
+func IsLimitExceeded(err error) bool {
+	var le *LimitExceededError
+
+	return errors.As(err, &le)
+}
+
+// DefaultUsageCacheDuration is the default duration for which the cached storage usage is trusted.
+const DefaultUsageCacheDuration = time.Hour
+
+// Options provides options for the quota wrapper.
+type Options struct {
+	// RestrictedPrefixes are the prefixes of blobs whose writes are rejected once the hard limit would be exceeded.
+	RestrictedPrefixes []blob.ID
+
+	// UsageCacheFile is the file where total storage usage is cached between uses of the storage,
+	// to avoid listing all blobs each time. Usage is not cached when empty.
+	UsageCacheFile string
+
+	// UsageCacheDuration is the duration after which the cached usage is no longer trusted.
+	UsageCacheDuration time.Duration
+}
+
+// cachedUsage is stored in the usage cache file.
+type cachedUsage struct {
+	UsedBytes int64     `json:"usedBytes"`
+	Time      time.Time `json:"time"`
+}
+
+// inFlightWrite describes writes of a blob which have not completed yet.
+type inFlightWrite struct {
+	maxLength int64
+	count     int
+}
+
+type quotaStorage struct {
+	blob.Storage
+
+	limits Limits
+	opt    Options
+
+	mu sync.Mutex
+	// +checklocks:mu
+	usageLoaded bool
+	// +checklocks:mu
+	usedBytes int64
+	// sizes of blobs, which is incomplete when the usage was loaded from the cache.
+	// +checklocks:mu
+	blobSizes map[blob.ID]int64
+	// +checklocks:mu
+	allSizesKnown bool
+	// set when usage may be overestimated, in which case it's not cached.
+	// +checklocks:mu
+	usageInexact bool
+	// +checklocks:mu
+	inFlight map[blob.ID]*inFlightWrite
+	// +checklocks:mu
+	softLimitWarned bool
+}
+
+func (s *quotaStorage) isRestricted(id blob.ID) bool {
+	for _, p := range s.opt.RestrictedPrefixes {
+		if strings.HasPrefix(string(id), string(p)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ensureUsageLoadedLocked determines the storage usage on first use, from the cache if possible.
+//
+// +checklocks:s.mu
+func (s *quotaStorage) ensureUsageLoadedLocked(ctx context.Context) error {
+	if s.usageLoaded {
+		return nil
+	}
+
+	if u, ok := s.readCachedUsage(ctx); ok {
+		// the cache is taken out while in use, so that if this process crashes before updating it,
+		// its writes are not missing from the usage next time.
+		s.removeCachedUsage(ctx)
+
+		s.usedBytes = u.UsedBytes
+		s.usageLoaded = true
+
+		s.checkSoftLimitLocked(ctx)
+
+		return nil
+	}
+
+	var used int64
+
+	if err := s.Storage.ListBlobs(ctx, "", func(bm blob.Metadata) error {
+		s.blobSizes[bm.BlobID] = bm.Length
+		used += bm.Length
+
+		return nil
+	}); err != nil {
+		clear(s.blobSizes)
+
+		return errors.Wrap(err, "unable to determine storage usage")
+	}
+
+	s.usedBytes = used
+	s.allSizesKnown = true
+	s.usageLoaded = true
+
+	s.checkSoftLimitLocked(ctx)
+
+	return nil
+}
+
+func (s *quotaStorage) readCachedUsage(ctx context.Context) (cachedUsage, bool) {
+	var u cachedUsage
+
+	if s.opt.UsageCacheFile == "" {
+		return u, false
+	}
+
+	b, err := os.ReadFile(s.opt.UsageCacheFile)
+	if err != nil {
+		return u, false
+	}
+
+	if err := json.Unmarshal(b, &u); err != nil {
+		log(ctx).Debugf("invalid storage usage cache %v: %v", s.opt.UsageCacheFile, err)
+		return u, false
+	}
+
+	if age := clock.Now().Sub(u.Time); age < 0 || age > s.opt.UsageCacheDuration {
+		return u, false
+	}
+
+	return u, true
+}
+
+func (s *quotaStorage) removeCachedUsage(ctx context.Context) {
+	if s.opt.UsageCacheFile == "" {
+		return
+	}
+
+	if err := os.Remove(s.opt.UsageCacheFile); err != nil && !os.IsNotExist(err) {
+		log(ctx).Debugf("unable to remove storage usage cache: %v", err)
+	}
+}
+
+// +checklocksread:s.mu
+func (s *quotaStorage) writeCachedUsageLocked(ctx context.Context) {
+	b, err := json.Marshal(cachedUsage{UsedBytes: s.usedBytes, Time: clock.Now()})
+	if err == nil {
+		err = atomicfile.Write(s.opt.UsageCacheFile, bytes.NewReader(b))
+	}
+
+	if err != nil {
+		log(ctx).Debugf("unable to write storage usage cache: %v", err)
+	}
+}
+
+// lookupUnknownSize determines the size of a blob which is not known because the usage was loaded
+// from the cache, so that overwriting or deleting an existing blob is accounted for correctly.
+func (s *quotaStorage) lookupUnknownSize(ctx context.Context, id blob.ID) {
+	s.mu.Lock()
+	_, known := s.blobSizes[id]
+	unknown := s.usageLoaded && !s.allSizesKnown && !known
+	s.mu.Unlock()
+
+	if !unknown {
+		return
+	}
+
+	var length int64
+
+	bm, err := s.Storage.GetMetadata(ctx, id)
+
+	switch {
+	case err == nil:
+		length = bm.Length
+
+	case !errors.Is(err, blob.ErrBlobNotFound):
+		log(ctx).Debugf("unable to determine size of %v: %v", id, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.blobSizes[id]; !ok {
+		s.blobSizes[id] = length
+	}
+}
+
+// effectiveSizeLocked returns the size of the blob accounted for in the usage, which includes
+// the largest of its in-flight writes.
+//
+// +checklocksread:s.mu
+func (s *quotaStorage) effectiveSizeLocked(id blob.ID) int64 {
+	size := s.blobSizes[id]
+
+	if w := s.inFlight[id]; w != nil {
+		size = max(size, w.maxLength)
+	}
+
+	return size
+}
+
+// reserve atomically checks the limits and accounts for the new blob length until the write completes.
+func (s *quotaStorage) reserve(ctx context.Context, id blob.ID, length int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.ensureUsageLoadedLocked(ctx); err != nil {
+		return err
+	}
+
+	if _, ok := s.blobSizes[id]; !ok && !s.allSizesKnown {
+		// the blob may exist with unknown size, in which case usage is overestimated.
+		s.usageInexact = true
+	}
+
+	before := s.effectiveSizeLocked(id)
+	delta := max(length-before, 0)
+
+	if s.limits.HardLimitBytes > 0 && delta > 0 && s.usedBytes+delta > s.limits.HardLimitBytes && s.isRestricted(id) {
+		return &LimitExceededError{
+			BlobID:         id,
+			BlobLength:     length,
+			UsedBytes:      s.usedBytes,
+			HardLimitBytes: s.limits.HardLimitBytes,
+		}
+	}
+
+	w := s.inFlight[id]
+	if w == nil {
+		w = &inFlightWrite{}
+		s.inFlight[id] = w
+	}
+
+	w.count++
+	w.maxLength = max(w.maxLength, length)
+
+	s.usedBytes += delta
+
+	return nil
+}
+
+// finish completes the write reserved by reserve, updating the size of the blob if it succeeded.
+func (s *quotaStorage) finish(ctx context.Context, id blob.ID, length int64, succeeded bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := s.effectiveSizeLocked(id)
+
+	if succeeded {
+		s.blobSizes[id] = length
+	}
+
+	if w := s.inFlight[id]; w != nil {
+		if w.count--; w.count == 0 {
+			delete(s.inFlight, id)
+		}
+	}
+
+	s.usedBytes += s.effectiveSizeLocked(id) - before
+
+	s.checkSoftLimitLocked(ctx)
+}
+
+// +checklocks:s.mu
+func (s *quotaStorage) checkSoftLimitLocked(ctx context.Context) {
+	if s.limits.SoftLimitBytes <= 0 {
+		return
+	}
+
+	if s.usedBytes <= s.limits.SoftLimitBytes {
+		s.softLimitWarned = false
+		return
+	}
+
+	if !s.softLimitWarned {
+		s.softLimitWarned = true
+
+		log(ctx).Warnf("Storage usage %v exceeds soft limit of %v.", units.BytesString(s.usedBytes), units.BytesString(s.limits.SoftLimitBytes))
+	}
+}
+
+func (s *quotaStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	length := int64(data.Length())
+
+	s.mu.Lock()
+	err := s.ensureUsageLoadedLocked(ctx)
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	s.lookupUnknownSize(ctx, id)
+
+	if err := s.reserve(ctx, id, length); err != nil {
+		return err
+	}
+
+	err = s.Storage.PutBlob(ctx, id, data, opts)
+
+	s.finish(ctx, id, length, err == nil)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *quotaStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	s.lookupUnknownSize(ctx, id)
+
+	if err := s.Storage.DeleteBlob(ctx, id); err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.usageLoaded {
+		// the cached usage no longer reflects the storage.
+		s.removeCachedUsage(ctx)
+		return nil
+	}
+
+	if _, ok := s.blobSizes[id]; !ok && !s.allSizesKnown {
+		// the size of blobs which existed when usage was loaded from the cache is unknown,
+		// so usage is overestimated until it is determined again by listing all blobs.
+		s.usageInexact = true
+		return nil
+	}
+
+	before := s.effectiveSizeLocked(id)
+
+	delete(s.blobSizes, id)
+
+	s.usedBytes += s.effectiveSizeLocked(id) - before
+
+	s.checkSoftLimitLocked(ctx)
+
+	return nil
+}
+
+func (s *quotaStorage) GetCapacity(ctx context.Context) (blob.Capacity, error) {
+	limit := s.limits.HardLimitBytes
+	if limit <= 0 {
+		limit = s.limits.SoftLimitBytes
+	}
+
+	s.mu.Lock()
+	err := s.ensureUsageLoadedLocked(ctx)
+	used := s.usedBytes
+	s.mu.Unlock()
+
+	if err != nil {
+		return blob.Capacity{}, err
+	}
+
+	c := blob.Capacity{
+		SizeB: uint64(limit),
+		FreeB: uint64(max(limit-used, 0)),
+	}
+
+	// the underlying volume may have less space available than the quota allows.
+	if bc, err := s.Storage.GetCapacity(ctx); err == nil && bc.FreeB < c.FreeB {
+		c.FreeB = bc.FreeB
+	}
+
+	return c, nil
+}
+
+func (s *quotaStorage) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.usageLoaded && !s.usageInexact && s.opt.UsageCacheFile != "" {
+		s.writeCachedUsageLocked(ctx)
+	}
+	s.mu.Unlock()
+
+	//nolint:wrapcheck
+	return s.Storage.Close(ctx)
+}
+
+// NewWrapper returns a Storage wrapper that tracks total size of all blobs in the underlying storage
+// and enforces the provided limits. Writes of blobs with any of the restricted prefixes are rejected
+// with LimitExceededError once the hard limit would be exceeded, other writes and all deletions
+// are always allowed so that the storage can be cleaned up.
+//
+// The usage is determined by listing all blobs when it's first needed, unless it has been cached
+// recently, in which case sizes of existing blobs are looked up before they are overwritten or deleted.
+// Usage written by other clients since it was cached is not accounted for.
+func NewWrapper(wrapped blob.Storage, limits Limits, opt Options) blob.Storage {
+	if opt.UsageCacheDuration <= 0 {
+		opt.UsageCacheDuration = DefaultUsageCacheDuration
+	}
+
+	return &quotaStorage{
+		Storage:   wrapped,
+		limits:    limits,
+		opt:       opt,
+		blobSizes: map[blob.ID]int64{},
+		inFlight:  map[blob.ID]*inFlightWrite{},
+	}
+}
@@ -0,0 +1,208 @@
+package quota_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/quota"
+)
+
+func TestQuotaStorage(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	data := blobtesting.DataMap{
+		"pexisting": make([]byte, 500),
+		"xindex":    make([]byte, 100),
+	}
+
+	st := quota.NewWrapper(blobtesting.NewMapStorage(data, nil, nil), quota.Limits{
+		SoftLimitBytes: 800,
+		HardLimitBytes: 1000,
+	}, quota.Options{RestrictedPrefixes: []blob.ID{"p"}})
+
+	verifyCapacity := func(wantFree uint64) {
+		t.Helper()
+
+		c, err := st.GetCapacity(ctx)
+		require.NoError(t, err)
+		require.Equal(t, blob.Capacity{SizeB: 1000, FreeB: wantFree}, c)
+	}
+
+	verifyCapacity(400)
+
+	// pack blob fits under the hard limit.
+	require.NoError(t, st.PutBlob(ctx, "p1", gather.FromSlice(make([]byte, 300)), blob.PutOptions{}))
+	verifyCapacity(100)
+
+	// pack blob exceeding hard limit is rejected.
+	err := st.PutBlob(ctx, "p2", gather.FromSlice(make([]byte, 200)), blob.PutOptions{})
+
+	var le *quota.LimitExceededError
+
+	require.ErrorAs(t, err, &le)
+	require.True(t, quota.IsLimitExceeded(err))
+	require.Equal(t, blob.ID("p2"), le.BlobID)
+	require.Equal(t, int64(900), le.UsedBytes)
+	require.NotContains(t, data, blob.ID("p2"))
+	verifyCapacity(100)
+
+	// non-pack blobs are always allowed.
+	require.NoError(t, st.PutBlob(ctx, "xindex2", gather.FromSlice(make([]byte, 200)), blob.PutOptions{}))
+	verifyCapacity(0)
+
+	// overwriting with a smaller blob reduces usage.
+	require.NoError(t, st.PutBlob(ctx, "xindex2", gather.FromSlice(make([]byte, 50)), blob.PutOptions{}))
+	verifyCapacity(50)
+
+	// deletions are allowed and free up space.
+	require.NoError(t, st.DeleteBlob(ctx, "pexisting"))
+	verifyCapacity(550)
+
+	require.NoError(t, st.PutBlob(ctx, "p2", gather.FromSlice(make([]byte, 200)), blob.PutOptions{}))
+	verifyCapacity(350)
+
+	// deleting non-existent blob does not change usage.
+	require.NoError(t, st.DeleteBlob(ctx, "pnonexistent"))
+	verifyCapacity(350)
+}
+
+func TestQuotaStorageFailedPutReleasesReservation(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	fs := blobtesting.NewFaultyStorage(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil))
+
+	st := quota.NewWrapper(fs, quota.Limits{HardLimitBytes: 100}, quota.Options{RestrictedPrefixes: []blob.ID{"p"}})
+
+	someErr := blob.ErrBlobAlreadyExists
+
+	fs.AddFault(blobtesting.MethodPutBlob).ErrorInstead(someErr)
+
+	require.ErrorIs(t, st.PutBlob(ctx, "p1", gather.FromSlice(make([]byte, 100)), blob.PutOptions{}), someErr)
+	require.NoError(t, st.PutBlob(ctx, "p1", gather.FromSlice(make([]byte, 100)), blob.PutOptions{}))
+}
+
+func TestQuotaStorageListError(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	fs := blobtesting.NewFaultyStorage(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil))
+	fs.AddFault(blobtesting.MethodListBlobs).ErrorInstead(blob.ErrBlobNotFound)
+
+	st := quota.NewWrapper(fs, quota.Limits{HardLimitBytes: 100}, quota.Options{RestrictedPrefixes: []blob.ID{"p"}})
+
+	// usage is determined on first use.
+	require.ErrorIs(t, st.PutBlob(ctx, "p1", gather.FromSlice(make([]byte, 10)), blob.PutOptions{}), blob.ErrBlobNotFound)
+	require.NoError(t, st.PutBlob(ctx, "p1", gather.FromSlice(make([]byte, 10)), blob.PutOptions{}))
+}
+
+func TestQuotaStorageConcurrentWrites(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	st := quota.NewWrapper(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), quota.Limits{
+		HardLimitBytes: 1000,
+	}, quota.Options{RestrictedPrefixes: []blob.ID{"p"}})
+
+	var eg errgroup.Group
+
+	// concurrent writes of the same blob are only counted once.
+	for range 10 {
+		eg.Go(func() error {
+			return st.PutBlob(ctx, "p1", gather.FromSlice(make([]byte, 100)), blob.PutOptions{})
+		})
+	}
+
+	require.NoError(t, eg.Wait())
+
+	c, err := st.GetCapacity(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(900), c.FreeB)
+
+	// concurrent writes of different blobs can't exceed the hard limit together.
+	var failed atomic.Int32
+
+	for i := range 20 {
+		eg.Go(func() error {
+			if err := st.PutBlob(ctx, blob.ID(fmt.Sprintf("p%v", i+2)), gather.FromSlice(make([]byte, 100)), blob.PutOptions{}); quota.IsLimitExceeded(err) {
+				failed.Add(1)
+			}
+
+			return nil
+		})
+	}
+
+	require.NoError(t, eg.Wait())
+	require.Equal(t, int32(11), failed.Load())
+
+	c, err = st.GetCapacity(ctx)
+	require.NoError(t, err)
+	require.Zero(t, c.FreeB)
+}
+
+func TestQuotaStorageUsageCache(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	data := blobtesting.DataMap{
+		"pexisting": make([]byte, 500),
+	}
+
+	fs := blobtesting.NewFaultyStorage(blobtesting.NewMapStorage(data, nil, nil))
+	opt := quota.Options{
+		RestrictedPrefixes: []blob.ID{"p"},
+		UsageCacheFile:     filepath.Join(testutil.TempDirectory(t), "usage.json"),
+	}
+
+	verifyFree := func(st blob.Storage, want uint64) {
+		t.Helper()
+
+		c, err := st.GetCapacity(ctx)
+		require.NoError(t, err)
+		require.Equal(t, want, c.FreeB)
+	}
+
+	st := quota.NewWrapper(fs, quota.Limits{HardLimitBytes: 1000}, opt)
+	require.NoError(t, st.PutBlob(ctx, "p1", gather.FromSlice(make([]byte, 100)), blob.PutOptions{}))
+	verifyFree(st, 400)
+	require.NoError(t, st.Close(ctx))
+
+	// the cached usage is used instead of listing blobs.
+	fs.AddFault(blobtesting.MethodListBlobs).ErrorInstead(blob.ErrBlobNotFound)
+
+	st = quota.NewWrapper(fs, quota.Limits{HardLimitBytes: 1000}, opt)
+	verifyFree(st, 400)
+
+	// blobs written in the same session are accounted for when deleted.
+	require.NoError(t, st.PutBlob(ctx, "p2", gather.FromSlice(make([]byte, 100)), blob.PutOptions{}))
+	require.NoError(t, st.DeleteBlob(ctx, "p2"))
+	verifyFree(st, 400)
+
+	// sizes of blobs which existed when the usage was cached are looked up before overwriting or deleting them.
+	require.NoError(t, st.PutBlob(ctx, "p1", gather.FromSlice(make([]byte, 150)), blob.PutOptions{}))
+	verifyFree(st, 350)
+	require.NoError(t, st.DeleteBlob(ctx, "pexisting"))
+	verifyFree(st, 850)
+	require.NoError(t, st.Close(ctx))
+
+	st = quota.NewWrapper(fs, quota.Limits{HardLimitBytes: 1000}, opt)
+	verifyFree(st, 850)
+
+	// when the size can't be determined, usage is overestimated and not cached.
+	fs.AddFault(blobtesting.MethodGetMetadata).ErrorInstead(errors.New("some error"))
+	require.NoError(t, st.PutBlob(ctx, "p1", gather.FromSlice(make([]byte, 150)), blob.PutOptions{}))
+	verifyFree(st, 700)
+	require.NoError(t, st.Close(ctx))
+
+	st = quota.NewWrapper(fs, quota.Limits{HardLimitBytes: 1000}, opt)
+	require.ErrorIs(t, st.PutBlob(ctx, "p3", gather.FromSlice(make([]byte, 10)), blob.PutOptions{}), blob.ErrBlobNotFound)
+	verifyFree(st, 850)
+	require.NoError(t, st.Close(ctx))
+}
@@ -0,0 +1,331 @@
+package rest
+
+import (
+	"container/heap"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.Module("rest")
+
+type handler struct {
+	st blob.Storage
+}
+
+// NewHandler returns a http.Handler that exposes the provided storage using the REST blob protocol.
+func NewHandler(st blob.Storage) http.Handler {
+	h := &handler{st}
+
+	m := http.NewServeMux()
+	m.HandleFunc("GET /"+blobsPath+"{$}", h.listBlobs)
+	m.HandleFunc("GET /"+blobsPath+"{id}", h.getBlob)
+	m.HandleFunc("PUT /"+blobsPath+"{id}", h.putBlob)
+	m.HandleFunc("DELETE /"+blobsPath+"{id}", h.deleteBlob)
+	m.HandleFunc("POST /"+retentionPath+"{id}", h.extendBlobRetention)
+	m.HandleFunc("GET /"+capacityPath, h.getCapacity)
+
+	return m
+}
+
+// RequireBasicAuth wraps the provided handler with one that requires HTTP basic authentication
+// with the provided username and password.
+func RequireBasicAuth(h http.Handler, username, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="kopia"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	code := errorCodeFor(err)
+
+	status := http.StatusInternalServerError
+
+	switch code {
+	case errorCodeNotFound:
+		status = http.StatusNotFound
+	case errorCodeInvalidRange:
+		status = http.StatusRequestedRangeNotSatisfiable
+	case errorCodeAlreadyExists:
+		status = http.StatusConflict
+	case errorCodeSetTimeUnsupported, errorCodeNotAVolume, errorCodeObjectLockUnsupported, errorCodeUnsupportedPutOption:
+		status = http.StatusNotImplemented
+	default:
+		log(r.Context()).Errorf("%v %v failed: %v", r.Method, r.URL.Path, err)
+	}
+
+	writeErrorResponse(w, status, errorResponse{Code: code, Error: err.Error()})
+}
+
+func writeBadRequest(w http.ResponseWriter, msg string) {
+	writeErrorResponse(w, http.StatusBadRequest, errorResponse{Code: errorCodeBadRequest, Error: msg})
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, resp errorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp) //nolint:errcheck
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v) //nolint:errcheck
+}
+
+func parseIntParam(r *http.Request, name string, def int64) (int64, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+
+	return v, errors.Wrapf(err, "invalid %v", name)
+}
+
+func (h *handler) getBlob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := blob.ID(r.PathValue("id"))
+
+	if r.Method == http.MethodHead {
+		bm, err := h.st.GetMetadata(ctx, id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set(headerModTime, formatModTime(bm.Timestamp))
+		w.Header().Set("Content-Length", strconv.FormatInt(bm.Length, 10))
+		w.WriteHeader(http.StatusOK)
+
+		return
+	}
+
+	offset, err := parseIntParam(r, paramOffset, 0)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	length, err := parseIntParam(r, paramLength, -1)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	if offset < 0 {
+		writeError(w, r, errors.Wrapf(blob.ErrInvalidRange, "invalid offset: %v", offset))
+		return
+	}
+
+	var buf gather.WriteBuffer
+	defer buf.Close()
+
+	if err := h.st.GetBlob(ctx, id, offset, length, &buf); err != nil {
+		writeError(w, r, h.classifyGetBlobError(r, id, offset, length, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Length()))
+	w.WriteHeader(http.StatusOK)
+	buf.Bytes().WriteTo(w) //nolint:errcheck
+}
+
+// classifyGetBlobError converts errors resulting from reading past the end of a blob into ErrInvalidRange,
+// since not all storage providers report them as such and clients should not retry them.
+func (h *handler) classifyGetBlobError(r *http.Request, id blob.ID, offset, length int64, err error) error {
+	if length < 0 || errorCodeFor(err) != errorCodeInternal {
+		return err
+	}
+
+	bm, merr := h.st.GetMetadata(r.Context(), id)
+	if merr == nil && offset+length > bm.Length {
+		return errors.Wrapf(blob.ErrInvalidRange, "range [%v,%v) exceeds blob length %v", offset, offset+length, bm.Length)
+	}
+
+	return err
+}
+
+func (h *handler) putBlob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := blob.ID(r.PathValue("id"))
+
+	var opts blob.PutOptions
+
+	if v := r.Header.Get(headerModTime); v != "" {
+		t, err := parseModTime(v)
+		if err != nil {
+			writeBadRequest(w, err.Error())
+			return
+		}
+
+		opts.SetModTime = t
+	}
+
+	opts.DoNotRecreate = r.Header.Get(headerDoNotRecreate) == "true"
+	opts.RetentionMode = blob.RetentionMode(r.Header.Get(headerRetentionMode))
+
+	if v := r.Header.Get(headerRetentionPeriod); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			writeBadRequest(w, "invalid retention period")
+			return
+		}
+
+		opts.RetentionPeriod = d
+	}
+
+	var buf gather.WriteBuffer
+	defer buf.Close()
+
+	if _, err := io.Copy(&buf, r.Body); err != nil {
+		writeBadRequest(w, "error reading request body")
+		return
+	}
+
+	if r.ContentLength >= 0 && int64(buf.Length()) != r.ContentLength {
+		writeBadRequest(w, "incomplete request body")
+		return
+	}
+
+	var modTime time.Time
+
+	opts.GetModTime = &modTime
+
+	if err := h.st.PutBlob(ctx, id, buf.Bytes(), opts); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if !modTime.IsZero() {
+		w.Header().Set(headerModTime, formatModTime(modTime))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) deleteBlob(w http.ResponseWriter, r *http.Request) {
+	if err := h.st.DeleteBlob(r.Context(), blob.ID(r.PathValue("id"))); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) extendBlobRetention(w http.ResponseWriter, r *http.Request) {
+	var opts blob.ExtendOptions
+
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeBadRequest(w, "invalid request body")
+		return
+	}
+
+	if err := h.st.ExtendBlobRetention(r.Context(), blob.ID(r.PathValue("id")), opts); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) getCapacity(w http.ResponseWriter, r *http.Request) {
+	c, err := h.st.GetCapacity(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, c)
+}
+
+// listBlobs returns a single page of blobs with the provided prefix whose IDs are greater than the marker.
+func (h *handler) listBlobs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix := blob.ID(q.Get(paramPrefix))
+	marker := blob.ID(q.Get(paramMarker))
+
+	limit, err := parseIntParam(r, paramLimit, defaultListPageSize)
+	if err != nil || limit <= 0 {
+		writeBadRequest(w, "invalid limit")
+		return
+	}
+
+	limit = min(limit, maxListPageSize)
+
+	// keep limit+1 blobs with the lowest IDs, the extra one tells whether there's another page.
+	var page listPageHeap
+
+	if err := h.st.ListBlobs(r.Context(), prefix, func(bm blob.Metadata) error {
+		if bm.BlobID <= marker {
+			return nil
+		}
+
+		if int64(page.Len()) <= limit {
+			heap.Push(&page, bm)
+		} else if bm.BlobID < page[0].BlobID {
+			page[0] = bm
+			heap.Fix(&page, 0)
+		}
+
+		return nil
+	}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	sort.Slice(page, func(i, j int) bool {
+		return page[i].BlobID < page[j].BlobID
+	})
+
+	resp := listResponse{Blobs: page}
+
+	if int64(len(page)) > limit {
+		resp.Blobs = page[0:limit]
+		resp.NextMarker = resp.Blobs[limit-1].BlobID
+	}
+
+	writeJSON(w, resp)
+}
+
+// listPageHeap is a max-heap of blob metadata ordered by blob ID.
+type listPageHeap []blob.Metadata
+
+func (h listPageHeap) Len() int           { return len(h) }
+func (h listPageHeap) Less(i, j int) bool { return h[i].BlobID > h[j].BlobID }
+func (h listPageHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *listPageHeap) Push(x any) {
+	*h = append(*h, x.(blob.Metadata)) //nolint:forcetypeassert
+}
+
+func (h *listPageHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+
+	return x
+}
@@ -0,0 +1,18 @@
+package rest
+
+import (
+	"github.com/kopia/kopia/repo/blob/throttling"
+)
+
+// Options defines options for REST blob server storage.
+type Options struct {
+	URL                                 string `json:"url"`
+	Username                            string `json:"username,omitempty"`
+	Password                            string `json:"password,omitempty"                            kopia:"sensitive"`
+	TrustedServerCertificateFingerprint string `json:"trustedServerCertificateFingerprint,omitempty"`
+
+	// ListPageSize is the maximum number of blobs requested in a single list call.
+	ListPageSize int `json:"listPageSize,omitempty"`
+
+	throttling.Limits
+}
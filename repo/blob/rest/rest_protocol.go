@@ -0,0 +1,118 @@
+package rest
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// The REST blob protocol consists of the following requests, all relative to the base URL:
+//
+//	GET    blobs/{id}[?offset=N&length=N]  - returns full or partial contents of a blob
+//	HEAD   blobs/{id}                      - returns blob length (Content-Length) and modification time
+//	PUT    blobs/{id}                      - stores the request body as a blob
+//	DELETE blobs/{id}                      - deletes a blob
+//	GET    blobs/?prefix=P&marker=ID&limit=N - lists blobs with the prefix in lexicographical order, one page at a time
+//	POST   retention/{id}                  - extends retention of a blob, request body is ExtendOptions
+//	GET    capacity                        - returns blob.Capacity of the underlying volume
+//
+// Modification times are exchanged in the X-Kopia-Mod-Time header, formatted as RFC3339Nano.
+// Failed requests return a non-2xx status and errorResponse describing the failure.
+//
+// A page of a listing contains up to 'limit' blobs whose IDs are greater than 'marker'. When more blobs
+// may follow, listResponse.NextMarker is set and clients request the next page passing it as 'marker'.
+// The server keeps at most 'limit' entries in memory regardless of the number of blobs.
+const (
+	blobsPath     = "blobs/"
+	retentionPath = "retention/"
+	capacityPath  = "capacity"
+
+	headerModTime         = "X-Kopia-Mod-Time"
+	headerDoNotRecreate   = "X-Kopia-Do-Not-Recreate"
+	headerRetentionMode   = "X-Kopia-Retention-Mode"
+	headerRetentionPeriod = "X-Kopia-Retention-Period"
+
+	paramOffset = "offset"
+	paramLength = "length"
+	paramPrefix = "prefix"
+	paramMarker = "marker"
+	paramLimit  = "limit"
+
+	defaultListPageSize = 1000
+	maxListPageSize     = 10000
+)
+
+// error codes reported in errorResponse.
+const (
+	errorCodeNotFound              = "NOT_FOUND"
+	errorCodeInvalidRange          = "INVALID_RANGE"
+	errorCodeAlreadyExists         = "ALREADY_EXISTS"
+	errorCodeSetTimeUnsupported    = "SET_TIME_UNSUPPORTED"
+	errorCodeNotAVolume            = "NOT_A_VOLUME"
+	errorCodeObjectLockUnsupported = "OBJECT_LOCK_UNSUPPORTED"
+	errorCodeUnsupportedPutOption  = "UNSUPPORTED_PUT_OPTION"
+	errorCodeBadRequest            = "BAD_REQUEST"
+	errorCodeInternal              = "INTERNAL"
+)
+
+// errorResponse is returned in the body of failed requests.
+type errorResponse struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// listResponse is a single page of a blob listing.
+type listResponse struct {
+	Blobs []blob.Metadata `json:"blobs"`
+
+	// NextMarker is the marker of the next page, empty on the last page.
+	NextMarker blob.ID `json:"nextMarker,omitempty"`
+}
+
+// knownErrors maps well-known blob errors to error codes and back.
+//
+//nolint:gochecknoglobals
+var knownErrors = []struct {
+	code string
+	err  error
+}{
+	{errorCodeNotFound, blob.ErrBlobNotFound},
+	{errorCodeInvalidRange, blob.ErrInvalidRange},
+	{errorCodeAlreadyExists, blob.ErrBlobAlreadyExists},
+	{errorCodeSetTimeUnsupported, blob.ErrSetTimeUnsupported},
+	{errorCodeNotAVolume, blob.ErrNotAVolume},
+	{errorCodeObjectLockUnsupported, blob.ErrUnsupportedObjectLock},
+	{errorCodeUnsupportedPutOption, blob.ErrUnsupportedPutBlobOption},
+}
+
+func errorCodeFor(err error) string {
+	for _, e := range knownErrors {
+		if errors.Is(err, e.err) {
+			return e.code
+		}
+	}
+
+	return errorCodeInternal
+}
+
+func errorForCode(code, message string) error {
+	for _, e := range knownErrors {
+		if e.code == code {
+			return errors.Wrap(e.err, message)
+		}
+	}
+
+	return errors.Errorf("server error (%v): %v", code, message)
+}
+
+func formatModTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseModTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+
+	return t, errors.Wrap(err, "invalid modification time")
+}
@@ -0,0 +1,343 @@
+// Package rest implements Storage and a matching HTTP handler based on a simple REST protocol.
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/iocopy"
+	"github.com/kopia/kopia/internal/tlsutil"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/retrying"
+)
+
+const restStorageType = "rest"
+
+type restStorage struct {
+	Options
+	blob.DefaultProviderImplementation
+
+	baseURL string
+	client  *http.Client
+}
+
+func (s *restStorage) blobURL(id blob.ID) string {
+	return s.baseURL + blobsPath + url.PathEscape(string(id))
+}
+
+func (s *restStorage) newRequest(ctx context.Context, method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create request")
+	}
+
+	if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+
+	// Since we're handling encrypted data, there's no point compressing it server-side.
+	req.Header.Set("Accept-Encoding", "identity")
+
+	return req, nil
+}
+
+// do executes the request and returns the response if it has a 2xx status, otherwise
+// it closes the response and returns the error reported by the server.
+func (s *restStorage) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%v %v", req.Method, req.URL.Path)
+	}
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return resp, nil
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if req.Method == http.MethodHead && resp.StatusCode == http.StatusNotFound {
+		// HEAD responses have no body.
+		return nil, blob.ErrBlobNotFound
+	}
+
+	var er errorResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&er); err != nil || er.Code == "" {
+		return nil, errors.Errorf("%v %v failed with status %v", req.Method, req.URL.Path, resp.Status)
+	}
+
+	return nil, errorForCode(er.Code, er.Error)
+}
+
+func (s *restStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	output.Reset()
+
+	if offset < 0 {
+		return blob.ErrInvalidRange
+	}
+
+	u := s.blobURL(id)
+	if length >= 0 {
+		u += "?" + url.Values{
+			paramOffset: {strconv.FormatInt(offset, 10)},
+			paramLength: {strconv.FormatInt(length, 10)},
+		}.Encode()
+	}
+
+	req, err := s.newRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if err := iocopy.JustCopy(output, resp.Body); err != nil {
+		return errors.Wrap(err, "error reading response")
+	}
+
+	if resp.ContentLength >= 0 && int64(output.Length()) != resp.ContentLength {
+		return errors.Errorf("incomplete response for %v", id)
+	}
+
+	//nolint:wrapcheck
+	return blob.EnsureLengthExactly(output.Length(), length)
+}
+
+func (s *restStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	req, err := s.newRequest(ctx, http.MethodHead, s.blobURL(id), nil)
+	if err != nil {
+		return blob.Metadata{}, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return blob.Metadata{}, err
+	}
+
+	resp.Body.Close() //nolint:errcheck
+
+	t, err := parseModTime(resp.Header.Get(headerModTime))
+	if err != nil {
+		return blob.Metadata{}, err
+	}
+
+	return blob.Metadata{
+		BlobID:    id,
+		Length:    resp.ContentLength,
+		Timestamp: t,
+	}, nil
+}
+
+func (s *restStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	rdr := data.Reader()
+	defer rdr.Close() //nolint:errcheck
+
+	req, err := s.newRequest(ctx, http.MethodPut, s.blobURL(id), rdr)
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = int64(data.Length())
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	if !opts.SetModTime.IsZero() {
+		req.Header.Set(headerModTime, formatModTime(opts.SetModTime))
+	}
+
+	if opts.DoNotRecreate {
+		req.Header.Set(headerDoNotRecreate, "true")
+	}
+
+	if opts.RetentionMode != "" {
+		req.Header.Set(headerRetentionMode, string(opts.RetentionMode))
+	}
+
+	if opts.RetentionPeriod != 0 {
+		req.Header.Set(headerRetentionPeriod, opts.RetentionPeriod.String())
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close() //nolint:errcheck
+
+	if opts.GetModTime != nil {
+		t, err := parseModTime(resp.Header.Get(headerModTime))
+		if err != nil {
+			return err
+		}
+
+		*opts.GetModTime = t
+	}
+
+	return nil
+}
+
+func (s *restStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, s.blobURL(id), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close() //nolint:errcheck
+
+	return nil
+}
+
+func (s *restStorage) ExtendBlobRetention(ctx context.Context, id blob.ID, opts blob.ExtendOptions) error {
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal options")
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPost, s.baseURL+retentionPath+url.PathEscape(string(id)), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close() //nolint:errcheck
+
+	return nil
+}
+
+func (s *restStorage) GetCapacity(ctx context.Context) (blob.Capacity, error) {
+	var c blob.Capacity
+
+	req, err := s.newRequest(ctx, http.MethodGet, s.baseURL+capacityPath, nil)
+	if err != nil {
+		return c, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return c, err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	return c, errors.Wrap(json.NewDecoder(resp.Body).Decode(&c), "invalid capacity response")
+}
+
+func (s *restStorage) listPage(ctx context.Context, prefix, marker blob.ID) (*listResponse, error) {
+	pageSize := s.ListPageSize
+	if pageSize <= 0 {
+		pageSize = defaultListPageSize
+	}
+
+	req, err := s.newRequest(ctx, http.MethodGet, s.baseURL+blobsPath+"?"+url.Values{
+		paramPrefix: {string(prefix)},
+		paramMarker: {string(marker)},
+		paramLimit:  {strconv.Itoa(pageSize)},
+	}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	var lr listResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&lr); err != nil {
+		return nil, errors.Wrap(err, "invalid list response")
+	}
+
+	return &lr, nil
+}
+
+func (s *restStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	var marker blob.ID
+
+	for {
+		page, err := s.listPage(ctx, prefix, marker)
+		if err != nil {
+			return err
+		}
+
+		for _, bm := range page.Blobs {
+			if err := callback(bm); err != nil {
+				return err
+			}
+		}
+
+		if page.NextMarker == "" {
+			return nil
+		}
+
+		if page.NextMarker <= marker {
+			return errors.Errorf("invalid list marker %q after %q", page.NextMarker, marker)
+		}
+
+		marker = page.NextMarker
+	}
+}
+
+func (s *restStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   restStorageType,
+		Config: &s.Options,
+	}
+}
+
+func (s *restStorage) DisplayName() string {
+	return "REST: " + s.URL
+}
+
+// New creates new REST blob server storage with specified options.
+func New(ctx context.Context, opts *Options, isCreate bool) (blob.Storage, error) {
+	_ = ctx
+	_ = isCreate
+
+	if opts.URL == "" {
+		return nil, errors.New("URL must be specified")
+	}
+
+	transport := http.DefaultTransport
+	if opts.TrustedServerCertificateFingerprint != "" {
+		transport = tlsutil.TransportTrustingSingleCertificate(opts.TrustedServerCertificateFingerprint)
+	}
+
+	baseURL := opts.URL
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	return retrying.NewWrapper(&restStorage{
+		Options: *opts,
+		baseURL: baseURL,
+		client:  &http.Client{Transport: transport},
+	}), nil
+}
+
+func init() {
+	blob.AddSupportedStorage(restStorageType, Options{}, New)
+}
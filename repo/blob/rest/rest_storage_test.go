@@ -0,0 +1,209 @@
+package rest_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/providervalidation"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+	"github.com/kopia/kopia/repo/blob/rest"
+)
+
+func newFilesystemServer(t *testing.T, useTLS bool) *httptest.Server {
+	t.Helper()
+
+	ctx := testlogging.Context(t)
+
+	st, err := filesystem.New(ctx, &filesystem.Options{Path: testutil.TempDirectory(t)}, true)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { st.Close(ctx) })
+
+	return newServer(t, st, useTLS)
+}
+
+func newServer(t *testing.T, st blob.Storage, useTLS bool) *httptest.Server {
+	t.Helper()
+
+	h := rest.RequireBasicAuth(rest.NewHandler(st), "user", "password")
+
+	var server *httptest.Server
+
+	if useTLS {
+		server = httptest.NewTLSServer(h)
+	} else {
+		server = httptest.NewServer(h)
+	}
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestRESTStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	server := newFilesystemServer(t, false)
+
+	st, err := rest.New(ctx, &rest.Options{
+		URL:      server.URL,
+		Username: "user",
+		Password: "password",
+	}, false)
+	require.NoError(t, err)
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+
+	c, err := st.GetCapacity(ctx)
+	require.NoError(t, err)
+	require.NotZero(t, c.SizeB)
+
+	require.NoError(t, st.Close(ctx))
+}
+
+func TestRESTStorageSmallListPages(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	server := newFilesystemServer(t, false)
+
+	st, err := rest.New(ctx, &rest.Options{
+		URL:          server.URL,
+		Username:     "user",
+		Password:     "password",
+		ListPageSize: 2,
+	}, false)
+	require.NoError(t, err)
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+	require.NoError(t, st.Close(ctx))
+}
+
+func TestRESTStorageTLSAndListing(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	server := newFilesystemServer(t, true)
+
+	fingerprint := sha256.Sum256(server.Certificate().Raw)
+
+	st, err := rest.New(ctx, &rest.Options{
+		URL:                                 server.URL,
+		Username:                            "user",
+		Password:                            "password",
+		TrustedServerCertificateFingerprint: hex.EncodeToString(fingerprint[:]),
+		ListPageSize:                        3,
+	}, false)
+	require.NoError(t, err)
+
+	var want []blob.ID
+
+	for i := range 10 {
+		id := blob.ID(fmt.Sprintf("p%02d", i))
+		want = append(want, id)
+
+		require.NoError(t, st.PutBlob(ctx, id, gather.FromSlice([]byte{byte(i)}), blob.PutOptions{}))
+	}
+
+	require.NoError(t, st.PutBlob(ctx, "q1", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+
+	blobtesting.AssertListResultsIDs(ctx, t, st, "p", want...)
+	blobtesting.AssertListResultsIDs(ctx, t, st, "q", "q1")
+
+	// stopping the listing early returns the error of the callback.
+	errStop := errors.New("stop")
+
+	var listed int
+
+	require.ErrorIs(t, st.ListBlobs(ctx, "p", func(blob.Metadata) error {
+		listed++
+		if listed == 2 {
+			return errStop
+		}
+
+		return nil
+	}), errStop)
+	require.Equal(t, 2, listed)
+
+	require.NoError(t, st.Close(ctx))
+}
+
+func TestRESTStorageListingError(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	fs := blobtesting.NewFaultyStorage(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil))
+	server := newServer(t, fs, false)
+
+	st, err := rest.New(ctx, &rest.Options{
+		URL:      server.URL,
+		Username: "user",
+		Password: "password",
+	}, false)
+	require.NoError(t, err)
+
+	require.NoError(t, st.PutBlob(ctx, "p1", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+
+	// listing failures on the server are reported to the client.
+	fs.AddFault(blobtesting.MethodListBlobsItem).ErrorInstead(blob.ErrBlobNotFound)
+
+	require.ErrorIs(t, st.ListBlobs(ctx, "p", func(blob.Metadata) error { return nil }), blob.ErrBlobNotFound)
+
+	blobtesting.AssertListResultsIDs(ctx, t, st, "p", "p1")
+
+	require.NoError(t, st.Close(ctx))
+}
+
+func TestRESTStorageRequiresAuth(t *testing.T) {
+	t.Parallel()
+
+	server := newFilesystemServer(t, false)
+
+	for _, creds := range [][]string{nil, {"user", "wrong"}, {"wrong", "password"}} {
+		req, err := http.NewRequestWithContext(testlogging.Context(t), http.MethodGet, server.URL+"/blobs/", http.NoBody)
+		require.NoError(t, err)
+
+		if creds != nil {
+			req.SetBasicAuth(creds[0], creds[1])
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestRESTStorageProviderValidation(t *testing.T) {
+	t.Parallel()
+	testutil.ProviderTest(t)
+
+	ctx := testlogging.Context(t)
+	server := newFilesystemServer(t, false)
+
+	st, err := rest.New(ctx, &rest.Options{
+		URL:      server.URL,
+		Username: "user",
+		Password: "password",
+	}, false)
+	require.NoError(t, err)
+
+	require.NoError(t, providervalidation.ValidateProvider(ctx, st, blobtesting.TestValidationOptions))
+	require.NoError(t, st.Close(ctx))
+}
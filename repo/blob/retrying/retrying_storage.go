@@ -42,6 +42,12 @@ func (s retryingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
 	}, isRetriable)
 }
 
+// WrapUnderlying returns a new retry loop around the underlying storage wrapped by the provided function,
+// which allows adding wrappers whose errors are subject to retries.
+func (s retryingStorage) WrapUnderlying(wrap func(st blob.Storage) blob.Storage) blob.Storage {
+	return &retryingStorage{Storage: wrap(s.Storage)}
+}
+
 // NewWrapper returns a Storage wrapper that adds retry loop around all operations of the underlying storage.
 func NewWrapper(wrapped blob.Storage) blob.Storage {
 	return &retryingStorage{Storage: wrapped}
@@ -67,6 +73,10 @@ func isRetriable(err error) bool {
 	case errors.Is(err, blob.ErrBlobAlreadyExists):
 		return false
 
+	case errors.Is(err, blob.ErrChecksumMismatch):
+		// corruption at rest won't go away by retrying
+		return false
+
 	case errors.Is(err, repo.ErrRepositoryUnavailableDueToUpgradeInProgress):
 		// hard-fail when upgrade is in progress
 		return false
@@ -59,3 +59,28 @@ func TestRetrying(t *testing.T) {
 
 	fs.VerifyAllFaultsExercised(t)
 }
+
+func TestRetryingWrapUnderlying(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	someError := errors.New("some error")
+	ms := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+
+	var fs *blobtesting.FaultyStorage
+
+	rs := retrying.NewWrapper(ms).(interface {
+		WrapUnderlying(wrap func(st blob.Storage) blob.Storage) blob.Storage
+	}).WrapUnderlying(func(st blob.Storage) blob.Storage {
+		fs = blobtesting.NewFaultyStorage(st)
+		fs.AddFault(blobtesting.MethodPutBlob).ErrorInstead(someError)
+
+		return fs
+	})
+
+	// errors of the added wrapper are retried.
+	require.NoError(t, rs.PutBlob(ctx, "deadcafe", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+
+	fs.VerifyAllFaultsExercised(t)
+}
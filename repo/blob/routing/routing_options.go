@@ -0,0 +1,20 @@
+package routing
+
+import (
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// Route maps blobs with a given ID prefix to a storage.
+type Route struct {
+	Prefix  blob.ID             `json:"prefix"`
+	Storage blob.ConnectionInfo `json:"storage"`
+}
+
+// Options defines options for routing storage.
+type Options struct {
+	// Routes maps blob ID prefixes to storages. When several prefixes match a blob ID, the longest one wins.
+	Routes []Route `json:"routes,omitempty"`
+
+	// Default is the storage used for blobs that don't match any route.
+	Default blob.ConnectionInfo `json:"default"`
+}
@@ -0,0 +1,255 @@
+// Package routing implements a storage that routes blobs to different underlying storages
+// based on their ID prefixes.
+package routing
+
+import (
+	"context"
+	stderrors "errors"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const routingStorageType = "routing"
+
+type route struct {
+	prefix  blob.ID
+	storage blob.Storage
+}
+
+type routingStorage struct {
+	Options
+
+	// routes sorted by prefix length, longest first, with default storage being last.
+	routes []route
+}
+
+// routeIndexFor returns the index of the route responsible for the provided blob ID.
+func (s *routingStorage) routeIndexFor(id blob.ID) int {
+	for i, r := range s.routes {
+		if strings.HasPrefix(string(id), string(r.prefix)) {
+			return i
+		}
+	}
+
+	// unreachable since default route has an empty prefix.
+	return len(s.routes) - 1
+}
+
+func (s *routingStorage) storageFor(id blob.ID) blob.Storage {
+	return s.routes[s.routeIndexFor(id)].storage
+}
+
+func (s *routingStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	//nolint:wrapcheck
+	return s.storageFor(id).GetBlob(ctx, id, offset, length, output)
+}
+
+func (s *routingStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	//nolint:wrapcheck
+	return s.storageFor(id).GetMetadata(ctx, id)
+}
+
+func (s *routingStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	//nolint:wrapcheck
+	return s.storageFor(id).PutBlob(ctx, id, data, opts)
+}
+
+func (s *routingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	//nolint:wrapcheck
+	return s.storageFor(id).DeleteBlob(ctx, id)
+}
+
+func (s *routingStorage) ExtendBlobRetention(ctx context.Context, id blob.ID, opts blob.ExtendOptions) error {
+	//nolint:wrapcheck
+	return s.storageFor(id).ExtendBlobRetention(ctx, id, opts)
+}
+
+// ListBlobs lists all routes that can contain blobs with the provided prefix.
+// Blobs found in a storage that would not be routed there are ignored.
+func (s *routingStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	for i, r := range s.routes {
+		var listPrefix blob.ID
+
+		switch {
+		case strings.HasPrefix(string(r.prefix), string(prefix)):
+			listPrefix = r.prefix
+		case strings.HasPrefix(string(prefix), string(r.prefix)):
+			listPrefix = prefix
+		default:
+			continue
+		}
+
+		if err := r.storage.ListBlobs(ctx, listPrefix, func(bm blob.Metadata) error {
+			if s.routeIndexFor(bm.BlobID) != i {
+				return nil
+			}
+
+			return callback(bm)
+		}); err != nil {
+			return errors.Wrapf(err, "error listing %v", r.storage.DisplayName())
+		}
+	}
+
+	return nil
+}
+
+// GetCapacity returns the total capacity of all storages that are volumes.
+func (s *routingStorage) GetCapacity(ctx context.Context) (blob.Capacity, error) {
+	var (
+		result blob.Capacity
+		found  bool
+	)
+
+	for _, r := range s.routes {
+		c, err := r.storage.GetCapacity(ctx)
+		if errors.Is(err, blob.ErrNotAVolume) {
+			continue
+		}
+
+		if err != nil {
+			return blob.Capacity{}, errors.Wrapf(err, "error getting capacity of %v", r.storage.DisplayName())
+		}
+
+		result.SizeB += c.SizeB
+		result.FreeB += c.FreeB
+		found = true
+	}
+
+	if !found {
+		return blob.Capacity{}, blob.ErrNotAVolume
+	}
+
+	return result, nil
+}
+
+// IsReadOnly returns true if any of the underlying storages is read-only.
+func (s *routingStorage) IsReadOnly() bool {
+	for _, r := range s.routes {
+		if r.storage.IsReadOnly() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *routingStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   routingStorageType,
+		Config: &s.Options,
+	}
+}
+
+func (s *routingStorage) DisplayName() string {
+	var parts []string
+
+	for _, r := range s.routes {
+		p := string(r.prefix)
+		if p == "" {
+			p = "*"
+		}
+
+		parts = append(parts, p+"="+r.storage.DisplayName())
+	}
+
+	return "Routing: " + strings.Join(parts, ", ")
+}
+
+func (s *routingStorage) Close(ctx context.Context) error {
+	var err error
+
+	for _, r := range s.routes {
+		err = stderrors.Join(err, r.storage.Close(ctx))
+	}
+
+	return errors.Wrap(err, "error closing storages")
+}
+
+func (s *routingStorage) FlushCaches(ctx context.Context) error {
+	var err error
+
+	for _, r := range s.routes {
+		err = stderrors.Join(err, r.storage.FlushCaches(ctx))
+	}
+
+	return errors.Wrap(err, "error flushing storage caches")
+}
+
+func newRoutingStorage(opt *Options, routes []route, def blob.Storage) (*routingStorage, error) {
+	seen := map[blob.ID]bool{}
+
+	for _, r := range routes {
+		if r.prefix == "" {
+			return nil, errors.New("route prefix must not be empty")
+		}
+
+		if seen[r.prefix] {
+			return nil, errors.Errorf("duplicate route prefix %q", r.prefix)
+		}
+
+		seen[r.prefix] = true
+	}
+
+	s := &routingStorage{
+		Options: *opt,
+		routes:  append(append([]route(nil), routes...), route{"", def}),
+	}
+
+	sort.SliceStable(s.routes, func(i, j int) bool {
+		return len(s.routes[i].prefix) > len(s.routes[j].prefix)
+	})
+
+	return s, nil
+}
+
+// New creates new routing storage with the specified options.
+func New(ctx context.Context, opt *Options, isCreate bool) (blob.Storage, error) {
+	if opt.Default.Type == "" {
+		return nil, errors.New("default storage must be specified")
+	}
+
+	var opened []blob.Storage
+
+	closeAll := func() {
+		for _, st := range opened {
+			st.Close(ctx) //nolint:errcheck
+		}
+	}
+
+	var routes []route
+
+	for _, r := range opt.Routes {
+		st, err := blob.NewStorage(ctx, r.Storage, isCreate)
+		if err != nil {
+			closeAll()
+			return nil, errors.Wrapf(err, "unable to open storage for prefix %q", r.Prefix)
+		}
+
+		opened = append(opened, st)
+		routes = append(routes, route{r.Prefix, st})
+	}
+
+	def, err := blob.NewStorage(ctx, opt.Default, isCreate)
+	if err != nil {
+		closeAll()
+		return nil, errors.Wrap(err, "unable to open default storage")
+	}
+
+	opened = append(opened, def)
+
+	s, err := newRoutingStorage(opt, routes, def)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func init() {
+	blob.AddSupportedStorage(routingStorageType, Options{}, New)
+}
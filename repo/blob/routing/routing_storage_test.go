@@ -0,0 +1,79 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+)
+
+func fsConnectionInfo(t *testing.T) blob.ConnectionInfo {
+	t.Helper()
+
+	return blob.ConnectionInfo{
+		Type:   "filesystem",
+		Config: &filesystem.Options{Path: testutil.TempDirectory(t)},
+	}
+}
+
+func TestRoutingStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	st, err := New(ctx, &Options{
+		Routes: []Route{
+			{Prefix: "a", Storage: fsConnectionInfo(t)},
+			{Prefix: "abg", Storage: fsConnectionInfo(t)},
+			{Prefix: "kopia.", Storage: fsConnectionInfo(t)},
+		},
+		Default: fsConnectionInfo(t),
+	}, true)
+	require.NoError(t, err)
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+
+	require.NoError(t, st.Close(ctx))
+}
+
+func TestRoutingStoragePlacement(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	packs, indexes, other := blobtesting.DataMap{}, blobtesting.DataMap{}, blobtesting.DataMap{}
+
+	st, err := newRoutingStorage(&Options{}, []route{
+		{"p", blobtesting.NewMapStorage(packs, nil, nil)},
+		{"x", blobtesting.NewMapStorage(indexes, nil, nil)},
+	}, blobtesting.NewMapStorage(other, nil, nil))
+	require.NoError(t, err)
+
+	for _, id := range []blob.ID{"p1", "p2", "xn0_1", "q1", "_log_1"} {
+		require.NoError(t, st.PutBlob(ctx, id, gather.FromSlice([]byte{1}), blob.PutOptions{}))
+	}
+
+	require.Len(t, packs, 2)
+	require.Len(t, indexes, 1)
+	require.Len(t, other, 2)
+
+	// stray blob in the default storage that belongs to another route is not listed.
+	other["p3"] = []byte{1}
+
+	blobtesting.AssertListResults(ctx, t, st, "", "_log_1", "p1", "p2", "q1", "xn0_1")
+	blobtesting.AssertListResults(ctx, t, st, "p", "p1", "p2")
+	blobtesting.AssertListResults(ctx, t, st, "xn", "xn0_1")
+
+	_, err = newRoutingStorage(&Options{}, []route{{"p", nil}, {"p", nil}}, nil)
+	require.Error(t, err)
+
+	_, err = newRoutingStorage(&Options{}, []route{{"", nil}}, nil)
+	require.Error(t, err)
+}
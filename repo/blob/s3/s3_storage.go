@@ -14,6 +14,7 @@
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/internal/clock"
@@ -26,6 +27,12 @@
 const (
 	s3storageType   = "s3"
 	latestVersionID = ""
+
+	// user metadata key holding CRC32C checksum, for S3-compatible providers without native checksum support.
+	checksumMetadataKey = "Kopia-Crc32c"
+
+	// native S3 checksum header.
+	nativeChecksumHeader = "x-amz-checksum-crc32c"
 )
 
 type s3Storage struct {
@@ -62,6 +69,9 @@ func (s *s3Storage) getBlobWithVersion(ctx context.Context, b blob.ID, version s
 			}
 		}
 
+		fullRead := blob.IsFullRead(offset, length)
+		opt.Checksum = fullRead && s.supportsNativeChecksums()
+
 		o, err := s.cli.GetObject(ctx, s.BucketName, s.getObjectNameString(b), opt)
 		if err != nil {
 			return errors.Wrap(err, "GetObject")
@@ -73,7 +83,17 @@ func (s *s3Storage) getBlobWithVersion(ctx context.Context, b blob.ID, version s
 			return nil
 		}
 
-		return iocopy.JustCopy(output, o)
+		if !fullRead {
+			return iocopy.JustCopy(output, o)
+		}
+
+		h := blob.NewCRC32C()
+
+		if err := iocopy.JustCopy(io.MultiWriter(output, h), o); err != nil {
+			return err
+		}
+
+		return verifyChecksum(b, o, h.Sum32())
 	}
 
 	if err := attempt(); err != nil {
@@ -84,6 +104,35 @@ func (s *s3Storage) getBlobWithVersion(ctx context.Context, b blob.ID, version s
 	return blob.EnsureLengthExactly(output.Length(), length)
 }
 
+// verifyChecksum compares the checksum of downloaded object with the one recorded when it was written, if any.
+func verifyChecksum(b blob.ID, o *minio.Object, actual uint32) error {
+	oi, err := o.Stat()
+	if err != nil {
+		return errors.Wrap(err, "Stat")
+	}
+
+	expected := oi.ChecksumCRC32C
+	if expected == "" {
+		expected = oi.UserMetadata[checksumMetadataKey]
+	}
+
+	if expected == "" {
+		// written without checksum or by a provider that does not return it.
+		return nil
+	}
+
+	if got := blob.EncodeCRC32C(actual); got != expected {
+		return blob.ChecksumMismatchError(b, expected, got)
+	}
+
+	return nil
+}
+
+// supportsNativeChecksums returns true if the endpoint is known to support native S3 checksum headers.
+func (s *s3Storage) supportsNativeChecksums() bool {
+	return s3utils.IsAmazonEndpoint(*s.cli.EndpointURL())
+}
+
 func isInvalidCredentials(err error) bool {
 	return err != nil && strings.Contains(err.Error(), blob.InvalidCredentialsErrStr)
 }
@@ -168,8 +217,20 @@ func (s *s3Storage) putBlob(ctx context.Context, b blob.ID, data blob.Bytes, opt
 		retainUntilDate = clock.Now().Add(opts.RetentionPeriod).UTC()
 	}
 
+	// checksum is always recorded in user metadata and additionally sent using native header
+	// where supported, which makes the provider reject corrupted uploads.
+	checksum := blob.EncodeCRC32C(blob.CRC32C(data))
+	userMetadata := map[string]string{
+		"X-Amz-Meta-" + checksumMetadataKey: checksum,
+	}
+
+	if s.supportsNativeChecksums() {
+		userMetadata[nativeChecksumHeader] = checksum
+	}
+
 	uploadInfo, err := s.cli.PutObject(ctx, s.BucketName, s.getObjectNameString(b), data.Reader(), int64(data.Length()), minio.PutObjectOptions{
-		ContentType: "application/x-kopia",
+		ContentType:  "application/x-kopia",
+		UserMetadata: userMetadata,
 		// Kopia already splits snapshot contents into small blobs to improve
 		// upload throughput. There is no need for further splitting
 		// through multipart uploads.
@@ -228,6 +289,21 @@ func (s *s3Storage) DeleteBlob(ctx context.Context, b blob.ID) error {
 }
 
 func (s *s3Storage) ExtendBlobRetention(ctx context.Context, b blob.ID, opts blob.ExtendOptions) error {
+	if opts.LegalHold != "" {
+		status := minio.LegalHoldStatus(opts.LegalHold)
+		if !status.IsValid() {
+			return errors.Errorf("invalid legal hold status: %q", opts.LegalHold)
+		}
+
+		if err := s.cli.PutObjectLegalHold(ctx, s.BucketName, s.getObjectNameString(b), minio.PutObjectLegalHoldOptions{
+			Status: &status,
+		}); err != nil {
+			return errors.Wrap(err, "unable to set legal hold")
+		}
+
+		return nil
+	}
+
 	retentionMode := minio.RetentionMode(opts.RetentionMode)
 	if !retentionMode.IsValid() {
 		return errors.Errorf("invalid retention mode: %q", opts.RetentionMode)
@@ -1,14 +1,20 @@
 package s3
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -828,3 +834,147 @@ func customCredentialsAndProvider(accessKey, secretKey, roleARN, region string)
 
 	return credentials.New(cp), cp
 }
+
+// fakeS3Object is an object stored by fakeS3.
+type fakeS3Object struct {
+	data    []byte
+	header  http.Header
+	modTime time.Time
+}
+
+// fakeS3 implements minimal subset of S3 API sufficient to verify checksums,
+// which allows tampering with stored data.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeS3Object
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := readFakeS3Payload(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		h := http.Header{}
+
+		for k, v := range r.Header {
+			if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+				h[k] = v
+			}
+		}
+
+		f.objects[r.URL.Path] = fakeS3Object{data, h, time.Now().Truncate(time.Second)}
+
+		w.Header().Set("ETag", `"etag"`)
+
+	case http.MethodGet, http.MethodHead:
+		o, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+
+			return
+		}
+
+		for k, v := range o.header {
+			w.Header()[k] = v
+		}
+
+		w.Header().Set("ETag", `"etag"`)
+		http.ServeContent(w, r, "", o.modTime, bytes.NewReader(o.data))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// readFakeS3Payload reads the request body, decoding chunks of streaming signed payloads.
+func readFakeS3Payload(r *http.Request) ([]byte, error) {
+	if r.Header.Get("X-Amz-Content-Sha256") != "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		//nolint:wrapcheck
+		return io.ReadAll(r.Body)
+	}
+
+	var result []byte
+
+	br := bufio.NewReader(r.Body)
+
+	for {
+		// each chunk is "<hex-size>;chunk-signature=<signature>\r\n<data>\r\n"
+		line, err := br.ReadString('\n')
+		if err != nil {
+			//nolint:wrapcheck
+			return nil, err
+		}
+
+		size, err := strconv.ParseInt(strings.Split(line, ";")[0], 16, 64)
+		if err != nil {
+			//nolint:wrapcheck
+			return nil, err
+		}
+
+		chunk := make([]byte, size+2) //nolint:mnd
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			//nolint:wrapcheck
+			return nil, err
+		}
+
+		if size == 0 {
+			return result, nil
+		}
+
+		result = append(result, chunk[:size]...)
+	}
+}
+
+// corrupt replaces stored object contents without updating its checksum.
+func (f *fakeS3) corrupt(path string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	o := f.objects[path]
+	o.data = data
+	f.objects[path] = o
+}
+
+func TestS3StorageChecksumMismatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	f := &fakeS3{objects: map[string]fakeS3Object{}}
+
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	st, err := newStorage(ctx, &Options{
+		Endpoint:        strings.TrimPrefix(server.URL, "http://"),
+		AccessKeyID:     minioRootAccessKeyID,
+		SecretAccessKey: minioRootSecretAccessKey,
+		BucketName:      minioBucketName,
+		Region:          minioRegion,
+		DoNotUseTLS:     true,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, st.PutBlob(ctx, "abcd", gather.FromSlice([]byte{1, 2, 3, 4}), blob.PutOptions{}))
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.NoError(t, st.GetBlob(ctx, "abcd", 0, -1, &tmp))
+	require.Equal(t, []byte{1, 2, 3, 4}, tmp.ToByteSlice())
+
+	f.corrupt("/"+minioBucketName+"/abcd", []byte{1, 2, 3, 5})
+
+	require.ErrorIs(t, st.GetBlob(ctx, "abcd", 0, -1, &tmp), blob.ErrChecksumMismatch)
+
+	// partial reads can't be verified.
+	require.NoError(t, st.GetBlob(ctx, "abcd", 0, 2, &tmp))
+}
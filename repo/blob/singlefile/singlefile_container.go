@@ -0,0 +1,551 @@
+package singlefile
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/iocopy"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const (
+	containerFileMode = 0o600
+	lockFileSuffix    = ".lock"
+	compactFileSuffix = ".compact"
+)
+
+// errChecksumMismatch is returned when the contents of a blob don't match the checksum stored in its record.
+var errChecksumMismatch = errors.New("blob checksum mismatch")
+
+// entry describes the location of a blob in the container file.
+type entry struct {
+	recordOffset int64
+	recordSize   int64
+	dataOffset   int64
+	length       int64
+	modTime      time.Time
+	dataCRC      uint32
+}
+
+// container manages a single container file, which is shared by all storage instances
+// using it within the process and locked against concurrent use by other processes.
+type container struct {
+	path     string
+	fileLock *flock.Flock
+
+	// number of storage instances using the container, protected by containersMutex.
+	refCount int
+
+	mu sync.RWMutex
+	// +checklocks:mu
+	f *os.File
+	// +checklocks:mu
+	end int64
+	// +checklocks:mu
+	entries map[blob.ID]entry
+	// +checklocks:mu
+	wastedBytes int64
+
+	// set when a partial record could not be removed from the end of the file. Records appended after it
+	// would be lost when the file is scanned, so writes fail until the file is compacted or reopened.
+	// +checklocks:mu
+	partialRecordErr error
+}
+
+func openContainer(ctx context.Context, path string, isCreate bool) (*container, error) {
+	fileLock := flock.New(path + lockFileSuffix)
+
+	ok, err := fileLock.TryLock()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to lock container file")
+	}
+
+	if !ok {
+		return nil, errors.Errorf("container file %v is in use by another process", path)
+	}
+
+	flags := os.O_RDWR
+	if isCreate {
+		flags |= os.O_CREATE
+	}
+
+	f, err := os.OpenFile(path, flags, containerFileMode) //nolint:gosec
+	if err != nil {
+		fileLock.Unlock() //nolint:errcheck
+		return nil, errors.Wrap(err, "unable to open container file")
+	}
+
+	c := &container{
+		path:     path,
+		fileLock: fileLock,
+		f:        f,
+		entries:  map[blob.ID]entry{},
+	}
+
+	if err := c.load(ctx); err != nil {
+		f.Close()         //nolint:errcheck
+		fileLock.Unlock() //nolint:errcheck
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// load initializes an empty container file or rebuilds the directory of an existing one.
+func (c *container) load(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fi, err := c.f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "unable to stat container file")
+	}
+
+	if fi.Size() == 0 {
+		return c.writeFileHeaderLocked(c.f)
+	}
+
+	hdr := make([]byte, fileHeaderSize)
+	if _, err := c.f.ReadAt(hdr, 0); err != nil || !strings.HasPrefix(string(hdr), fileMagic) {
+		return errors.Errorf("%v is not a container file", c.path)
+	}
+
+	return c.scanLocked(ctx, fi.Size())
+}
+
+// +checklocks:c.mu
+func (c *container) writeFileHeaderLocked(f *os.File) error {
+	hdr := make([]byte, fileHeaderSize)
+	copy(hdr, fileMagic)
+
+	if _, err := f.WriteAt(hdr, 0); err != nil {
+		return errors.Wrap(err, "unable to write container header")
+	}
+
+	c.end = fileHeaderSize
+
+	return errors.Wrap(f.Sync(), "unable to sync container file")
+}
+
+// scanLocked reads all record headers, rebuilding the directory. A trailing partial record, such as one
+// left behind by an interrupted write, is truncated. Invalid records followed by other data are reported
+// as errors, since truncating them would silently discard the blobs stored after them.
+//
+// +checklocks:c.mu
+func (c *container) scanLocked(ctx context.Context, fileSize int64) error {
+	offset := int64(fileHeaderSize)
+	fixed := make([]byte, recordHeaderSize)
+
+	for offset < fileSize {
+		h, err := c.readRecordHeaderLocked(offset, fixed)
+
+		switch {
+		case err == nil && offset+h.size()+h.dataLength <= fileSize:
+			c.applyRecordLocked(h, offset)
+
+			offset += h.size() + h.dataLength
+
+			continue
+
+		case err == nil, errors.Is(err, errPartialRecord):
+			// the record extends past the end of the file.
+
+		case errors.Is(err, errInvalidRecord):
+			// some filesystems leave zeros at the end of files after a crash.
+			zeros, zerr := c.isZeroLocked(offset, fileSize)
+			if zerr != nil {
+				return zerr
+			}
+
+			if !zeros {
+				return errors.Wrapf(err, "invalid record at offset %v of container file %v", offset, c.path)
+			}
+
+		default:
+			return err
+		}
+
+		log(ctx).Warnf("truncating partial record at offset %v of container file %v", offset, c.path)
+
+		if err := c.f.Truncate(offset); err != nil {
+			return errors.Wrap(err, "unable to truncate container file")
+		}
+
+		break
+	}
+
+	c.end = offset
+
+	return nil
+}
+
+// +checklocksread:c.mu
+func (c *container) readRecordHeaderLocked(offset int64, fixed []byte) (recordHeader, error) {
+	if err := c.readAtLocked(fixed, offset); err != nil {
+		return recordHeader{}, err
+	}
+
+	h, idLength, err := decodeFixedHeader(fixed)
+	if err != nil {
+		return h, err
+	}
+
+	full := make([]byte, recordHeaderSize+idLength)
+	copy(full, fixed)
+
+	if err := c.readAtLocked(full[recordHeaderSize:], offset+recordHeaderSize); err != nil {
+		return h, err
+	}
+
+	return h, verifyHeader(&h, full)
+}
+
+// readAtLocked reads len(b) bytes at the provided offset, returning errPartialRecord if the file ends before.
+//
+// +checklocksread:c.mu
+func (c *container) readAtLocked(b []byte, offset int64) error {
+	_, err := c.f.ReadAt(b, offset)
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, io.EOF):
+		return errPartialRecord
+	default:
+		return errors.Wrap(err, "unable to read container file")
+	}
+}
+
+// isZeroLocked returns true if the file contains only zeros between the provided offsets.
+//
+// +checklocksread:c.mu
+func (c *container) isZeroLocked(offset, end int64) (bool, error) {
+	const bufSize = 64 << 10
+
+	buf := make([]byte, bufSize)
+
+	for offset < end {
+		n := min(int64(len(buf)), end-offset)
+
+		if _, err := c.f.ReadAt(buf[:n], offset); err != nil {
+			return false, errors.Wrap(err, "unable to read container file")
+		}
+
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false, nil
+			}
+		}
+
+		offset += n
+	}
+
+	return true, nil
+}
+
+// +checklocks:c.mu
+func (c *container) applyRecordLocked(h recordHeader, offset int64) {
+	if old, ok := c.entries[h.blobID]; ok {
+		c.wastedBytes += old.recordSize
+	}
+
+	switch h.recordType {
+	case recordTypePut:
+		c.entries[h.blobID] = entry{
+			recordOffset: offset,
+			recordSize:   h.size() + h.dataLength,
+			dataOffset:   offset + h.size(),
+			length:       h.dataLength,
+			modTime:      h.modTime,
+			dataCRC:      h.dataCRC,
+		}
+
+	case recordTypeDelete:
+		delete(c.entries, h.blobID)
+
+		// the tombstone itself is only needed until the next compaction.
+		c.wastedBytes += h.size()
+	}
+}
+
+// appendRecordLocked appends a record with the provided data to the end of the file.
+//
+// +checklocks:c.mu
+func (c *container) appendRecordLocked(h recordHeader, data blob.Bytes) error {
+	if c.partialRecordErr != nil {
+		return c.partialRecordErr
+	}
+
+	offset := c.end
+
+	err := c.writeRecordLocked(offset, h, data)
+	if err != nil {
+		// the partial record is truncated when the file is reopened, as long as no other records follow it.
+		if terr := c.f.Truncate(offset); terr != nil {
+			c.partialRecordErr = errors.Wrapf(terr, "unable to remove partial record at offset %v of container file %v", offset, c.path)
+		}
+
+		return err
+	}
+
+	c.applyRecordLocked(h, offset)
+	c.end = offset + h.size() + h.dataLength
+
+	return nil
+}
+
+// +checklocks:c.mu
+func (c *container) writeRecordLocked(offset int64, h recordHeader, data blob.Bytes) error {
+	if _, err := c.f.WriteAt(h.encode(), offset); err != nil {
+		return errors.Wrap(err, "unable to write record header")
+	}
+
+	if data != nil {
+		if _, err := data.WriteTo(io.NewOffsetWriter(c.f, offset+h.size())); err != nil {
+			return errors.Wrap(err, "unable to write blob data")
+		}
+	}
+
+	return errors.Wrap(c.f.Sync(), "unable to sync container file")
+}
+
+func (c *container) putBlob(id blob.ID, data blob.Bytes, opts blob.PutOptions) (time.Time, error) {
+	if len(id) > maxBlobIDLength {
+		return time.Time{}, errors.Errorf("blob ID too long: %v", len(id))
+	}
+
+	crc := crc32.New(crcTable)
+	if _, err := data.WriteTo(crc); err != nil {
+		return time.Time{}, errors.Wrap(err, "unable to compute checksum")
+	}
+
+	modTime := opts.SetModTime
+	if modTime.IsZero() {
+		modTime = clock.Now()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[id]; exists && opts.DoNotRecreate {
+		return time.Time{}, blob.ErrBlobAlreadyExists
+	}
+
+	return modTime, c.appendRecordLocked(recordHeader{
+		recordType: recordTypePut,
+		blobID:     id,
+		dataLength: int64(data.Length()),
+		modTime:    modTime,
+		dataCRC:    crc.Sum32(),
+	}, data)
+}
+
+func (c *container) deleteBlob(id blob.ID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[id]; !ok {
+		return nil
+	}
+
+	return c.appendRecordLocked(recordHeader{
+		recordType: recordTypeDelete,
+		blobID:     id,
+		modTime:    clock.Now(),
+	}, nil)
+}
+
+func (c *container) getMetadata(id blob.ID) (blob.Metadata, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, ok := c.entries[id]
+	if !ok {
+		return blob.Metadata{}, blob.ErrBlobNotFound
+	}
+
+	return blob.Metadata{BlobID: id, Length: e.length, Timestamp: e.modTime}, nil
+}
+
+func (c *container) getBlob(id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, ok := c.entries[id]
+	if !ok {
+		return blob.ErrBlobNotFound
+	}
+
+	fullRead := length < 0 || (offset == 0 && length == e.length)
+	if length < 0 {
+		length = e.length - offset
+	}
+
+	if offset < 0 || offset > e.length || length < 0 || offset+length > e.length {
+		return errors.Wrapf(blob.ErrInvalidRange, "invalid range [%v,%v) of blob with length %v", offset, offset+length, e.length)
+	}
+
+	if !fullRead {
+		return errors.Wrap(iocopy.JustCopy(output, io.NewSectionReader(c.f, e.dataOffset+offset, length)), "error reading blob")
+	}
+
+	crc := crc32.New(crcTable)
+
+	if err := iocopy.JustCopy(io.MultiWriter(output, crc), io.NewSectionReader(c.f, e.dataOffset, e.length)); err != nil {
+		return errors.Wrap(err, "error reading blob")
+	}
+
+	if crc.Sum32() != e.dataCRC {
+		return errors.Wrapf(errChecksumMismatch, "blob %v", id)
+	}
+
+	return nil
+}
+
+// listBlobs returns metadata of all blobs with the provided prefix.
+func (c *container) listBlobs(prefix blob.ID) []blob.Metadata {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var result []blob.Metadata
+
+	for id, e := range c.entries {
+		if strings.HasPrefix(string(id), string(prefix)) {
+			result = append(result, blob.Metadata{BlobID: id, Length: e.length, Timestamp: e.modTime})
+		}
+	}
+
+	return result
+}
+
+// wastedPercent returns the percentage of the file occupied by deleted or overwritten blobs.
+func (c *container) wastedPercent() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return int(c.wastedBytes * 100 / c.end) //nolint:mnd
+}
+
+// shouldCompact returns true when deleted or overwritten blobs occupy at least the provided
+// number of bytes and percentage of the file.
+func (c *container) shouldCompact(minWastedBytes int64, minWastedPercent int) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.wastedBytes > 0 && c.wastedBytes >= minWastedBytes && c.wastedBytes*100/c.end >= int64(minWastedPercent) //nolint:mnd
+}
+
+// compact rewrites the container file so that it only contains records of existing blobs.
+// The new file is written next to the original one and atomically renamed over it.
+// The original file is closed only after it has been replaced, so the container remains
+// usable when compaction fails.
+func (c *container) compact(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.wastedBytes == 0 {
+		return nil
+	}
+
+	tmpPath := c.path + compactFileSuffix
+
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, containerFileMode) //nolint:gosec
+	if err != nil {
+		return errors.Wrap(err, "unable to create compacted file")
+	}
+
+	newEntries, newEnd, err := c.writeCompactedLocked(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if err == nil {
+		err = os.Rename(tmpPath, c.path)
+	}
+
+	if err != nil {
+		tmp.Close()        //nolint:errcheck
+		os.Remove(tmpPath) //nolint:errcheck
+
+		return errors.Wrap(err, "unable to replace container file")
+	}
+
+	log(ctx).Debugf("compacted container %v from %v to %v bytes", c.path, c.end, newEnd)
+
+	old := c.f
+
+	c.f = tmp
+	c.entries = newEntries
+	c.end = newEnd
+	c.wastedBytes = 0
+	c.partialRecordErr = nil
+
+	if err := old.Close(); err != nil {
+		log(ctx).Errorf("unable to close replaced container file %v: %v", c.path, err)
+	}
+
+	return nil
+}
+
+// +checklocks:c.mu
+func (c *container) writeCompactedLocked(tmp *os.File) (map[blob.ID]entry, int64, error) {
+	hdr := make([]byte, fileHeaderSize)
+	copy(hdr, fileMagic)
+
+	if _, err := tmp.WriteAt(hdr, 0); err != nil {
+		return nil, 0, errors.Wrap(err, "unable to write header")
+	}
+
+	// preserve the relative order of records.
+	ids := make([]blob.ID, 0, len(c.entries))
+	for id := range c.entries {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return c.entries[ids[i]].recordOffset < c.entries[ids[j]].recordOffset
+	})
+
+	newEntries := make(map[blob.ID]entry, len(c.entries))
+	offset := int64(fileHeaderSize)
+
+	for _, id := range ids {
+		e := c.entries[id]
+
+		if _, err := io.Copy(io.NewOffsetWriter(tmp, offset), io.NewSectionReader(c.f, e.recordOffset, e.recordSize)); err != nil {
+			return nil, 0, errors.Wrapf(err, "unable to copy blob %v", id)
+		}
+
+		delta := offset - e.recordOffset
+		e.recordOffset += delta
+		e.dataOffset += delta
+		newEntries[id] = e
+
+		offset += e.recordSize
+	}
+
+	return newEntries, offset, nil
+}
+
+func (c *container) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.f.Close()
+
+	if uerr := c.fileLock.Unlock(); err == nil {
+		err = uerr
+	}
+
+	return errors.Wrap(err, "error closing container")
+}
@@ -0,0 +1,117 @@
+package singlefile
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// The container file starts with a fixed header followed by a sequence of records.
+// Each record describes either a stored blob (recordTypePut) or the deletion of a blob (recordTypeDelete):
+//
+//	magic      uint32
+//	type       uint8
+//	idLength   uint16
+//	dataLength uint64
+//	modTime    int64 (unix nanoseconds)
+//	dataCRC    uint32
+//	headerCRC  uint32 (covers all preceding fields and the blob ID)
+//	blob ID    [idLength]byte
+//	data       [dataLength]byte
+//
+// The directory of blobs is rebuilt by scanning record headers when the container is opened,
+// later records for the same blob ID supersede earlier ones.
+const (
+	fileMagic      = "KOPIASF1"
+	fileHeaderSize = 16
+
+	recordMagic      uint32 = 0x4b524543
+	recordHeaderSize        = 4 + 1 + 2 + 8 + 8 + 4 + 4
+
+	recordTypePut    byte = 1
+	recordTypeDelete byte = 2
+
+	maxBlobIDLength = 1<<16 - 1
+)
+
+var (
+	errInvalidRecord = errors.New("invalid record")
+	errPartialRecord = errors.New("partial record")
+)
+
+//nolint:gochecknoglobals
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// recordHeader is the decoded fixed-size header of a record, followed by the blob ID.
+type recordHeader struct {
+	recordType byte
+	blobID     blob.ID
+	dataLength int64
+	modTime    time.Time
+	dataCRC    uint32
+}
+
+func (h *recordHeader) size() int64 {
+	return recordHeaderSize + int64(len(h.blobID))
+}
+
+// encode returns the encoded header including the blob ID.
+func (h *recordHeader) encode() []byte {
+	b := make([]byte, h.size())
+
+	binary.BigEndian.PutUint32(b[0:], recordMagic)
+	b[4] = h.recordType
+	binary.BigEndian.PutUint16(b[5:], uint16(len(h.blobID))) //nolint:gosec
+	binary.BigEndian.PutUint64(b[7:], uint64(h.dataLength))  //nolint:gosec
+	binary.BigEndian.PutUint64(b[15:], uint64(h.modTime.UnixNano()))
+	binary.BigEndian.PutUint32(b[23:], h.dataCRC)
+	copy(b[recordHeaderSize:], h.blobID)
+	binary.BigEndian.PutUint32(b[27:], headerChecksum(b))
+
+	return b
+}
+
+// headerChecksum computes the checksum of the encoded header, excluding the checksum field itself.
+func headerChecksum(b []byte) uint32 {
+	c := crc32.Checksum(b[0:27], crcTable)
+
+	return crc32.Update(c, crcTable, b[recordHeaderSize:])
+}
+
+// decodeFixedHeader decodes the fixed part of the header and returns the length of the blob ID that follows.
+func decodeFixedHeader(b []byte) (h recordHeader, idLength int, err error) {
+	if len(b) < recordHeaderSize || binary.BigEndian.Uint32(b[0:]) != recordMagic {
+		return h, 0, errInvalidRecord
+	}
+
+	h.recordType = b[4]
+	if h.recordType != recordTypePut && h.recordType != recordTypeDelete {
+		return h, 0, errInvalidRecord
+	}
+
+	idLength = int(binary.BigEndian.Uint16(b[5:]))
+	h.dataLength = int64(binary.BigEndian.Uint64(b[7:]))             //nolint:gosec
+	h.modTime = time.Unix(0, int64(binary.BigEndian.Uint64(b[15:]))) //nolint:gosec
+	h.dataCRC = binary.BigEndian.Uint32(b[23:])
+
+	if h.dataLength < 0 {
+		return h, 0, errInvalidRecord
+	}
+
+	return h, idLength, nil
+}
+
+// verifyHeader validates the checksum of the full encoded header and fills in the blob ID.
+func verifyHeader(h *recordHeader, b []byte) error {
+	if binary.BigEndian.Uint32(b[27:]) != headerChecksum(b) {
+		return errInvalidRecord
+	}
+
+	h.blobID = blob.ID(b[recordHeaderSize:])
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package singlefile
+
+import (
+	"github.com/kopia/kopia/repo/blob/throttling"
+)
+
+// Options defines options for single-file container storage.
+type Options struct {
+	// Path of the container file.
+	Path string `json:"path"`
+
+	// AutoCompactPercent is the percentage of the container file occupied by deleted or overwritten
+	// blobs above which the file is compacted when the storage is closed.
+	// Zero means the default, negative values disable automatic compaction.
+	AutoCompactPercent int `json:"autoCompactPercent,omitempty"`
+
+	// AutoCompactWastedBytes is the number of bytes occupied by deleted or overwritten blobs above which
+	// the file is also compacted while in use, provided AutoCompactPercent is reached as well.
+	// Zero means the default, negative values disable compaction while in use.
+	AutoCompactWastedBytes int64 `json:"autoCompactWastedBytes,omitempty"`
+
+	throttling.Limits
+}
@@ -0,0 +1,207 @@
+// Package singlefile implements Storage that keeps all blobs inside a single container file,
+// which makes it easy to move or copy the repository, for example to removable media.
+package singlefile
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.Module("singlefile")
+
+const (
+	singleFileStorageType = "singlefile"
+
+	defaultAutoCompactPercent     = 50
+	defaultAutoCompactWastedBytes = 256 << 20
+)
+
+//nolint:gochecknoglobals
+var (
+	containersMutex sync.Mutex
+	// +checklocks:containersMutex
+	containers = map[string]*container{}
+)
+
+// acquireContainer returns the container for a given path, opening it if it's not already in use by this process.
+func acquireContainer(ctx context.Context, path string, isCreate bool) (*container, error) {
+	containersMutex.Lock()
+	defer containersMutex.Unlock()
+
+	c := containers[path]
+	if c == nil {
+		var err error
+
+		c, err = openContainer(ctx, path, isCreate)
+		if err != nil {
+			return nil, err
+		}
+
+		containers[path] = c
+	}
+
+	c.refCount++
+
+	return c, nil
+}
+
+// releaseContainer releases the container and closes it when it's no longer used, compacting it first if needed.
+func releaseContainer(ctx context.Context, c *container, autoCompactPercent int) error {
+	containersMutex.Lock()
+	defer containersMutex.Unlock()
+
+	c.refCount--
+	if c.refCount > 0 {
+		return nil
+	}
+
+	delete(containers, c.path)
+
+	if autoCompactPercent >= 0 && c.shouldCompact(0, autoCompactPercent) {
+		if err := c.compact(ctx); err != nil {
+			log(ctx).Errorf("unable to compact container %v: %v", c.path, err)
+		}
+	}
+
+	return c.close()
+}
+
+type singleFileStorage struct {
+	Options
+	blob.DefaultProviderImplementation
+
+	c         *container
+	closeOnce sync.Once
+}
+
+func (s *singleFileStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	output.Reset()
+
+	return s.c.getBlob(id, offset, length, output)
+}
+
+func (s *singleFileStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	return s.c.getMetadata(id)
+}
+
+func (s *singleFileStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	if opts.HasRetentionOptions() {
+		return errors.Wrap(blob.ErrUnsupportedPutBlobOption, "blob-retention")
+	}
+
+	modTime, err := s.c.putBlob(id, data, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.GetModTime != nil {
+		*opts.GetModTime = modTime
+	}
+
+	s.maybeCompact(ctx)
+
+	return nil
+}
+
+func (s *singleFileStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	if err := s.c.deleteBlob(id); err != nil {
+		return err
+	}
+
+	s.maybeCompact(ctx)
+
+	return nil
+}
+
+// maybeCompact compacts the container while it's in use, once deleted or overwritten blobs
+// occupy at least AutoCompactWastedBytes and AutoCompactPercent of the file.
+func (s *singleFileStorage) maybeCompact(ctx context.Context) {
+	p := s.autoCompactPercent()
+	if p < 0 || s.AutoCompactWastedBytes < 0 {
+		return
+	}
+
+	minWasted := s.AutoCompactWastedBytes
+	if minWasted == 0 {
+		minWasted = defaultAutoCompactWastedBytes
+	}
+
+	if !s.c.shouldCompact(minWasted, p) {
+		return
+	}
+
+	if err := s.c.compact(ctx); err != nil {
+		log(ctx).Errorf("unable to compact container %v: %v", s.c.path, err)
+	}
+}
+
+func (s *singleFileStorage) autoCompactPercent() int {
+	if s.AutoCompactPercent == 0 {
+		return defaultAutoCompactPercent
+	}
+
+	return s.AutoCompactPercent
+}
+
+func (s *singleFileStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	for _, bm := range s.c.listBlobs(prefix) {
+		if err := callback(bm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *singleFileStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   singleFileStorageType,
+		Config: &s.Options,
+	}
+}
+
+func (s *singleFileStorage) DisplayName() string {
+	return "Single File: " + s.Path
+}
+
+func (s *singleFileStorage) Close(ctx context.Context) error {
+	var err error
+
+	s.closeOnce.Do(func() {
+		err = releaseContainer(ctx, s.c, s.autoCompactPercent())
+	})
+
+	return err
+}
+
+// New creates new single-file container storage with the specified options.
+func New(ctx context.Context, opts *Options, isCreate bool) (blob.Storage, error) {
+	if opts.Path == "" {
+		return nil, errors.New("container file path must be specified")
+	}
+
+	path, err := filepath.Abs(opts.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid path")
+	}
+
+	c, err := acquireContainer(ctx, path, isCreate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &singleFileStorage{
+		Options: *opts,
+		c:       c,
+	}, nil
+}
+
+func init() {
+	blob.AddSupportedStorage(singleFileStorageType, Options{}, New)
+}
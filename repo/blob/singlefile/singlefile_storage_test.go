@@ -0,0 +1,283 @@
+package singlefile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestSingleFileStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	st, err := New(ctx, &Options{
+		Path: filepath.Join(testutil.TempDirectory(t), "repo.kopia"),
+	}, true)
+	require.NoError(t, err)
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+
+	require.NoError(t, st.Close(ctx))
+}
+
+func TestSingleFileStorageMustExistUnlessCreating(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	_, err := New(ctx, &Options{
+		Path: filepath.Join(testutil.TempDirectory(t), "no-such-file"),
+	}, false)
+	require.Error(t, err)
+
+	notContainer := filepath.Join(testutil.TempDirectory(t), "not-container")
+	require.NoError(t, os.WriteFile(notContainer, []byte("some other file contents"), 0o600))
+
+	_, err = New(ctx, &Options{Path: notContainer}, false)
+	require.ErrorContains(t, err, "is not a container file")
+}
+
+func TestSingleFileStorageReopenAndCompact(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	path := filepath.Join(testutil.TempDirectory(t), "repo.kopia")
+
+	// disable compaction on close, so we can observe wasted space after reopening.
+	opt := &Options{Path: path, AutoCompactPercent: -1}
+
+	st, err := New(ctx, opt, true)
+	require.NoError(t, err)
+
+	payload := make([]byte, 10000)
+
+	require.NoError(t, st.PutBlob(ctx, "a", gather.FromSlice(payload), blob.PutOptions{}))
+	require.NoError(t, st.PutBlob(ctx, "b", gather.FromSlice(payload), blob.PutOptions{}))
+	require.NoError(t, st.PutBlob(ctx, "c", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+	require.NoError(t, st.PutBlob(ctx, "c", gather.FromSlice([]byte{4, 5}), blob.PutOptions{}))
+	require.NoError(t, st.DeleteBlob(ctx, "a"))
+	require.NoError(t, st.Close(ctx))
+
+	sizeBefore := fileSize(t, path)
+
+	// the directory is rebuilt from the file.
+	st, err = New(ctx, opt, false)
+	require.NoError(t, err)
+
+	blobtesting.AssertListResults(ctx, t, st, "", "b", "c")
+	blobtesting.AssertGetBlob(ctx, t, st, "c", []byte{4, 5})
+
+	c := st.(*singleFileStorage).c
+	require.Greater(t, c.wastedPercent(), 40)
+
+	require.NoError(t, c.compact(ctx))
+	require.Zero(t, c.wastedPercent())
+
+	blobtesting.AssertListResults(ctx, t, st, "", "b", "c")
+	blobtesting.AssertGetBlob(ctx, t, st, "b", payload)
+	blobtesting.AssertGetBlob(ctx, t, st, "c", []byte{4, 5})
+
+	// the storage remains writable after compaction.
+	require.NoError(t, st.PutBlob(ctx, "d", gather.FromSlice([]byte{6}), blob.PutOptions{}))
+	require.NoError(t, st.Close(ctx))
+
+	require.Less(t, fileSize(t, path), sizeBefore)
+
+	st, err = New(ctx, opt, false)
+	require.NoError(t, err)
+	blobtesting.AssertListResults(ctx, t, st, "", "b", "c", "d")
+	require.NoError(t, st.Close(ctx))
+}
+
+func TestSingleFileStorageAutoCompact(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	path := filepath.Join(testutil.TempDirectory(t), "repo.kopia")
+
+	st, err := New(ctx, &Options{Path: path}, true)
+	require.NoError(t, err)
+
+	require.NoError(t, st.PutBlob(ctx, "a", gather.FromSlice(make([]byte, 10000)), blob.PutOptions{}))
+	require.NoError(t, st.PutBlob(ctx, "b", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+	require.NoError(t, st.DeleteBlob(ctx, "a"))
+	require.NoError(t, st.Close(ctx))
+
+	require.Less(t, fileSize(t, path), int64(1000))
+}
+
+func TestSingleFileStorageAutoCompactWhileInUse(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	path := filepath.Join(testutil.TempDirectory(t), "repo.kopia")
+
+	st, err := New(ctx, &Options{Path: path, AutoCompactWastedBytes: 5000}, true)
+	require.NoError(t, err)
+
+	require.NoError(t, st.PutBlob(ctx, "a", gather.FromSlice(make([]byte, 10000)), blob.PutOptions{}))
+	require.NoError(t, st.PutBlob(ctx, "b", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+	require.NoError(t, st.DeleteBlob(ctx, "a"))
+
+	// compacted without closing the storage.
+	require.Less(t, fileSize(t, path), int64(1000))
+
+	blobtesting.AssertListResults(ctx, t, st, "", "b")
+	blobtesting.AssertGetBlob(ctx, t, st, "b", []byte{1})
+	require.NoError(t, st.Close(ctx))
+}
+
+func TestSingleFileStorageFailedCompactKeepsContainerUsable(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	path := filepath.Join(testutil.TempDirectory(t), "repo.kopia")
+
+	st, err := New(ctx, &Options{Path: path, AutoCompactPercent: -1}, true)
+	require.NoError(t, err)
+
+	require.NoError(t, st.PutBlob(ctx, "a", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+	require.NoError(t, st.PutBlob(ctx, "b", gather.FromSlice([]byte{4, 5, 6, 7}), blob.PutOptions{}))
+	require.NoError(t, st.DeleteBlob(ctx, "a"))
+
+	// make replacing the container file fail, the open file remains usable.
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.MkdirAll(filepath.Join(path, "subdir"), 0o700))
+
+	c := st.(*singleFileStorage).c
+	require.Error(t, c.compact(ctx))
+
+	blobtesting.AssertGetBlob(ctx, t, st, "b", []byte{4, 5, 6, 7})
+	require.NoError(t, st.PutBlob(ctx, "c", gather.FromSlice([]byte{8, 9}), blob.PutOptions{}))
+	blobtesting.AssertGetBlob(ctx, t, st, "c", []byte{8, 9})
+
+	_, err = os.Stat(path + compactFileSuffix)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, st.Close(ctx))
+	require.NoError(t, os.RemoveAll(path))
+}
+
+func TestSingleFileStorageTruncatesPartialRecord(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	path := filepath.Join(testutil.TempDirectory(t), "repo.kopia")
+
+	st, err := New(ctx, &Options{Path: path}, true)
+	require.NoError(t, err)
+	require.NoError(t, st.PutBlob(ctx, "a", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+	require.NoError(t, st.PutBlob(ctx, "b", gather.FromSlice(make([]byte, 1000)), blob.PutOptions{}))
+	require.NoError(t, st.Close(ctx))
+
+	// simulate write of blob "b" interrupted half-way.
+	require.NoError(t, os.Truncate(path, fileSize(t, path)-500))
+
+	st, err = New(ctx, &Options{Path: path}, false)
+	require.NoError(t, err)
+
+	blobtesting.AssertListResults(ctx, t, st, "", "a")
+	require.NoError(t, st.PutBlob(ctx, "c", gather.FromSlice([]byte{4}), blob.PutOptions{}))
+	blobtesting.AssertListResults(ctx, t, st, "", "a", "c")
+	require.NoError(t, st.Close(ctx))
+}
+
+func TestSingleFileStorageTruncatesZeroTail(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	path := filepath.Join(testutil.TempDirectory(t), "repo.kopia")
+
+	st, err := New(ctx, &Options{Path: path}, true)
+	require.NoError(t, err)
+	require.NoError(t, st.PutBlob(ctx, "a", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+	require.NoError(t, st.Close(ctx))
+
+	size := fileSize(t, path)
+
+	// simulate zeros left at the end of the file after a crash.
+	require.NoError(t, os.Truncate(path, size+4096))
+
+	st, err = New(ctx, &Options{Path: path}, false)
+	require.NoError(t, err)
+
+	blobtesting.AssertListResults(ctx, t, st, "", "a")
+	require.NoError(t, st.Close(ctx))
+	require.Equal(t, size, fileSize(t, path))
+}
+
+func TestSingleFileStorageRejectsInvalidRecord(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	path := filepath.Join(testutil.TempDirectory(t), "repo.kopia")
+
+	st, err := New(ctx, &Options{Path: path}, true)
+	require.NoError(t, err)
+	require.NoError(t, st.PutBlob(ctx, "a", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+	require.NoError(t, st.PutBlob(ctx, "b", gather.FromSlice([]byte{4, 5, 6}), blob.PutOptions{}))
+	require.NoError(t, st.PutBlob(ctx, "c", gather.FromSlice([]byte{7, 8, 9}), blob.PutOptions{}))
+	require.NoError(t, st.Close(ctx))
+
+	size := fileSize(t, path)
+
+	// corrupt the header of blob "b", which is followed by blob "c".
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	data[fileHeaderSize+recordHeaderSize+1+3+recordHeaderSize] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	_, err = New(ctx, &Options{Path: path}, false)
+	require.ErrorIs(t, err, errInvalidRecord)
+
+	// the file must not have been truncated.
+	require.Equal(t, size, fileSize(t, path))
+}
+
+func TestSingleFileStorageDetectsCorruption(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	path := filepath.Join(testutil.TempDirectory(t), "repo.kopia")
+
+	st, err := New(ctx, &Options{Path: path}, true)
+	require.NoError(t, err)
+	require.NoError(t, st.PutBlob(ctx, "a", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+	require.NoError(t, st.Close(ctx))
+
+	// flip the last byte of blob data.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	st, err = New(ctx, &Options{Path: path}, false)
+	require.NoError(t, err)
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.ErrorIs(t, st.GetBlob(ctx, "a", 0, -1, &tmp), errChecksumMismatch)
+	require.NoError(t, st.Close(ctx))
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+
+	return fi.Size()
+}
@@ -45,6 +45,11 @@
 // function on a storage implementation that does not have the intended functionality.
 var ErrUnsupportedObjectLock = errors.New("object locking unsupported")
 
+// ErrChecksumMismatch is returned when the contents of a blob read from storage don't match
+// the checksum recorded by the storage provider when the blob was written. Providers storing
+// blobs as plain files (filesystem, SFTP, WebDAV, rclone) have no blob metadata and don't record checksums.
+var ErrChecksumMismatch = errors.New("blob checksum mismatch")
+
 // Bytes encapsulates a sequence of bytes, possibly stored in a non-contiguous buffers,
 // which can be written sequentially or treated as a io.Reader.
 type Bytes interface {
@@ -122,6 +127,21 @@ func (r RetentionMode) IsValid() bool {
 	return r == Governance || r == Compliance
 }
 
+// LegalHold - object legal hold status.
+type LegalHold string
+
+const (
+	// LegalHoldOn - legal hold is placed on the object.
+	LegalHoldOn LegalHold = "ON"
+
+	// LegalHoldOff - legal hold is released.
+	LegalHoldOff LegalHold = "OFF"
+)
+
+func (h LegalHold) String() string {
+	return string(h)
+}
+
 // PutOptions represents put-options for a single BLOB in a storage.
 type PutOptions struct {
 	RetentionMode   RetentionMode
@@ -140,6 +160,9 @@ type PutOptions struct {
 type ExtendOptions struct {
 	RetentionMode   RetentionMode
 	RetentionPeriod time.Duration
+
+	// if not empty, place or release the legal hold on the blob instead of extending its retention period.
+	LegalHold LegalHold
 }
 
 // DefaultProviderImplementation provides a default implementation for
@@ -0,0 +1,246 @@
+package swift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+)
+
+const (
+	objectStoreServiceType = "object-store"
+	publicInterface        = "public"
+	defaultDomainName      = "Default"
+
+	// tokens are renewed when they are about to expire within this time.
+	tokenExpirationMargin = 5 * time.Minute
+)
+
+type keystoneName struct {
+	Name string `json:"name"`
+}
+
+type keystoneUser struct {
+	Name     string       `json:"name"`
+	Domain   keystoneName `json:"domain"`
+	Password string       `json:"password"`
+}
+
+type keystonePasswordIdentity struct {
+	User keystoneUser `json:"user"`
+}
+
+type keystoneApplicationCredential struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+type keystoneIdentity struct {
+	Methods               []string                       `json:"methods"`
+	Password              *keystonePasswordIdentity      `json:"password,omitempty"`
+	ApplicationCredential *keystoneApplicationCredential `json:"application_credential,omitempty"`
+}
+
+type keystoneProject struct {
+	Name   string       `json:"name"`
+	Domain keystoneName `json:"domain"`
+}
+
+type keystoneScope struct {
+	Project keystoneProject `json:"project"`
+}
+
+type keystoneAuth struct {
+	Identity keystoneIdentity `json:"identity"`
+	Scope    *keystoneScope   `json:"scope,omitempty"`
+}
+
+type keystoneAuthRequest struct {
+	Auth keystoneAuth `json:"auth"`
+}
+
+type keystoneAuthResponse struct {
+	Token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+		Catalog   []struct {
+			Type      string `json:"type"`
+			Endpoints []struct {
+				Interface string `json:"interface"`
+				Region    string `json:"region"`
+				URL       string `json:"url"`
+			} `json:"endpoints"`
+		} `json:"catalog"`
+	} `json:"token"`
+}
+
+// authenticator obtains and caches Keystone v3 tokens along with the object-store endpoint.
+type authenticator struct {
+	opt    *Options
+	client *http.Client
+
+	mu sync.Mutex
+	// +checklocks:mu
+	token string
+	// +checklocks:mu
+	storageURL string
+	// +checklocks:mu
+	expiresAt time.Time
+}
+
+func domainOrDefault(n string) keystoneName {
+	if n == "" {
+		n = defaultDomainName
+	}
+
+	return keystoneName{n}
+}
+
+func (a *authenticator) authRequest() (*keystoneAuthRequest, error) {
+	var r keystoneAuthRequest
+
+	switch {
+	case a.opt.ApplicationCredentialID != "":
+		// application credentials are always scoped to the project they were created in.
+		r.Auth.Identity = keystoneIdentity{
+			Methods: []string{"application_credential"},
+			ApplicationCredential: &keystoneApplicationCredential{
+				ID:     a.opt.ApplicationCredentialID,
+				Secret: a.opt.ApplicationCredentialSecret,
+			},
+		}
+
+	case a.opt.Username != "":
+		r.Auth.Identity = keystoneIdentity{
+			Methods: []string{"password"},
+			Password: &keystonePasswordIdentity{
+				User: keystoneUser{
+					Name:     a.opt.Username,
+					Domain:   domainOrDefault(a.opt.UserDomainName),
+					Password: a.opt.Password,
+				},
+			},
+		}
+
+		if a.opt.ProjectName != "" {
+			r.Auth.Scope = &keystoneScope{
+				Project: keystoneProject{
+					Name:   a.opt.ProjectName,
+					Domain: domainOrDefault(a.opt.ProjectDomainName),
+				},
+			}
+		}
+
+	default:
+		return nil, errors.New("either username or application credential must be specified")
+	}
+
+	return &r, nil
+}
+
+// credentials returns a valid token and the storage URL, authenticating if necessary.
+func (a *authenticator) credentials(ctx context.Context) (token, storageURL string, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && clock.Now().Add(tokenExpirationMargin).Before(a.expiresAt) {
+		return a.token, a.storageURL, nil
+	}
+
+	if err := a.authenticateLocked(ctx); err != nil {
+		return "", "", err
+	}
+
+	return a.token, a.storageURL, nil
+}
+
+// invalidate discards the provided token if it's still the current one, forcing re-authentication.
+func (a *authenticator) invalidate(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token == token {
+		a.token = ""
+	}
+}
+
+// +checklocks:a.mu
+func (a *authenticator) authenticateLocked(ctx context.Context) error {
+	ar, err := a.authRequest()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(ar)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal auth request")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(a.opt.AuthURL, "/")+"/auth/tokens", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "unable to create auth request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "unable to authenticate")
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return errors.Errorf("authentication failed: %v", resp.Status)
+	}
+
+	var kr keystoneAuthResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&kr); err != nil {
+		return errors.Wrap(err, "invalid authentication response")
+	}
+
+	token := resp.Header.Get("X-Subject-Token")
+	if token == "" {
+		return errors.New("authentication response did not include a token")
+	}
+
+	storageURL, err := a.findStorageURL(&kr)
+	if err != nil {
+		return err
+	}
+
+	a.token = token
+	a.storageURL = storageURL
+	a.expiresAt = kr.Token.ExpiresAt
+
+	return nil
+}
+
+func (a *authenticator) findStorageURL(kr *keystoneAuthResponse) (string, error) {
+	for _, svc := range kr.Token.Catalog {
+		if svc.Type != objectStoreServiceType {
+			continue
+		}
+
+		for _, ep := range svc.Endpoints {
+			if ep.Interface != publicInterface {
+				continue
+			}
+
+			if a.opt.Region != "" && ep.Region != a.opt.Region {
+				continue
+			}
+
+			return strings.TrimSuffix(ep.URL, "/"), nil
+		}
+	}
+
+	return "", errors.Errorf("object-store endpoint not found in service catalog (region %q)", a.opt.Region)
+}
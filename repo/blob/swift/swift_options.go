@@ -0,0 +1,38 @@
+package swift
+
+import (
+	"github.com/kopia/kopia/repo/blob/throttling"
+)
+
+// Options defines options for OpenStack Swift storage.
+type Options struct {
+	// Container is the name of the Swift container where data is stored.
+	Container string `json:"container"`
+
+	// Prefix specifies additional string to prepend to all objects.
+	Prefix string `json:"prefix,omitempty"`
+
+	// AuthURL is the URL of Keystone v3 identity service, e.g. https://keystone.example.com:5000/v3
+	AuthURL string `json:"authURL"`
+
+	// Username and Password authenticate using the 'password' method, the user is resolved
+	// in UserDomainName and the token is scoped to ProjectName in ProjectDomainName.
+	Username          string `json:"username,omitempty"`
+	Password          string `json:"password,omitempty"          kopia:"sensitive"`
+	UserDomainName    string `json:"userDomainName,omitempty"`
+	ProjectName       string `json:"projectName,omitempty"`
+	ProjectDomainName string `json:"projectDomainName,omitempty"`
+
+	// ApplicationCredentialID and ApplicationCredentialSecret authenticate using the
+	// 'application_credential' method instead of username and password.
+	ApplicationCredentialID     string `json:"applicationCredentialID,omitempty"`
+	ApplicationCredentialSecret string `json:"applicationCredentialSecret,omitempty" kopia:"sensitive"`
+
+	// Region selects the object-store endpoint from the service catalog, if there are several.
+	Region string `json:"region,omitempty"`
+
+	// ListPageSize is the maximum number of objects requested in a single list call.
+	ListPageSize int `json:"listPageSize,omitempty"`
+
+	throttling.Limits
+}
@@ -0,0 +1,420 @@
+// Package swift implements Storage based on an OpenStack Swift container.
+package swift
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/iocopy"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/retrying"
+)
+
+const (
+	swiftStorageType = "swift"
+
+	defaultListPageSize = 1000
+
+	// format of 'last_modified' field in container listings, always in UTC.
+	listingTimeFormat = "2006-01-02T15:04:05.999999"
+)
+
+type swiftStorage struct {
+	Options
+	blob.DefaultProviderImplementation
+
+	client *http.Client
+	auth   *authenticator
+}
+
+type listEntry struct {
+	Name         string `json:"name"`
+	Bytes        int64  `json:"bytes"`
+	LastModified string `json:"last_modified"`
+}
+
+func (s *swiftStorage) objectPath(id blob.ID) string {
+	// object names may contain slashes which must be preserved.
+	return "/" + url.PathEscape(s.Container) + "/" + strings.ReplaceAll(url.PathEscape(s.Prefix+string(id)), "%2F", "/")
+}
+
+// do executes the request against the object-store endpoint, re-authenticating once if the token
+// has been rejected. The returned response always has a 2xx status, other statuses are
+// translated to errors.
+func (s *swiftStorage) do(ctx context.Context, method, path string, query url.Values, header http.Header, body blob.Bytes) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		token, storageURL, err := s.auth.credentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		u := storageURL + path
+		if len(query) > 0 {
+			u += "?" + query.Encode()
+		}
+
+		var rdr io.ReadCloser
+		if body != nil {
+			rdr = body.Reader()
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, u, rdr)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create request")
+		}
+
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		if body != nil {
+			req.ContentLength = int64(body.Length())
+		}
+
+		req.Header.Set("X-Auth-Token", token)
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%v %v", method, path)
+		}
+
+		if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+			return resp, nil
+		}
+
+		resp.Body.Close() //nolint:errcheck
+
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			// token may have been revoked or expired early.
+			s.auth.invalidate(token)
+			continue
+		}
+
+		return nil, translateStatus(method, path, resp)
+	}
+}
+
+func translateStatus(method, path string, resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return blob.ErrBlobNotFound
+	case http.StatusRequestedRangeNotSatisfiable:
+		return blob.ErrInvalidRange
+	case http.StatusPreconditionFailed:
+		return blob.ErrBlobAlreadyExists
+	case http.StatusUnprocessableEntity:
+		return errors.Wrapf(blob.ErrChecksumMismatch, "%v %v", method, path)
+	default:
+		return errors.Errorf("%v %v failed with status %v", method, path, resp.Status)
+	}
+}
+
+func (s *swiftStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	output.Reset()
+
+	if offset < 0 {
+		return blob.ErrInvalidRange
+	}
+
+	if length == 0 {
+		// zero-length ranges can't be expressed using HTTP ranges, only validate the offset.
+		bm, err := s.GetMetadata(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if offset > bm.Length {
+			return errors.Wrapf(blob.ErrInvalidRange, "offset %v exceeds blob length %v", offset, bm.Length)
+		}
+
+		return nil
+	}
+
+	header := http.Header{}
+
+	// Since we're handling encrypted data, there's no point compressing it server-side.
+	header.Set("Accept-Encoding", "identity")
+
+	if length > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%v-%v", offset, offset+length-1))
+	} else if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, s.objectPath(id), nil, header, nil)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		return errors.Errorf("server ignored range request for %v", id)
+	}
+
+	// ETag of a whole object is the MD5 of its contents, computed by Swift when it was written.
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	if !blob.IsFullRead(offset, length) || etag == "" {
+		if err := iocopy.JustCopy(output, resp.Body); err != nil {
+			return errors.Wrap(err, "error reading response")
+		}
+
+		//nolint:wrapcheck
+		return blob.EnsureLengthExactly(output.Length(), length)
+	}
+
+	h := md5.New() //nolint:gosec
+
+	if err := iocopy.JustCopy(io.MultiWriter(output, h), resp.Body); err != nil {
+		return errors.Wrap(err, "error reading response")
+	}
+
+	if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, etag) {
+		return blob.ChecksumMismatchError(id, etag, actual)
+	}
+
+	return nil
+}
+
+func (s *swiftStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	resp, err := s.do(ctx, http.MethodHead, s.objectPath(id), nil, nil, nil)
+	if err != nil {
+		return blob.Metadata{}, err
+	}
+
+	resp.Body.Close() //nolint:errcheck
+
+	t, err := timestampFromHeader(resp.Header)
+	if err != nil {
+		return blob.Metadata{}, err
+	}
+
+	return blob.Metadata{
+		BlobID:    id,
+		Length:    resp.ContentLength,
+		Timestamp: t,
+	}, nil
+}
+
+func (s *swiftStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	switch {
+	case opts.HasRetentionOptions():
+		return errors.Wrap(blob.ErrUnsupportedPutBlobOption, "blob-retention")
+	case !opts.SetModTime.IsZero():
+		return blob.ErrSetTimeUnsupported
+	}
+
+	h := md5.New()  //nolint:gosec
+	data.WriteTo(h) //nolint:errcheck
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	// Swift rejects the upload if the MD5 of received data does not match.
+	header.Set("ETag", hex.EncodeToString(h.Sum(nil)))
+
+	if opts.DoNotRecreate {
+		header.Set("If-None-Match", "*")
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, s.objectPath(id), nil, header, data)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close() //nolint:errcheck
+
+	if opts.GetModTime != nil {
+		t, err := timestampFromHeader(resp.Header)
+		if err != nil {
+			bm, merr := s.GetMetadata(ctx, id)
+			if merr != nil {
+				return errors.Wrap(merr, "unable to get blob modification time")
+			}
+
+			t = bm.Timestamp
+		}
+
+		*opts.GetModTime = t
+	}
+
+	return nil
+}
+
+func (s *swiftStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.objectPath(id), nil, nil, nil)
+	if errors.Is(err, blob.ErrBlobNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close() //nolint:errcheck
+
+	return nil
+}
+
+func (s *swiftStorage) listPage(ctx context.Context, prefix, marker string, limit int) ([]listEntry, error) {
+	resp, err := s.do(ctx, http.MethodGet, "/"+url.PathEscape(s.Container), url.Values{
+		"format": {"json"},
+		"prefix": {prefix},
+		"marker": {marker},
+		"limit":  {strconv.Itoa(limit)},
+	}, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list container")
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode == http.StatusNoContent {
+		// empty container.
+		return nil, nil
+	}
+
+	var entries []listEntry
+
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, errors.Wrap(err, "invalid list response")
+	}
+
+	return entries, nil
+}
+
+func (s *swiftStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	pageSize := s.ListPageSize
+	if pageSize <= 0 {
+		pageSize = defaultListPageSize
+	}
+
+	var marker string
+
+	for {
+		entries, err := s.listPage(ctx, s.Prefix+string(prefix), marker, pageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			t, err := time.Parse(listingTimeFormat, e.LastModified)
+			if err != nil {
+				return errors.Wrapf(err, "invalid modification time of %v", e.Name)
+			}
+
+			if err := callback(blob.Metadata{
+				BlobID:    blob.ID(strings.TrimPrefix(e.Name, s.Prefix)),
+				Length:    e.Bytes,
+				Timestamp: t,
+			}); err != nil {
+				return err
+			}
+
+			marker = e.Name
+		}
+
+		if len(entries) < pageSize {
+			return nil
+		}
+	}
+}
+
+func (s *swiftStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   swiftStorageType,
+		Config: &s.Options,
+	}
+}
+
+func (s *swiftStorage) DisplayName() string {
+	return fmt.Sprintf("Swift: %v", s.Container)
+}
+
+// timestampFromHeader returns object modification time, preferring the precise X-Timestamp
+// over Last-Modified which only has a resolution of one second.
+func timestampFromHeader(h http.Header) (time.Time, error) {
+	if v := h.Get("X-Timestamp"); v != "" {
+		sec, frac, _ := strings.Cut(v, ".")
+
+		s, err := strconv.ParseInt(sec, 10, 64)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "invalid X-Timestamp %q", v)
+		}
+
+		var nanos int64
+
+		if frac != "" {
+			// pad or truncate fraction to 9 digits.
+			frac = (frac + "000000000")[0:9]
+
+			nanos, err = strconv.ParseInt(frac, 10, 64)
+			if err != nil {
+				return time.Time{}, errors.Wrapf(err, "invalid X-Timestamp %q", v)
+			}
+		}
+
+		return time.Unix(s, nanos).UTC(), nil
+	}
+
+	if v := h.Get("Last-Modified"); v != "" {
+		t, err := http.ParseTime(v)
+
+		return t, errors.Wrapf(err, "invalid Last-Modified %q", v)
+	}
+
+	return time.Time{}, errors.New("modification time not returned by the server")
+}
+
+// New creates new OpenStack Swift-backed storage with specified options.
+func New(ctx context.Context, opt *Options, isCreate bool) (blob.Storage, error) {
+	_ = isCreate
+
+	if opt.Container == "" {
+		return nil, errors.New("container must be specified")
+	}
+
+	if opt.AuthURL == "" {
+		return nil, errors.New("auth URL must be specified")
+	}
+
+	client := &http.Client{Transport: http.DefaultTransport}
+
+	s := &swiftStorage{
+		Options: *opt,
+		client:  client,
+	}
+
+	s.auth = &authenticator{
+		opt:    &s.Options,
+		client: client,
+	}
+
+	// verify that the container is accessible.
+	resp, err := s.do(ctx, http.MethodHead, "/"+url.PathEscape(opt.Container), nil, nil, nil)
+	if err != nil {
+		if errors.Is(err, blob.ErrBlobNotFound) {
+			return nil, errors.Errorf("container %q not found", opt.Container)
+		}
+
+		return nil, errors.Wrapf(err, "unable to access container %q", opt.Container)
+	}
+
+	resp.Body.Close() //nolint:errcheck
+
+	return retrying.NewWrapper(s), nil
+}
+
+func init() {
+	blob.AddSupportedStorage(swiftStorageType, Options{}, New)
+}
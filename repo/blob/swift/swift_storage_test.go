@@ -0,0 +1,400 @@
+package swift_test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/providervalidation"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/swift"
+)
+
+const (
+	testContainer = "kopia-test"
+	testUser      = "user"
+	testPassword  = "password"
+	testProject   = "project"
+	testRegion    = "region2"
+)
+
+type fakeObject struct {
+	data    []byte
+	modTime time.Time
+	etag    string
+}
+
+// fakeSwift implements a minimal subset of Keystone v3 and Swift APIs sufficient for tests.
+type fakeSwift struct {
+	mu          sync.Mutex
+	validTokens map[string]bool
+	nextToken   int
+	authCount   int
+	objects     map[string]fakeObject
+	server      *httptest.Server
+}
+
+func newFakeSwift(t *testing.T) *fakeSwift {
+	t.Helper()
+
+	f := &fakeSwift{
+		validTokens: map[string]bool{},
+		objects:     map[string]fakeObject{},
+	}
+
+	m := http.NewServeMux()
+	m.HandleFunc("POST /v3/auth/tokens", f.authenticate)
+	m.HandleFunc("/v1/AUTH_test/{container}", f.container)
+	m.HandleFunc("/v1/AUTH_test/{container}/{object...}", f.object)
+
+	f.server = httptest.NewServer(m)
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+func (f *fakeSwift) revokeTokens() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.validTokens = map[string]bool{}
+}
+
+func (f *fakeSwift) authenticate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Auth struct {
+			Identity struct {
+				Password struct {
+					User struct {
+						Name     string `json:"name"`
+						Password string `json:"password"`
+					} `json:"user"`
+				} `json:"password"`
+			} `json:"identity"`
+			Scope struct {
+				Project struct {
+					Name string `json:"name"`
+				} `json:"project"`
+			} `json:"scope"`
+		} `json:"auth"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	u := req.Auth.Identity.Password.User
+	if u.Name != testUser || u.Password != testPassword || req.Auth.Scope.Project.Name != testProject {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	f.mu.Lock()
+	f.nextToken++
+	f.authCount++
+	token := fmt.Sprintf("token-%v", f.nextToken)
+	f.validTokens[token] = true
+	f.mu.Unlock()
+
+	w.Header().Set("X-Subject-Token", token)
+	w.WriteHeader(http.StatusCreated)
+
+	fmt.Fprintf(w, `{"token":{"expires_at":%q,"catalog":[
+		{"type":"identity","endpoints":[{"interface":"public","region":%q,"url":"http://invalid"}]},
+		{"type":"object-store","endpoints":[
+			{"interface":"internal","region":%q,"url":"http://invalid"},
+			{"interface":"public","region":"region1","url":"http://invalid"},
+			{"interface":"public","region":%q,"url":"%v/v1/AUTH_test/"}
+		]}]}}`, time.Now().Add(time.Hour).Format(time.RFC3339), testRegion, testRegion, testRegion, f.server.URL)
+}
+
+func (f *fakeSwift) checkToken(w http.ResponseWriter, r *http.Request) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.validTokens[r.Header.Get("X-Auth-Token")] {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	if r.PathValue("container") != testContainer {
+		http.Error(w, "not found", http.StatusNotFound)
+		return false
+	}
+
+	return true
+}
+
+func (f *fakeSwift) container(w http.ResponseWriter, r *http.Request) {
+	if !f.checkToken(w, r) {
+		return
+	}
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	q := r.URL.Query()
+	prefix := q.Get("prefix")
+	marker := q.Get("marker")
+
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil {
+		limit = 10000
+	}
+
+	type entry struct {
+		Name         string `json:"name"`
+		Bytes        int    `json:"bytes"`
+		LastModified string `json:"last_modified"`
+	}
+
+	var entries []entry
+
+	f.mu.Lock()
+	for name, o := range f.objects {
+		if strings.HasPrefix(name, prefix) && name > marker {
+			entries = append(entries, entry{name, len(o.data), o.modTime.UTC().Format("2006-01-02T15:04:05.000000")})
+		}
+	}
+	f.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	if len(entries) > limit {
+		entries = entries[0:limit]
+	}
+
+	if len(entries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	json.NewEncoder(w).Encode(entries) //nolint:errcheck
+}
+
+func (f *fakeSwift) object(w http.ResponseWriter, r *http.Request) {
+	if !f.checkToken(w, r) {
+		return
+	}
+
+	name := r.PathValue("object")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	o, exists := f.objects[name]
+
+	switch r.Method {
+	case http.MethodPut:
+		if exists && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		if etag := r.Header.Get("ETag"); etag != "" && etag != md5Hex(data) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+
+		o = fakeObject{data, time.Now().Truncate(time.Microsecond), md5Hex(data)}
+		f.objects[name] = o
+
+		w.Header().Set("Last-Modified", o.modTime.Format(http.TimeFormat))
+		w.WriteHeader(http.StatusCreated)
+
+	case http.MethodDelete:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodHead, http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("X-Timestamp", fmt.Sprintf("%d.%06d", o.modTime.Unix(), o.modTime.Nanosecond()/1000))
+		w.Header().Set("ETag", `"`+o.etag+`"`)
+
+		// ServeContent handles Range headers, including unsatisfiable ranges.
+		http.ServeContent(w, r, "", o.modTime, strings.NewReader(string(o.data)))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// corrupt replaces stored object contents without updating its checksum.
+func (f *fakeSwift) corrupt(name string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	o := f.objects[name]
+	o.data = data
+	f.objects[name] = o
+}
+
+func md5Hex(data []byte) string {
+	h := md5.Sum(data) //nolint:gosec
+
+	return hex.EncodeToString(h[:])
+}
+
+func (f *fakeSwift) options() *swift.Options {
+	return &swift.Options{
+		Container:   testContainer,
+		AuthURL:     f.server.URL + "/v3",
+		Username:    testUser,
+		Password:    testPassword,
+		ProjectName: testProject,
+		Region:      testRegion,
+	}
+}
+
+func TestSwiftStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	f := newFakeSwift(t)
+
+	st, err := swift.New(ctx, f.options(), false)
+	require.NoError(t, err)
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+	require.NoError(t, st.Close(ctx))
+}
+
+func TestSwiftStorageProviderValidation(t *testing.T) {
+	t.Parallel()
+	testutil.ProviderTest(t)
+
+	ctx := testlogging.Context(t)
+	f := newFakeSwift(t)
+
+	st, err := swift.New(ctx, f.options(), false)
+	require.NoError(t, err)
+
+	require.NoError(t, providervalidation.ValidateProvider(ctx, st, blobtesting.TestValidationOptions))
+	require.NoError(t, st.Close(ctx))
+}
+
+func TestSwiftStorageWithPrefixAndPagination(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	f := newFakeSwift(t)
+
+	opt := f.options()
+	opt.Prefix = "some/prefix/"
+	opt.ListPageSize = 3
+
+	st, err := swift.New(ctx, opt, false)
+	require.NoError(t, err)
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+
+	f.mu.Lock()
+	for name := range f.objects {
+		require.True(t, strings.HasPrefix(name, "some/prefix/"), name)
+	}
+	f.mu.Unlock()
+}
+
+func TestSwiftStorageReauthenticates(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	f := newFakeSwift(t)
+
+	st, err := swift.New(ctx, f.options(), false)
+	require.NoError(t, err)
+
+	require.NoError(t, st.PutBlob(ctx, "abcd", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+
+	f.revokeTokens()
+
+	_, err = st.GetMetadata(ctx, "abcd")
+	require.NoError(t, err)
+	require.Equal(t, 2, f.authCount)
+}
+
+func TestSwiftStorageErrors(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	f := newFakeSwift(t)
+
+	opt := f.options()
+	opt.Password = "wrong"
+
+	_, err := swift.New(ctx, opt, false)
+	require.ErrorContains(t, err, "authentication failed")
+
+	opt = f.options()
+	opt.Container = "no-such-container"
+
+	_, err = swift.New(ctx, opt, false)
+	require.ErrorContains(t, err, "not found")
+
+	opt = f.options()
+	opt.Region = "no-such-region"
+
+	_, err = swift.New(ctx, opt, false)
+	require.ErrorContains(t, err, "object-store endpoint not found")
+}
+
+func TestSwiftStorageChecksumMismatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	f := newFakeSwift(t)
+
+	st, err := swift.New(ctx, f.options(), false)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	require.NoError(t, st.PutBlob(ctx, "abcd", gather.FromSlice([]byte{1, 2, 3, 4}), blob.PutOptions{}))
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.NoError(t, st.GetBlob(ctx, "abcd", 0, -1, &tmp))
+
+	f.corrupt("abcd", []byte{1, 2, 3, 5})
+
+	require.ErrorIs(t, st.GetBlob(ctx, "abcd", 0, -1, &tmp), blob.ErrChecksumMismatch)
+
+	// partial reads can't be verified.
+	require.NoError(t, st.GetBlob(ctx, "abcd", 0, 2, &tmp))
+}
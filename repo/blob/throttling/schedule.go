@@ -0,0 +1,258 @@
+package throttling
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
+)
+
+const unlimitedValue = "unlimited"
+
+//nolint:gochecknoglobals
+var dayNames = map[string][]time.Weekday{
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// ScheduleWindow overrides upload and download limits during a window of local time of day,
+// optionally restricted to certain days of the week.
+type ScheduleWindow struct {
+	// Days when the window starts, each one of 'mon'...'sun', 'weekdays' or 'weekends'. Empty means every day.
+	Days []string `json:"days,omitempty"`
+
+	// Start and End are local times of day in HH:MM format. When End is not after Start, the window spans midnight.
+	Start string `json:"start"`
+	End   string `json:"end"`
+
+	// Limits applied during the window, nil means the limit is not overridden and zero means unlimited.
+	UploadBytesPerSecond   *float64 `json:"maxUploadSpeedBytesPerSecond,omitempty"`
+	DownloadBytesPerSecond *float64 `json:"maxDownloadSpeedBytesPerSecond,omitempty"`
+}
+
+func parseTimeOfDay(s string) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, errors.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+
+	h, err := strconv.Atoi(hh)
+	if err != nil || h < 0 || h > 24 {
+		return 0, errors.Errorf("invalid hour in %q", s)
+	}
+
+	m, err := strconv.Atoi(mm)
+	if err != nil || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, errors.Errorf("invalid minute in %q", s)
+	}
+
+	return h*60 + m, nil //nolint:mnd
+}
+
+func (w ScheduleWindow) startsOn(d time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+
+	for _, n := range w.Days {
+		for _, wd := range dayNames[n] {
+			if wd == d {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Validate checks that the window is well-formed.
+func (w ScheduleWindow) Validate() error {
+	for _, d := range w.Days {
+		if _, ok := dayNames[d]; !ok {
+			return errors.Errorf("invalid day %q", d)
+		}
+	}
+
+	start, err := parseTimeOfDay(w.Start)
+	if err != nil {
+		return errors.Wrap(err, "start")
+	}
+
+	end, err := parseTimeOfDay(w.End)
+	if err != nil {
+		return errors.Wrap(err, "end")
+	}
+
+	if start == end {
+		return errors.New("window must not be empty")
+	}
+
+	if v := w.UploadBytesPerSecond; v != nil && *v < 0 {
+		return errors.New("upload limit must not be negative")
+	}
+
+	if v := w.DownloadBytesPerSecond; v != nil && *v < 0 {
+		return errors.New("download limit must not be negative")
+	}
+
+	return nil
+}
+
+// Contains returns true if the provided time is within the window.
+func (w ScheduleWindow) Contains(t time.Time) bool {
+	start, err := parseTimeOfDay(w.Start)
+	if err != nil {
+		return false
+	}
+
+	end, err := parseTimeOfDay(w.End)
+	if err != nil {
+		return false
+	}
+
+	t = t.Local()
+	now := t.Hour()*60 + t.Minute() //nolint:mnd
+
+	if start < end {
+		return now >= start && now < end && w.startsOn(t.Weekday())
+	}
+
+	// window spans midnight, it may have started today or yesterday.
+	if now >= start {
+		return w.startsOn(t.Weekday())
+	}
+
+	if now < end {
+		return w.startsOn(t.AddDate(0, 0, -1).Weekday())
+	}
+
+	return false
+}
+
+func limitString(v *float64) string {
+	switch {
+	case v == nil:
+		return "(unchanged)"
+	case *v == 0:
+		return unlimitedValue
+	default:
+		return units.BytesPerSecondsString(*v)
+	}
+}
+
+func (w ScheduleWindow) String() string {
+	days := "daily"
+	if len(w.Days) > 0 {
+		days = strings.Join(w.Days, ",")
+	}
+
+	return fmt.Sprintf("%v %v-%v upload:%v download:%v", days, w.Start, w.End, limitString(w.UploadBytesPerSecond), limitString(w.DownloadBytesPerSecond))
+}
+
+func parseScheduleLimit(s string) (*float64, error) {
+	if s == unlimitedValue {
+		v := 0.0
+		return &v, nil
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return nil, errors.Errorf("invalid limit %q", s)
+	}
+
+	return &v, nil
+}
+
+// ParseScheduleWindow parses the window from a string such as 'weekdays 09:00-17:00 upload=5000000 download=unlimited'.
+// Days are optional and limits are expressed in bytes per second.
+func ParseScheduleWindow(s string) (ScheduleWindow, error) {
+	var w ScheduleWindow
+
+	fields := strings.Fields(s)
+	if len(fields) > 0 && !strings.Contains(fields[0], ":") {
+		w.Days = strings.Split(fields[0], ",")
+		fields = fields[1:]
+	}
+
+	if len(fields) == 0 {
+		return w, errors.Errorf("missing time range in %q", s)
+	}
+
+	var ok bool
+
+	w.Start, w.End, ok = strings.Cut(fields[0], "-")
+	if !ok {
+		return w, errors.Errorf("invalid time range %q, expected HH:MM-HH:MM", fields[0])
+	}
+
+	for _, f := range fields[1:] {
+		k, v, _ := strings.Cut(f, "=")
+
+		lim, err := parseScheduleLimit(v)
+		if err != nil {
+			return w, err
+		}
+
+		switch k {
+		case "upload":
+			w.UploadBytesPerSecond = lim
+		case "download":
+			w.DownloadBytesPerSecond = lim
+		default:
+			return w, errors.Errorf("unknown limit %q, expected 'upload' or 'download'", k)
+		}
+	}
+
+	return w, w.Validate()
+}
+
+// ActiveScheduleWindow returns the index of the first schedule window containing the provided time or -1.
+func (l Limits) ActiveScheduleWindow(t time.Time) int {
+	for i, w := range l.Schedule {
+		if w.Contains(t) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// effective returns limits with the overrides from the provided schedule window applied.
+func (l Limits) effective(windowIndex int) Limits {
+	if windowIndex < 0 {
+		return l
+	}
+
+	w := l.Schedule[windowIndex]
+
+	if w.UploadBytesPerSecond != nil {
+		l.UploadBytesPerSecond = *w.UploadBytesPerSecond
+	}
+
+	if w.DownloadBytesPerSecond != nil {
+		l.DownloadBytesPerSecond = *w.DownloadBytesPerSecond
+	}
+
+	return l
+}
+
+func (l Limits) validateSchedule() error {
+	for i, w := range l.Schedule {
+		if err := w.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid schedule window #%v", i)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package throttling
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
+
+func TestParseScheduleWindow(t *testing.T) {
+	cases := []struct {
+		input   string
+		want    ScheduleWindow
+		wantErr string
+	}{
+		{
+			input: "weekdays 09:00-17:00 upload=5000000",
+			want:  ScheduleWindow{Days: []string{"weekdays"}, Start: "09:00", End: "17:00", UploadBytesPerSecond: float64Ptr(5000000)},
+		},
+		{
+			input: "22:00-06:00 upload=unlimited download=unlimited",
+			want:  ScheduleWindow{Start: "22:00", End: "06:00", UploadBytesPerSecond: float64Ptr(0), DownloadBytesPerSecond: float64Ptr(0)},
+		},
+		{
+			input: "sat,sun 00:00-24:00 download=1000",
+			want:  ScheduleWindow{Days: []string{"sat", "sun"}, Start: "00:00", End: "24:00", DownloadBytesPerSecond: float64Ptr(1000)},
+		},
+		{input: "", wantErr: "missing time range"},
+		{input: "weekdays", wantErr: "missing time range"},
+		{input: "09:00", wantErr: "invalid time range"},
+		{input: "someday 09:00-10:00", wantErr: "invalid day"},
+		{input: "09:00-09:00", wantErr: "must not be empty"},
+		{input: "25:00-09:00", wantErr: "invalid hour"},
+		{input: "09:60-10:00", wantErr: "invalid minute"},
+		{input: "09:00-10:00 upload=-1", wantErr: "invalid limit"},
+		{input: "09:00-10:00 upload=fast", wantErr: "invalid limit"},
+		{input: "09:00-10:00 reads=10", wantErr: "unknown limit"},
+	}
+
+	for _, tc := range cases {
+		got, err := ParseScheduleWindow(tc.input)
+		if tc.wantErr != "" {
+			require.ErrorContains(t, err, tc.wantErr, tc.input)
+			continue
+		}
+
+		require.NoError(t, err, tc.input)
+		require.Equal(t, tc.want, got, tc.input)
+	}
+}
+
+func TestScheduleWindowContains(t *testing.T) {
+	// 2024-01-01 was a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.Local)
+	}
+
+	business := ScheduleWindow{Days: []string{"weekdays"}, Start: "09:00", End: "17:00"}
+	require.False(t, business.Contains(at(1, 8, 59)))
+	require.True(t, business.Contains(at(1, 9, 0)))
+	require.True(t, business.Contains(at(5, 16, 59)))
+	require.False(t, business.Contains(at(5, 17, 0)))
+	require.False(t, business.Contains(at(6, 12, 0)))
+
+	// window spanning midnight belongs to the day it started.
+	fridayNight := ScheduleWindow{Days: []string{"fri"}, Start: "22:00", End: "06:00"}
+	require.False(t, fridayNight.Contains(at(5, 5, 0)))
+	require.True(t, fridayNight.Contains(at(5, 22, 0)))
+	require.True(t, fridayNight.Contains(at(6, 5, 59)))
+	require.False(t, fridayNight.Contains(at(6, 6, 0)))
+	require.False(t, fridayNight.Contains(at(6, 22, 0)))
+
+	allDay := ScheduleWindow{Start: "00:00", End: "24:00"}
+	require.True(t, allDay.Contains(at(3, 0, 0)))
+	require.True(t, allDay.Contains(at(3, 23, 59)))
+}
+
+func TestThrottlerSchedule(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local)
+
+	limits := Limits{
+		UploadBytesPerSecond:   1000,
+		DownloadBytesPerSecond: 2000,
+		Schedule: []ScheduleWindow{
+			{Days: []string{"weekdays"}, Start: "09:00", End: "17:00", UploadBytesPerSecond: float64Ptr(100)},
+			{Start: "22:00", End: "06:00", UploadBytesPerSecond: float64Ptr(0), DownloadBytesPerSecond: float64Ptr(0)},
+		},
+	}
+
+	th, err := NewThrottler(limits, time.Second, 0)
+	require.NoError(t, err)
+
+	tbt := th.(*tokenBucketBasedThrottler)
+	tbt.timeNow = func() time.Time { return now }
+
+	// re-apply limits using fake time.
+	require.NoError(t, th.SetLimits(limits))
+
+	verify := func(wantWindow int, wantUpload, wantDownload float64) {
+		t.Helper()
+
+		th.BeforeOperation(ctx, operationListBlobs)
+
+		w, ok := th.ActiveScheduleWindow()
+		if wantWindow < 0 {
+			require.False(t, ok)
+		} else {
+			require.True(t, ok)
+			require.Equal(t, limits.Schedule[wantWindow], w)
+		}
+
+		require.InDelta(t, wantUpload, tbt.upload.maxTokens, 0.001)
+		require.InDelta(t, wantDownload, tbt.download.maxTokens, 0.001)
+
+		// configured limits are never modified by the schedule.
+		require.Equal(t, limits, th.Limits())
+	}
+
+	verify(-1, 1000, 2000)
+
+	now = time.Date(2024, 1, 1, 8, 59, 30, 0, time.Local)
+	verify(-1, 1000, 2000)
+
+	// schedule is only re-evaluated periodically.
+	now = time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+	verify(-1, 1000, 2000)
+
+	now = now.Add(scheduleCheckInterval)
+	verify(0, 100, 2000)
+
+	now = time.Date(2024, 1, 1, 23, 0, 0, 0, time.Local)
+	verify(1, 0, 0)
+
+	now = time.Date(2024, 1, 6, 12, 0, 0, 0, time.Local)
+	verify(-1, 1000, 2000)
+
+	// setting limits applies schedule immediately.
+	now = time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local)
+	require.NoError(t, th.SetLimits(limits))
+	verify(0, 100, 2000)
+
+	bad := limits
+	bad.Schedule = []ScheduleWindow{{Start: "10:00", End: "10:00"}}
+	require.ErrorContains(t, th.SetLimits(bad), "invalid schedule window #0")
+	require.Equal(t, limits, th.Limits())
+}
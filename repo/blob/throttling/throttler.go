@@ -6,6 +6,8 @@
 	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
 )
 
 // SettableThrottler exposes methods to set throttling limits.
@@ -15,8 +17,14 @@ type SettableThrottler interface {
 	Limits() Limits
 	SetLimits(limits Limits) error
 	OnUpdate(handler UpdatedHandler)
+
+	// ActiveScheduleWindow returns the schedule window currently in effect, if any.
+	ActiveScheduleWindow() (ScheduleWindow, bool)
 }
 
+// scheduleCheckInterval is how often the throttler checks whether a different schedule window became active.
+const scheduleCheckInterval = time.Minute
+
 // UpdatedHandler is invoked as part of SetLimits() after limits are updated.
 type UpdatedHandler func(l Limits) error
 
@@ -24,6 +32,12 @@ type tokenBucketBasedThrottler struct {
 	mu sync.Mutex
 	// +checklocks:mu
 	limits Limits
+	// +checklocks:mu
+	activeWindow int
+	// +checklocks:mu
+	nextScheduleCheck time.Time
+
+	timeNow func() time.Time
 
 	readOps  *tokenBucket
 	writeOps *tokenBucket
@@ -40,6 +54,8 @@ type tokenBucketBasedThrottler struct {
 }
 
 func (t *tokenBucketBasedThrottler) BeforeOperation(ctx context.Context, op string) {
+	t.maybeApplySchedule(ctx)
+
 	switch op {
 	case operationListBlobs:
 		t.listOps.Take(ctx, 1)
@@ -74,6 +90,53 @@ func (t *tokenBucketBasedThrottler) BeforeUpload(ctx context.Context, numBytes i
 	t.upload.Take(ctx, float64(numBytes))
 }
 
+// maybeApplySchedule periodically re-evaluates the schedule and switches limits when a different window becomes active.
+func (t *tokenBucketBasedThrottler) maybeApplySchedule(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.limits.Schedule) == 0 {
+		return
+	}
+
+	now := t.timeNow()
+	if now.Before(t.nextScheduleCheck) {
+		return
+	}
+
+	t.nextScheduleCheck = now.Add(scheduleCheckInterval)
+
+	w := t.limits.ActiveScheduleWindow(now)
+	if w == t.activeWindow {
+		return
+	}
+
+	// schedule windows only override bandwidth, leave other limits (notably semaphores) alone.
+	if err := t.setBandwidthLimits(t.limits.effective(w)); err != nil {
+		log(ctx).Errorf("unable to apply throttling schedule: %v", err)
+		return
+	}
+
+	if w >= 0 {
+		log(ctx).Debugf("activated throttling schedule window %v", t.limits.Schedule[w])
+	} else {
+		log(ctx).Debugf("throttling schedule window no longer active")
+	}
+
+	t.activeWindow = w
+}
+
+func (t *tokenBucketBasedThrottler) ActiveScheduleWindow() (ScheduleWindow, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.activeWindow < 0 {
+		return ScheduleWindow{}, false
+	}
+
+	return t.limits.Schedule[t.activeWindow], true
+}
+
 func (t *tokenBucketBasedThrottler) Limits() Limits {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -86,12 +149,21 @@ func (t *tokenBucketBasedThrottler) SetLimits(limits Limits) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if err := t.setLimits(limits); err != nil {
-		_ = t.setLimits(t.limits)
+	if err := limits.validateSchedule(); err != nil {
+		return err
+	}
+
+	now := t.timeNow()
+	w := limits.ActiveScheduleWindow(now)
+
+	if err := t.setLimits(limits.effective(w)); err != nil {
+		_ = t.setLimits(t.limits.effective(t.activeWindow))
 		return err
 	}
 
 	t.limits = limits
+	t.activeWindow = w
+	t.nextScheduleCheck = now.Add(scheduleCheckInterval)
 
 	for _, h := range t.onUpdate {
 		if err := h(limits); err != nil {
@@ -115,12 +187,8 @@ func (t *tokenBucketBasedThrottler) setLimits(limits Limits) error {
 		return errors.Wrap(err, "ListsPerSecond")
 	}
 
-	if err := t.upload.SetLimit(limits.UploadBytesPerSecond * t.window.Seconds()); err != nil {
-		return errors.Wrap(err, "UploadBytesPerSecond")
-	}
-
-	if err := t.download.SetLimit(limits.DownloadBytesPerSecond * t.window.Seconds()); err != nil {
-		return errors.Wrap(err, "DownloadBytesPerSecond")
+	if err := t.setBandwidthLimits(limits); err != nil {
+		return err
 	}
 
 	if err := t.concurrentReads.SetLimit(limits.ConcurrentReads); err != nil {
@@ -134,6 +202,18 @@ func (t *tokenBucketBasedThrottler) setLimits(limits Limits) error {
 	return nil
 }
 
+func (t *tokenBucketBasedThrottler) setBandwidthLimits(limits Limits) error {
+	if err := t.upload.SetLimit(limits.UploadBytesPerSecond * t.window.Seconds()); err != nil {
+		return errors.Wrap(err, "UploadBytesPerSecond")
+	}
+
+	if err := t.download.SetLimit(limits.DownloadBytesPerSecond * t.window.Seconds()); err != nil {
+		return errors.Wrap(err, "DownloadBytesPerSecond")
+	}
+
+	return nil
+}
+
 func (t *tokenBucketBasedThrottler) OnUpdate(handler UpdatedHandler) {
 	t.onUpdate = append(t.onUpdate, handler)
 }
@@ -147,6 +227,9 @@ type Limits struct {
 	DownloadBytesPerSecond float64 `json:"maxDownloadSpeedBytesPerSecond,omitempty"`
 	ConcurrentReads        int     `json:"concurrentReads,omitempty"`
 	ConcurrentWrites       int     `json:"concurrentWrites,omitempty"`
+
+	// Schedule overrides upload and download limits during certain times, the first matching window wins.
+	Schedule []ScheduleWindow `json:"schedule,omitempty"`
 }
 
 var _ Throttler = (*tokenBucketBasedThrottler)(nil)
@@ -162,6 +245,8 @@ func NewThrottler(limits Limits, window time.Duration, initialFillRatio float64)
 		concurrentReads:  newSemaphore(),
 		concurrentWrites: newSemaphore(),
 		window:           window,
+		activeWindow:     -1,
+		timeNow:          clock.Now,
 	}
 
 	if err := t.SetLimits(limits); err != nil {
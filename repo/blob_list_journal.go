@@ -0,0 +1,145 @@
+package repo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/cache"
+	"github.com/kopia/kopia/internal/crypto"
+	"github.com/kopia/kopia/internal/feature"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/listjournal"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+	"github.com/kopia/kopia/repo/blob/sharded"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/format"
+)
+
+const blobListJournalCacheSubdir = "blob-list-journal"
+
+// BlobListJournalFeature is required to open repositories using the blob list journal, since clients
+// which don't record their pack blob writes and deletions in the journal would make it inconsistent.
+const BlobListJournalFeature feature.Feature = "blob-list-journal"
+
+//nolint:gochecknoglobals
+var blobListJournalPurpose = []byte("blob-list-journal")
+
+func blobListJournalHMACSecret(fmgr *format.Manager) []byte {
+	return crypto.DeriveKeyFromMasterKey(fmgr.GetHmacSecret(), fmgr.UniqueID(), blobListJournalPurpose, localCacheIntegrityHMACSecretLength)
+}
+
+// maybeAddBlobListJournal wraps the storage with blob listing journal if it has been enabled for the repository.
+func maybeAddBlobListJournal(ctx context.Context, st blob.Storage, fmgr *format.Manager, cacheOpts *content.CachingOptions) (blob.Storage, error) {
+	enabled, err := listjournal.IsEnabled(ctx, st)
+	if err != nil || !enabled {
+		return st, err //nolint:wrapcheck
+	}
+
+	var cacheStorage blob.Storage
+
+	if cacheOpts.CacheDirectory != "" {
+		dir := filepath.Join(cacheOpts.CacheDirectory, blobListJournalCacheSubdir)
+
+		if err := os.MkdirAll(dir, cache.DirMode); err != nil {
+			return nil, errors.Wrap(err, "error creating blob list journal cache directory")
+		}
+
+		cacheStorage, err = filesystem.New(ctx, &filesystem.Options{
+			Path: dir,
+			Options: sharded.Options{
+				DirectoryShards: []int{},
+			},
+		}, false)
+		if err != nil {
+			return nil, errors.Wrap(err, "error opening blob list journal cache")
+		}
+	}
+
+	return listjournal.NewWrapper(st, cacheStorage, content.PackBlobIDPrefixes, blobListJournalHMACSecret(fmgr)), nil
+}
+
+// SetBlobListJournalEnabled enables or disables the persistent journal of pack blob writes and deletions
+// used to serve pack blob listings. While enabled, the repository requires BlobListJournalFeature,
+// so versions of kopia without journal support can't open it.
+//
+// Running clients don't pick up the change, they must disconnect and re-connect to the repository.
+func SetBlobListJournalEnabled(ctx context.Context, rep DirectRepositoryWriter, enabled bool) error {
+	st := rep.BlobStorage()
+
+	isEnabled, err := listjournal.IsEnabled(ctx, st)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine blob list journal status")
+	}
+
+	if !enabled {
+		if isEnabled {
+			if err := listjournal.DeleteAll(ctx, st); err != nil {
+				return errors.Wrap(err, "error deleting blob list journal")
+			}
+		}
+
+		return setBlobListJournalFeatureRequired(ctx, rep.FormatManager(), false)
+	}
+
+	// require the feature before the journal is enabled, so that clients which don't update it can't write to the repository.
+	if err := setBlobListJournalFeatureRequired(ctx, rep.FormatManager(), true); err != nil {
+		return err
+	}
+
+	if isEnabled {
+		return nil
+	}
+
+	// write initial checkpoint before the marker, so that clients never see the journal enabled without one.
+	if _, _, err := listjournal.Reconcile(ctx, listjournal.NewWrapper(st, nil, content.PackBlobIDPrefixes, blobListJournalHMACSecret(rep.FormatManager()))); err != nil {
+		return errors.Wrap(err, "error writing initial blob list journal checkpoint")
+	}
+
+	return errors.Wrap(st.PutBlob(ctx, listjournal.MarkerBlobID, gather.FromSlice([]byte{}), blob.PutOptions{}), "error writing blob list journal marker")
+}
+
+// setBlobListJournalFeatureRequired adds or removes BlobListJournalFeature from the required features of the repository.
+func setBlobListJournalFeatureRequired(ctx context.Context, fmgr *format.Manager, required bool) error {
+	requiredFeatures, err := fmgr.RequiredFeatures(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to get required features")
+	}
+
+	var updated []feature.Required
+
+	for _, f := range requiredFeatures {
+		if f.Feature != BlobListJournalFeature {
+			updated = append(updated, f)
+		}
+	}
+
+	if required {
+		updated = append(updated, feature.Required{
+			Feature: BlobListJournalFeature,
+			IfNotUnderstood: feature.IfNotUnderstood{
+				Message: "The repository uses the journal of pack blob writes and deletions to list pack blobs.",
+			},
+		})
+	}
+
+	if len(updated) == len(requiredFeatures) {
+		// the feature is already required or not required as requested.
+		return nil
+	}
+
+	mp, err := fmgr.GetMutableParameters(ctx)
+	if err != nil {
+		return errors.Wrap(err, "mutable parameters")
+	}
+
+	blobcfg, err := fmgr.BlobCfgBlob(ctx)
+	if err != nil {
+		return errors.Wrap(err, "blob configuration")
+	}
+
+	return errors.Wrap(fmgr.SetParameters(ctx, mp, blobcfg, updated), "error setting required features")
+}
@@ -13,6 +13,7 @@
 	HeaderZstdFastest           HeaderID = 0x1101
 	HeaderZstdBetterCompression HeaderID = 0x1102
 	HeaderZstdBestCompression   HeaderID = 0x1103
+	HeaderZstdDictionary        HeaderID = 0x1110
 
 	headerS2Default   HeaderID = 0x1200
 	headerS2Better    HeaderID = 0x1201
@@ -28,4 +29,10 @@
 	headerDeflateDefault         HeaderID = 0x1500
 	headerDeflateBestSpeed       HeaderID = 0x1501
 	headerDeflateBestCompression HeaderID = 0x1502
+
+	headerBrotliDefault           HeaderID = 0x1600
+	headerBrotliBetterCompression HeaderID = 0x1601
+	headerBrotliBestCompression   HeaderID = 0x1602
+
+	headerXZDefault HeaderID = 0x1700
 )
@@ -30,6 +30,7 @@ type Compressor interface {
 	ByName         = map[Name]Compressor{}
 	HeaderIDToName = map[HeaderID]Name{}
 	IsDeprecated   = map[Name]bool{}
+	IsArchival     = map[Name]bool{}
 )
 
 // RegisterCompressor registers the provided compressor implementation.
@@ -54,6 +55,14 @@ func RegisterDeprecatedCompressor(name Name, c Compressor) {
 	IsDeprecated[name] = true
 }
 
+// RegisterArchivalCompressor registers the provided compressor implementation, which favors compression ratio
+// over speed and is meant for data which is written once and rarely read.
+func RegisterArchivalCompressor(name Name, c Compressor) {
+	RegisterCompressor(name, c)
+
+	IsArchival[name] = true
+}
+
 func compressionHeader(id HeaderID) []byte {
 	b := make([]byte, compressionHeaderSize)
 	binary.BigEndian.PutUint32(b, uint32(id))
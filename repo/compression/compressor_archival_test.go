@@ -0,0 +1,95 @@
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchivalCompressors_RoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	text := makeTextLikeData(rnd, 200000)
+
+	for name := range IsArchival {
+		comp := ByName[name]
+
+		for _, data := range [][]byte{nil, {1}, text} {
+			t.Run(fmt.Sprintf("%v-%v", name, len(data)), func(t *testing.T) {
+				compressed := mustCompress(t, comp, data)
+				require.Equal(t, data, nonNil(mustDecompress(t, comp, compressed)))
+
+				var viaHeader bytes.Buffer
+
+				require.NoError(t, DecompressByHeader(&viaHeader, bytes.NewReader(compressed)))
+				require.Equal(t, data, nonNil(viaHeader.Bytes()))
+			})
+		}
+	}
+
+	// archival compressors favor compression ratio.
+	require.Less(t, len(mustCompress(t, ByName["brotli-best-compression"], text)), len(mustCompress(t, ByName["gzip-best-compression"], text)))
+}
+
+func TestArchivalCompressors_CorruptedInput(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	data := makeTextLikeData(rnd, 100000)
+
+	for name := range IsArchival {
+		t.Run(string(name), func(t *testing.T) {
+			comp := ByName[name]
+			compressed := mustCompress(t, comp, data)
+
+			// truncated data
+			for _, n := range []int{compressionHeaderSize, compressionHeaderSize + 1, len(compressed) / 2, len(compressed) - 1} {
+				var out bytes.Buffer
+
+				require.Error(t, comp.Decompress(&out, bytes.NewReader(compressed[:n]), true), "truncated to %v", n)
+			}
+
+			// garbage after the header
+			garbage := append(append([]byte{}, compressed[:compressionHeaderSize]...), bytes.Repeat([]byte{0xff}, 1000)...)
+			require.Error(t, comp.Decompress(&bytes.Buffer{}, bytes.NewReader(garbage), true))
+
+			// corrupted bytes never silently decompress to the original data
+			for range 20 {
+				corrupted := append([]byte{}, compressed...)
+				corrupted[compressionHeaderSize+rnd.Intn(len(corrupted)-compressionHeaderSize)] ^= byte(1 + rnd.Intn(255))
+
+				var out bytes.Buffer
+
+				if err := comp.Decompress(&out, bytes.NewReader(corrupted), true); err == nil {
+					require.NotEqual(t, data, out.Bytes())
+				}
+			}
+		})
+	}
+}
+
+func makeTextLikeData(rnd *rand.Rand, size int) []byte {
+	words := []string{"the", "quick", "brown", "fox", "jumps", "over", "lazy", "dog", "archive", "snapshot", "repository", "content", "kopia", "backup"}
+
+	var buf bytes.Buffer
+
+	for buf.Len() < size {
+		buf.WriteString(words[rnd.Intn(len(words))])
+
+		if rnd.Intn(10) == 0 {
+			fmt.Fprintf(&buf, " %v.\n", rnd.Intn(1000))
+		} else {
+			buf.WriteString(" ")
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func nonNil(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+
+	return b
+}
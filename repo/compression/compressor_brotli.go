@@ -0,0 +1,86 @@
+package compression
+
+import (
+	"io"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/freepool"
+	"github.com/kopia/kopia/internal/iocopy"
+)
+
+func init() {
+	RegisterArchivalCompressor("brotli", newBrotliCompressor(headerBrotliDefault, brotli.DefaultCompression))
+	RegisterArchivalCompressor("brotli-better-compression", newBrotliCompressor(headerBrotliBetterCompression, 9)) //nolint:mnd
+	RegisterArchivalCompressor("brotli-best-compression", newBrotliCompressor(headerBrotliBestCompression, brotli.BestCompression))
+}
+
+func newBrotliCompressor(id HeaderID, quality int) Compressor {
+	return &brotliCompressor{id, compressionHeader(id), sync.Pool{
+		New: func() interface{} {
+			return brotli.NewWriterLevel(io.Discard, quality)
+		},
+	}}
+}
+
+type brotliCompressor struct {
+	id     HeaderID
+	header []byte
+	pool   sync.Pool
+}
+
+func (c *brotliCompressor) HeaderID() HeaderID {
+	return c.id
+}
+
+func (c *brotliCompressor) Compress(output io.Writer, input io.Reader) error {
+	if _, err := output.Write(c.header); err != nil {
+		return errors.Wrap(err, "unable to write header")
+	}
+
+	//nolint:forcetypeassert
+	w := c.pool.Get().(*brotli.Writer)
+	defer c.pool.Put(w)
+
+	w.Reset(output)
+
+	if err := iocopy.JustCopy(w, input); err != nil {
+		return errors.Wrap(err, "compression error")
+	}
+
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "compression close error")
+	}
+
+	return nil
+}
+
+//nolint:gochecknoglobals
+var brotliDecoderPool = freepool.New(func() *brotli.Reader {
+	return brotli.NewReader(nil)
+}, func(v *brotli.Reader) {
+	mustSucceed(v.Reset(nil))
+})
+
+func (c *brotliCompressor) Decompress(output io.Writer, input io.Reader, withHeader bool) error {
+	if withHeader {
+		if err := verifyCompressionHeader(input, c.header); err != nil {
+			return err
+		}
+	}
+
+	dec := brotliDecoderPool.Take()
+	defer brotliDecoderPool.Return(dec)
+
+	if err := dec.Reset(input); err != nil {
+		return errors.Wrap(err, "decompression reset error")
+	}
+
+	if err := iocopy.JustCopy(output, dec); err != nil {
+		return errors.Wrap(err, "decompression error")
+	}
+
+	return nil
+}
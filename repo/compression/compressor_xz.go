@@ -0,0 +1,69 @@
+package compression
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+
+	"github.com/kopia/kopia/internal/iocopy"
+)
+
+func init() {
+	RegisterArchivalCompressor("xz", newXZCompressor(headerXZDefault))
+}
+
+// newXZCompressor returns a compressor producing xz streams using LZMA2 compression.
+func newXZCompressor(id HeaderID) Compressor {
+	return &xzCompressor{id, compressionHeader(id)}
+}
+
+type xzCompressor struct {
+	id     HeaderID
+	header []byte
+}
+
+func (c *xzCompressor) HeaderID() HeaderID {
+	return c.id
+}
+
+func (c *xzCompressor) Compress(output io.Writer, input io.Reader) error {
+	if _, err := output.Write(c.header); err != nil {
+		return errors.Wrap(err, "unable to write header")
+	}
+
+	// xz writers can't be reset, so they are not pooled.
+	w, err := xz.NewWriter(output)
+	if err != nil {
+		return errors.Wrap(err, "unable to create compressor")
+	}
+
+	if err := iocopy.JustCopy(w, input); err != nil {
+		return errors.Wrap(err, "compression error")
+	}
+
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "compression close error")
+	}
+
+	return nil
+}
+
+func (c *xzCompressor) Decompress(output io.Writer, input io.Reader, withHeader bool) error {
+	if withHeader {
+		if err := verifyCompressionHeader(input, c.header); err != nil {
+			return err
+		}
+	}
+
+	r, err := xz.ReaderConfig{SingleStream: true}.NewReader(input)
+	if err != nil {
+		return errors.Wrap(err, "decompression error")
+	}
+
+	if err := iocopy.JustCopy(output, r); err != nil {
+		return errors.Wrap(err, "decompression error")
+	}
+
+	return nil
+}
@@ -0,0 +1,349 @@
+package compression
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/freepool"
+	"github.com/kopia/kopia/internal/iocopy"
+)
+
+const zstdDictionaryIDSize = 4
+
+// ErrDictionaryNotFound is returned when decompressing data compressed using an unknown dictionary.
+var ErrDictionaryNotFound = errors.New("compression dictionary not found")
+
+func init() {
+	// without dictionaries, the compressor produces regular zstd frames, which can be read by any
+	// instance of the compressor. Repositories substitute a compressor using their trained dictionaries.
+	RegisterCompressor("zstd-dictionary", mustNewZstdDictionaryCompressor())
+}
+
+func mustNewZstdDictionaryCompressor() Compressor {
+	c, err := NewZstdDictionaryCompressor()
+	mustSucceed(err)
+
+	return c
+}
+
+// NewZstdDictionaryCompressor returns a compressor which compresses using the first of the provided zstd dictionaries
+// and decompresses data compressed with any of them. The ID of the dictionary is stored after the compression header,
+// so that data compressed using older dictionaries remains readable.
+func NewZstdDictionaryCompressor(dicts ...[]byte) (Compressor, error) {
+	c := &zstdDictionaryCompressor{
+		header: compressionHeader(HeaderZstdDictionary),
+		known:  map[uint32]bool{0: true},
+	}
+
+	for _, d := range dicts {
+		id, err := ZstdDictionaryID(d)
+		if err != nil {
+			return nil, err
+		}
+
+		c.known[id] = true
+	}
+
+	encoderOptions := []zstd.EOption{zstd.WithEncoderLevel(zstd.SpeedDefault)}
+	decoderOptions := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+
+	if len(dicts) > 0 {
+		c.activeID, _ = ZstdDictionaryID(dicts[0])
+
+		encoderOptions = append(encoderOptions, zstd.WithEncoderDict(dicts[0]))
+		decoderOptions = append(decoderOptions, zstd.WithDecoderDicts(dicts...))
+	}
+
+	// verify options once, so that the pools never fail to create encoders and decoders.
+	if _, err := zstd.NewWriter(io.Discard, encoderOptions...); err != nil {
+		return nil, errors.Wrap(err, "invalid dictionary")
+	}
+
+	if _, err := zstd.NewReader(nil, decoderOptions...); err != nil {
+		return nil, errors.Wrap(err, "invalid dictionary")
+	}
+
+	c.encoders = sync.Pool{
+		New: func() interface{} {
+			w, err := zstd.NewWriter(io.Discard, encoderOptions...)
+			mustSucceed(err)
+			return w
+		},
+	}
+
+	c.decoders = freepool.New(func() *zstd.Decoder {
+		r, err := zstd.NewReader(nil, decoderOptions...)
+		mustSucceed(err)
+		return r
+	}, func(v *zstd.Decoder) {
+		mustSucceed(v.Reset(nil))
+	})
+
+	return c, nil
+}
+
+type zstdDictionaryCompressor struct {
+	header   []byte
+	activeID uint32
+	known    map[uint32]bool
+	encoders sync.Pool
+	decoders *freepool.Pool[zstd.Decoder]
+}
+
+func (c *zstdDictionaryCompressor) HeaderID() HeaderID {
+	return HeaderZstdDictionary
+}
+
+func (c *zstdDictionaryCompressor) Compress(output io.Writer, input io.Reader) error {
+	if _, err := output.Write(c.header); err != nil {
+		return errors.Wrap(err, "unable to write header")
+	}
+
+	if _, err := output.Write(binary.BigEndian.AppendUint32(nil, c.activeID)); err != nil {
+		return errors.Wrap(err, "unable to write dictionary ID")
+	}
+
+	//nolint:forcetypeassert
+	w := c.encoders.Get().(*zstd.Encoder)
+	defer c.encoders.Put(w)
+
+	w.Reset(output)
+
+	if err := iocopy.JustCopy(w, input); err != nil {
+		return errors.Wrap(err, "compression error")
+	}
+
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "compression close error")
+	}
+
+	return nil
+}
+
+func (c *zstdDictionaryCompressor) Decompress(output io.Writer, input io.Reader, withHeader bool) error {
+	if withHeader {
+		if err := verifyCompressionHeader(input, c.header); err != nil {
+			return err
+		}
+	}
+
+	var b [zstdDictionaryIDSize]byte
+
+	if _, err := io.ReadFull(input, b[:]); err != nil {
+		return errors.Wrap(err, "error reading dictionary ID")
+	}
+
+	if id := binary.BigEndian.Uint32(b[:]); !c.known[id] {
+		return errors.Wrapf(ErrDictionaryNotFound, "dictionary %08x", id)
+	}
+
+	dec := c.decoders.Take()
+	defer c.decoders.Return(dec)
+
+	if err := dec.Reset(input); err != nil {
+		return errors.Wrap(err, "decompression reset error")
+	}
+
+	if err := iocopy.JustCopy(output, dec); err != nil {
+		return errors.Wrap(err, "decompression error")
+	}
+
+	return nil
+}
+
+// ZstdDictionaryID returns the ID of the provided zstd dictionary.
+func ZstdDictionaryID(dict []byte) (uint32, error) {
+	d, err := zstd.InspectDictionary(dict)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid dictionary")
+	}
+
+	return d.ID(), nil
+}
+
+const (
+	// length of the sequences of bytes counted when training dictionaries, must be 8.
+	zstdTrainDmerSize = 8
+
+	// size of the segments of samples selected to be included in dictionaries.
+	zstdTrainSegmentSize = 64
+
+	// minimum number of sequences in a segment, which must be shared with other samples for the segment to be selected.
+	zstdTrainMinSharedDmers = 8
+
+	// number of bits of the hash table counting the number of samples containing each sequence.
+	zstdTrainHashBits = 21
+)
+
+// TrainZstdDictionary builds a zstd dictionary of up to maxSize bytes with the provided ID from the samples.
+//
+// The content of the dictionary is made of segments of the samples containing the byte sequences shared by
+// the largest number of samples, with the most valuable segments last, where they are cheapest to reference.
+func TrainZstdDictionary(id uint32, samples [][]byte, maxSize int) ([]byte, error) {
+	if id == 0 {
+		return nil, errors.New("dictionary ID must not be zero")
+	}
+
+	var usable [][]byte
+
+	for _, s := range samples {
+		if len(s) >= zstdTrainDmerSize {
+			usable = append(usable, s)
+		}
+	}
+
+	if len(usable) == 0 {
+		return nil, errors.New("no samples to train the dictionary")
+	}
+
+	t := newZstdTrainer(usable)
+
+	history := t.selectSegments(maxSize)
+	if len(history) < zstdTrainSegmentSize {
+		return nil, errors.New("samples do not have enough data in common to train the dictionary")
+	}
+
+	dict, err := zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       id,
+		Contents: usable,
+		History:  history,
+		Offsets:  [3]int{1, 4, 8}, //nolint:mnd
+		Level:    zstd.SpeedDefault,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to build dictionary")
+	}
+
+	return dict, nil
+}
+
+type zstdTrainer struct {
+	samples [][]byte
+
+	// number of samples containing the sequences of bytes hashing to each slot.
+	freq []uint32
+}
+
+type zstdTrainSegment struct {
+	sample int
+	offset int
+	score  uint64
+}
+
+func newZstdTrainer(samples [][]byte) *zstdTrainer {
+	t := &zstdTrainer{
+		samples: samples,
+		freq:    make([]uint32, 1<<zstdTrainHashBits),
+	}
+
+	// sample (plus one) which last incremented each slot, so that each sample counts once.
+	lastSample := make([]uint32, 1<<zstdTrainHashBits)
+
+	for i, s := range samples {
+		for p := 0; p+zstdTrainDmerSize <= len(s); p++ {
+			slot := zstdTrainSlot(s[p:])
+
+			if lastSample[slot] != uint32(i+1) {
+				lastSample[slot] = uint32(i + 1)
+				t.freq[slot]++
+			}
+		}
+	}
+
+	return t
+}
+
+func zstdTrainSlot(b []byte) uint32 {
+	return uint32((binary.LittleEndian.Uint64(b) * 0x9e3779b97f4a7c15) >> (64 - zstdTrainHashBits)) //nolint:mnd
+}
+
+// score returns the sum of the number of samples containing sequences in the segment, excluding
+// sequences contained in only one sample, which are useless in dictionaries. Segments sharing
+// too few sequences with other samples, including those only sharing hash collisions, score zero.
+func (t *zstdTrainer) score(seg zstdTrainSegment) uint64 {
+	var total, shared uint64
+
+	b := t.samples[seg.sample][seg.offset : seg.offset+zstdTrainSegmentSize]
+
+	for p := 0; p+zstdTrainDmerSize <= len(b); p++ {
+		if f := t.freq[zstdTrainSlot(b[p:])]; f > 1 {
+			total += uint64(f)
+			shared++
+		}
+	}
+
+	if shared < zstdTrainMinSharedDmers {
+		return 0
+	}
+
+	return total
+}
+
+// selectSegments greedily selects the segments with the best scores, updating the scores after each selection
+// so that sequences already present in the dictionary are not counted again.
+func (t *zstdTrainer) selectSegments(maxSize int) []byte {
+	var candidates []zstdTrainSegment
+
+	for i, s := range t.samples {
+		// consider segments overlapping by half.
+		for p := 0; p+zstdTrainSegmentSize <= len(s); p += zstdTrainSegmentSize / 2 { //nolint:mnd
+			seg := zstdTrainSegment{sample: i, offset: p}
+
+			if seg.score = t.score(seg); seg.score > 0 {
+				candidates = append(candidates, seg)
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	var selected []zstdTrainSegment
+
+	// scores only decrease as segments are selected, so a segment whose updated score is not lower than
+	// the initial score of the next candidate is the best one.
+	for len(candidates) > 0 && (len(selected)+1)*zstdTrainSegmentSize <= maxSize {
+		best := candidates[0]
+		candidates = candidates[1:]
+
+		best.score = t.score(best)
+		if best.score == 0 {
+			continue
+		}
+
+		if len(candidates) > 0 && best.score < candidates[0].score {
+			// re-insert the segment with the updated score.
+			n := sort.Search(len(candidates), func(i int) bool {
+				return candidates[i].score < best.score
+			})
+
+			candidates = append(candidates, zstdTrainSegment{})
+			copy(candidates[n+1:], candidates[n:])
+			candidates[n] = best
+
+			continue
+		}
+
+		selected = append(selected, best)
+
+		b := t.samples[best.sample][best.offset : best.offset+zstdTrainSegmentSize]
+		for p := 0; p+zstdTrainDmerSize <= len(b); p++ {
+			t.freq[zstdTrainSlot(b[p:])] = 0
+		}
+	}
+
+	history := make([]byte, 0, len(selected)*zstdTrainSegmentSize)
+
+	for i := len(selected) - 1; i >= 0; i-- {
+		s := selected[i]
+		history = append(history, t.samples[s.sample][s.offset:s.offset+zstdTrainSegmentSize]...)
+	}
+
+	return history
+}
@@ -0,0 +1,120 @@
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestZstdDictionary(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	var samples [][]byte
+
+	for range 500 {
+		samples = append(samples, makeDirectoryLikeSample(rnd))
+	}
+
+	_, err := TrainZstdDictionary(0, samples, 16<<10)
+	require.Error(t, err)
+
+	dict1, err := TrainZstdDictionary(0x12345678, samples, 16<<10)
+	require.NoError(t, err)
+
+	id, err := ZstdDictionaryID(dict1)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0x12345678), id)
+
+	dict2, err := TrainZstdDictionary(0x23456789, samples[100:], 16<<10)
+	require.NoError(t, err)
+
+	c1, err := NewZstdDictionaryCompressor(dict1)
+	require.NoError(t, err)
+
+	// after retraining, the new dictionary is used for compression and the old one remains readable.
+	c2, err := NewZstdDictionaryCompressor(dict2, dict1)
+	require.NoError(t, err)
+
+	data := makeDirectoryLikeSample(rnd)
+
+	withoutDictionary := mustCompress(t, ByName["zstd"], data)
+	compressed1 := mustCompress(t, c1, data)
+	compressed2 := mustCompress(t, c2, data)
+
+	require.Less(t, len(compressed1), len(withoutDictionary)*3/4)
+	require.Less(t, len(compressed2), len(withoutDictionary)*3/4)
+
+	require.Equal(t, data, mustDecompress(t, c1, compressed1))
+	require.Equal(t, data, mustDecompress(t, c2, compressed1))
+	require.Equal(t, data, mustDecompress(t, c2, compressed2))
+
+	// the compressor registered without dictionaries and compressors with older dictionaries
+	// can't decompress data compressed using unknown dictionaries.
+	require.ErrorIs(t, ByName["zstd-dictionary"].Decompress(&bytes.Buffer{}, bytes.NewReader(compressed1), true), ErrDictionaryNotFound)
+	require.ErrorIs(t, c1.Decompress(&bytes.Buffer{}, bytes.NewReader(compressed2), true), ErrDictionaryNotFound)
+
+	// data compressed without dictionaries can be read by all.
+	compressed0 := mustCompress(t, ByName["zstd-dictionary"], data)
+	require.Equal(t, data, mustDecompress(t, c2, compressed0))
+}
+
+func TestZstdDictionary_NotEnoughData(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	var samples [][]byte
+
+	for range 10 {
+		b := make([]byte, 1000)
+		rnd.Read(b)
+
+		samples = append(samples, b)
+	}
+
+	_, err := TrainZstdDictionary(0x12345678, samples, 16<<10)
+	require.Error(t, err)
+
+	_, err = TrainZstdDictionary(0x12345678, nil, 16<<10)
+	require.Error(t, err)
+}
+
+func makeDirectoryLikeSample(rnd *rand.Rand) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString(`{"stream":"kopia:directory","entries":[`)
+
+	for i := range 5 + rnd.Intn(5) {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+
+		fmt.Fprintf(&buf, `{"name":"file-%x.txt","type":"f","mode":"0644","mtime":"2024-01-%02dT10:%02d:00.%09dZ","uid":1000,"gid":1000,"obj":"%032x","size":%v}`,
+			rnd.Int63(), 1+rnd.Intn(28), rnd.Intn(60), rnd.Intn(1e9), rnd.Int63(), rnd.Intn(100000))
+	}
+
+	buf.WriteString(`],"summary":{"size":12345,"files":5,"symlinks":0,"dirs":0,"maxTime":"2024-01-01T10:00:00Z","numFailed":0}}`)
+
+	return buf.Bytes()
+}
+
+func mustCompress(t *testing.T, c Compressor, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	require.NoError(t, c.Compress(&buf, bytes.NewReader(data)))
+
+	return buf.Bytes()
+}
+
+func mustDecompress(t *testing.T, c Compressor, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	require.NoError(t, c.Decompress(&buf, bytes.NewReader(data), true))
+
+	return buf.Bytes()
+}
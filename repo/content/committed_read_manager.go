@@ -25,6 +25,7 @@
 	"github.com/kopia/kopia/repo/blob/sharded"
 	"github.com/kopia/kopia/repo/compression"
 	"github.com/kopia/kopia/repo/content/indexblob"
+	"github.com/kopia/kopia/repo/encryption"
 	"github.com/kopia/kopia/repo/format"
 	"github.com/kopia/kopia/repo/hashing"
 	"github.com/kopia/kopia/repo/logging"
@@ -96,6 +97,8 @@ type SharedManager struct {
 
 	format format.Provider
 
+	zstdDictionaries zstdDictionaryCache
+
 	checkInvariantsOnUnlock bool
 	minPreambleLength       int
 	maxPreambleLength       int
@@ -195,7 +198,7 @@ func (sm *SharedManager) attemptReadPackFileLocalIndex(ctx context.Context, pack
 	}
 
 	return errors.Wrap(
-		sm.decryptAndVerify(encryptedLocalIndexBytes.Bytes(), postamble.localIndexIV, output),
+		sm.decryptAndVerify(sm.format.Encryptor(), encryptedLocalIndexBytes.Bytes(), postamble.localIndexIV, output),
 		"unable to decrypt local index")
 }
 
@@ -282,29 +285,29 @@ func (sm *SharedManager) indexBlobManager(ctx context.Context) (indexblob.Manage
 	return q, nil
 }
 
-func (sm *SharedManager) decryptContentAndVerify(payload gather.Bytes, bi Info, output *gather.WriteBuffer) error {
+func (sm *SharedManager) decryptContentAndVerify(ctx context.Context, payload gather.Bytes, bi Info, output *gather.WriteBuffer) error {
 	sm.Stats.readContent(payload.Length())
 
 	var hashBuf [hashing.MaxHashSize]byte
 
 	iv := getPackedContentIV(hashBuf[:0], bi.ContentID)
 
-	// reserved for future use
-	if k := bi.EncryptionKeyID; k != 0 {
-		return errors.Errorf("unsupported encryption key ID: %v", k)
+	enc, err := sm.format.EncryptorForKeyID(ctx, bi.EncryptionKeyID)
+	if err != nil {
+		return errors.Wrapf(err, "unable to decrypt content %v", bi.ContentID)
 	}
 
 	h := bi.CompressionHeaderID
 	if h == 0 {
 		return errors.Wrapf(
-			sm.decryptAndVerify(payload, iv, output),
+			sm.decryptAndVerify(enc, payload, iv, output),
 			"invalid checksum at %v offset %v length %v/%v", bi.PackBlobID, bi.PackOffset, bi.PackedLength, payload.Length())
 	}
 
 	var tmp gather.WriteBuffer
 	defer tmp.Close()
 
-	if err := sm.decryptAndVerify(payload, iv, &tmp); err != nil {
+	if err := sm.decryptAndVerify(enc, payload, iv, &tmp); err != nil {
 		return errors.Wrapf(err, "invalid checksum at %v offset %v length %v/%v", bi.PackBlobID, bi.PackOffset, bi.PackedLength, payload.Length())
 	}
 
@@ -315,7 +318,11 @@ func (sm *SharedManager) decryptContentAndVerify(payload gather.Bytes, bi Info,
 
 	t0 := timetrack.StartTimer()
 
-	if err := c.Decompress(output, tmp.Bytes().Reader(), true); err != nil {
+	if h == compression.HeaderZstdDictionary {
+		if err := sm.decompressWithZstdDictionary(ctx, output, tmp.Bytes()); err != nil {
+			return errors.Wrap(err, "error decompressing")
+		}
+	} else if err := c.Decompress(output, tmp.Bytes().Reader(), true); err != nil {
 		return errors.Wrap(err, "error decompressing")
 	}
 
@@ -324,10 +331,10 @@ func (sm *SharedManager) decryptContentAndVerify(payload gather.Bytes, bi Info,
 	return nil
 }
 
-func (sm *SharedManager) decryptAndVerify(encrypted gather.Bytes, iv []byte, output *gather.WriteBuffer) error {
+func (sm *SharedManager) decryptAndVerify(enc encryption.Encryptor, encrypted gather.Bytes, iv []byte, output *gather.WriteBuffer) error {
 	t0 := timetrack.StartTimer()
 
-	if err := sm.format.Encryptor().Decrypt(encrypted, iv, output); err != nil {
+	if err := enc.Decrypt(encrypted, iv, output); err != nil {
 		sm.Stats.foundInvalidContent()
 		return errors.Wrap(err, "decrypt")
 	}
@@ -260,8 +260,10 @@ func (bm *WriteManager) addToPackUnlocked(ctx context.Context, contentID ID, dat
 	var compressedAndEncrypted gather.WriteBuffer
 	defer compressedAndEncrypted.Close()
 
+	keyID := bm.format.GetActiveEncryptionKeyID()
+
 	// encrypt and compress before taking lock
-	actualComp, err := bm.maybeCompressAndEncryptDataForPacking(data, contentID, comp, &compressedAndEncrypted, mp)
+	actualComp, err := bm.maybeCompressAndEncryptDataForPacking(ctx, data, contentID, comp, keyID, &compressedAndEncrypted, mp)
 	if err != nil {
 		return errors.Wrapf(err, "unable to encrypt %q", contentID)
 	}
@@ -313,6 +315,7 @@ func (bm *WriteManager) addToPackUnlocked(ctx context.Context, contentID ID, dat
 		TimestampSeconds: bm.contentWriteTime(previousWriteTime),
 		FormatVersion:    byte(mp.Version),
 		OriginalLength:   uint32(data.Length()),
+		EncryptionKeyID:  keyID,
 	}
 
 	if _, err := compressedAndEncrypted.Bytes().WriteTo(pp.currentPackData); err != nil {
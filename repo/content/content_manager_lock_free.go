@@ -24,7 +24,7 @@
 
 const indexBlobCompactionWarningThreshold = 1000
 
-func (sm *SharedManager) maybeCompressAndEncryptDataForPacking(data gather.Bytes, contentID ID, comp compression.HeaderID, output *gather.WriteBuffer, mp format.MutableParameters) (compression.HeaderID, error) {
+func (sm *SharedManager) maybeCompressAndEncryptDataForPacking(ctx context.Context, data gather.Bytes, contentID ID, comp compression.HeaderID, keyID byte, output *gather.WriteBuffer, mp format.MutableParameters) (compression.HeaderID, error) {
 	var hashOutput [hashing.MaxHashSize]byte
 
 	iv := getPackedContentIV(hashOutput[:0], contentID)
@@ -34,6 +34,16 @@ func (sm *SharedManager) maybeCompressAndEncryptDataForPacking(data gather.Bytes
 	if contentID.HasPrefix() && comp == NoCompression && mp.IndexVersion >= index.Version2 {
 		// 'zstd-fastest' has a good mix of being fast, low memory usage and high compression for JSON.
 		comp = compression.HeaderZstdFastest
+
+		// dictionaries trained on repository contents improve compression of small metadata contents.
+		if contentID.Prefix() != ZstdDictionaryContentPrefix && sm.zstdDictionaryCompressorForWriting(ctx) != nil {
+			comp = compression.HeaderZstdDictionary
+		}
+	}
+
+	// dictionaries are never compressed using dictionaries.
+	if contentID.Prefix() == ZstdDictionaryContentPrefix && comp == compression.HeaderZstdDictionary {
+		comp = compression.HeaderZstdFastest
 	}
 
 	//nolint:nestif
@@ -51,6 +61,12 @@ func (sm *SharedManager) maybeCompressAndEncryptDataForPacking(data gather.Bytes
 			return NoCompression, errors.Errorf("unsupported compressor %x", comp)
 		}
 
+		if comp == compression.HeaderZstdDictionary {
+			if dc := sm.zstdDictionaryCompressorForWriting(ctx); dc != nil {
+				c = dc
+			}
+		}
+
 		t0 := timetrack.StartTimer()
 
 		if err := c.Compress(&tmp, data.Reader()); err != nil {
@@ -73,9 +89,14 @@ func (sm *SharedManager) maybeCompressAndEncryptDataForPacking(data gather.Bytes
 
 	sm.afterCompressionBytes.Add(int64(data.Length()))
 
+	enc, err := sm.format.EncryptorForKeyID(ctx, keyID)
+	if err != nil {
+		return NoCompression, errors.Wrap(err, "unable to get encryptor")
+	}
+
 	t1 := timetrack.StartTimer()
 
-	if err := sm.format.Encryptor().Encrypt(data, iv, output); err != nil {
+	if err := enc.Encrypt(data, iv, output); err != nil {
 		return NoCompression, errors.Wrap(err, "unable to encrypt")
 	}
 
@@ -118,7 +139,7 @@ func (sm *SharedManager) getContentDataReadLocked(ctx context.Context, pp *pendi
 		return errors.Wrapf(err, "error getting cached content from blob %q", bi.PackBlobID)
 	}
 
-	return sm.decryptContentAndVerify(payload.Bytes(), bi, output)
+	return sm.decryptContentAndVerify(ctx, payload.Bytes(), bi, output)
 }
 
 func (sm *SharedManager) preparePackDataContent(mp format.MutableParameters, pp *pendingPackInfo) (index.Builder, error) {
@@ -2096,6 +2096,115 @@ func (s *contentManagerSuite) TestCompression_NonCompressibleData(t *testing.T)
 	verifyContent(ctx, t, bm2, cid, nonCompressibleData)
 }
 
+func (s *contentManagerSuite) TestCompression_ZstdDictionary(t *testing.T) {
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+	bm := s.newTestContentManagerWithTweaks(t, st, &contentManagerTestTweaks{
+		indexVersion: index.Version2,
+	})
+
+	ctx := testlogging.Context(t)
+	rnd := rand.New(rand.NewSource(1))
+	dataSet := map[ID][]byte{}
+
+	writeMetadata := func() ID {
+		t.Helper()
+
+		b := makeDirectoryLikeContent(rnd)
+
+		cid, err := bm.WriteContent(ctx, gather.FromSlice(b), "k", NoCompression)
+		require.NoError(t, err)
+
+		dataSet[cid] = b
+
+		return cid
+	}
+
+	for range 300 {
+		cid := writeMetadata()
+
+		ci, err := bm.ContentInfo(ctx, cid)
+		require.NoError(t, err)
+		require.Equal(t, compression.HeaderZstdFastest, ci.CompressionHeaderID)
+	}
+
+	require.NoError(t, bm.Flush(ctx))
+
+	id1, err := bm.TrainZstdDictionary(ctx, TrainZstdDictionaryOptions{MaxDictionarySize: 16 << 10})
+	require.NoError(t, err)
+	require.NoError(t, bm.Flush(ctx))
+
+	// metadata written after training is compressed using the dictionary.
+	cid1 := writeMetadata()
+
+	ci1, err := bm.ContentInfo(ctx, cid1)
+	require.NoError(t, err)
+	require.Equal(t, compression.HeaderZstdDictionary, ci1.CompressionHeaderID)
+
+	// contents can explicitly request compression using the dictionary.
+	explicitData := makeDirectoryLikeContent(rnd)
+
+	explicitID, err := bm.WriteContent(ctx, gather.FromSlice(explicitData), "", compression.HeaderZstdDictionary)
+	require.NoError(t, err)
+
+	dataSet[explicitID] = explicitData
+
+	require.NoError(t, bm.Flush(ctx))
+
+	// after retraining, contents compressed using the previous dictionary remain readable.
+	id2, err := bm.TrainZstdDictionary(ctx, TrainZstdDictionaryOptions{MaxDictionarySize: 16 << 10})
+	require.NoError(t, err)
+	require.NotEqual(t, id1, id2)
+	require.NoError(t, bm.Flush(ctx))
+
+	cid2 := writeMetadata()
+
+	require.NoError(t, bm.Flush(ctx))
+	verifyContentManagerDataSet(ctx, t, bm, dataSet)
+
+	bm2 := s.newTestContentManagerWithTweaks(t, st, &contentManagerTestTweaks{
+		indexVersion: index.Version2,
+	})
+
+	verifyContentManagerDataSet(ctx, t, bm2, dataSet)
+
+	ci2, err := bm2.ContentInfo(ctx, cid2)
+	require.NoError(t, err)
+	require.Equal(t, compression.HeaderZstdDictionary, ci2.CompressionHeaderID)
+}
+
+func (s *contentManagerSuite) TestCompression_ZstdDictionaryRequiresCompression(t *testing.T) {
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+	bm := s.newTestContentManagerWithTweaks(t, st, &contentManagerTestTweaks{
+		indexVersion: index.Version1,
+	})
+
+	ctx := testlogging.Context(t)
+
+	_, err := bm.TrainZstdDictionary(ctx, TrainZstdDictionaryOptions{})
+	require.Error(t, err)
+}
+
+func makeDirectoryLikeContent(rnd *rand.Rand) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString(`{"stream":"kopia:directory","entries":[`)
+
+	for i := range 5 + rnd.Intn(5) {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+
+		fmt.Fprintf(&buf, `{"name":"file-%x.txt","type":"f","mode":"0644","mtime":"2024-01-%02dT10:%02d:00Z","obj":"%032x","size":%v}`,
+			rnd.Int63(), 1+rnd.Intn(28), rnd.Intn(60), rnd.Int63(), rnd.Intn(100000))
+	}
+
+	buf.WriteString(`],"summary":{"size":12345,"files":5,"dirs":0,"maxTime":"2024-01-01T10:00:00Z"}}`)
+
+	return buf.Bytes()
+}
+
 func (s *contentManagerSuite) TestContentCachingByFormat(t *testing.T) {
 	data := blobtesting.DataMap{}
 	st := blobtesting.NewMapStorage(data, nil, nil)
@@ -0,0 +1,325 @@
+package content
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	mathrand "math/rand"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/feature"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/compression"
+	"github.com/kopia/kopia/repo/content/index"
+)
+
+// ZstdDictionaryContentPrefix is the prefix of contents holding zstd dictionaries trained on repository contents.
+const ZstdDictionaryContentPrefix IDPrefix = "z"
+
+// ZstdDictionaryFeature is the feature required to open repositories with zstd dictionaries.
+const ZstdDictionaryFeature feature.Feature = "zstd-dictionary"
+
+// defaults for training zstd dictionaries.
+const (
+	DefaultZstdDictionaryMaxSize        = 112 << 10
+	DefaultZstdDictionaryMaxSamples     = 10000
+	DefaultZstdDictionaryMaxSampleSize  = 64 << 10
+	DefaultZstdDictionaryMaxTotalSample = 16 << 20
+
+	// zstd dictionary IDs below this value are reserved.
+	minZstdDictionaryID = 1 << 15
+)
+
+// TrainZstdDictionaryOptions specifies how zstd dictionaries are trained.
+type TrainZstdDictionaryOptions struct {
+	MaxDictionarySize  int // maximum size of the dictionary
+	MaxSamples         int // maximum number of contents sampled
+	MaxSampleSize      int // larger contents are not sampled
+	MaxTotalSampleSize int // maximum total size of contents sampled
+}
+
+func (o TrainZstdDictionaryOptions) withDefaults() TrainZstdDictionaryOptions {
+	if o.MaxDictionarySize <= 0 {
+		o.MaxDictionarySize = DefaultZstdDictionaryMaxSize
+	}
+
+	if o.MaxSamples <= 0 {
+		o.MaxSamples = DefaultZstdDictionaryMaxSamples
+	}
+
+	if o.MaxSampleSize <= 0 {
+		o.MaxSampleSize = DefaultZstdDictionaryMaxSampleSize
+	}
+
+	if o.MaxTotalSampleSize <= 0 {
+		o.MaxTotalSampleSize = DefaultZstdDictionaryMaxTotalSample
+	}
+
+	return o
+}
+
+// zstdDictionaryCache holds the zstd dictionaries stored in the repository.
+type zstdDictionaryCache struct {
+	mu sync.Mutex
+
+	// +checklocks:mu
+	loaded bool
+
+	// revision of committed contents at which the dictionaries were loaded.
+	// +checklocks:mu
+	revision int64
+
+	// +checklocks:mu
+	dicts map[ID][]byte
+
+	// compressor using the dictionaries, nil if there are none.
+	// +checklocks:mu
+	compressor compression.Compressor
+}
+
+// zstdDictionaryCompressor returns the compressor using zstd dictionaries stored in the repository, the newest one
+// being used for compression, or nil if there are no dictionaries.
+func (sm *SharedManager) zstdDictionaryCompressor(ctx context.Context) (compression.Compressor, error) {
+	d := &sm.zstdDictionaries
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	rev := sm.committedContents.revision()
+	if d.loaded && d.revision == rev {
+		return d.compressor, nil
+	}
+
+	var infos []Info
+
+	if err := sm.committedContents.listContents(index.PrefixRange(ZstdDictionaryContentPrefix), func(i Info) error {
+		infos = append(infos, i)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error listing zstd dictionaries")
+	}
+
+	// the newest dictionary which is not deleted is used for compression.
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Deleted != infos[j].Deleted {
+			return !infos[i].Deleted
+		}
+
+		return infos[i].TimestampSeconds > infos[j].TimestampSeconds
+	})
+
+	if d.dicts == nil {
+		d.dicts = map[ID][]byte{}
+	}
+
+	var dicts [][]byte
+
+	for _, i := range infos {
+		dict, ok := d.dicts[i.ContentID]
+		if !ok {
+			// dictionaries are never compressed using dictionaries, which would be reentrant.
+			if i.CompressionHeaderID == compression.HeaderZstdDictionary {
+				return nil, errors.Errorf("invalid compression of zstd dictionary %v", i.ContentID)
+			}
+
+			var tmp gather.WriteBuffer
+
+			err := sm.getContentDataReadLocked(ctx, nil, i, &tmp)
+			dict = tmp.ToByteSlice()
+
+			tmp.Close()
+
+			if err != nil {
+				return nil, errors.Wrapf(err, "error reading zstd dictionary %v", i.ContentID)
+			}
+
+			d.dicts[i.ContentID] = dict
+		}
+
+		dicts = append(dicts, dict)
+	}
+
+	d.compressor = nil
+
+	if len(dicts) > 0 {
+		c, err := compression.NewZstdDictionaryCompressor(dicts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "error loading zstd dictionaries")
+		}
+
+		d.compressor = c
+	}
+
+	d.loaded = true
+	d.revision = rev
+
+	return d.compressor, nil
+}
+
+// zstdDictionaryCompressorForWriting returns the compressor using zstd dictionaries stored in the repository
+// or nil if there are none or they can't be loaded, in which case the contents are compressed without dictionaries.
+func (sm *SharedManager) zstdDictionaryCompressorForWriting(ctx context.Context) compression.Compressor {
+	c, err := sm.zstdDictionaryCompressor(ctx)
+	if err != nil {
+		sm.log.Debugf("unable to load zstd dictionaries: %v", err)
+		return nil
+	}
+
+	return c
+}
+
+// decompressWithZstdDictionary decompresses the provided data using zstd dictionaries stored in the repository.
+// When the data was compressed using an unknown dictionary, indexes are refreshed to find newly-trained dictionaries.
+func (sm *SharedManager) decompressWithZstdDictionary(ctx context.Context, output *gather.WriteBuffer, input gather.Bytes) error {
+	c, err := sm.zstdDictionaryCompressor(ctx)
+	if err != nil {
+		return err
+	}
+
+	if c == nil {
+		c = compression.ByHeaderID[compression.HeaderZstdDictionary]
+	}
+
+	err = c.Decompress(output, input.Reader(), true)
+	if !errors.Is(err, compression.ErrDictionaryNotFound) {
+		return err //nolint:wrapcheck
+	}
+
+	if rerr := sm.Refresh(ctx); rerr != nil {
+		return errors.Wrap(rerr, "error refreshing indexes")
+	}
+
+	if c, err = sm.zstdDictionaryCompressor(ctx); err != nil {
+		return err
+	}
+
+	if c == nil {
+		return errors.Wrap(compression.ErrDictionaryNotFound, "no zstd dictionaries")
+	}
+
+	//nolint:wrapcheck
+	return c.Decompress(output, input.Reader(), true)
+}
+
+// TrainZstdDictionary trains a zstd dictionary on a random sample of small contents and stores it in the repository.
+// After the repository is flushed, the dictionary is used to compress metadata contents and contents compressed
+// using compression.HeaderZstdDictionary, while previous dictionaries remain available for decompression.
+func (bm *WriteManager) TrainZstdDictionary(ctx context.Context, opt TrainZstdDictionaryOptions) (uint32, error) {
+	if !bm.SupportsContentCompression() {
+		return 0, errors.New("zstd dictionaries require a repository format supporting content compression")
+	}
+
+	opt = opt.withDefaults()
+
+	samples, err := bm.sampleContents(ctx, opt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := bm.newZstdDictionaryID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	dict, err := compression.TrainZstdDictionary(id, samples, opt.MaxDictionarySize)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to train zstd dictionary")
+	}
+
+	if _, err := bm.WriteContent(ctx, gather.FromSlice(dict), ZstdDictionaryContentPrefix, compression.HeaderZstdFastest); err != nil {
+		return 0, errors.Wrap(err, "unable to write zstd dictionary")
+	}
+
+	return id, nil
+}
+
+// sampleContents returns the data of a random sample of small contents.
+func (bm *WriteManager) sampleContents(ctx context.Context, opt TrainZstdDictionaryOptions) ([][]byte, error) {
+	var (
+		candidates []ID
+		seen       int
+	)
+
+	// reservoir sampling of content IDs.
+	if err := bm.IterateContents(ctx, IterateOptions{}, func(ci Info) error {
+		if ci.ContentID.Prefix() == ZstdDictionaryContentPrefix || int(ci.OriginalLength) > opt.MaxSampleSize {
+			return nil
+		}
+
+		seen++
+
+		if len(candidates) < opt.MaxSamples {
+			candidates = append(candidates, ci.ContentID)
+		} else if n := mathrand.Intn(seen); n < opt.MaxSamples { //nolint:gosec
+			candidates[n] = ci.ContentID
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error sampling contents")
+	}
+
+	var (
+		samples   [][]byte
+		totalSize int
+	)
+
+	for _, cid := range candidates {
+		if totalSize >= opt.MaxTotalSampleSize {
+			break
+		}
+
+		data, err := bm.GetContent(ctx, cid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading content %v", cid)
+		}
+
+		samples = append(samples, data)
+		totalSize += len(data)
+	}
+
+	return samples, nil
+}
+
+func (bm *WriteManager) newZstdDictionaryID(ctx context.Context) (uint32, error) {
+	existing := map[uint32]bool{}
+
+	if err := bm.IterateContents(ctx, IterateOptions{
+		Range:          index.PrefixRange(ZstdDictionaryContentPrefix),
+		IncludeDeleted: true,
+	}, func(ci Info) error {
+		data, err := bm.GetContent(ctx, ci.ContentID)
+		if err != nil {
+			return errors.Wrapf(err, "error reading zstd dictionary %v", ci.ContentID)
+		}
+
+		id, err := compression.ZstdDictionaryID(data)
+		if err != nil {
+			return errors.Wrapf(err, "invalid zstd dictionary %v", ci.ContentID)
+		}
+
+		existing[id] = true
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	for {
+		var b [4]byte
+
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, errors.Wrap(err, "unable to generate dictionary ID")
+		}
+
+		// IDs are in the [2^15, 2^31) range, which is not reserved.
+		id := binary.BigEndian.Uint32(b[:])>>1 | minZstdDictionaryID
+
+		if !existing[id] {
+			return id, nil
+		}
+	}
+}
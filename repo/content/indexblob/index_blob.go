@@ -25,6 +25,10 @@ type CompactOptions struct {
 	DropDeletedBefore                time.Time
 	DropContents                     []index.ID
 	DisableEventualConsistencySafety bool
+
+	// IsRetained optionally identifies index blobs which must not be compacted, since compaction
+	// eventually deletes its inputs.
+	IsRetained func(id blob.ID) bool
 }
 
 func (co *CompactOptions) maxEventualConsistencySettleTime() time.Duration {
@@ -18,6 +18,12 @@ type Metadata struct {
 	Superseded []blob.Metadata
 }
 
+// encryptionKeyReloader is implemented by crypters whose encryption keys can be rotated
+// by other clients while the repository is open.
+type encryptionKeyReloader interface {
+	ReloadEncryptionKeys(ctx context.Context) error
+}
+
 // EncryptionManager manages encryption and caching of index blobs.
 type EncryptionManager struct {
 	st             blob.Storage
@@ -38,7 +44,35 @@ func (m *EncryptionManager) GetEncryptedBlob(ctx context.Context, blobID blob.ID
 		return errors.Wrap(err, "getContent")
 	}
 
-	return errors.Wrap(blobcrypto.Decrypt(m.crypter, payload.Bytes(), blobID, output), "decrypt blob")
+	err := blobcrypto.Decrypt(m.crypter, payload.Bytes(), blobID, output)
+	if err == nil {
+		return nil
+	}
+
+	r, ok := m.crypter.(encryptionKeyReloader)
+	if !ok {
+		return errors.Wrap(err, "decrypt blob")
+	}
+
+	// the blob may have been re-encrypted using a key this client has not seen yet,
+	// or the cached copy may be encrypted using a key that has since been retired.
+	if rerr := r.ReloadEncryptionKeys(ctx); rerr != nil {
+		return errors.Wrap(rerr, "unable to reload encryption keys")
+	}
+
+	payload.Reset()
+
+	if err := m.st.GetBlob(ctx, blobID, 0, -1, &payload); err != nil {
+		return errors.Wrap(err, "getContent")
+	}
+
+	if err := blobcrypto.Decrypt(m.crypter, payload.Bytes(), blobID, output); err != nil {
+		return errors.Wrap(err, "decrypt blob")
+	}
+
+	m.indexBlobCache.Put(ctx, string(blobID), payload.Bytes())
+
+	return nil
 }
 
 // EncryptAndWriteBlob encrypts and writes the provided data into a blob,
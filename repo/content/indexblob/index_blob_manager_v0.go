@@ -451,6 +451,11 @@ func (m *ManagerV0) getBlobsToCompact(indexBlobs []Metadata, opt CompactOptions,
 			continue
 		}
 
+		if opt.IsRetained != nil && opt.IsRetained(b.BlobID) {
+			m.log.Debugf("not compacting %v because it's retained", b.BlobID)
+			continue
+		}
+
 		nonCompactedBlobs = append(nonCompactedBlobs, b)
 		totalSizeNonCompactedBlobs += b.Length
 
@@ -6,6 +6,7 @@
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/repo/encryption"
 )
 
@@ -45,6 +46,13 @@ func CreateAlgorithm(opts *Options) (encryption.Encryptor, error) {
 	return factory(opts)
 }
 
+// Repairer is implemented by ECC algorithms which can write back the data they correct.
+type Repairer interface {
+	// Repair writes the input with all damaged shards corrected to the output and returns the number
+	// of damaged shards, which is zero when the input is intact and the output is identical to it.
+	Repair(input gather.Bytes, output *gather.WriteBuffer) (int, error)
+}
+
 // Parameters encapsulates all ECC parameters.
 type Parameters interface {
 	GetECCAlgorithm() string
@@ -248,6 +248,35 @@ func (r *ReedSolomonCrcECC) Encrypt(input gather.Bytes, _ []byte, output *gather
 // Decrypt corrects the data from input based on the ECC data.
 // See Encrypt comments for a description of the layout.
 func (r *ReedSolomonCrcECC) Decrypt(input gather.Bytes, _ []byte, output *gather.WriteBuffer) error {
+	_, err := r.decode(input, output)
+
+	return err
+}
+
+// Repair corrects the data from input based on the ECC data and encodes it again,
+// which produces the original input when it was not damaged.
+func (r *ReedSolomonCrcECC) Repair(input gather.Bytes, output *gather.WriteBuffer) (int, error) {
+	var decoded gather.WriteBuffer
+	defer decoded.Close()
+
+	damaged, err := r.decode(input, &decoded)
+	if err != nil {
+		return damaged, err
+	}
+
+	if err := r.Encrypt(decoded.Bytes(), nil, output); err != nil {
+		return damaged, err
+	}
+
+	if output.Length() != input.Length() {
+		return damaged, errors.Errorf("repaired length %v does not match the original length %v", output.Length(), input.Length())
+	}
+
+	return damaged, nil
+}
+
+// decode writes the data corrected based on the ECC data to the output and returns the number of damaged shards.
+func (r *ReedSolomonCrcECC) decode(input gather.Bytes, output *gather.WriteBuffer) (int, error) {
 	sizes := r.computeSizesFromStored(input.Length())
 	dataPlusCrcSizeInBlock := sizes.DataShards * (crcSize + sizes.ShardSize)
 	parityPlusCrcSizeInBlock := sizes.ParityShards * (crcSize + sizes.ShardSize)
@@ -273,7 +302,7 @@ func (r *ReedSolomonCrcECC) Decrypt(input gather.Bytes, _ []byte, output *gather
 	dataPos := 0
 	eccPos := 0
 
-	var originalSize int
+	var originalSize, damaged int
 
 	writeOriginalPos := 0
 	paddingStartPos := len(copied) - parityPlusCrcSizeInBlock*sizes.Blocks
@@ -293,6 +322,7 @@ func (r *ReedSolomonCrcECC) Decrypt(input gather.Bytes, _ []byte, output *gather
 				if crc != crc32.ChecksumIEEE(shards[i]) {
 					// The data was corrupted, so we need to reconstruct it
 					shards[i] = nil
+					damaged++
 				}
 			}
 		}
@@ -309,6 +339,7 @@ func (r *ReedSolomonCrcECC) Decrypt(input gather.Bytes, _ []byte, output *gather
 			if crc != crc32.ChecksumIEEE(shards[s]) {
 				// The data was corrupted, so we need to reconstruct it
 				shards[s] = nil
+				damaged++
 			}
 		}
 
@@ -318,7 +349,7 @@ func (r *ReedSolomonCrcECC) Decrypt(input gather.Bytes, _ []byte, output *gather
 
 		err := sizes.enc.ReconstructData(shards)
 		if err != nil {
-			return errors.Wrap(err, "Error computing ECC")
+			return damaged, errors.Wrap(err, "Error computing ECC")
 		}
 
 		startShard := 0
@@ -340,7 +371,7 @@ func (r *ReedSolomonCrcECC) Decrypt(input gather.Bytes, _ []byte, output *gather
 		}
 	}
 
-	return nil
+	return damaged, nil
 }
 
 func readLength(shards [][]byte, sizes *sizesInfo) (originalSize, startShard, startByte int) {
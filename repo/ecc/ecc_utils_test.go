@@ -1,6 +1,7 @@
 package ecc
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -49,6 +50,8 @@ func testPutAndGet(t *testing.T, opts *Options, originalSize,
 	result := output.ToByteSlice()
 	require.Len(t, result, originalSize+expectedEccSize)
 
+	encoded := append([]byte(nil), result...)
+
 	makeChanges(impl, result)
 
 	output = gather.NewWriteBuffer()
@@ -61,6 +64,20 @@ func testPutAndGet(t *testing.T, opts *Options, originalSize,
 	} else {
 		require.Error(t, err)
 	}
+
+	// repairing restores the original encoding and reports damaged shards.
+	output = gather.NewWriteBuffer()
+
+	damaged, err := impl.(Repairer).Repair(gather.FromSlice(result), output)
+
+	if expectedSuccess {
+		require.NoError(t, err)
+		require.Equal(t, encoded, output.ToByteSlice())
+		require.Equal(t, bytes.Equal(encoded, result), damaged == 0)
+	} else {
+		require.Error(t, err)
+		require.Positive(t, damaged)
+	}
 }
 
 func flipByte(data []byte, i int) {
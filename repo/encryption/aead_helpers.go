@@ -66,7 +66,7 @@ func aeadOpenPrefixedWithNonce(a cipher.AEAD, ciphertext gather.Bytes, contentID
 
 	result, err := a.Open(input[:0], nonce, input, contentID)
 	if err != nil {
-		return errors.Errorf("unable to decrypt content: %v", err)
+		return errors.Wrap(err, "unable to decrypt content")
 	}
 
 	output.Append(result)
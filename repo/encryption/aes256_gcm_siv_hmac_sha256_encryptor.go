@@ -0,0 +1,81 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+)
+
+const aes256GCMSIVHmacSha256Overhead = 28
+
+const aes256GCMSIVKeyDerivationSecretSize = 32
+
+// aes256GCMSIVHmacSha256 uses nonce-misuse-resistant AES-GCM-SIV (RFC 8452), so that a repeated nonce
+// only reveals whether the same content has been encrypted twice.
+//
+// The ciphertext layout is [nonce][ciphertext][tag], the same as other AEAD-based encryptors.
+type aes256GCMSIVHmacSha256 struct {
+	hmacPool *sync.Pool
+}
+
+// aeadForContent returns AES-GCM-SIV using key derived from a given contentID.
+func (e aes256GCMSIVHmacSha256) aeadForContent(contentID []byte) (cipher.AEAD, error) {
+	//nolint:forcetypeassert
+	h := e.hmacPool.Get().(hash.Hash)
+	defer e.hmacPool.Put(h)
+	h.Reset()
+
+	if _, err := h.Write(contentID); err != nil {
+		return nil, errors.Wrap(err, "unable to derive encryption key")
+	}
+
+	var hashBuf [32]byte
+	key := h.Sum(hashBuf[:0])
+
+	return newAesGcmSiv(key)
+}
+
+func (e aes256GCMSIVHmacSha256) Decrypt(input gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	a, err := e.aeadForContent(contentID)
+	if err != nil {
+		return err
+	}
+
+	return aeadOpenPrefixedWithNonce(a, input, contentID, output)
+}
+
+func (e aes256GCMSIVHmacSha256) Encrypt(input gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	a, err := e.aeadForContent(contentID)
+	if err != nil {
+		return err
+	}
+
+	return aeadSealWithRandomNonce(a, input, contentID, output)
+}
+
+func (e aes256GCMSIVHmacSha256) Overhead() int {
+	return aes256GCMSIVHmacSha256Overhead
+}
+
+func init() {
+	Register("AES256-GCM-SIV-HMAC-SHA256", "Nonce-misuse-resistant AES-256-GCM-SIV using per-content key generated using HMAC-SHA256", false, func(p Parameters) (Encryptor, error) {
+		keyDerivationSecret, err := deriveKey(p, []byte(purposeEncryptionKey), aes256GCMSIVKeyDerivationSecretSize)
+		if err != nil {
+			return nil, err
+		}
+
+		hmacPool := &sync.Pool{
+			New: func() interface{} {
+				return hmac.New(sha256.New, keyDerivationSecret)
+			},
+		}
+
+		return aes256GCMSIVHmacSha256{hmacPool}, nil
+	})
+}
@@ -0,0 +1,267 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	gcmSivNonceSize = 12
+	gcmSivTagSize   = 16
+	gcmSivBlockSize = 16
+
+	// maximum plaintext and additional data length, per RFC 8452.
+	gcmSivMaxLength = 1 << 36
+)
+
+var errGcmSivOpen = errors.New("message authentication failed")
+
+// aesGcmSiv implements AEAD_AES_128_GCM_SIV and AEAD_AES_256_GCM_SIV as described in RFC 8452,
+// which remain secure (except for revealing repeated messages) when a nonce is accidentally reused.
+type aesGcmSiv struct {
+	block  cipher.Block
+	keyLen int
+}
+
+func newAesGcmSiv(key []byte) (cipher.AEAD, error) {
+	if len(key) != 16 && len(key) != 32 { //nolint:mnd
+		return nil, errors.Errorf("invalid AES-GCM-SIV key length: %v", len(key))
+	}
+
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create AES cipher")
+	}
+
+	return aesGcmSiv{b, len(key)}, nil
+}
+
+func (aesGcmSiv) NonceSize() int { return gcmSivNonceSize }
+
+func (aesGcmSiv) Overhead() int { return gcmSivTagSize }
+
+func (a aesGcmSiv) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != gcmSivNonceSize {
+		panic("aes-gcm-siv: incorrect nonce length")
+	}
+
+	if uint64(len(plaintext)) > gcmSivMaxLength || uint64(len(additionalData)) > gcmSivMaxLength {
+		panic("aes-gcm-siv: message too large")
+	}
+
+	authKey, encBlock := a.deriveKeys(nonce)
+	tag := computeGcmSivTag(authKey, encBlock, nonce, plaintext, additionalData)
+
+	ret, out := sliceForAppend(dst, len(plaintext)+gcmSivTagSize)
+	gcmSivCTR(encBlock, tag, out[:len(plaintext)], plaintext)
+	copy(out[len(plaintext):], tag[:])
+
+	return ret
+}
+
+func (a aesGcmSiv) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != gcmSivNonceSize {
+		return nil, errors.New("aes-gcm-siv: incorrect nonce length")
+	}
+
+	if len(ciphertext) < gcmSivTagSize || uint64(len(ciphertext)) > gcmSivMaxLength+gcmSivTagSize || uint64(len(additionalData)) > gcmSivMaxLength {
+		return nil, errGcmSivOpen
+	}
+
+	var tag [gcmSivTagSize]byte
+
+	copy(tag[:], ciphertext[len(ciphertext)-gcmSivTagSize:])
+	ciphertext = ciphertext[:len(ciphertext)-gcmSivTagSize]
+
+	authKey, encBlock := a.deriveKeys(nonce)
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	gcmSivCTR(encBlock, tag, out, ciphertext)
+
+	expectedTag := computeGcmSivTag(authKey, encBlock, nonce, out, additionalData)
+	if subtle.ConstantTimeCompare(expectedTag[:], tag[:]) != 1 {
+		clear(out)
+
+		return nil, errGcmSivOpen
+	}
+
+	return ret, nil
+}
+
+// deriveKeys derives per-nonce message authentication and encryption keys.
+func (a aesGcmSiv) deriveKeys(nonce []byte) (authKey [16]byte, encBlock cipher.Block) {
+	var (
+		in, out [gcmSivBlockSize]byte
+		keys    [16 + 32]byte
+	)
+
+	copy(in[4:], nonce)
+
+	// each block of the key-generating key contributes 8 bytes, first to the authentication key.
+	for i := range (len(authKey) + a.keyLen) / 8 { //nolint:mnd
+		binary.LittleEndian.PutUint32(in[:4], uint32(i)) //nolint:gosec
+		a.block.Encrypt(out[:], in[:])
+		copy(keys[i*8:], out[:8])
+	}
+
+	copy(authKey[:], keys[:len(authKey)])
+
+	encBlock, _ = aes.NewCipher(keys[len(authKey) : len(authKey)+a.keyLen]) //nolint:errcheck
+
+	return authKey, encBlock
+}
+
+// computeGcmSivTag computes the authentication tag over the plaintext and additional data.
+func computeGcmSivTag(authKey [16]byte, encBlock cipher.Block, nonce, plaintext, additionalData []byte) [gcmSivTagSize]byte {
+	p := newPolyval(authKey)
+	p.updatePadded(additionalData)
+	p.updatePadded(plaintext)
+
+	var lengths [gcmSivBlockSize]byte
+
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData))*8) //nolint:mnd
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plaintext))*8)      //nolint:mnd
+	p.updateBlock(lengths[:])
+
+	s := p.sum()
+
+	for i := range nonce {
+		s[i] ^= nonce[i]
+	}
+
+	s[15] &= 0x7f
+
+	var tag [gcmSivTagSize]byte
+
+	encBlock.Encrypt(tag[:], s[:])
+
+	return tag
+}
+
+// gcmSivCTR encrypts or decrypts the input using AES-CTR with 32-bit little-endian counter initialized from the tag.
+func gcmSivCTR(encBlock cipher.Block, tag [gcmSivTagSize]byte, out, in []byte) {
+	counter := tag
+	counter[15] |= 0x80
+
+	var keyStream [gcmSivBlockSize]byte
+
+	for len(in) > 0 {
+		encBlock.Encrypt(keyStream[:], counter[:])
+		binary.LittleEndian.PutUint32(counter[:4], binary.LittleEndian.Uint32(counter[:4])+1)
+
+		n := subtle.XORBytes(out, in, keyStream[:])
+		in, out = in[n:], out[n:]
+	}
+}
+
+// polyval implements the POLYVAL universal hash function over GF(2^128) defined by
+// x^128 + x^127 + x^126 + x^121 + 1, with elements represented as little-endian 128-bit integers.
+//
+// Multiplication doesn't use secret-dependent table lookups or branches, so it runs in constant time.
+type polyval struct {
+	hLo, hHi uint64
+	sLo, sHi uint64
+}
+
+func newPolyval(key [16]byte) *polyval {
+	return &polyval{
+		hLo: binary.LittleEndian.Uint64(key[:8]),
+		hHi: binary.LittleEndian.Uint64(key[8:]),
+	}
+}
+
+func (p *polyval) updatePadded(b []byte) {
+	for len(b) >= gcmSivBlockSize {
+		p.updateBlock(b[:gcmSivBlockSize])
+		b = b[gcmSivBlockSize:]
+	}
+
+	if len(b) > 0 {
+		var last [gcmSivBlockSize]byte
+
+		copy(last[:], b)
+		p.updateBlock(last[:])
+	}
+}
+
+// updateBlock computes S = (S xor X) * H * x^-128.
+func (p *polyval) updateBlock(x []byte) {
+	aLo := p.sLo ^ binary.LittleEndian.Uint64(x[:8])
+	aHi := p.sHi ^ binary.LittleEndian.Uint64(x[8:])
+
+	// 256-bit carry-less product v3:v2:v1:v0 using Karatsuba multiplication.
+	loLo, loHi := clmul(aLo, p.hLo)
+	hiLo, hiHi := clmul(aHi, p.hHi)
+	midLo, midHi := clmul(aLo^aHi, p.hLo^p.hHi)
+
+	midLo ^= loLo ^ hiLo
+	midHi ^= loHi ^ hiHi
+
+	v0, v1, v2, v3 := loLo, loHi^midLo, hiLo^midHi, hiHi
+
+	// Montgomery reduction, each step adds v*P, where v is the lowest word, and divides by x^64.
+	v1 ^= v0<<63 ^ v0<<62 ^ v0<<57
+	v2 ^= v0 ^ v0>>1 ^ v0>>2 ^ v0>>7
+	v2 ^= v1<<63 ^ v1<<62 ^ v1<<57
+	v3 ^= v1 ^ v1>>1 ^ v1>>2 ^ v1>>7
+
+	p.sLo, p.sHi = v2, v3
+}
+
+func (p *polyval) sum() [16]byte {
+	var out [16]byte
+
+	binary.LittleEndian.PutUint64(out[:8], p.sLo)
+	binary.LittleEndian.PutUint64(out[8:], p.sHi)
+
+	return out
+}
+
+// clmul returns the 128-bit carry-less product of x and y.
+func clmul(x, y uint64) (lo, hi uint64) {
+	lo = bmul64(x, y)
+	hi = bits.Reverse64(bmul64(bits.Reverse64(x), bits.Reverse64(y))) >> 1
+
+	return lo, hi
+}
+
+// bmul64 returns the lower 64 bits of the carry-less product of x and y in constant time.
+// Bits are split into four groups with three zero bits between each pair of bits, so that
+// integer multiplication can't carry into bits of the same group.
+func bmul64(x, y uint64) uint64 {
+	const (
+		m0 = 0x1111111111111111
+		m1 = 0x2222222222222222
+		m2 = 0x4444444444444444
+		m3 = 0x8888888888888888
+	)
+
+	x0, x1, x2, x3 := x&m0, x&m1, x&m2, x&m3
+	y0, y1, y2, y3 := y&m0, y&m1, y&m2, y&m3
+
+	z0 := x0*y0 ^ x1*y3 ^ x2*y2 ^ x3*y1
+	z1 := x0*y1 ^ x1*y0 ^ x2*y3 ^ x3*y2
+	z2 := x0*y2 ^ x1*y1 ^ x2*y0 ^ x3*y3
+	z3 := x0*y3 ^ x1*y2 ^ x2*y1 ^ x3*y0
+
+	return z0&m0 | z1&m1 | z2&m2 | z3&m3
+}
+
+// sliceForAppend extends the provided slice by n bytes, returning the extended slice and the new tail.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+
+	tail = head[len(in):]
+
+	return head, tail
+}
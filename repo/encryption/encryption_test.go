@@ -108,8 +108,10 @@ func TestCiphertextSamples(t *testing.T) {
 
 			// samples of base16-encoded ciphertexts of payload encrypted with masterKey & contentID
 			samples: map[string]string{
-				"AES256-GCM-HMAC-SHA256":        "e43ba07f85a6d70c5f1102ca06cf19c597e5f91e527b21f00fb76e8bec3fd1",
-				"CHACHA20-POLY1305-HMAC-SHA256": "118359f3d4d589d939efbbc3168ae4c77c51bcebce6845fe6ef5d11342faa6",
+				"AES256-GCM-HMAC-SHA256":         "e43ba07f85a6d70c5f1102ca06cf19c597e5f91e527b21f00fb76e8bec3fd1",
+				"CHACHA20-POLY1305-HMAC-SHA256":  "118359f3d4d589d939efbbc3168ae4c77c51bcebce6845fe6ef5d11342faa6",
+				"XCHACHA20-POLY1305-HMAC-SHA256": "bc000bbac5c80e36ac20b8d2d9f27a23aa06f6f2457c13e01428f451c8c47a60a40a063158b3687dff6019",
+				"AES256-GCM-SIV-HMAC-SHA256":     "98e8325e9a0edd5e51e500e9d2a288482ac29e64f006ae2e73f54474454c60",
 			},
 		},
 		{
@@ -119,8 +121,10 @@ func TestCiphertextSamples(t *testing.T) {
 
 			// samples of base16-encoded ciphertexts of payload encrypted with masterKey & contentID
 			samples: map[string]string{
-				"AES256-GCM-HMAC-SHA256":        "eaad755a238f1daa4052db2e5ccddd934790b6cca415b3ccfd46ac5746af33d9d30f4400ffa9eb3a64fb1ce21b888c12c043bf6787d4a5c15ad10f21f6a6027ee3afe0",
-				"CHACHA20-POLY1305-HMAC-SHA256": "836d2ba87892711077adbdbe1452d3b2c590bbfdf6fd3387dc6810220a32ec19de862e1a4f865575e328424b5f178afac1b7eeff11494f719d119b7ebb924d1d0846a3",
+				"AES256-GCM-HMAC-SHA256":         "eaad755a238f1daa4052db2e5ccddd934790b6cca415b3ccfd46ac5746af33d9d30f4400ffa9eb3a64fb1ce21b888c12c043bf6787d4a5c15ad10f21f6a6027ee3afe0",
+				"CHACHA20-POLY1305-HMAC-SHA256":  "836d2ba87892711077adbdbe1452d3b2c590bbfdf6fd3387dc6810220a32ec19de862e1a4f865575e328424b5f178afac1b7eeff11494f719d119b7ebb924d1d0846a3",
+				"XCHACHA20-POLY1305-HMAC-SHA256": "46cda351d8041da1d65d532b16fff1cae28e293434c5752e2c28b7b25b994e524229e2e88f43fe3510f5d2e9d2e12e6158b70662e37e0ac0c228a5b8e01d29d72c0399cdf409418a7f4f4a78d7c3d3",
+				"AES256-GCM-SIV-HMAC-SHA256":     "8557548b41cbd774a7d979f4a217142c4c6cf9b5101fedb6e7a98d95969eecf967cd6b84a65006339cb9299caffdb433a4e6afa09cd652d53188e65feb8142b1aff3aa",
 			},
 		},
 	}
@@ -195,3 +199,76 @@ func BenchmarkEncryption(b *testing.B) {
 		out.Close()
 	}
 }
+
+func TestSealedBox(t *testing.T) {
+	pub, priv, err := encryption.NewSealedBoxKeyPair()
+	require.NoError(t, err)
+
+	_, otherPriv, err := encryption.NewSealedBoxKeyPair()
+	require.NoError(t, err)
+
+	_, err = encryption.NewSealedBoxEncryptor(pub, otherPriv)
+	require.ErrorContains(t, err, "does not match")
+
+	writer, err := encryption.NewSealedBoxEncryptor(pub, nil)
+	require.NoError(t, err)
+
+	reader, err := encryption.NewSealedBoxEncryptor(pub, priv)
+	require.NoError(t, err)
+
+	data := []byte("some data")
+	contentID := bytes.Repeat([]byte{1}, 16)
+
+	var cipherText, plainText gather.WriteBuffer
+	defer cipherText.Close()
+	defer plainText.Close()
+
+	require.NoError(t, writer.Encrypt(gather.FromSlice(data), contentID, &cipherText))
+	require.Equal(t, len(data)+writer.Overhead(), cipherText.Length())
+
+	// write-only encryptor can't decrypt even what it has written.
+	require.ErrorIs(t, writer.Decrypt(cipherText.Bytes(), contentID, &plainText), encryption.ErrWriteOnly)
+
+	require.NoError(t, reader.Decrypt(cipherText.Bytes(), contentID, &plainText))
+	require.Equal(t, data, plainText.ToByteSlice())
+
+	// content ID is authenticated.
+	plainText.Reset()
+	require.Error(t, reader.Decrypt(cipherText.Bytes(), bytes.Repeat([]byte{2}, 16), &plainText))
+}
+
+func TestAesGcmSivEncryptorTamper(t *testing.T) {
+	e, err := encryption.CreateEncryptor(parameters{"AES256-GCM-SIV-HMAC-SHA256", make([]byte, 32)})
+	require.NoError(t, err)
+
+	contentID := []byte{1, 2, 3, 4}
+
+	// multi-block payload with partial last block.
+	plaintext := bytes.Repeat([]byte{1, 2, 3, 4, 5, 6, 7}, 1000)
+
+	var ct, pt gather.WriteBuffer
+	defer ct.Close()
+	defer pt.Close()
+
+	require.NoError(t, e.Encrypt(gather.FromSlice(plaintext), contentID, &ct))
+	require.Equal(t, len(plaintext)+e.Overhead(), ct.Length())
+
+	require.NoError(t, e.Decrypt(ct.Bytes(), contentID, &pt))
+	require.Equal(t, plaintext, pt.ToByteSlice())
+
+	// decrypting with a different content ID uses a different key and AAD.
+	pt.Reset()
+	require.Error(t, e.Decrypt(ct.Bytes(), []byte{1, 2, 3, 5}, &pt))
+
+	b := ct.ToByteSlice()
+
+	// tamper with the nonce, first and last ciphertext block and the tag.
+	for _, i := range []int{0, 11, 12, 28, len(b) - 17, len(b) - 16, len(b) - 1} {
+		b[i] ^= 0x80
+
+		pt.Reset()
+		require.Error(t, e.Decrypt(gather.FromSlice(b), contentID, &pt), "tampered byte %v", i)
+
+		b[i] ^= 0x80
+	}
+}
@@ -0,0 +1,150 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/kopia/kopia/internal/gather"
+)
+
+// SealedBoxKeySize is the size of public and private keys used by sealed box encryption.
+const SealedBoxKeySize = 32
+
+const (
+	sealedBoxOverhead = SealedBoxKeySize + 12 + 16 // ephemeral public key + nonce + GCM tag
+
+	purposeSealedBoxKey = "kopia-sealed-box"
+)
+
+// ErrWriteOnly is returned when decrypting sealed contents without the private key.
+var ErrWriteOnly = errors.New("decryption requires the repository private key, this client is write-only")
+
+// sealedBox encrypts contents to a X25519 public key, so that contents can only be decrypted by holders
+// of the private key. Each content is encrypted with AES-256-GCM using a key derived from
+// an ephemeral key pair, whose public key is prepended to the ciphertext.
+type sealedBox struct {
+	publicKey  *ecdh.PublicKey
+	privateKey *ecdh.PrivateKey
+}
+
+// NewSealedBoxKeyPair generates a new key pair for sealed box encryption.
+func NewSealedBoxKeyPair() (publicKey, privateKey []byte, err error) {
+	k, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to generate key pair")
+	}
+
+	return k.PublicKey().Bytes(), k.Bytes(), nil
+}
+
+// NewSealedBoxEncryptor returns an Encryptor that seals contents to the provided public key.
+// When the private key is not provided, the encryptor can only encrypt and Decrypt returns ErrWriteOnly.
+func NewSealedBoxEncryptor(publicKey, privateKey []byte) (Encryptor, error) {
+	pub, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid public key")
+	}
+
+	e := &sealedBox{publicKey: pub}
+
+	if privateKey != nil {
+		priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid private key")
+		}
+
+		if !priv.PublicKey().Equal(pub) {
+			return nil, errors.Errorf("private key does not match the public key")
+		}
+
+		e.privateKey = priv
+	}
+
+	return e, nil
+}
+
+// aead returns AES-256-GCM keyed with the secret shared between the ephemeral and the recipient key.
+func (e *sealedBox) aead(sharedSecret, ephemeralPublicKey []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte(nil), ephemeralPublicKey...), e.publicKey.Bytes()...)
+
+	key := make([]byte, aes256KeyDerivationSecretSize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, salt, []byte(purposeSealedBoxKey)), key); err != nil {
+		return nil, errors.Wrap(err, "unable to derive key")
+	}
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create AES-256 cipher")
+	}
+
+	//nolint:wrapcheck
+	return cipher.NewGCM(c)
+}
+
+func (e *sealedBox) Encrypt(input gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return errors.Wrap(err, "unable to generate ephemeral key")
+	}
+
+	shared, err := ephemeral.ECDH(e.publicKey)
+	if err != nil {
+		return errors.Wrap(err, "key agreement failed")
+	}
+
+	ephemeralPublicKey := ephemeral.PublicKey().Bytes()
+
+	a, err := e.aead(shared, ephemeralPublicKey)
+	if err != nil {
+		return err
+	}
+
+	output.Append(ephemeralPublicKey)
+
+	return aeadSealWithRandomNonce(a, input, contentID, output)
+}
+
+func (e *sealedBox) Decrypt(input gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	if e.privateKey == nil {
+		return ErrWriteOnly
+	}
+
+	if input.Length() < sealedBoxOverhead {
+		return errors.Errorf("ciphertext too short: %v", input.Length())
+	}
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	buf := input.AppendToSlice(tmp.MakeContiguous(input.Length())[:0])
+	ephemeralPublicKey := bytes.Clone(buf[0:SealedBoxKeySize])
+
+	pub, err := ecdh.X25519().NewPublicKey(ephemeralPublicKey)
+	if err != nil {
+		return errors.Wrap(err, "invalid ephemeral public key")
+	}
+
+	shared, err := e.privateKey.ECDH(pub)
+	if err != nil {
+		return errors.Wrap(err, "key agreement failed")
+	}
+
+	a, err := e.aead(shared, ephemeralPublicKey)
+	if err != nil {
+		return err
+	}
+
+	return aeadOpenPrefixedWithNonce(a, gather.FromSlice(buf[SealedBoxKeySize:]), contentID, output)
+}
+
+func (e *sealedBox) Overhead() int {
+	return sealedBoxOverhead
+}
@@ -0,0 +1,82 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/kopia/kopia/internal/gather"
+)
+
+const xchacha20poly1305hmacSha256EncryptorOverhead = 40
+
+const xchacha20KeyDerivationSecretSize = 32
+
+// xchacha20poly1305hmacSha256Encryptor uses 192-bit random nonces, which makes accidental nonce reuse negligible
+// even for very large numbers of messages encrypted with the same key.
+type xchacha20poly1305hmacSha256Encryptor struct {
+	hmacPool *sync.Pool
+}
+
+// aeadForContent returns cipher.AEAD using key derived from a given contentID.
+func (e xchacha20poly1305hmacSha256Encryptor) aeadForContent(contentID []byte) (cipher.AEAD, error) {
+	//nolint:forcetypeassert
+	h := e.hmacPool.Get().(hash.Hash)
+	defer e.hmacPool.Put(h)
+
+	h.Reset()
+
+	if _, err := h.Write(contentID); err != nil {
+		return nil, errors.Wrap(err, "unable to derive encryption key")
+	}
+
+	var hashBuf [32]byte
+	key := h.Sum(hashBuf[:0])
+
+	//nolint:wrapcheck
+	return chacha20poly1305.NewX(key)
+}
+
+func (e xchacha20poly1305hmacSha256Encryptor) Decrypt(input gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	a, err := e.aeadForContent(contentID)
+	if err != nil {
+		return err
+	}
+
+	return aeadOpenPrefixedWithNonce(a, input, contentID, output)
+}
+
+func (e xchacha20poly1305hmacSha256Encryptor) Encrypt(input gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	a, err := e.aeadForContent(contentID)
+	if err != nil {
+		return err
+	}
+
+	return aeadSealWithRandomNonce(a, input, contentID, output)
+}
+
+func (e xchacha20poly1305hmacSha256Encryptor) Overhead() int {
+	return xchacha20poly1305hmacSha256EncryptorOverhead
+}
+
+func init() {
+	Register("XCHACHA20-POLY1305-HMAC-SHA256", "XCHACHA20-POLY1305 with extended nonce using per-content key generated using HMAC-SHA256", false, func(p Parameters) (Encryptor, error) {
+		keyDerivationSecret, err := deriveKey(p, []byte(purposeEncryptionKey), xchacha20KeyDerivationSecretSize)
+		if err != nil {
+			return nil, err
+		}
+
+		hmacPool := &sync.Pool{
+			New: func() interface{} {
+				return hmac.New(sha256.New, keyDerivationSecret)
+			},
+		}
+
+		return xchacha20poly1305hmacSha256Encryptor{hmacPool}, nil
+	})
+}
@@ -92,19 +92,23 @@ func deserializeBlobCfgBytes(j *KopiaRepositoryJSON, encryptedBlobCfgBytes, form
 	return r, nil
 }
 
-// WriteBlobCfgBlob writes `kopia.blobcfg` encrypted using the provided key.
+// WriteBlobCfgBlob writes `kopia.blobcfg` and its replicas encrypted using the provided key.
 func (f *KopiaRepositoryJSON) WriteBlobCfgBlob(ctx context.Context, st blob.Storage, blobcfg BlobStorageConfiguration, formatEncryptionKey []byte) error {
 	blobCfgBytes, err := serializeBlobCfgBytes(f, blobcfg, formatEncryptionKey)
 	if err != nil {
 		return errors.Wrap(err, "unable to encrypt blobcfg bytes")
 	}
 
-	if err := st.PutBlob(ctx, KopiaBlobCfgBlobID, gather.FromSlice(blobCfgBytes), blob.PutOptions{
-		RetentionMode:   blobcfg.RetentionMode,
-		RetentionPeriod: blobcfg.RetentionPeriod,
-	}); err != nil {
+	if err := st.PutBlob(ctx, KopiaBlobCfgBlobID, gather.FromSlice(blobCfgBytes), blobcfg.putOptions()); err != nil {
 		return errors.Wrapf(err, "PutBlob() failed for %q", KopiaBlobCfgBlobID)
 	}
 
-	return nil
+	return writeReplicas(ctx, st, KopiaBlobCfgBlobID, blobCfgBytes, f.Replicas, blobcfg.putOptions())
+}
+
+func (r *BlobStorageConfiguration) putOptions() blob.PutOptions {
+	return blob.PutOptions{
+		RetentionMode:   r.RetentionMode,
+		RetentionPeriod: r.RetentionPeriod,
+	}
 }
@@ -21,6 +21,12 @@ type ContentFormat struct {
 	MutableParameters
 
 	EnablePasswordChange bool `json:"enablePasswordChange"` // disables replication of kopia.repository blob in packs
+
+	EncryptionKeys        []ContentEncryptionKey `json:"encryptionKeys,omitempty"`        // additional content encryption keys, identified by EncryptionKeyID
+	ActiveEncryptionKeyID byte                   `json:"activeEncryptionKeyID,omitempty"` // ID of the key used to encrypt new contents, 0 means MasterKey
+	MasterKeyRetired      bool                   `json:"masterKeyRetired,omitempty"`      // MasterKey is no longer used to encrypt or decrypt contents and index blobs
+
+	PublicKey []byte `json:"publicKey,omitempty"` // public key to which contents are sealed, clients without the private key can't read contents
 }
 
 // ResolveFormatVersion applies format options parameters based on the format version.
@@ -100,6 +106,11 @@ func (f *ContentFormat) GetMasterKey() []byte {
 	return f.MasterKey
 }
 
+// GetActiveEncryptionKeyID implements FormattingOptionsProvider.
+func (f *ContentFormat) GetActiveEncryptionKeyID() byte {
+	return f.ActiveEncryptionKeyID
+}
+
 // GetECCAlgorithm implements ecc.Parameters.
 func (f *ContentFormat) GetECCAlgorithm() string {
 	return f.ECC
@@ -0,0 +1,49 @@
+package format
+
+import (
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/encryption"
+)
+
+// keyRingEncryptor encrypts repository blobs using the active content encryption key and
+// decrypts them using any key in the key ring, so that index and session blobs written before
+// the key was rotated remain readable until maintenance re-encrypts them.
+type keyRingEncryptor struct {
+	active encryption.Encryptor
+	others []encryption.Encryptor
+}
+
+func (e *keyRingEncryptor) Encrypt(plainText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	//nolint:wrapcheck
+	return e.active.Encrypt(plainText, contentID, output)
+}
+
+func (e *keyRingEncryptor) Decrypt(cipherText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	// decrypt into temporary buffer, since failed attempts must not leave anything in the output.
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	err := e.active.Decrypt(cipherText, contentID, &tmp)
+
+	for i := 0; err != nil && i < len(e.others); i++ {
+		tmp.Reset()
+
+		if e.others[i].Decrypt(cipherText, contentID, &tmp) == nil {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	_, err = tmp.Bytes().WriteTo(output)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (e *keyRingEncryptor) Overhead() int {
+	return e.active.Overhead()
+}
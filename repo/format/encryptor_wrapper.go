@@ -1,7 +1,10 @@
 package format
 
 import (
+	"github.com/pkg/errors"
+
 	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/ecc"
 	"github.com/kopia/kopia/repo/encryption"
 )
 
@@ -36,6 +39,17 @@ func (p *encryptorWrapper) Decrypt(cipherText gather.Bytes, contentID []byte, ou
 	return p.impl.Decrypt(tmp.Bytes(), contentID, output)
 }
 
+// Repair implements ecc.Repairer by repairing the error correction layer, without decrypting the data.
+func (p *encryptorWrapper) Repair(cipherText gather.Bytes, output *gather.WriteBuffer) (int, error) {
+	r, ok := p.next.(ecc.Repairer)
+	if !ok {
+		return 0, errors.New("error correction does not support repair")
+	}
+
+	//nolint:wrapcheck
+	return r.Repair(cipherText, output)
+}
+
 func (p *encryptorWrapper) Overhead() int {
 	panic("Should not be called")
 }
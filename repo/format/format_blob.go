@@ -6,6 +6,8 @@
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/json"
+	"slices"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -55,6 +57,15 @@ type KopiaRepositoryJSON struct {
 	EncryptionAlgorithm string `json:"encryption"`
 	// encrypted, serialized JSON encryptedRepositoryConfig{}
 	EncryptedFormatBytes []byte `json:"encryptedBlockFormat,omitempty"`
+
+	// when present, random format encryption key wrapped with keys derived from each of the passwords.
+	KeySlots []KeySlot `json:"keySlots,omitempty"`
+
+	// when present, format encryption key wrapped with a secret split into recovery shares.
+	RecoveryKey *RecoveryKey `json:"recoveryKey,omitempty"`
+
+	// when present, redundant copies of `kopia.repository` and `kopia.blobcfg` blobs are maintained.
+	Replicas *ReplicaOptions `json:"replicas,omitempty"`
 }
 
 // ParseKopiaRepositoryJSON parses the provided byte slice into KopiaRepositoryJSON.
@@ -69,7 +80,14 @@ func ParseKopiaRepositoryJSON(b []byte) (*KopiaRepositoryJSON, error) {
 }
 
 // DeriveFormatEncryptionKeyFromPassword derives encryption key using the provided password and per-repository unique ID.
+// For repositories using key slots, the key is unwrapped from the first key slot matching the password.
 func (f *KopiaRepositoryJSON) DeriveFormatEncryptionKeyFromPassword(password string) ([]byte, error) {
+	if f.HasKeySlots() {
+		_, key, err := f.unlockKeySlot(password)
+
+		return key, err
+	}
+
 	res, err := crypto.DeriveKeyFromPassword(password, f.UniqueID, formatBlobEncryptionKeySize, f.KeyDerivationAlgorithm)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to derive format encryption key")
@@ -78,6 +96,22 @@ func (f *KopiaRepositoryJSON) DeriveFormatEncryptionKeyFromPassword(password str
 	return res, nil
 }
 
+// ValidateKeyDerivationAlgorithm returns an error if the provided algorithm can't be used to derive
+// format encryption keys. In addition to SupportedFormatBlobKeyDerivationAlgorithms(), Argon2id
+// can be used with custom parameters.
+func ValidateKeyDerivationAlgorithm(algorithm string) error {
+	if slices.Contains(SupportedFormatBlobKeyDerivationAlgorithms(), algorithm) {
+		return nil
+	}
+
+	if !strings.HasPrefix(algorithm, crypto.Argon2idAlgorithmPrefix) {
+		return errors.Errorf("unsupported key derivation algorithm %v, supported algorithms: %v", algorithm, SupportedFormatBlobKeyDerivationAlgorithms())
+	}
+
+	//nolint:wrapcheck
+	return crypto.ValidatePBKeyDerivationAlgorithm(algorithm)
+}
+
 // RecoverFormatBlob attempts to recover format blob replica from the specified file.
 // The format blob can be either the prefix or a suffix of the given file.
 // optionally the length can be provided (if known) to speed up recovery.
@@ -170,29 +204,39 @@ func verifyFormatBlobChecksum(b []byte) ([]byte, bool) {
 	return data, true
 }
 
-// WriteKopiaRepositoryBlob writes `kopia.repository` blob to a given storage.
+// WriteKopiaRepositoryBlob writes `kopia.repository` blob and its replicas to a given storage.
 func (f *KopiaRepositoryJSON) WriteKopiaRepositoryBlob(ctx context.Context, st blob.Storage, blobCfg BlobStorageConfiguration) error {
-	return f.WriteKopiaRepositoryBlobWithID(ctx, st, blobCfg, KopiaRepositoryBlobID)
+	b, err := f.writeKopiaRepositoryBlob(ctx, st, blobCfg, KopiaRepositoryBlobID)
+	if err != nil {
+		return err
+	}
+
+	return writeReplicas(ctx, st, KopiaRepositoryBlobID, b, f.Replicas, blobCfg.putOptions())
 }
 
 // WriteKopiaRepositoryBlobWithID writes `kopia.repository` blob to a given storage under an alternate blobID.
 func (f *KopiaRepositoryJSON) WriteKopiaRepositoryBlobWithID(ctx context.Context, st blob.Storage, blobCfg BlobStorageConfiguration, id blob.ID) error {
+	_, err := f.writeKopiaRepositoryBlob(ctx, st, blobCfg, id)
+
+	return err
+}
+
+func (f *KopiaRepositoryJSON) writeKopiaRepositoryBlob(ctx context.Context, st blob.Storage, blobCfg BlobStorageConfiguration, id blob.ID) ([]byte, error) {
 	buf := gather.NewWriteBuffer()
+	defer buf.Close()
+
 	e := json.NewEncoder(buf)
 	e.SetIndent("", "  ")
 
 	if err := e.Encode(f); err != nil {
-		return errors.Wrap(err, "unable to marshal format blob")
+		return nil, errors.Wrap(err, "unable to marshal format blob")
 	}
 
-	if err := st.PutBlob(ctx, id, buf.Bytes(), blob.PutOptions{
-		RetentionMode:   blobCfg.RetentionMode,
-		RetentionPeriod: blobCfg.RetentionPeriod,
-	}); err != nil {
-		return errors.Wrapf(err, "unable to write format blob %q", id)
+	if err := st.PutBlob(ctx, id, buf.Bytes(), blobCfg.putOptions()); err != nil {
+		return nil, errors.Wrapf(err, "unable to write format blob %q", id)
 	}
 
-	return nil
+	return buf.ToByteSlice(), nil
 }
 
 func encryptRepositoryBlobBytesAes256Gcm(data, masterKey, repositoryID []byte) ([]byte, error) {
@@ -4,13 +4,18 @@
 	"context"
 
 	"github.com/pkg/errors"
-
-	"github.com/kopia/kopia/repo/blob"
 )
 
 // ChangePassword changes the repository password and rewrites
-// `kopia.repository` & `kopia.blobcfg`.
+// `kopia.repository` & `kopia.blobcfg`. For repositories using key slots,
+// only the key slot matching the current password is replaced.
 func (m *Manager) ChangePassword(ctx context.Context, newPassword string) error {
+	return m.ChangePasswordWithKeyDerivationAlgorithm(ctx, newPassword, "")
+}
+
+// ChangePasswordWithKeyDerivationAlgorithm is like ChangePassword but also switches to the provided
+// key derivation algorithm. An empty algorithm keeps the current one.
+func (m *Manager) ChangePasswordWithKeyDerivationAlgorithm(ctx context.Context, newPassword, keyDerivationAlgorithm string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -18,27 +23,34 @@ func (m *Manager) ChangePassword(ctx context.Context, newPassword string) error
 		return errors.Errorf("password changes are not supported for repositories created using Kopia v0.8 or older")
 	}
 
-	newFormatEncryptionKey, err := m.j.DeriveFormatEncryptionKeyFromPassword(newPassword)
-	if err != nil {
-		return errors.Wrap(err, "unable to derive master key")
+	if keyDerivationAlgorithm != "" {
+		if err := ValidateKeyDerivationAlgorithm(keyDerivationAlgorithm); err != nil {
+			return err
+		}
 	}
 
-	m.formatEncryptionKey = newFormatEncryptionKey
-	m.password = newPassword
+	if m.j.HasKeySlots() {
+		return m.changeKeySlotPasswordLocked(ctx, newPassword, keyDerivationAlgorithm)
+	}
+
+	oldKeyDerivationAlgorithm := m.j.KeyDerivationAlgorithm
 
-	if err := m.j.EncryptRepositoryConfig(m.repoConfig, newFormatEncryptionKey); err != nil {
-		return errors.Wrap(err, "unable to encrypt format bytes")
+	if keyDerivationAlgorithm != "" {
+		m.j.KeyDerivationAlgorithm = keyDerivationAlgorithm
 	}
 
-	if err := m.j.WriteBlobCfgBlob(ctx, m.blobs, m.blobCfgBlob, newFormatEncryptionKey); err != nil {
-		return errors.Wrap(err, "unable to write blobcfg blob")
+	newFormatEncryptionKey, err := m.j.DeriveFormatEncryptionKeyFromPassword(newPassword)
+	if err != nil {
+		m.j.KeyDerivationAlgorithm = oldKeyDerivationAlgorithm
+		return errors.Wrap(err, "unable to derive master key")
 	}
 
-	if err := m.j.WriteKopiaRepositoryBlob(ctx, m.blobs, m.blobCfgBlob); err != nil {
-		return errors.Wrap(err, "unable to write format blob")
+	if err := m.writeFormatWithKeyLocked(ctx, newFormatEncryptionKey); err != nil {
+		m.j.KeyDerivationAlgorithm = oldKeyDerivationAlgorithm
+		return err
 	}
 
-	m.cache.Remove(ctx, []blob.ID{KopiaRepositoryBlobID, KopiaBlobCfgBlobID})
+	m.password = newPassword
 
 	return nil
 }
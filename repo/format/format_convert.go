@@ -0,0 +1,332 @@
+package format
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const (
+	// ConversionBlobIDPrefix is the prefix of blobs holding the state of a format conversion in progress,
+	// including the indexes of contents that have already been written using the new format.
+	ConversionBlobIDPrefix = "kopia.convert."
+
+	conversionFormatBlobID blob.ID = ConversionBlobIDPrefix + "repository"
+	conversionReadyBlobID  blob.ID = ConversionBlobIDPrefix + "ready"
+)
+
+// ErrFormatConverted is returned when the repository has been converted to a new format while it was open.
+var ErrFormatConverted = errors.New("repository format has been converted, it must be reopened") // +checklocksignore
+
+// ConversionStatus describes the progress of a format conversion.
+type ConversionStatus int
+
+// Supported conversion statuses.
+const (
+	ConversionNone       ConversionStatus = iota // no conversion in progress
+	ConversionInProgress                         // contents are being rewritten using the new format
+	ConversionReady                              // all contents have been rewritten, indexes and format blob need to be switched
+	ConversionCommitted                          // the repository is using the new format, old contents need to be cleaned up
+)
+
+// ConversionOptions specifies the new hashing, encryption and error correction parameters of a repository.
+type ConversionOptions struct {
+	Hash               string `json:"hash"`
+	Encryption         string `json:"encryption"`
+	ECC                string `json:"ecc,omitempty"`
+	ECCOverheadPercent int    `json:"eccOverheadPercent,omitempty"`
+}
+
+// ConversionOptions returns the conversion options matching the current repository format.
+func (m *Manager) ConversionOptions(ctx context.Context) (ConversionOptions, error) {
+	if err := m.maybeRefreshNotLocked(ctx); err != nil {
+		return ConversionOptions{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return conversionOptionsOf(&m.repoConfig.ContentFormat), nil
+}
+
+// PrepareConversion stages the repository format with the provided parameters and returns its provider,
+// which is used to rewrite all contents. The format of the repository itself is not modified until
+// the conversion is committed. Calling it again with the same options resumes the conversion.
+func (m *Manager) PrepareConversion(ctx context.Context, opt ConversionOptions) (Provider, error) {
+	if err := m.maybeRefreshNotLocked(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.repoConfig.UpgradeLock == nil {
+		return nil, errors.New("repository must be locked for conversion")
+	}
+
+	if !m.repoConfig.EpochParameters.Enabled {
+		return nil, errors.New("format conversion requires epoch-based indexes, upgrade the repository first")
+	}
+
+	if len(m.repoConfig.PublicKey) > 0 {
+		return nil, errors.New("format conversion is not supported for repositories using asymmetric encryption")
+	}
+
+	if opt.ECCOverheadPercent == 0 {
+		opt.ECC = ""
+	}
+
+	if conversionOptionsOf(&m.repoConfig.ContentFormat) == opt {
+		return nil, errors.WithMessage(ErrFormatUptoDate, "repository is already using the requested format")
+	}
+
+	staged, b, err := m.loadConversionLocked(ctx)
+
+	switch {
+	case err == nil:
+		if conversionOptionsOf(&staged.ContentFormat) != opt {
+			return nil, errors.New("conversion to a different format is in progress, roll it back first")
+		}
+
+	case errors.Is(err, blob.ErrBlobNotFound):
+		staged = &RepositoryConfig{
+			ContentFormat:    m.repoConfig.ContentFormat,
+			ObjectFormat:     m.repoConfig.ObjectFormat,
+			RequiredFeatures: m.repoConfig.RequiredFeatures,
+		}
+
+		staged.Hash = opt.Hash
+		staged.Encryption = opt.Encryption
+		staged.ECC = opt.ECC
+		staged.ECCOverheadPercent = opt.ECCOverheadPercent
+
+		// all content IDs change, so that stale copies of contents cached by clients are never used.
+		if len(staged.HMACSecret) > 0 {
+			staged.HMACSecret = randomBytes(len(staged.HMACSecret))
+		}
+
+		if _, err := newFormattingOptionsProvider(&staged.ContentFormat, nil, m.privateKey); err != nil {
+			return nil, errors.Wrap(err, "invalid format")
+		}
+
+		if b, err = m.writeConversionLocked(ctx, staged); err != nil {
+			return nil, err
+		}
+
+		log(ctx).Infof("Staged format conversion to hash %v, encryption %v.", opt.Hash, opt.Encryption)
+
+	default:
+		return nil, err
+	}
+
+	return m.conversionProviderLocked(staged, b)
+}
+
+// ConversionProvider returns the provider for the staged format of a conversion in progress.
+func (m *Manager) ConversionProvider(ctx context.Context) (Provider, error) {
+	if err := m.maybeRefreshNotLocked(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	staged, b, err := m.loadConversionLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.conversionProviderLocked(staged, b)
+}
+
+// GetConversionStatus returns the status of a format conversion.
+func (m *Manager) GetConversionStatus(ctx context.Context) (ConversionStatus, error) {
+	if err := m.maybeRefreshNotLocked(ctx); err != nil {
+		return ConversionNone, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ready, err := m.conversionReadyLocked(ctx)
+	if err != nil {
+		return ConversionNone, err
+	}
+
+	staged, _, err := m.loadConversionLocked(ctx)
+	if errors.Is(err, blob.ErrBlobNotFound) {
+		return ConversionNone, nil
+	}
+
+	if err != nil {
+		return ConversionNone, err
+	}
+
+	switch {
+	case !ready:
+		return ConversionInProgress, nil
+	case bytes.Equal(staged.HMACSecret, m.repoConfig.HMACSecret) && conversionOptionsOf(&staged.ContentFormat) == conversionOptionsOf(&m.repoConfig.ContentFormat):
+		return ConversionCommitted, nil
+	default:
+		return ConversionReady, nil
+	}
+}
+
+// SetConversionReady marks the conversion in progress as ready to be committed, after all contents have been rewritten.
+func (m *Manager) SetConversionReady(ctx context.Context) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, _, err := m.loadConversionLocked(ctx); err != nil {
+		return errors.Wrap(err, "no conversion in progress")
+	}
+
+	if err := m.blobs.PutBlob(ctx, conversionReadyBlobID, gather.FromSlice([]byte("ready")), m.blobCfgBlob.putOptions()); err != nil {
+		return errors.Wrap(err, "unable to mark conversion as ready")
+	}
+
+	return nil
+}
+
+// CommitConversion switches the repository format to the staged one. The indexes written using the new format
+// must be in place before this is called and the manager must not be used afterwards.
+func (m *Manager) CommitConversion(ctx context.Context) error {
+	if err := m.maybeRefreshNotLocked(ctx); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	staged, _, err := m.loadConversionLocked(ctx)
+	if err != nil {
+		return errors.Wrap(err, "no conversion in progress")
+	}
+
+	m.repoConfig.Hash = staged.Hash
+	m.repoConfig.Encryption = staged.Encryption
+	m.repoConfig.ECC = staged.ECC
+	m.repoConfig.ECCOverheadPercent = staged.ECCOverheadPercent
+	m.repoConfig.HMACSecret = staged.HMACSecret
+
+	return m.updateRepoConfigLocked(ctx)
+}
+
+// DiscardConversion removes all blobs holding the state of a format conversion.
+func (m *Manager) DiscardConversion(ctx context.Context) error {
+	// the ready marker goes first, since other blobs are needed to complete a ready conversion.
+	if err := m.blobs.DeleteBlob(ctx, conversionReadyBlobID); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+		return errors.Wrap(err, "unable to delete conversion marker")
+	}
+
+	var ids []blob.ID
+
+	if err := m.blobs.ListBlobs(ctx, ConversionBlobIDPrefix, func(bm blob.Metadata) error {
+		if bm.BlobID != conversionFormatBlobID {
+			ids = append(ids, bm.BlobID)
+		}
+
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "unable to list conversion blobs")
+	}
+
+	// the staged format goes last, so that an interrupted cleanup can be identified.
+	ids = append(ids, conversionFormatBlobID)
+
+	for _, id := range ids {
+		if err := m.blobs.DeleteBlob(ctx, id); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+			return errors.Wrapf(err, "unable to delete %v", id)
+		}
+	}
+
+	return nil
+}
+
+// +checklocksread:m.mu
+func (m *Manager) conversionReadyLocked(ctx context.Context) (bool, error) {
+	_, err := m.blobs.GetMetadata(ctx, conversionReadyBlobID)
+	if errors.Is(err, blob.ErrBlobNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, errors.Wrap(err, "unable to check conversion status")
+	}
+
+	return true, nil
+}
+
+// loadConversionLocked reads the staged repository configuration and the serialized format blob which contains it.
+// +checklocksread:m.mu
+func (m *Manager) loadConversionLocked(ctx context.Context) (*RepositoryConfig, []byte, error) {
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	if err := m.blobs.GetBlob(ctx, conversionFormatBlobID, 0, -1, &tmp); err != nil {
+		return nil, nil, errors.Wrap(err, "unable to read staged format")
+	}
+
+	b := tmp.ToByteSlice()
+
+	j, err := ParseKopiaRepositoryJSON(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rc, err := j.decryptRepositoryConfig(m.formatEncryptionKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to decrypt staged format")
+	}
+
+	return rc, b, nil
+}
+
+// +checklocksread:m.mu
+func (m *Manager) writeConversionLocked(ctx context.Context, staged *RepositoryConfig) ([]byte, error) {
+	j := *m.j
+	j.Replicas = nil
+
+	if err := j.EncryptRepositoryConfig(staged, m.formatEncryptionKey); err != nil {
+		return nil, errors.Wrap(err, "unable to encrypt staged format")
+	}
+
+	return j.writeKopiaRepositoryBlob(ctx, m.blobs, m.blobCfgBlob, conversionFormatBlobID)
+}
+
+// +checklocksread:m.mu
+func (m *Manager) conversionProviderLocked(staged *RepositoryConfig, b []byte) (Provider, error) {
+	b, err := addFormatBlobChecksumAndLength(b)
+	if err != nil {
+		return nil, errors.Errorf("unable to add checksum")
+	}
+
+	prov, err := newFormattingOptionsProvider(&staged.ContentFormat, b, m.privateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating staged format provider")
+	}
+
+	return prov, nil
+}
+
+func conversionOptionsOf(f *ContentFormat) ConversionOptions {
+	return ConversionOptions{
+		Hash:               f.Hash,
+		Encryption:         f.Encryption,
+		ECC:                f.ECC,
+		ECCOverheadPercent: f.ECCOverheadPercent,
+	}
+}
+
+// sameContentFormat determines whether contents written using one provider can be read using the other one.
+func sameContentFormat(a, b Provider) bool {
+	return a.GetHashFunction() == b.GetHashFunction() &&
+		a.GetEncryptionAlgorithm() == b.GetEncryptionAlgorithm() &&
+		a.GetECCAlgorithm() == b.GetECCAlgorithm() &&
+		a.GetECCOverheadPercent() == b.GetECCOverheadPercent() &&
+		bytes.Equal(a.GetHmacSecret(), b.GetHmacSecret())
+}
@@ -0,0 +1,131 @@
+package format_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/format"
+)
+
+func TestFormatConversionLifecycle(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, format.MaxFormatVersion, repotesting.Options{OpenOptions: func(opts *repo.Options) {
+		opts.UpgradeOwnerID = "upgrade-owner"
+	}})
+
+	fm := env.RepositoryWriter.FormatManager()
+
+	current, err := fm.ConversionOptions(ctx)
+	require.NoError(t, err)
+
+	target := current
+	target.Hash = "BLAKE3-256"
+	target.Encryption = "CHACHA20-POLY1305-HMAC-SHA256"
+
+	_, err = fm.PrepareConversion(ctx, target)
+	require.ErrorContains(t, err, "repository must be locked for conversion")
+
+	d := env.Repository.ClientOptions().FormatBlobCacheDuration
+
+	lock := func() {
+		t.Helper()
+
+		_, err := fm.SetConversionLockIntent(ctx, format.UpgradeLockIntent{
+			OwnerID:                "upgrade-owner",
+			CreationTime:           env.Repository.Time(),
+			IODrainTimeout:         d * 2,
+			StatusPollInterval:     d,
+			Message:                "converting",
+			MaxPermittedClockDrift: time.Second,
+		})
+		require.NoError(t, err)
+	}
+
+	lock()
+
+	mp, err := fm.GetMutableParameters(ctx)
+	require.NoError(t, err)
+	require.Equal(t, format.MaxFormatVersion, mp.Version)
+
+	_, err = fm.PrepareConversion(ctx, current)
+	require.ErrorIs(t, err, format.ErrFormatUptoDate)
+
+	prov, err := fm.PrepareConversion(ctx, target)
+	require.NoError(t, err)
+	require.Equal(t, "BLAKE3-256", prov.GetHashFunction())
+	require.Equal(t, "CHACHA20-POLY1305-HMAC-SHA256", prov.GetEncryptionAlgorithm())
+	require.NotEqual(t, fm.GetHmacSecret(), prov.GetHmacSecret())
+
+	// preparing again resumes the conversion using the same staged format.
+	prov2, err := fm.PrepareConversion(ctx, target)
+	require.NoError(t, err)
+	require.Equal(t, prov.GetHmacSecret(), prov2.GetHmacSecret())
+
+	other := target
+	other.Hash = "HMAC-SHA256"
+
+	_, err = fm.PrepareConversion(ctx, other)
+	require.ErrorContains(t, err, "conversion to a different format is in progress")
+
+	status, err := fm.GetConversionStatus(ctx)
+	require.NoError(t, err)
+	require.Equal(t, format.ConversionInProgress, status)
+
+	// rolling back discards the staged format.
+	require.NoError(t, fm.RollbackUpgrade(ctx))
+
+	status, err = fm.GetConversionStatus(ctx)
+	require.NoError(t, err)
+	require.Equal(t, format.ConversionNone, status)
+
+	lock()
+
+	_, err = fm.PrepareConversion(ctx, target)
+	require.NoError(t, err)
+	require.NoError(t, fm.SetConversionReady(ctx))
+
+	status, err = fm.GetConversionStatus(ctx)
+	require.NoError(t, err)
+	require.Equal(t, format.ConversionReady, status)
+
+	require.ErrorContains(t, fm.RollbackUpgrade(ctx), "can't be rolled back")
+}
+
+func TestFormatConversionLockUpgradesFormatVersion(t *testing.T) {
+	asOwner := func(opts *repo.Options) {
+		opts.UpgradeOwnerID = "upgrade-owner"
+	}
+
+	ctx, env := repotesting.NewEnvironment(t, format.FormatVersion2, repotesting.Options{OpenOptions: asOwner})
+
+	fm := env.RepositoryWriter.FormatManager()
+	d := env.Repository.ClientOptions().FormatBlobCacheDuration
+
+	_, err := fm.SetConversionLockIntent(ctx, format.UpgradeLockIntent{
+		OwnerID:                "upgrade-owner",
+		CreationTime:           env.Repository.Time(),
+		IODrainTimeout:         d * 2,
+		StatusPollInterval:     d,
+		Message:                "converting",
+		MaxPermittedClockDrift: time.Second,
+	})
+	require.NoError(t, err)
+
+	// clients which don't understand the lock must not be able to open the repository and keep writing.
+	env.MustReopen(t, asOwner)
+
+	mp, err := env.RepositoryWriter.FormatManager().GetMutableParameters(ctx)
+	require.NoError(t, err)
+	require.Equal(t, format.MaxFormatVersion, mp.Version)
+
+	require.NoError(t, env.RepositoryWriter.FormatManager().RollbackUpgrade(ctx))
+
+	env.MustReopen(t)
+
+	mp, err = env.RepositoryWriter.FormatManager().GetMutableParameters(ctx)
+	require.NoError(t, err)
+	require.Equal(t, format.FormatVersion2, mp.Version)
+}
@@ -0,0 +1,193 @@
+package format
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/feature"
+	"github.com/kopia/kopia/repo/content/index"
+)
+
+// invalidEncryptionKeyID is reserved by the v2 index format and can't be assigned to a key.
+const invalidEncryptionKeyID = 0xFF
+
+// EncryptionKeyRingFeature is the feature required to open repositories whose content encryption
+// key has been rotated. Clients which don't understand it would keep encrypting with MasterKey and
+// would be unable to read contents and index blobs encrypted with other keys.
+const EncryptionKeyRingFeature feature.Feature = "encryption-key-ring"
+
+// ContentEncryptionKey is an additional key used to encrypt contents, which allows rotating
+// the key used for new contents without rewriting the repository at once. The original
+// MasterKey always has ID 0 and is not stored in the key ring.
+type ContentEncryptionKey struct {
+	ID          byte      `json:"id"`
+	MasterKey   []byte    `json:"masterKey,omitempty" kopia:"sensitive"`
+	CreatedTime time.Time `json:"created"`
+}
+
+// ContentEncryptionKeys returns the content encryption key ring without key material.
+func (m *Manager) ContentEncryptionKeys(ctx context.Context) ([]ContentEncryptionKey, error) {
+	if err := m.maybeRefreshNotLocked(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return scrubEncryptionKeys(m.repoConfig.EncryptionKeys), nil
+}
+
+// RotateEncryptionKey adds a new random content encryption key to the key ring and makes it
+// the key used to encrypt new contents. Contents encrypted with previous keys remain readable
+// until they are rewritten by maintenance and the keys are retired.
+//
+// The first rotation adds EncryptionKeyRingFeature to the required features, which prevents older
+// clients from opening the repository.
+func (m *Manager) RotateEncryptionKey(ctx context.Context) (byte, error) {
+	if err := m.maybeRefreshNotLocked(ctx); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.repoConfig.PublicKey) > 0 {
+		return 0, errors.Errorf("encryption key rotation is not supported for repositories using asymmetric encryption")
+	}
+
+	if m.repoConfig.IndexVersion < index.Version2 {
+		return 0, errors.Errorf("encryption key rotation requires index format v2 or newer, upgrade the repository first")
+	}
+
+	newID := int(m.repoConfig.ActiveEncryptionKeyID) + 1
+	if newID >= invalidEncryptionKeyID {
+		return 0, errors.Errorf("all encryption key IDs have been used")
+	}
+
+	oldKeys, oldActive, oldFeatures := m.repoConfig.EncryptionKeys, m.repoConfig.ActiveEncryptionKeyID, m.repoConfig.RequiredFeatures
+
+	if !hasRequiredFeature(oldFeatures, EncryptionKeyRingFeature) {
+		m.repoConfig.RequiredFeatures = append(append([]feature.Required(nil), oldFeatures...), feature.Required{
+			Feature: EncryptionKeyRingFeature,
+			IfNotUnderstood: feature.IfNotUnderstood{
+				Message: "The repository uses multiple content encryption keys.",
+			},
+		})
+	}
+
+	m.repoConfig.EncryptionKeys = append(append([]ContentEncryptionKey(nil), oldKeys...), ContentEncryptionKey{
+		ID:          byte(newID),
+		MasterKey:   randomBytes(len(m.repoConfig.MasterKey)),
+		CreatedTime: m.timeNow(),
+	})
+	m.repoConfig.ActiveEncryptionKeyID = byte(newID)
+
+	if err := m.updateEncryptionKeysLocked(ctx); err != nil {
+		m.repoConfig.EncryptionKeys, m.repoConfig.ActiveEncryptionKeyID, m.repoConfig.RequiredFeatures = oldKeys, oldActive, oldFeatures
+		return 0, err
+	}
+
+	return byte(newID), nil
+}
+
+// RetireEncryptionKey removes the key with the provided ID from the key ring, after which contents
+// and index blobs encrypted with it can no longer be read. The caller must ensure no such contents
+// or blobs remain and that no client may still be writing using the key.
+//
+// Retiring the original master key (ID 0) only stops it from being used for contents and index blobs,
+// it is still kept in the format blob because it's used to derive keys for auxiliary data,
+// such as the maintenance schedule.
+func (m *Manager) RetireEncryptionKey(ctx context.Context, keyID byte) error {
+	if err := m.maybeRefreshNotLocked(ctx); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if keyID == m.repoConfig.ActiveEncryptionKeyID {
+		return errors.Errorf("encryption key %v is active and can't be retired", keyID)
+	}
+
+	oldKeys, oldMasterKeyRetired := m.repoConfig.EncryptionKeys, m.repoConfig.MasterKeyRetired
+
+	if keyID == 0 {
+		if oldMasterKeyRetired {
+			return errors.Errorf("encryption key %v not found", keyID)
+		}
+
+		m.repoConfig.MasterKeyRetired = true
+	} else {
+		var newKeys []ContentEncryptionKey
+
+		for _, k := range oldKeys {
+			if k.ID != keyID {
+				newKeys = append(newKeys, k)
+			}
+		}
+
+		if len(newKeys) == len(oldKeys) {
+			return errors.Errorf("encryption key %v not found", keyID)
+		}
+
+		m.repoConfig.EncryptionKeys = newKeys
+	}
+
+	if err := m.updateEncryptionKeysLocked(ctx); err != nil {
+		m.repoConfig.EncryptionKeys, m.repoConfig.MasterKeyRetired = oldKeys, oldMasterKeyRetired
+		return err
+	}
+
+	return nil
+}
+
+// IsMasterKeyRetired returns true if the original master key (ID 0) has been retired.
+func (m *Manager) IsMasterKeyRetired(ctx context.Context) (bool, error) {
+	if err := m.maybeRefreshNotLocked(ctx); err != nil {
+		return false, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.repoConfig.MasterKeyRetired, nil
+}
+
+// updateEncryptionKeysLocked validates and persists the key ring and makes this manager pick it up on next access.
+// +checklocks:m.mu
+func (m *Manager) updateEncryptionKeysLocked(ctx context.Context) error {
+	if _, _, err := createKeyRingEncryptors(&m.repoConfig.ContentFormat, m.immutable.Encryptor(), m.immutable.Encryptor()); err != nil {
+		return errors.Wrap(err, "invalid encryption keys")
+	}
+
+	if err := m.updateRepoConfigLocked(ctx); err != nil {
+		return err
+	}
+
+	m.validUntil = time.Time{}
+
+	return nil
+}
+
+func scrubEncryptionKeys(keys []ContentEncryptionKey) []ContentEncryptionKey {
+	var result []ContentEncryptionKey
+
+	for _, k := range keys {
+		k.MasterKey = nil
+		result = append(result, k)
+	}
+
+	return result
+}
+
+func hasRequiredFeature(features []feature.Required, f feature.Feature) bool {
+	for _, rf := range features {
+		if rf.Feature == f {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+package format_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/format"
+)
+
+func TestEncryptionKeyRing(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	cf2 := cf
+	cf2.EncryptionKeys = []format.ContentEncryptionKey{{ID: 1, MasterKey: bytes.Repeat([]byte{1}, 32)}}
+	cf2.ActiveEncryptionKeyID = 1
+
+	p, err := format.NewFormattingOptionsProvider(&cf2, nil)
+	require.NoError(t, err)
+	require.Equal(t, byte(1), p.GetActiveEncryptionKeyID())
+
+	e0, err := p.EncryptorForKeyID(ctx, 0)
+	require.NoError(t, err)
+
+	e1, err := p.EncryptorForKeyID(ctx, 1)
+	require.NoError(t, err)
+
+	_, err = p.EncryptorForKeyID(ctx, 2)
+	require.ErrorContains(t, err, "unknown encryption key ID")
+
+	// contents encrypted using one key can't be decrypted using another.
+	iv := bytes.Repeat([]byte{2}, 16)
+
+	var encrypted, decrypted gather.WriteBuffer
+	defer encrypted.Close()
+	defer decrypted.Close()
+
+	require.NoError(t, e1.Encrypt(gather.FromSlice([]byte("hello")), iv, &encrypted))
+	require.Error(t, e0.Decrypt(encrypted.Bytes(), iv, &decrypted))
+	require.NoError(t, e1.Decrypt(encrypted.Bytes(), iv, &decrypted))
+	require.Equal(t, []byte("hello"), decrypted.ToByteSlice())
+
+	// blobs are encrypted using the active key and can be decrypted using any key.
+	var blobEncrypted gather.WriteBuffer
+	defer blobEncrypted.Close()
+
+	require.NoError(t, p.Encryptor().Encrypt(gather.FromSlice([]byte("blob")), iv, &blobEncrypted))
+	decrypted.Reset()
+	require.NoError(t, e1.Decrypt(blobEncrypted.Bytes(), iv, &decrypted))
+	decrypted.Reset()
+	require.NoError(t, p.Encryptor().Decrypt(encrypted.Bytes(), iv, &decrypted))
+	require.Equal(t, []byte("hello"), decrypted.ToByteSlice())
+
+	encrypted.Reset()
+	require.NoError(t, e0.Encrypt(gather.FromSlice([]byte("old")), iv, &encrypted))
+	decrypted.Reset()
+	require.NoError(t, p.Encryptor().Decrypt(encrypted.Bytes(), iv, &decrypted))
+	require.Equal(t, []byte("old"), decrypted.ToByteSlice())
+
+	// once the master key is retired, it can't be used for contents or blobs.
+	cf2.MasterKeyRetired = true
+
+	p, err = format.NewFormattingOptionsProvider(&cf2, nil)
+	require.NoError(t, err)
+
+	_, err = p.EncryptorForKeyID(ctx, 0)
+	require.ErrorContains(t, err, "unknown encryption key ID")
+	decrypted.Reset()
+	require.Error(t, p.Encryptor().Decrypt(encrypted.Bytes(), iv, &decrypted))
+	require.NoError(t, p.Encryptor().Decrypt(blobEncrypted.Bytes(), iv, &decrypted))
+	require.Equal(t, []byte("blob"), decrypted.ToByteSlice())
+
+	for _, invalid := range []struct {
+		keys             []format.ContentEncryptionKey
+		active           byte
+		masterKeyRetired bool
+	}{
+		{nil, 1, false},
+		{nil, 0, true},
+		{[]format.ContentEncryptionKey{{ID: 1, MasterKey: cf.MasterKey}}, 0, true},
+		{[]format.ContentEncryptionKey{{ID: 0, MasterKey: cf.MasterKey}}, 0, false},
+		{[]format.ContentEncryptionKey{{ID: 0xFF, MasterKey: cf.MasterKey}}, 0, false},
+		{[]format.ContentEncryptionKey{{ID: 1, MasterKey: cf.MasterKey}, {ID: 1, MasterKey: cf.MasterKey}}, 1, false},
+	} {
+		cf3 := cf
+		cf3.EncryptionKeys = invalid.keys
+		cf3.ActiveEncryptionKeyID = invalid.active
+		cf3.MasterKeyRetired = invalid.masterKeyRetired
+
+		_, err := format.NewFormattingOptionsProvider(&cf3, nil)
+		require.Error(t, err)
+	}
+}
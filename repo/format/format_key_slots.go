@@ -0,0 +1,263 @@
+package format
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/crypto"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const (
+	// DefaultKeySlotLabel is the label of the key slot holding the original repository password,
+	// which is created when the first additional key slot is added.
+	DefaultKeySlotLabel = "default"
+
+	// KeySlotsKeyDerivationAlgorithm replaces the key derivation algorithm of the format blob once
+	// the format encryption key is stored in key slots. Versions of kopia without key slot support
+	// fail to derive the key with it, reporting the algorithm as unsupported instead of deriving
+	// a wrong key and reporting an invalid password.
+	KeySlotsKeyDerivationAlgorithm = "key-slots (upgrade kopia to open this repository)"
+
+	keySlotSaltLength = 32
+)
+
+// KeySlot holds the format encryption key wrapped with a key derived from one of the repository passwords.
+type KeySlot struct {
+	Label                  string    `json:"label"`
+	KeyDerivationAlgorithm string    `json:"keyAlgo"`
+	Salt                   []byte    `json:"salt"`
+	EncryptedKey           []byte    `json:"encryptedKey"`
+	CreatedTime            time.Time `json:"created"`
+}
+
+// newKeySlot creates a key slot which wraps the provided format encryption key with a key derived from the password.
+func newKeySlot(label, password, keyDerivationAlgorithm string, formatEncryptionKey, uniqueID []byte, now time.Time) (KeySlot, error) {
+	ks := KeySlot{
+		Label:                  label,
+		KeyDerivationAlgorithm: keyDerivationAlgorithm,
+		Salt:                   randomBytes(keySlotSaltLength),
+		CreatedTime:            now,
+	}
+
+	slotKey, err := crypto.DeriveKeyFromPassword(password, ks.Salt, formatBlobEncryptionKeySize, keyDerivationAlgorithm)
+	if err != nil {
+		return KeySlot{}, errors.Wrap(err, "unable to derive key slot key")
+	}
+
+	ks.EncryptedKey, err = encryptRepositoryBlobBytesAes256Gcm(formatEncryptionKey, slotKey, uniqueID)
+	if err != nil {
+		return KeySlot{}, errors.Wrap(err, "unable to encrypt key slot")
+	}
+
+	return ks, nil
+}
+
+// unwrap returns the format encryption key stored in the key slot or ErrInvalidPassword if the password does not match.
+func (ks *KeySlot) unwrap(password string, uniqueID []byte) ([]byte, error) {
+	slotKey, err := crypto.DeriveKeyFromPassword(password, ks.Salt, formatBlobEncryptionKeySize, ks.KeyDerivationAlgorithm)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to derive key for key slot %q", ks.Label)
+	}
+
+	key, err := crypto.DecryptAes256Gcm(ks.EncryptedKey, slotKey, uniqueID)
+	if err != nil {
+		return nil, ErrInvalidPassword
+	}
+
+	return key, nil
+}
+
+// HasKeySlots returns true if the format encryption key is stored in key slots instead of being derived from the password.
+func (f *KopiaRepositoryJSON) HasKeySlots() bool {
+	return len(f.KeySlots) > 0
+}
+
+// unlockKeySlot returns the index of the key slot that can be unlocked with the provided password and the format encryption key stored in it.
+func (f *KopiaRepositoryJSON) unlockKeySlot(password string) (int, []byte, error) {
+	for i := range f.KeySlots {
+		key, err := f.KeySlots[i].unwrap(password, f.UniqueID)
+		if err == nil {
+			return i, key, nil
+		}
+
+		if !errors.Is(err, ErrInvalidPassword) {
+			return -1, nil, err
+		}
+	}
+
+	return -1, nil, ErrInvalidPassword
+}
+
+func (f *KopiaRepositoryJSON) findKeySlot(label string) int {
+	for i := range f.KeySlots {
+		if f.KeySlots[i].Label == label {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// KeySlots returns the list of key slots of the repository, empty if the format encryption key is derived directly from the password.
+func (m *Manager) KeySlots(ctx context.Context) ([]KeySlot, error) {
+	if err := m.maybeRefreshNotLocked(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]KeySlot(nil), m.j.KeySlots...), nil
+}
+
+// AddKeySlot adds a key slot which allows opening the repository with the provided password.
+// The first key slot added to a repository converts it to key slots by generating a random format encryption key
+// and storing it in the DefaultKeySlotLabel slot using the current password.
+func (m *Manager) AddKeySlot(ctx context.Context, label, password, keyDerivationAlgorithm string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.repoConfig.EnablePasswordChange {
+		return errors.Errorf("key slots are not supported for repositories created using Kopia v0.8 or older")
+	}
+
+	if label == "" {
+		return errors.Errorf("key slot label must be provided")
+	}
+
+	if keyDerivationAlgorithm == "" {
+		keyDerivationAlgorithm = DefaultKeyDerivationAlgorithm
+	}
+
+	if err := ValidateKeyDerivationAlgorithm(keyDerivationAlgorithm); err != nil {
+		return err
+	}
+
+	formatEncryptionKey := m.formatEncryptionKey
+	slots := append([]KeySlot(nil), m.j.KeySlots...)
+
+	if len(slots) == 0 {
+		// derived key can't be revoked, switch to random format encryption key stored in key slots.
+		formatEncryptionKey = randomBytes(formatBlobEncryptionKeySize)
+
+		ks, err := newKeySlot(DefaultKeySlotLabel, m.password, m.j.KeyDerivationAlgorithm, formatEncryptionKey, m.j.UniqueID, m.timeNow())
+		if err != nil {
+			return err
+		}
+
+		slots = append(slots, ks)
+	}
+
+	for _, ks := range slots {
+		if ks.Label == label {
+			return errors.Errorf("key slot %q already exists", label)
+		}
+	}
+
+	ks, err := newKeySlot(label, password, keyDerivationAlgorithm, formatEncryptionKey, m.j.UniqueID, m.timeNow())
+	if err != nil {
+		return err
+	}
+
+	return m.writeKeySlotsLocked(ctx, append(slots, ks), formatEncryptionKey)
+}
+
+// RemoveKeySlot removes the key slot with the provided label, revoking access using its password.
+// The key slot used to open the repository and the last remaining key slot can't be removed.
+func (m *Manager) RemoveKeySlot(ctx context.Context, label string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.j.findKeySlot(label)
+	if i < 0 {
+		return errors.Errorf("key slot %q not found", label)
+	}
+
+	current, _, err := m.j.unlockKeySlot(m.password)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine current key slot")
+	}
+
+	if current == i {
+		return errors.Errorf("key slot %q is used by the current connection and can't be removed", label)
+	}
+
+	slots := append([]KeySlot(nil), m.j.KeySlots[0:i]...)
+	slots = append(slots, m.j.KeySlots[i+1:]...)
+
+	return m.writeKeySlotsLocked(ctx, slots, m.formatEncryptionKey)
+}
+
+// changeKeySlotPasswordLocked replaces the key slot used to open the repository with one using the new password
+// and the provided key derivation algorithm, or the one used by the current key slot if empty.
+// +checklocks:m.mu
+func (m *Manager) changeKeySlotPasswordLocked(ctx context.Context, newPassword, keyDerivationAlgorithm string) error {
+	current, _, err := m.j.unlockKeySlot(m.password)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine current key slot")
+	}
+
+	old := m.j.KeySlots[current]
+
+	if keyDerivationAlgorithm == "" {
+		keyDerivationAlgorithm = old.KeyDerivationAlgorithm
+	}
+
+	ks, err := newKeySlot(old.Label, newPassword, keyDerivationAlgorithm, m.formatEncryptionKey, m.j.UniqueID, m.timeNow())
+	if err != nil {
+		return err
+	}
+
+	slots := append([]KeySlot(nil), m.j.KeySlots...)
+	slots[current] = ks
+
+	if err := m.writeKeySlotsLocked(ctx, slots, m.formatEncryptionKey); err != nil {
+		return err
+	}
+
+	m.password = newPassword
+
+	return nil
+}
+
+// writeKeySlotsLocked rewrites the format blob with the provided key slots, re-encrypting
+// the repository configuration if the format encryption key has changed.
+// +checklocks:m.mu
+func (m *Manager) writeKeySlotsLocked(ctx context.Context, slots []KeySlot, formatEncryptionKey []byte) error {
+	oldSlots, oldFormatBytes, oldKeyDerivationAlgorithm := m.j.KeySlots, m.j.EncryptedFormatBytes, m.j.KeyDerivationAlgorithm
+	m.j.KeySlots = slots
+	m.j.KeyDerivationAlgorithm = KeySlotsKeyDerivationAlgorithm
+
+	if err := m.writeFormatWithKeyLocked(ctx, formatEncryptionKey); err != nil {
+		m.j.KeySlots, m.j.EncryptedFormatBytes, m.j.KeyDerivationAlgorithm = oldSlots, oldFormatBytes, oldKeyDerivationAlgorithm
+		return err
+	}
+
+	return nil
+}
+
+// writeFormatWithKeyLocked encrypts repository configuration with the provided format encryption key
+// and writes `kopia.repository` and `kopia.blobcfg` blobs.
+// +checklocks:m.mu
+func (m *Manager) writeFormatWithKeyLocked(ctx context.Context, formatEncryptionKey []byte) error {
+	if err := m.j.EncryptRepositoryConfig(m.repoConfig, formatEncryptionKey); err != nil {
+		return errors.Wrap(err, "unable to encrypt format bytes")
+	}
+
+	if err := m.j.WriteBlobCfgBlob(ctx, m.blobs, m.blobCfgBlob, formatEncryptionKey); err != nil {
+		return errors.Wrap(err, "unable to write blobcfg blob")
+	}
+
+	if err := m.j.WriteKopiaRepositoryBlob(ctx, m.blobs, m.blobCfgBlob); err != nil {
+		return errors.Wrap(err, "unable to write format blob")
+	}
+
+	m.formatEncryptionKey = formatEncryptionKey
+
+	m.cache.Remove(ctx, []blob.ID{KopiaRepositoryBlobID, KopiaBlobCfgBlobID})
+
+	return nil
+}
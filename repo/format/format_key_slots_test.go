@@ -0,0 +1,140 @@
+package format_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/crypto"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/format"
+)
+
+func TestKeySlots(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	ta := faketime.NewTimeAdvance(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	nowFunc := ta.NowFunc()
+
+	cf2 := cf
+	cf2.Version = format.FormatVersion3
+	cf2.EnablePasswordChange = true
+
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	require.NoError(t, format.Initialize(ctx, st, &format.KopiaRepositoryJSON{}, &format.RepositoryConfig{ContentFormat: cf2}, format.BlobStorageConfiguration{}, "some-password"))
+
+	openManager := func(password string) (*format.Manager, error) {
+		return format.NewManagerWithCache(ctx, st, cacheDuration, password, nowFunc, format.NewMemoryBlobCache(nowFunc))
+	}
+
+	mgr, err := openManager("some-password")
+	require.NoError(t, err)
+
+	slots, err := mgr.KeySlots(ctx)
+	require.NoError(t, err)
+	require.Empty(t, slots)
+
+	// this manager keeps using the key it derived at open time.
+	other, err := openManager("some-password")
+	require.NoError(t, err)
+
+	require.NoError(t, mgr.AddKeySlot(ctx, "alice", "alice-password", format.DefaultKeyDerivationAlgorithm))
+	require.ErrorContains(t, mgr.AddKeySlot(ctx, "carol", "carol-password", "no-such-algorithm"), "unsupported key derivation algorithm")
+	require.ErrorContains(t, mgr.AddKeySlot(ctx, "alice", "alice-password2", ""), "already exists")
+	require.ErrorContains(t, mgr.AddKeySlot(ctx, format.DefaultKeySlotLabel, "x", ""), "already exists")
+	require.NoError(t, mgr.AddKeySlot(ctx, "bob", "bob-password", ""))
+
+	slots, err = mgr.KeySlots(ctx)
+	require.NoError(t, err)
+	require.Len(t, slots, 3)
+	require.Equal(t, format.DefaultKeySlotLabel, slots[0].Label)
+	require.Equal(t, "alice", slots[1].Label)
+	require.Equal(t, "bob", slots[2].Label)
+	require.Equal(t, format.DefaultKeyDerivationAlgorithm, slots[2].KeyDerivationAlgorithm)
+
+	// all passwords open the repository, including in managers that cached previous key.
+	for _, pass := range []string{"some-password", "alice-password", "bob-password"} {
+		_, err = openManager(pass)
+		require.NoError(t, err, pass)
+	}
+
+	ta.Advance(cacheDuration)
+	mustGetMutableParameters(t, other)
+
+	_, err = openManager("wrong-password")
+	require.ErrorIs(t, err, format.ErrInvalidPassword)
+
+	// revoke bob.
+	require.ErrorContains(t, mgr.RemoveKeySlot(ctx, "no-such-slot"), "not found")
+	require.ErrorContains(t, mgr.RemoveKeySlot(ctx, format.DefaultKeySlotLabel), "used by the current connection")
+	require.NoError(t, mgr.RemoveKeySlot(ctx, "bob"))
+
+	_, err = openManager("bob-password")
+	require.ErrorIs(t, err, format.ErrInvalidPassword)
+
+	// changing the password only replaces the key slot of the current password.
+	alice, err := openManager("alice-password")
+	require.NoError(t, err)
+	require.NoError(t, alice.ChangePassword(ctx, "alice-new-password"))
+
+	_, err = openManager("alice-password")
+	require.ErrorIs(t, err, format.ErrInvalidPassword)
+
+	_, err = openManager("alice-new-password")
+	require.NoError(t, err)
+
+	_, err = openManager("some-password")
+	require.NoError(t, err)
+
+	slots, err = alice.KeySlots(ctx)
+	require.NoError(t, err)
+	require.Len(t, slots, 2)
+	require.Equal(t, "alice", slots[1].Label)
+}
+
+func TestKeySlotsRejectedByOlderClients(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	cf2 := cf
+	cf2.Version = format.FormatVersion3
+	cf2.EnablePasswordChange = true
+
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	require.NoError(t, format.Initialize(ctx, st, &format.KopiaRepositoryJSON{}, &format.RepositoryConfig{ContentFormat: cf2}, format.BlobStorageConfiguration{}, "some-password"))
+
+	mgr, err := format.NewManagerWithCache(ctx, st, cacheDuration, "some-password", time.Now, format.NewMemoryBlobCache(time.Now))
+	require.NoError(t, err)
+	require.NoError(t, mgr.AddKeySlot(ctx, "alice", "alice-password", ""))
+
+	var b gather.WriteBuffer
+	defer b.Close()
+
+	require.NoError(t, st.GetBlob(ctx, format.KopiaRepositoryBlobID, 0, -1, &b))
+
+	j, err := format.ParseKopiaRepositoryJSON(b.ToByteSlice())
+	require.NoError(t, err)
+	require.Equal(t, format.KeySlotsKeyDerivationAlgorithm, j.KeyDerivationAlgorithm)
+
+	// clients without key slot support derive the key from the password using the algorithm in the format blob.
+	_, err = crypto.DeriveKeyFromPassword("some-password", j.UniqueID, 32, j.KeyDerivationAlgorithm)
+	require.ErrorContains(t, err, "upgrade kopia")
+
+	_, err = j.DeriveFormatEncryptionKeyFromPassword("some-password")
+	require.NoError(t, err)
+}
+
+func TestKeySlotsNotSupported(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	require.NoError(t, format.Initialize(ctx, st, &format.KopiaRepositoryJSON{}, &format.RepositoryConfig{ContentFormat: cf}, format.BlobStorageConfiguration{}, "some-password"))
+
+	mgr, err := format.NewManagerWithCache(ctx, st, cacheDuration, "some-password", time.Now, format.NewMemoryBlobCache(time.Now))
+	require.NoError(t, err)
+
+	require.ErrorContains(t, mgr.AddKeySlot(ctx, "alice", "alice-password", ""), "not supported")
+}
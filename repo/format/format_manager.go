@@ -1,6 +1,7 @@
 package format
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"io"
@@ -39,6 +40,8 @@ type Manager struct {
 	// +checklocks:mu
 	formatEncryptionKey []byte
 	// +checklocks:mu
+	privateKey []byte
+	// +checklocks:mu
 	j *KopiaRepositoryJSON
 	// +checklocks:mu
 	repoConfig *RepositoryConfig
@@ -127,52 +130,76 @@ func (m *Manager) refresh(ctx context.Context) error {
 	defer m.mu.Unlock()
 
 	b, cacheMTime, err := m.readAndCacheRepositoryBlobBytes(ctx, KopiaRepositoryBlobID)
-	if err != nil {
+	if err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
 		return errors.Wrap(err, "unable to read format blob")
 	}
 
-	j, err := ParseKopiaRepositoryJSON(b)
-	if err != nil {
-		return errors.Wrap(err, "can't parse format blob")
+	var (
+		j                   *KopiaRepositoryJSON
+		repoConfig          *RepositoryConfig
+		formatEncryptionKey []byte
+	)
+
+	if err == nil {
+		if _, perr := ParseKopiaRepositoryJSON(b); perr == nil {
+			// a format blob which can be parsed is authoritative, replicas may be stale and
+			// must not be used to open the repository with a password it no longer accepts.
+			if j, repoConfig, formatEncryptionKey, err = m.decodeFormatBlobLocked(b); err != nil {
+				return err
+			}
+		} else {
+			err = errors.Wrap(perr, "can't parse format blob")
+		}
+	} else {
+		err = errors.Wrap(err, "unable to read format blob")
 	}
 
-	b, err = addFormatBlobChecksumAndLength(b)
 	if err != nil {
-		return errors.Errorf("unable to add checksum")
-	}
+		// the format blob is missing or damaged, fall back to the first replica which can be opened.
+		rid, rb, rerr := readReplica(ctx, m.blobs, KopiaRepositoryBlobID, func(data []byte) error {
+			if bytes.Equal(data, b) {
+				return errors.New("same as format blob")
+			}
 
-	// use old key, if present to avoid deriving it, which is expensive
-	formatEncryptionKey := m.formatEncryptionKey
-	if len(m.formatEncryptionKey) == 0 {
-		formatEncryptionKey, err = j.DeriveFormatEncryptionKeyFromPassword(m.password)
-		if err != nil {
-			return errors.Wrap(err, "derive format encryption key")
+			var derr error
+
+			j, repoConfig, formatEncryptionKey, derr = m.decodeFormatBlobLocked(data)
+			if errors.Is(derr, ErrInvalidPassword) {
+				// report invalid password rather than the damage of the format blob.
+				err = derr
+			}
+
+			return derr
+		})
+		if rerr != nil {
+			return err
 		}
+
+		log(ctx).Warnf("format blob is missing or damaged, using %v instead. Run 'kopia repository recover-format' to repair it.", rid)
+
+		b, cacheMTime = rb, m.timeNow()
 	}
 
-	repoConfig, err := j.decryptRepositoryConfig(formatEncryptionKey)
+	blobCfg, err := m.loadBlobCfgLocked(ctx, j, formatEncryptionKey)
 	if err != nil {
-		return ErrInvalidPassword
+		return err
 	}
 
-	var blobCfg BlobStorageConfiguration
-
-	if b2, _, err2 := m.readAndCacheRepositoryBlobBytes(ctx, KopiaBlobCfgBlobID); err2 == nil {
-		var e2 error
-
-		blobCfg, e2 = deserializeBlobCfgBytes(j, b2, formatEncryptionKey)
-		if e2 != nil {
-			return errors.Wrap(e2, "deserialize blob config")
-		}
-	} else if !errors.Is(err2, blob.ErrBlobNotFound) {
-		return errors.Wrap(err2, "load blob config")
+	b, err = addFormatBlobChecksumAndLength(b)
+	if err != nil {
+		return errors.Errorf("unable to add checksum")
 	}
 
-	prov, err := NewFormattingOptionsProvider(&repoConfig.ContentFormat, b)
+	prov, err := newFormattingOptionsProvider(&repoConfig.ContentFormat, b, m.privateKey)
 	if err != nil {
 		return errors.Wrap(err, "error creating format provider")
 	}
 
+	if m.immutable != nil && !sameContentFormat(m.immutable, prov) {
+		// contents written using the previous format would be unreadable.
+		return ErrFormatConverted
+	}
+
 	m.current = prov
 	m.j = j
 	m.repoConfig = repoConfig
@@ -192,6 +219,88 @@ func (m *Manager) refresh(ctx context.Context) error {
 	return nil
 }
 
+// decodeFormatBlobLocked parses the provided format blob and decrypts the repository configuration.
+// +checklocks:m.mu
+func (m *Manager) decodeFormatBlobLocked(b []byte) (*KopiaRepositoryJSON, *RepositoryConfig, []byte, error) {
+	j, err := ParseKopiaRepositoryJSON(b)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "can't parse format blob")
+	}
+
+	// use old key, if present to avoid deriving it, which is expensive
+	formatEncryptionKey := m.formatEncryptionKey
+	if len(m.formatEncryptionKey) == 0 {
+		formatEncryptionKey, err = j.DeriveFormatEncryptionKeyFromPassword(m.password)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "derive format encryption key")
+		}
+	}
+
+	repoConfig, err := j.decryptRepositoryConfig(formatEncryptionKey)
+	if err != nil && len(m.formatEncryptionKey) != 0 {
+		// format encryption key may have been replaced by another client, derive it again.
+		formatEncryptionKey, err = j.DeriveFormatEncryptionKeyFromPassword(m.password)
+		if err != nil {
+			return nil, nil, nil, ErrInvalidPassword
+		}
+
+		repoConfig, err = j.decryptRepositoryConfig(formatEncryptionKey)
+	}
+
+	if err != nil {
+		return nil, nil, nil, ErrInvalidPassword
+	}
+
+	return j, repoConfig, formatEncryptionKey, nil
+}
+
+// loadBlobCfgLocked reads and decrypts `kopia.blobcfg` blob, falling back to its replicas if it's missing or damaged.
+// +checklocks:m.mu
+func (m *Manager) loadBlobCfgLocked(ctx context.Context, j *KopiaRepositoryJSON, formatEncryptionKey []byte) (BlobStorageConfiguration, error) {
+	b, _, err := m.readAndCacheRepositoryBlobBytes(ctx, KopiaBlobCfgBlobID)
+	if err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+		return BlobStorageConfiguration{}, errors.Wrap(err, "load blob config")
+	}
+
+	var blobCfg BlobStorageConfiguration
+
+	if err == nil {
+		if blobCfg, err = deserializeBlobCfgBytes(j, b, formatEncryptionKey); err == nil {
+			return blobCfg, nil
+		}
+
+		err = errors.Wrap(err, "deserialize blob config")
+	}
+
+	if j.Replicas == nil || j.Replicas.Count == 0 {
+		if errors.Is(err, blob.ErrBlobNotFound) {
+			// blob config is optional.
+			return BlobStorageConfiguration{}, nil
+		}
+
+		return BlobStorageConfiguration{}, err
+	}
+
+	rid, _, rerr := readReplica(ctx, m.blobs, KopiaBlobCfgBlobID, func(data []byte) error {
+		var derr error
+
+		blobCfg, derr = deserializeBlobCfgBytes(j, data, formatEncryptionKey)
+
+		return derr
+	})
+	if rerr != nil {
+		if errors.Is(err, blob.ErrBlobNotFound) {
+			return BlobStorageConfiguration{}, nil
+		}
+
+		return BlobStorageConfiguration{}, err
+	}
+
+	log(ctx).Warnf("blobcfg blob is missing or damaged, using %v instead. Run 'kopia repository recover-format' to repair it.", rid)
+
+	return blobCfg, nil
+}
+
 // GetEncryptionAlgorithm returns the encryption algorithm.
 func (m *Manager) GetEncryptionAlgorithm() string {
 	return m.immutable.GetEncryptionAlgorithm()
@@ -222,9 +331,62 @@ func (m *Manager) HashFunc() hashing.HashFunc {
 	return m.immutable.HashFunc()
 }
 
-// Encryptor returns the resolved encryptor.
+// Encryptor returns the resolved encryptor, which uses the current content encryption key ring.
 func (m *Manager) Encryptor() encryption.Encryptor {
-	return m.immutable.Encryptor()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.current == nil {
+		return m.immutable.Encryptor()
+	}
+
+	return m.current.Encryptor()
+}
+
+// EncryptorForKeyID returns the encryptor for contents written using the provided encryption key ID.
+// If the key is not known, the format blob is reloaded from the storage in case another client has rotated the key.
+func (m *Manager) EncryptorForKeyID(ctx context.Context, keyID byte) (encryption.Encryptor, error) {
+	f, err := m.getOrRefreshFormat(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if e, err := f.EncryptorForKeyID(ctx, keyID); err == nil {
+		return e, nil
+	}
+
+	// the key may have been added by another client recently.
+	if err := m.ReloadEncryptionKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	//nolint:wrapcheck
+	return m.current.EncryptorForKeyID(ctx, keyID)
+}
+
+// ReloadEncryptionKeys reloads the format blob from the storage, bypassing the cache, to pick up
+// encryption keys rotated or retired by other clients.
+func (m *Manager) ReloadEncryptionKeys(ctx context.Context) error {
+	m.mu.Lock()
+	m.ignoreCacheOnFirstRefresh = true
+	m.mu.Unlock()
+
+	return m.refresh(ctx)
+}
+
+// GetActiveEncryptionKeyID returns the ID of the key used to encrypt new contents.
+func (m *Manager) GetActiveEncryptionKeyID() byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.current == nil {
+		return 0
+	}
+
+	return m.current.GetActiveEncryptionKeyID()
 }
 
 // GetMasterKey gets the master key.
@@ -365,6 +527,7 @@ func (m *Manager) ScrubbedContentFormat() ContentFormat {
 	cf := m.repoConfig.ContentFormat
 	cf.MasterKey = nil
 	cf.HMACSecret = nil
+	cf.EncryptionKeys = scrubEncryptionKeys(cf.EncryptionKeys)
 
 	return cf
 }
@@ -456,6 +619,16 @@ func Initialize(ctx context.Context, st blob.Storage, formatBlob *KopiaRepositor
 		formatBlob.KeyDerivationAlgorithm = DefaultKeyDerivationAlgorithm
 	}
 
+	if err := ValidateKeyDerivationAlgorithm(formatBlob.KeyDerivationAlgorithm); err != nil {
+		return err
+	}
+
+	if formatBlob.Replicas != nil {
+		if err := formatBlob.Replicas.Validate(); err != nil {
+			return err
+		}
+	}
+
 	if len(formatBlob.UniqueID) == 0 {
 		formatBlob.UniqueID = randomBytes(UniqueIDLengthBytes)
 	}
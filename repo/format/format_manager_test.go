@@ -10,6 +10,7 @@
 	"github.com/stretchr/testify/require"
 
 	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/crypto"
 	"github.com/kopia/kopia/internal/epoch"
 	"github.com/kopia/kopia/internal/faketime"
 	"github.com/kopia/kopia/internal/feature"
@@ -367,6 +368,57 @@ func TestChangePassword(t *testing.T) {
 	require.ErrorIs(t, err, format.ErrInvalidPassword)
 }
 
+func TestChangePasswordWithKeyDerivationAlgorithm(t *testing.T) {
+	ctx := testlogging.Context(t)
+	nowFunc := faketime.NewTimeAdvance(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)).NowFunc()
+
+	cf2 := cf
+	cf2.Version = format.FormatVersion3
+	cf2.EnablePasswordChange = true
+
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	require.NoError(t, format.Initialize(ctx, st, &format.KopiaRepositoryJSON{}, &format.RepositoryConfig{ContentFormat: cf2}, format.BlobStorageConfiguration{}, "some-password"))
+
+	require.Error(t, format.Initialize(ctx, blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), &format.KopiaRepositoryJSON{
+		KeyDerivationAlgorithm: "argon2id-1024-0-1",
+	}, &format.RepositoryConfig{ContentFormat: cf2}, format.BlobStorageConfiguration{}, "some-password"))
+
+	openManager := func(password string) (*format.Manager, error) {
+		return format.NewManagerWithCache(ctx, st, cacheDuration, password, nowFunc, format.NewMemoryBlobCache(nowFunc))
+	}
+
+	mgr, err := openManager("some-password")
+	require.NoError(t, err)
+
+	require.Error(t, mgr.ChangePasswordWithKeyDerivationAlgorithm(ctx, "new-password", "no-such-algorithm"))
+	require.Error(t, mgr.ChangePasswordWithKeyDerivationAlgorithm(ctx, "new-password", "argon2id-1024-1-0"))
+
+	require.NoError(t, mgr.ChangePasswordWithKeyDerivationAlgorithm(ctx, "new-password", "argon2id-1024-1-1"))
+
+	j, err := format.ParseKopiaRepositoryJSON(mustGetBytes(t, st, format.KopiaRepositoryBlobID))
+	require.NoError(t, err)
+	require.Equal(t, "argon2id-1024-1-1", j.KeyDerivationAlgorithm)
+
+	_, err = openManager("some-password")
+	require.ErrorIs(t, err, format.ErrInvalidPassword)
+
+	mgr, err = openManager("new-password")
+	require.NoError(t, err)
+
+	// key slots record the algorithm per slot.
+	require.NoError(t, mgr.AddKeySlot(ctx, "other", "other-password", format.DefaultKeyDerivationAlgorithm))
+	require.NoError(t, mgr.ChangePasswordWithKeyDerivationAlgorithm(ctx, "newer-password", crypto.Argon2idAlgorithmName(2048, 1, 2)))
+
+	slots, err := mgr.KeySlots(ctx)
+	require.NoError(t, err)
+	require.Len(t, slots, 2)
+	require.Equal(t, "argon2id-2048-1-2", slots[0].KeyDerivationAlgorithm)
+	require.Equal(t, format.DefaultKeyDerivationAlgorithm, slots[1].KeyDerivationAlgorithm)
+
+	_, err = openManager("newer-password")
+	require.NoError(t, err)
+}
+
 func TestFormatManagerValidDuration(t *testing.T) {
 	cases := map[time.Duration]time.Duration{
 		-1:               15 * time.Minute,
@@ -0,0 +1,52 @@
+package format
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/feature"
+	"github.com/kopia/kopia/repo/encryption"
+)
+
+// AsymmetricEncryptionFeature is the feature required to open repositories whose contents are sealed
+// to a public key. Clients which don't understand it would encrypt contents using MasterKey and would
+// be unable to read sealed contents.
+//
+// Only contents, including manifests, are sealed. Index blobs and other repository metadata are still
+// encrypted using MasterKey, which together with HMACSecret is stored in the format blob and is known to
+// every client with the repository password, including write-only ones. Such clients can't read contents,
+// but can read content IDs, sizes and locations from indexes. Preventing write-only clients from deleting
+// existing data requires storage permissions or retention, since the restriction is enforced by the client.
+const AsymmetricEncryptionFeature feature.Feature = "asymmetric-encryption"
+
+// PublicKey returns the public key to which contents are sealed or nil if the repository
+// does not use asymmetric encryption.
+func (m *Manager) PublicKey() []byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.repoConfig.PublicKey
+}
+
+// SetPrivateKey provides the private key of a repository using asymmetric encryption,
+// which allows reading contents sealed to its public key.
+func (m *Manager) SetPrivateKey(privateKey []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.repoConfig.PublicKey) == 0 {
+		return errors.Errorf("repository does not use asymmetric encryption")
+	}
+
+	if _, err := encryption.NewSealedBoxEncryptor(m.repoConfig.PublicKey, privateKey); err != nil {
+		return errors.Wrap(err, "invalid private key")
+	}
+
+	m.privateKey = privateKey
+
+	// rebuild content encryptors on next access.
+	m.validUntil = time.Time{}
+
+	return nil
+}
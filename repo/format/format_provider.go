@@ -2,6 +2,7 @@
 
 import (
 	"context"
+	"sort"
 
 	"github.com/pkg/errors"
 
@@ -56,6 +57,10 @@ type Provider interface {
 	HashFunc() hashing.HashFunc
 	Encryptor() encryption.Encryptor
 
+	// EncryptorForKeyID returns the encryptor for contents written using the provided encryption key ID.
+	EncryptorForKeyID(ctx context.Context, keyID byte) (encryption.Encryptor, error)
+	GetActiveEncryptionKeyID() byte
+
 	// this is typically cached, but sometimes refreshes MutableParameters from
 	// the repository so the results should not be cached.
 	GetMutableParameters(ctx context.Context) (MutableParameters, error)
@@ -71,12 +76,19 @@ type formattingOptionsProvider struct {
 
 	h           hashing.HashFunc
 	e           encryption.Encryptor
+	keyRing     map[byte]encryption.Encryptor
 	formatBytes []byte
 }
 
 // NewFormattingOptionsProvider validates the provided formatting options and returns static
 // FormattingOptionsProvider based on them.
 func NewFormattingOptionsProvider(f0 *ContentFormat, formatBytes []byte) (Provider, error) {
+	return newFormattingOptionsProvider(f0, formatBytes, nil)
+}
+
+// newFormattingOptionsProvider is like NewFormattingOptionsProvider but also accepts the private key
+// used to decrypt sealed contents, which is nil for write-only clients.
+func newFormattingOptionsProvider(f0 *ContentFormat, formatBytes, privateKey []byte) (Provider, error) {
 	clone := *f0
 	f := &clone
 	formatVersion := f.Version
@@ -108,23 +120,24 @@ func NewFormattingOptionsProvider(f0 *ContentFormat, formatBytes []byte) (Provid
 		return nil, errors.Wrap(err, "unable to create hash")
 	}
 
-	e, err := encryption.CreateEncryptor(f)
+	e, err := createEncryptor(f)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to create encryptor")
+		return nil, err
 	}
 
-	if f.GetECCAlgorithm() != "" && f.GetECCOverheadPercent() > 0 {
-		eccEncryptor, err := ecc.CreateEncryptor(f)
-		if err != nil {
-			return nil, errors.Wrap(err, "unable to create ECC")
-		}
+	contentEncryptor := e
 
-		e = &encryptorWrapper{
-			impl: e,
-			next: eccEncryptor,
+	if len(f.PublicKey) > 0 {
+		if contentEncryptor, err = createSealedBoxEncryptor(f, privateKey); err != nil {
+			return nil, err
 		}
 	}
 
+	keyRing, e, err := createKeyRingEncryptors(f, e, contentEncryptor)
+	if err != nil {
+		return nil, err
+	}
+
 	contentID := h(nil, gather.FromSlice(nil))
 
 	var tmp gather.WriteBuffer
@@ -140,6 +153,7 @@ func NewFormattingOptionsProvider(f0 *ContentFormat, formatBytes []byte) (Provid
 
 		h:           h,
 		e:           e,
+		keyRing:     keyRing,
 		formatBytes: formatBytes,
 	}, nil
 }
@@ -148,6 +162,14 @@ func (f *formattingOptionsProvider) Encryptor() encryption.Encryptor {
 	return f.e
 }
 
+func (f *formattingOptionsProvider) EncryptorForKeyID(ctx context.Context, keyID byte) (encryption.Encryptor, error) {
+	if e := f.keyRing[keyID]; e != nil {
+		return e, nil
+	}
+
+	return nil, errors.Errorf("unknown encryption key ID: %v", keyID)
+}
+
 func (f *formattingOptionsProvider) HashFunc() hashing.HashFunc {
 	return f.h
 }
@@ -160,4 +182,123 @@ func (f *formattingOptionsProvider) RepositoryFormatBytes(ctx context.Context) (
 	return f.formatBytes, nil
 }
 
+// createEncryptor creates the encryptor for the provided content format, including ECC if enabled.
+func createEncryptor(f *ContentFormat) (encryption.Encryptor, error) {
+	e, err := encryption.CreateEncryptor(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create encryptor")
+	}
+
+	return maybeAddECC(f, e)
+}
+
+// createSealedBoxEncryptor creates the encryptor for contents sealed to the public key, including ECC if enabled.
+func createSealedBoxEncryptor(f *ContentFormat, privateKey []byte) (encryption.Encryptor, error) {
+	e, err := encryption.NewSealedBoxEncryptor(f.PublicKey, privateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create sealed box encryptor")
+	}
+
+	return maybeAddECC(f, e)
+}
+
+func maybeAddECC(f *ContentFormat, e encryption.Encryptor) (encryption.Encryptor, error) {
+	if f.GetECCAlgorithm() != "" && f.GetECCOverheadPercent() > 0 {
+		eccEncryptor, err := ecc.CreateEncryptor(f)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create ECC")
+		}
+
+		e = &encryptorWrapper{
+			impl: e,
+			next: eccEncryptor,
+		}
+	}
+
+	return e, nil
+}
+
+// createKeyRingEncryptors creates encryptors for all content encryption keys, indexed by their IDs,
+// and the encryptor for repository blobs, which uses the active key and can decrypt blobs written
+// using any key in the key ring.
+func createKeyRingEncryptors(f *ContentFormat, masterKeyEncryptor, masterKeyContentEncryptor encryption.Encryptor) (map[byte]encryption.Encryptor, encryption.Encryptor, error) {
+	if len(f.EncryptionKeys) == 0 && !f.MasterKeyRetired && f.ActiveEncryptionKeyID == 0 {
+		// encryption key was never rotated.
+		return map[byte]encryption.Encryptor{0: masterKeyContentEncryptor}, masterKeyEncryptor, nil
+	}
+
+	contentEncryptors := map[byte]encryption.Encryptor{}
+
+	// blob encryptors are created without ECC, which is applied on top of the key ring.
+	blobEncryptors := map[byte]encryption.Encryptor{}
+
+	if !f.MasterKeyRetired {
+		e, err := encryption.CreateEncryptor(f)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "unable to create encryptor")
+		}
+
+		contentEncryptors[0] = masterKeyContentEncryptor
+		blobEncryptors[0] = e
+	}
+
+	for _, k := range f.EncryptionKeys {
+		if k.ID == 0 || k.ID == invalidEncryptionKeyID {
+			return nil, nil, errors.Errorf("invalid encryption key ID: %v", k.ID)
+		}
+
+		if blobEncryptors[k.ID] != nil {
+			return nil, nil, errors.Errorf("duplicate encryption key ID: %v", k.ID)
+		}
+
+		kf := *f
+		kf.MasterKey = k.MasterKey
+
+		e, err := encryption.CreateEncryptor(&kf)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "unable to create encryptor for encryption key %v", k.ID)
+		}
+
+		ce, err := maybeAddECC(&kf, e)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "encryption key %v", k.ID)
+		}
+
+		contentEncryptors[k.ID] = ce
+		blobEncryptors[k.ID] = e
+	}
+
+	ring := &keyRingEncryptor{
+		active: blobEncryptors[f.ActiveEncryptionKeyID],
+	}
+
+	if ring.active == nil {
+		return nil, nil, errors.Errorf("active encryption key %v not found", f.ActiveEncryptionKeyID)
+	}
+
+	var otherIDs []byte
+
+	for id := range blobEncryptors {
+		if id != f.ActiveEncryptionKeyID {
+			otherIDs = append(otherIDs, id)
+		}
+	}
+
+	// newer keys are more likely to have been used to write blobs.
+	sort.Slice(otherIDs, func(i, j int) bool {
+		return otherIDs[i] > otherIDs[j]
+	})
+
+	for _, id := range otherIDs {
+		ring.others = append(ring.others, blobEncryptors[id])
+	}
+
+	blobEncryptor, err := maybeAddECC(f, ring)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return contentEncryptors, blobEncryptor, nil
+}
+
 var _ Provider = (*formattingOptionsProvider)(nil)
@@ -0,0 +1,281 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/crypto"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/shamir"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const (
+	recoverySecretLength       = 32
+	recoveryShareVersion       = 1
+	recoveryShareChecksumSize  = 4
+	recoveryShareGroupLength   = 5
+	purposeRecoveryWrappingKey = "recovery-shares"
+)
+
+// ErrInvalidRecoveryShares is returned when the provided recovery shares can't be combined to unlock the repository.
+var ErrInvalidRecoveryShares = errors.New("invalid recovery shares")
+
+//nolint:gochecknoglobals
+var recoveryShareEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// RecoveryKey holds the format encryption key wrapped with a random recovery secret, which is split
+// into Shares using Shamir's secret sharing so that any Threshold of them can restore access to the repository.
+type RecoveryKey struct {
+	Threshold    int       `json:"threshold"`
+	Shares       int       `json:"shares"`
+	EncryptedKey []byte    `json:"encryptedKey"`
+	CreatedTime  time.Time `json:"created"`
+}
+
+// recoveryWrappingKey returns the key used to wrap the format encryption key. The secret is random,
+// so unlike passwords it does not need to be stretched.
+func recoveryWrappingKey(secret, uniqueID []byte) []byte {
+	return crypto.DeriveKeyFromMasterKey(secret, uniqueID, []byte(purposeRecoveryWrappingKey), formatBlobEncryptionKeySize)
+}
+
+// encodeRecoveryShare encodes the share as groups of upper-case base32 characters with a checksum,
+// which can be printed, typed in or stored in QR codes using the alphanumeric mode.
+func encodeRecoveryShare(threshold int, share []byte) string {
+	body := append([]byte{recoveryShareVersion, byte(threshold)}, share...)
+	sum := sha256.Sum256(body)
+	s := recoveryShareEncoding.EncodeToString(append(body, sum[:recoveryShareChecksumSize]...))
+
+	var groups []string
+
+	for len(s) > recoveryShareGroupLength {
+		groups = append(groups, s[:recoveryShareGroupLength])
+		s = s[recoveryShareGroupLength:]
+	}
+
+	return strings.Join(append(groups, s), "-")
+}
+
+// decodeRecoveryShare returns the threshold and the share encoded using encodeRecoveryShare.
+func decodeRecoveryShare(s string) (int, []byte, error) {
+	s = strings.ToUpper(strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return r == '-' || r == ' ' || r == '\t'
+	}), ""))
+
+	b, err := recoveryShareEncoding.DecodeString(s)
+	if err != nil || len(b) < 2+recoveryShareChecksumSize {
+		return 0, nil, errors.New("malformed recovery share")
+	}
+
+	body, checksum := b[:len(b)-recoveryShareChecksumSize], b[len(b)-recoveryShareChecksumSize:]
+
+	if sum := sha256.Sum256(body); !bytes.Equal(sum[:recoveryShareChecksumSize], checksum) {
+		return 0, nil, errors.New("recovery share checksum mismatch, check for typos")
+	}
+
+	if body[0] != recoveryShareVersion {
+		return 0, nil, errors.Errorf("unsupported recovery share version %v", body[0])
+	}
+
+	return int(body[1]), body[2:], nil
+}
+
+// unlockRecoveryKey returns the format encryption key unwrapped using the secret combined from the provided shares.
+func (f *KopiaRepositoryJSON) unlockRecoveryKey(encodedShares []string) ([]byte, error) {
+	rk := f.RecoveryKey
+	if rk == nil {
+		return nil, errors.New("repository does not have recovery shares")
+	}
+
+	var shares [][]byte
+
+	for i, s := range encodedShares {
+		threshold, share, err := decodeRecoveryShare(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "recovery share #%v", i+1)
+		}
+
+		if threshold != rk.Threshold {
+			return nil, errors.Wrapf(ErrInvalidRecoveryShares, "recovery share #%v was created for a different set of shares", i+1)
+		}
+
+		shares = append(shares, share)
+	}
+
+	if len(shares) < rk.Threshold {
+		return nil, errors.Errorf("%v recovery shares are required, got %v", rk.Threshold, len(shares))
+	}
+
+	secret, err := shamir.Combine(shares)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidRecoveryShares, err.Error())
+	}
+
+	key, err := crypto.DecryptAes256Gcm(rk.EncryptedKey, recoveryWrappingKey(secret, f.UniqueID), f.UniqueID)
+	if err != nil {
+		return nil, ErrInvalidRecoveryShares
+	}
+
+	return key, nil
+}
+
+// RecoveryKey returns information about the recovery shares of the repository or nil if none have been created.
+func (m *Manager) RecoveryKey(ctx context.Context) (*RecoveryKey, error) {
+	if err := m.maybeRefreshNotLocked(ctx); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.j.RecoveryKey == nil {
+		return nil, nil
+	}
+
+	rk := *m.j.RecoveryKey
+	rk.EncryptedKey = nil
+
+	return &rk, nil
+}
+
+// CreateRecoveryShares splits a new recovery secret, which unlocks the format encryption key, into the provided
+// number of shares, any threshold of which can be used to restore access to the repository if all passwords are lost.
+// Previously created shares are invalidated. Repositories which derive the format encryption key from the password
+// are converted to key slots, so that password changes don't invalidate the shares.
+func (m *Manager) CreateRecoveryShares(ctx context.Context, threshold, shares int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.repoConfig.EnablePasswordChange {
+		return nil, errors.Errorf("recovery shares are not supported for repositories created using Kopia v0.8 or older")
+	}
+
+	formatEncryptionKey := m.formatEncryptionKey
+	slots := m.j.KeySlots
+
+	if len(slots) == 0 {
+		// derived key would change with the password, switch to random format encryption key stored in key slots.
+		formatEncryptionKey = randomBytes(formatBlobEncryptionKeySize)
+
+		ks, err := newKeySlot(DefaultKeySlotLabel, m.password, m.j.KeyDerivationAlgorithm, formatEncryptionKey, m.j.UniqueID, m.timeNow())
+		if err != nil {
+			return nil, err
+		}
+
+		slots = []KeySlot{ks}
+	}
+
+	secret := randomBytes(recoverySecretLength)
+
+	parts, err := shamir.Split(secret, shares, threshold)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to split recovery secret")
+	}
+
+	encryptedKey, err := encryptRepositoryBlobBytesAes256Gcm(formatEncryptionKey, recoveryWrappingKey(secret, m.j.UniqueID), m.j.UniqueID)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encrypt recovery key")
+	}
+
+	oldRecoveryKey := m.j.RecoveryKey
+	m.j.RecoveryKey = &RecoveryKey{
+		Threshold:    threshold,
+		Shares:       shares,
+		EncryptedKey: encryptedKey,
+		CreatedTime:  m.timeNow(),
+	}
+
+	if err := m.writeKeySlotsLocked(ctx, slots, formatEncryptionKey); err != nil {
+		m.j.RecoveryKey = oldRecoveryKey
+		return nil, err
+	}
+
+	var result []string
+
+	for _, p := range parts {
+		result = append(result, encodeRecoveryShare(threshold, p))
+	}
+
+	return result, nil
+}
+
+// RemoveRecoveryShares invalidates all recovery shares of the repository.
+func (m *Manager) RemoveRecoveryShares(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.j.RecoveryKey == nil {
+		return errors.New("repository does not have recovery shares")
+	}
+
+	oldRecoveryKey := m.j.RecoveryKey
+	m.j.RecoveryKey = nil
+
+	if err := m.writeFormatWithKeyLocked(ctx, m.formatEncryptionKey); err != nil {
+		m.j.RecoveryKey = oldRecoveryKey
+		return err
+	}
+
+	return nil
+}
+
+// RecoveryShareThreshold returns the number of recovery shares required to restore access to the repository
+// in the provided storage.
+func RecoveryShareThreshold(ctx context.Context, st blob.Storage) (int, error) {
+	j, err := readKopiaRepositoryJSON(ctx, st)
+	if err != nil {
+		return 0, err
+	}
+
+	if j.RecoveryKey == nil {
+		return 0, errors.New("repository does not have recovery shares")
+	}
+
+	return j.RecoveryKey.Threshold, nil
+}
+
+// AddKeySlotUsingRecoveryShares restores access to the repository in the provided storage by combining
+// the recovery shares and adding a key slot with the provided label and new password.
+func AddKeySlotUsingRecoveryShares(ctx context.Context, st blob.Storage, shares []string, label, newPassword string, timeNow func() time.Time) error {
+	j, err := readKopiaRepositoryJSON(ctx, st)
+	if err != nil {
+		return err
+	}
+
+	formatEncryptionKey, err := j.unlockRecoveryKey(shares)
+	if err != nil {
+		return err
+	}
+
+	m := &Manager{
+		blobs:                     st,
+		validDuration:             DefaultRepositoryBlobCacheDuration,
+		cache:                     NewMemoryBlobCache(timeNow),
+		timeNow:                   timeNow,
+		formatEncryptionKey:       formatEncryptionKey,
+		ignoreCacheOnFirstRefresh: true,
+	}
+
+	if err := m.refresh(ctx); err != nil {
+		return errors.Wrap(err, "unable to open repository using recovery shares")
+	}
+
+	return m.AddKeySlot(ctx, label, newPassword, DefaultKeyDerivationAlgorithm)
+}
+
+func readKopiaRepositoryJSON(ctx context.Context, st blob.Storage) (*KopiaRepositoryJSON, error) {
+	var b gather.WriteBuffer
+	defer b.Close()
+
+	if err := st.GetBlob(ctx, KopiaRepositoryBlobID, 0, -1, &b); err != nil {
+		return nil, errors.Wrap(err, "unable to read format blob")
+	}
+
+	return ParseKopiaRepositoryJSON(b.ToByteSlice())
+}
@@ -0,0 +1,100 @@
+package format_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/format"
+)
+
+func TestRecoveryShares(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	ta := faketime.NewTimeAdvance(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	nowFunc := ta.NowFunc()
+
+	cf2 := cf
+	cf2.Version = format.FormatVersion3
+	cf2.EnablePasswordChange = true
+
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	require.NoError(t, format.Initialize(ctx, st, &format.KopiaRepositoryJSON{}, &format.RepositoryConfig{ContentFormat: cf2}, format.BlobStorageConfiguration{}, "some-password"))
+
+	openManager := func(password string) (*format.Manager, error) {
+		return format.NewManagerWithCache(ctx, st, cacheDuration, password, nowFunc, format.NewMemoryBlobCache(nowFunc))
+	}
+
+	mgr, err := openManager("some-password")
+	require.NoError(t, err)
+
+	rk, err := mgr.RecoveryKey(ctx)
+	require.NoError(t, err)
+	require.Nil(t, rk)
+
+	_, err = mgr.CreateRecoveryShares(ctx, 1, 5)
+	require.Error(t, err)
+
+	oldShares, err := mgr.CreateRecoveryShares(ctx, 2, 3)
+	require.NoError(t, err)
+
+	shares, err := mgr.CreateRecoveryShares(ctx, 3, 5)
+	require.NoError(t, err)
+	require.Len(t, shares, 5)
+
+	rk, err = mgr.RecoveryKey(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, rk.Threshold)
+	require.Equal(t, 5, rk.Shares)
+	require.Nil(t, rk.EncryptedKey)
+
+	// the repository has been converted to key slots, so password changes keep the shares valid.
+	slots, err := mgr.KeySlots(ctx)
+	require.NoError(t, err)
+	require.Len(t, slots, 1)
+
+	require.NoError(t, mgr.ChangePassword(ctx, "changed-password"))
+
+	threshold, err := format.RecoveryShareThreshold(ctx, st)
+	require.NoError(t, err)
+	require.Equal(t, 3, threshold)
+
+	require.ErrorContains(t, format.AddKeySlotUsingRecoveryShares(ctx, st, shares[0:2], "recovered", "recovered-password", nowFunc), "3 recovery shares are required")
+	require.ErrorIs(t, format.AddKeySlotUsingRecoveryShares(ctx, st, oldShares, "recovered", "recovered-password", nowFunc), format.ErrInvalidRecoveryShares)
+
+	typo := []byte(shares[1])
+	if typo[3] == 'A' {
+		typo[3] = 'B'
+	} else {
+		typo[3] = 'A'
+	}
+
+	require.ErrorContains(t, format.AddKeySlotUsingRecoveryShares(ctx, st, []string{shares[0], string(typo), shares[2]}, "recovered", "recovered-password", nowFunc), "checksum")
+
+	// shares are accepted in any order, case and grouping.
+	require.NoError(t, format.AddKeySlotUsingRecoveryShares(ctx, st, []string{
+		shares[4],
+		strings.ToLower(shares[2]),
+		strings.ReplaceAll(shares[0], "-", " "),
+	}, "recovered", "recovered-password", nowFunc))
+
+	recovered, err := openManager("recovered-password")
+	require.NoError(t, err)
+
+	slots, err = recovered.KeySlots(ctx)
+	require.NoError(t, err)
+	require.Len(t, slots, 2)
+	require.Equal(t, "recovered", slots[1].Label)
+
+	_, err = openManager("changed-password")
+	require.NoError(t, err)
+
+	require.NoError(t, recovered.RemoveRecoveryShares(ctx))
+	require.Error(t, recovered.RemoveRecoveryShares(ctx))
+	require.ErrorContains(t, format.AddKeySlotUsingRecoveryShares(ctx, st, shares, "recovered2", "recovered-password", nowFunc), "does not have recovery shares")
+}
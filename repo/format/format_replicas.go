@@ -0,0 +1,479 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/ecc"
+	"github.com/kopia/kopia/repo/encryption"
+)
+
+const (
+	// MaxReplicas is the maximum number of redundant copies of the format blobs.
+	MaxReplicas = 10
+
+	replicaBlobIDInfix    = ".replica."
+	replicaFormatVersion  = 1
+	replicaHeaderSize     = 2
+	maxReplicaECCOverhead = 100
+)
+
+// ReplicaOptions describes redundant copies of `kopia.repository` and `kopia.blobcfg` blobs,
+// which are used when the primary blobs are missing or damaged.
+type ReplicaOptions struct {
+	Count              int `json:"count"`
+	ECCOverheadPercent int `json:"eccOverheadPercent,omitempty"`
+}
+
+// Validate validates the replica options.
+func (o ReplicaOptions) Validate() error {
+	if o.Count < 0 || o.Count > MaxReplicas {
+		return errors.Errorf("number of format blob replicas must be between 0 and %v", MaxReplicas)
+	}
+
+	if o.ECCOverheadPercent < 0 || o.ECCOverheadPercent > maxReplicaECCOverhead {
+		return errors.Errorf("format blob replica ECC overhead must be between 0 and %v percent", maxReplicaECCOverhead)
+	}
+
+	return nil
+}
+
+// ReplicaBlobID returns the identifier of the n-th replica (starting at 1) of the provided format blob.
+func ReplicaBlobID(id blob.ID, n int) blob.ID {
+	return id + replicaBlobIDInfix + blob.ID(strconv.Itoa(n))
+}
+
+// encodeReplica returns the replica of the provided blob contents, which consists of a header holding
+// the format version and ECC overhead, followed by contents checksummed with HMAC-SHA256, optionally
+// protected with Reed-Solomon error correction.
+func encodeReplica(data []byte, eccOverheadPercent int) ([]byte, error) {
+	h := hmac.New(sha256.New, formatBlobChecksumSecret)
+	h.Write(data)
+
+	payload := h.Sum(append([]byte(nil), data...))
+
+	if eccOverheadPercent > 0 {
+		e, err := replicaECC(eccOverheadPercent)
+		if err != nil {
+			return nil, err
+		}
+
+		var out gather.WriteBuffer
+		defer out.Close()
+
+		if err := e.Encrypt(gather.FromSlice(payload), nil, &out); err != nil {
+			return nil, errors.Wrap(err, "unable to add error correction")
+		}
+
+		payload = out.ToByteSlice()
+	}
+
+	return append([]byte{replicaFormatVersion, byte(eccOverheadPercent)}, payload...), nil
+}
+
+// decodeReplica returns the blob contents stored in the replica, repairing it using error correction if possible.
+func decodeReplica(b []byte) ([]byte, error) {
+	if len(b) < replicaHeaderSize || b[0] != replicaFormatVersion {
+		return nil, errors.New("invalid replica header")
+	}
+
+	payload := b[replicaHeaderSize:]
+
+	if eccOverheadPercent := int(b[1]); eccOverheadPercent > 0 {
+		e, err := replicaECC(eccOverheadPercent)
+		if err != nil {
+			return nil, err
+		}
+
+		var out gather.WriteBuffer
+		defer out.Close()
+
+		if err := e.Decrypt(gather.FromSlice(payload), nil, &out); err != nil {
+			return nil, errors.Wrap(err, "unable to correct errors")
+		}
+
+		payload = out.ToByteSlice()
+	}
+
+	data, ok := verifyFormatBlobChecksum(payload)
+	if !ok {
+		return nil, errors.New("replica checksum mismatch")
+	}
+
+	return data, nil
+}
+
+func replicaECC(overheadPercent int) (encryption.Encryptor, error) {
+	e, err := ecc.CreateAlgorithm(&ecc.Options{
+		Algorithm:       ecc.AlgorithmReedSolomonWithCrc32,
+		OverheadPercent: overheadPercent,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create ECC")
+	}
+
+	return e, nil
+}
+
+// writeReplicas writes replicas of the provided format blob contents and removes replicas
+// that are no longer needed.
+func writeReplicas(ctx context.Context, st blob.Storage, id blob.ID, data []byte, opt *ReplicaOptions, putOpts blob.PutOptions) error {
+	var count, eccOverheadPercent int
+
+	if opt != nil {
+		count, eccOverheadPercent = opt.Count, opt.ECCOverheadPercent
+	}
+
+	if count > 0 {
+		r, err := encodeReplica(data, eccOverheadPercent)
+		if err != nil {
+			return err
+		}
+
+		for n := 1; n <= count; n++ {
+			if err := st.PutBlob(ctx, ReplicaBlobID(id, n), gather.FromSlice(r), putOpts); err != nil {
+				return errors.Wrapf(err, "unable to write replica %v of %q", n, id)
+			}
+		}
+	}
+
+	existing, err := listReplicas(ctx, st, id)
+	if err != nil {
+		return err
+	}
+
+	for _, rid := range existing {
+		if n, _ := strconv.Atoi(strings.TrimPrefix(string(rid), string(id)+replicaBlobIDInfix)); n >= 1 && n <= count {
+			continue
+		}
+
+		if err := st.DeleteBlob(ctx, rid); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+			return errors.Wrapf(err, "unable to delete replica %q", rid)
+		}
+	}
+
+	return nil
+}
+
+// listReplicas returns the sorted identifiers of all replicas of the provided blob.
+func listReplicas(ctx context.Context, st blob.Storage, id blob.ID) ([]blob.ID, error) {
+	var result []blob.ID
+
+	if err := st.ListBlobs(ctx, id+replicaBlobIDInfix, func(bm blob.Metadata) error {
+		result = append(result, bm.BlobID)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "unable to list replicas of %q", id)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+
+	return result, nil
+}
+
+// readReplica returns the contents of the first replica of the provided blob accepted by the provided function.
+func readReplica(ctx context.Context, st blob.Storage, id blob.ID, accept func(data []byte) error) (blob.ID, []byte, error) {
+	ids, err := listReplicas(ctx, st, id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	for _, rid := range ids {
+		if err := st.GetBlob(ctx, rid, 0, -1, &tmp); err != nil {
+			log(ctx).Debugf("unable to read replica %v: %v", rid, err)
+			continue
+		}
+
+		data, err := decodeReplica(tmp.ToByteSlice())
+		if err != nil {
+			log(ctx).Warnf("format blob replica %v is damaged: %v", rid, err)
+			continue
+		}
+
+		if err := accept(data); err != nil {
+			log(ctx).Debugf("replica %v not accepted: %v", rid, err)
+			continue
+		}
+
+		return rid, data, nil
+	}
+
+	return "", nil, errors.Errorf("no usable replica of %q found", id)
+}
+
+// GetReplicaOptions returns the options of redundant copies of format blobs.
+func (m *Manager) GetReplicaOptions(ctx context.Context) (ReplicaOptions, error) {
+	if err := m.maybeRefreshNotLocked(ctx); err != nil {
+		return ReplicaOptions{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.j.Replicas == nil {
+		return ReplicaOptions{}, nil
+	}
+
+	return *m.j.Replicas, nil
+}
+
+// SetReplicaOptions changes the options of redundant copies of format blobs and rewrites
+// `kopia.repository` and `kopia.blobcfg` blobs along with their replicas.
+func (m *Manager) SetReplicaOptions(ctx context.Context, opt ReplicaOptions) error {
+	if err := opt.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldReplicas := m.j.Replicas
+
+	m.j.Replicas = &opt
+	if opt.Count == 0 {
+		m.j.Replicas = nil
+	}
+
+	if err := m.writeFormatWithKeyLocked(ctx, m.formatEncryptionKey); err != nil {
+		m.j.Replicas = oldReplicas
+		return err
+	}
+
+	return nil
+}
+
+// FormatRecoveryResult describes the outcome of RecoverFormatBlobs.
+type FormatRecoveryResult struct {
+	// Source describes the copy of the format blob that has been used.
+	Source string `json:"source"`
+
+	// Repaired contains the identifiers of blobs that were missing or damaged.
+	Repaired []blob.ID `json:"repaired"`
+}
+
+type formatBlobCopy struct {
+	source string
+	data   []byte
+}
+
+// RecoverFormatBlobs rebuilds `kopia.repository` and `kopia.blobcfg` blobs and their replicas using the first
+// copy that can be opened with the provided password. The primary blob is used if it can be parsed, otherwise
+// the replicas and the copies cached by a client in the provided cache directory are tried.
+// When dryRun is true, no blobs are written.
+func RecoverFormatBlobs(ctx context.Context, st blob.Storage, password, cacheDirectory string, dryRun bool) (*FormatRecoveryResult, error) {
+	formatCopies, err := collectFormatBlobCopies(ctx, st, KopiaRepositoryBlobID, cacheDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		chosen              *formatBlobCopy
+		j                   *KopiaRepositoryJSON
+		formatEncryptionKey []byte
+		anyParsed           bool
+		tried               [][]byte
+	)
+
+	for i := range formatCopies {
+		c := &formatCopies[i]
+
+		if slices.ContainsFunc(tried, func(b []byte) bool { return bytes.Equal(b, c.data) }) {
+			continue
+		}
+
+		tried = append(tried, c.data)
+
+		cj, err := ParseKopiaRepositoryJSON(c.data)
+		if err != nil {
+			log(ctx).Warnf("unable to parse format blob from %v: %v", c.source, err)
+			continue
+		}
+
+		anyParsed = true
+
+		key, err := cj.DeriveFormatEncryptionKeyFromPassword(password)
+		if err == nil {
+			_, err = cj.decryptRepositoryConfig(key)
+		}
+
+		if err != nil {
+			if i == 0 && c.source == string(KopiaRepositoryBlobID) {
+				// older copies must never replace a format blob which can be parsed, they may have
+				// key slots or passwords which have since been removed.
+				return nil, ErrInvalidPassword
+			}
+
+			continue
+		}
+
+		chosen, j, formatEncryptionKey = c, cj, key
+
+		break
+	}
+
+	switch {
+	case chosen != nil:
+	case anyParsed:
+		return nil, ErrInvalidPassword
+	default:
+		return nil, errors.New("no usable copy of the format blob found")
+	}
+
+	blobCfgCopies, err := collectFormatBlobCopies(ctx, st, KopiaBlobCfgBlobID, cacheDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		blobCfg      BlobStorageConfiguration
+		blobCfgBytes []byte
+	)
+
+	for _, c := range blobCfgCopies {
+		if bc, err := deserializeBlobCfgBytes(j, c.data, formatEncryptionKey); err == nil {
+			blobCfg, blobCfgBytes = bc, c.data
+			break
+		}
+	}
+
+	if blobCfgBytes == nil {
+		if len(blobCfgCopies) > 0 {
+			return nil, errors.New("no usable copy of the blobcfg blob found")
+		}
+
+		if blobCfgBytes, err = serializeBlobCfgBytes(j, blobCfg, formatEncryptionKey); err != nil {
+			return nil, errors.Wrap(err, "unable to serialize blobcfg blob")
+		}
+	}
+
+	result := &FormatRecoveryResult{Source: chosen.source}
+	putOpts := blob.PutOptions{
+		RetentionMode:   blobCfg.RetentionMode,
+		RetentionPeriod: blobCfg.RetentionPeriod,
+	}
+
+	// write blobcfg first, same as when initializing the repository.
+	for _, b := range []struct {
+		id   blob.ID
+		data []byte
+	}{
+		{KopiaBlobCfgBlobID, blobCfgBytes},
+		{KopiaRepositoryBlobID, chosen.data},
+	} {
+		repaired, err := repairFormatBlob(ctx, st, b.id, b.data, j.Replicas, putOpts, dryRun)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Repaired = append(result.Repaired, repaired...)
+	}
+
+	return result, nil
+}
+
+// collectFormatBlobCopies returns all available copies of the provided format blob, in the order of preference.
+func collectFormatBlobCopies(ctx context.Context, st blob.Storage, id blob.ID, cacheDirectory string) ([]formatBlobCopy, error) {
+	var (
+		result []formatBlobCopy
+		tmp    gather.WriteBuffer
+	)
+
+	defer tmp.Close()
+
+	switch err := st.GetBlob(ctx, id, 0, -1, &tmp); {
+	case err == nil:
+		result = append(result, formatBlobCopy{string(id), tmp.ToByteSlice()})
+	case errors.Is(err, blob.ErrBlobNotFound):
+		log(ctx).Warnf("%v not found", id)
+	default:
+		return nil, errors.Wrapf(err, "unable to read %q", id)
+	}
+
+	ids, err := listReplicas(ctx, st, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rid := range ids {
+		if err := st.GetBlob(ctx, rid, 0, -1, &tmp); err != nil {
+			log(ctx).Warnf("unable to read replica %v: %v", rid, err)
+			continue
+		}
+
+		data, err := decodeReplica(tmp.ToByteSlice())
+		if err != nil {
+			log(ctx).Warnf("format blob replica %v is damaged: %v", rid, err)
+			continue
+		}
+
+		result = append(result, formatBlobCopy{string(rid), data})
+	}
+
+	if cacheDirectory != "" {
+		if data, _, ok := NewDiskCache(cacheDirectory).Get(ctx, id); ok {
+			result = append(result, formatBlobCopy{"cached copy of " + string(id), data})
+		}
+	}
+
+	return result, nil
+}
+
+// repairFormatBlob writes the provided blob and its replicas, unless they already have the expected contents.
+func repairFormatBlob(ctx context.Context, st blob.Storage, id blob.ID, data []byte, opt *ReplicaOptions, putOpts blob.PutOptions, dryRun bool) ([]blob.ID, error) {
+	expected := map[blob.ID][]byte{id: data}
+
+	if opt != nil && opt.Count > 0 {
+		r, err := encodeReplica(data, opt.ECCOverheadPercent)
+		if err != nil {
+			return nil, err
+		}
+
+		for n := 1; n <= opt.Count; n++ {
+			expected[ReplicaBlobID(id, n)] = r
+		}
+	}
+
+	var (
+		repaired []blob.ID
+		tmp      gather.WriteBuffer
+	)
+
+	defer tmp.Close()
+
+	for bid, want := range expected {
+		if err := st.GetBlob(ctx, bid, 0, -1, &tmp); err == nil && bytes.Equal(tmp.ToByteSlice(), want) {
+			continue
+		}
+
+		repaired = append(repaired, bid)
+
+		if dryRun {
+			continue
+		}
+
+		if err := st.PutBlob(ctx, bid, gather.FromSlice(want), putOpts); err != nil {
+			return nil, errors.Wrapf(err, "unable to write %q", bid)
+		}
+	}
+
+	sort.Slice(repaired, func(i, j int) bool {
+		return repaired[i] < repaired[j]
+	})
+
+	return repaired, nil
+}
@@ -0,0 +1,153 @@
+package format_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/format"
+)
+
+func TestFormatBlobReplicas(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	ta := faketime.NewTimeAdvance(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	nowFunc := ta.NowFunc()
+
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	require.Error(t, format.Initialize(ctx, st, &format.KopiaRepositoryJSON{
+		Replicas: &format.ReplicaOptions{Count: format.MaxReplicas + 1},
+	}, rc, format.BlobStorageConfiguration{}, "some-password"))
+
+	require.NoError(t, format.Initialize(ctx, st, &format.KopiaRepositoryJSON{
+		Replicas: &format.ReplicaOptions{Count: 2, ECCOverheadPercent: 50},
+	}, rc, format.BlobStorageConfiguration{}, "some-password"))
+
+	for _, id := range []blob.ID{format.KopiaRepositoryBlobID, format.KopiaBlobCfgBlobID} {
+		require.Contains(t, data, format.ReplicaBlobID(id, 1))
+		require.Contains(t, data, format.ReplicaBlobID(id, 2))
+	}
+
+	openManager := func(password string) (*format.Manager, error) {
+		return format.NewManagerWithCache(ctx, st, cacheDuration, password, nowFunc, format.NewMemoryBlobCache(nowFunc))
+	}
+
+	original := data[format.KopiaRepositoryBlobID]
+	originalBlobCfg := data[format.KopiaBlobCfgBlobID]
+
+	// corrupt the format blob, one of the replicas and damage the other one in a way that can be corrected.
+	data[format.KopiaRepositoryBlobID] = original[0 : len(original)/2]
+	delete(data, format.ReplicaBlobID(format.KopiaRepositoryBlobID, 1))
+	data[format.ReplicaBlobID(format.KopiaRepositoryBlobID, 2)][10] ^= 0xff
+	delete(data, format.KopiaBlobCfgBlobID)
+
+	mgr, err := openManager("some-password")
+	require.NoError(t, err)
+
+	_, err = mgr.BlobCfgBlob(ctx)
+	require.NoError(t, err)
+
+	_, err = openManager("wrong-password")
+	require.ErrorIs(t, err, format.ErrInvalidPassword)
+
+	_, err = format.RecoverFormatBlobs(ctx, st, "wrong-password", "", false)
+	require.ErrorIs(t, err, format.ErrInvalidPassword)
+
+	res, err := format.RecoverFormatBlobs(ctx, st, "some-password", "", true)
+	require.NoError(t, err)
+	require.Equal(t, "kopia.repository.replica.2", res.Source)
+	require.Equal(t, []blob.ID{
+		format.KopiaBlobCfgBlobID,
+		format.KopiaRepositoryBlobID,
+		format.ReplicaBlobID(format.KopiaRepositoryBlobID, 1),
+		format.ReplicaBlobID(format.KopiaRepositoryBlobID, 2),
+	}, res.Repaired)
+	require.NotContains(t, data, format.KopiaBlobCfgBlobID, "dry run must not write blobs")
+
+	res, err = format.RecoverFormatBlobs(ctx, st, "some-password", "", false)
+	require.NoError(t, err)
+	require.Len(t, res.Repaired, 4)
+	require.Equal(t, original, data[format.KopiaRepositoryBlobID])
+	require.Equal(t, originalBlobCfg, data[format.KopiaBlobCfgBlobID])
+
+	res, err = format.RecoverFormatBlobs(ctx, st, "some-password", "", false)
+	require.NoError(t, err)
+	require.Equal(t, string(format.KopiaRepositoryBlobID), res.Source)
+	require.Empty(t, res.Repaired)
+
+	// reducing the number of replicas removes the ones no longer needed.
+	require.NoError(t, mgr.SetReplicaOptions(ctx, format.ReplicaOptions{Count: 1}))
+	require.Contains(t, data, format.ReplicaBlobID(format.KopiaRepositoryBlobID, 1))
+	require.NotContains(t, data, format.ReplicaBlobID(format.KopiaRepositoryBlobID, 2))
+	require.NotContains(t, data, format.ReplicaBlobID(format.KopiaBlobCfgBlobID, 2))
+
+	opt, err := mgr.GetReplicaOptions(ctx)
+	require.NoError(t, err)
+	require.Equal(t, format.ReplicaOptions{Count: 1}, opt)
+
+	// without error correction, damaged replicas are rejected.
+	delete(data, format.KopiaRepositoryBlobID)
+	data[format.ReplicaBlobID(format.KopiaRepositoryBlobID, 1)][10] ^= 0xff
+
+	_, err = openManager("some-password")
+	require.ErrorIs(t, err, blob.ErrBlobNotFound)
+
+	_, err = format.RecoverFormatBlobs(ctx, st, "some-password", "", false)
+	require.ErrorContains(t, err, "no usable copy")
+}
+
+func TestFormatBlobReplicas_StaleReplicaAfterPasswordChange(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	ta := faketime.NewTimeAdvance(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	nowFunc := ta.NowFunc()
+
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	prc := *rc
+	prc.EnablePasswordChange = true
+
+	require.NoError(t, format.Initialize(ctx, st, &format.KopiaRepositoryJSON{
+		Replicas: &format.ReplicaOptions{Count: 1},
+	}, &prc, format.BlobStorageConfiguration{}, "old-password"))
+
+	openManager := func(password string) (*format.Manager, error) {
+		return format.NewManagerWithCache(ctx, st, cacheDuration, password, nowFunc, format.NewMemoryBlobCache(nowFunc))
+	}
+
+	staleReplica := data[format.ReplicaBlobID(format.KopiaRepositoryBlobID, 1)]
+
+	mgr, err := openManager("old-password")
+	require.NoError(t, err)
+	require.NoError(t, mgr.ChangePassword(ctx, "new-password"))
+
+	// simulate the replica not being updated after the password change.
+	current := data[format.KopiaRepositoryBlobID]
+	data[format.ReplicaBlobID(format.KopiaRepositoryBlobID, 1)] = staleReplica
+
+	// the old password must not open the repository using the stale replica.
+	_, err = openManager("old-password")
+	require.ErrorIs(t, err, format.ErrInvalidPassword)
+
+	_, err = format.RecoverFormatBlobs(ctx, st, "old-password", "", false)
+	require.ErrorIs(t, err, format.ErrInvalidPassword)
+	require.Equal(t, current, data[format.KopiaRepositoryBlobID])
+
+	_, err = openManager("new-password")
+	require.NoError(t, err)
+
+	// recovery uses the format blob and replaces the stale replica.
+	res, err := format.RecoverFormatBlobs(ctx, st, "new-password", "", false)
+	require.NoError(t, err)
+	require.Equal(t, string(format.KopiaRepositoryBlobID), res.Source)
+	require.Equal(t, []blob.ID{format.ReplicaBlobID(format.KopiaRepositoryBlobID, 1)}, res.Repaired)
+	require.Equal(t, current, data[format.KopiaRepositoryBlobID])
+}
@@ -37,6 +37,18 @@ func BackupBlobID(l UpgradeLockIntent) blob.ID {
 // should cause the unsupporting clients (non-upgrade capable) to fail
 // connecting to the repository.
 func (m *Manager) SetUpgradeLockIntent(ctx context.Context, l UpgradeLockIntent) (*UpgradeLockIntent, error) {
+	return m.setLockIntent(ctx, l, true)
+}
+
+// SetConversionLockIntent sets the upgrade lock intent on the repository format blob
+// in the same way as SetUpgradeLockIntent(), which is used when rewriting the repository
+// using new format parameters. Unlike an upgrade, it succeeds if the repository is already
+// using the latest format version.
+func (m *Manager) SetConversionLockIntent(ctx context.Context, l UpgradeLockIntent) (*UpgradeLockIntent, error) {
+	return m.setLockIntent(ctx, l, false)
+}
+
+func (m *Manager) setLockIntent(ctx context.Context, l UpgradeLockIntent, requireNewerFormatVersion bool) (*UpgradeLockIntent, error) {
 	if err := m.maybeRefreshNotLocked(ctx); err != nil {
 		return nil, err
 	}
@@ -51,7 +63,7 @@ func (m *Manager) SetUpgradeLockIntent(ctx context.Context, l UpgradeLockIntent)
 	if m.repoConfig.UpgradeLock == nil {
 		// when we are putting a new lock then ensure that we can upgrade
 		// to that version
-		if m.repoConfig.ContentFormat.Version >= MaxFormatVersion {
+		if requireNewerFormatVersion && m.repoConfig.ContentFormat.Version >= MaxFormatVersion {
 			return nil, errors.WithMessagef(ErrFormatUptoDate, "repository is using version %d, and version %d is the maximum",
 				m.repoConfig.ContentFormat.Version, MaxFormatVersion)
 		}
@@ -64,8 +76,9 @@ func (m *Manager) SetUpgradeLockIntent(ctx context.Context, l UpgradeLockIntent)
 
 		// set a new lock or revoke an existing lock.
 		m.repoConfig.UpgradeLock = &l
+
 		// mark the upgrade to the new format version, this will ensure that older
-		// clients won't be able to parse the new version
+		// clients, which don't understand the lock, won't be able to parse the new version
 		m.repoConfig.ContentFormat.Version = MaxFormatVersion
 	} else if newL, err := m.repoConfig.UpgradeLock.Update(&l); err == nil {
 		m.repoConfig.UpgradeLock = newL
@@ -136,6 +149,23 @@ func (m *Manager) RollbackUpgrade(ctx context.Context) error {
 		return errors.New("no upgrade in progress")
 	}
 
+	ready, err := m.conversionReadyLocked(ctx)
+	if err != nil {
+		return err
+	}
+
+	if ready {
+		return errors.New("format conversion is being committed and can't be rolled back, run 'kopia repository convert' again to complete it")
+	}
+
+	if _, err := m.blobs.GetMetadata(ctx, conversionFormatBlobID); err == nil {
+		if err := m.DiscardConversion(ctx); err != nil {
+			return errors.Wrap(err, "failed to discard format conversion")
+		}
+	} else if !errors.Is(err, blob.ErrBlobNotFound) {
+		return errors.Wrap(err, "unable to check for format conversion")
+	}
+
 	// restore the oldest backup and delete the rest
 	var oldestBackup *blob.Metadata
 
@@ -174,6 +204,12 @@ func (m *Manager) RollbackUpgrade(ctx context.Context) error {
 			return errors.Wrapf(err, "failed to restore format blob from backup %q", oldestBackup.BlobID)
 		}
 
+		if j, err := ParseKopiaRepositoryJSON(d.ToByteSlice()); err == nil {
+			if err := writeReplicas(ctx, m.blobs, KopiaRepositoryBlobID, d.ToByteSlice(), j.Replicas, blob.PutOptions{}); err != nil {
+				return errors.Wrap(err, "failed to restore format blob replicas")
+			}
+		}
+
 		// delete the backup after we have restored the format-blob
 		if err := m.blobs.DeleteBlob(ctx, oldestBackup.BlobID); err != nil {
 			return errors.Wrapf(err, "failed to delete the format blob backup %q", oldestBackup.BlobID)
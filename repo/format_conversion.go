@@ -0,0 +1,331 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/epoch"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/listjournal"
+	"github.com/kopia/kopia/internal/metrics"
+	"github.com/kopia/kopia/internal/repodiag"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/repo/object"
+)
+
+const formatConversionWriterID = "format-conversion"
+
+// FormatConversionTarget writes contents, objects and manifests of a repository being converted using
+// the staged format. Packs are written next to the existing ones, but indexes are kept separately until
+// the conversion is committed, so the repository remains readable using its current format.
+type FormatConversionTarget struct {
+	cmgr *content.WriteManager
+	omgr *object.Manager
+	mmgr *manifest.Manager
+
+	close func(ctx context.Context) error
+}
+
+// ContentManager returns the content manager using the staged format.
+func (t *FormatConversionTarget) ContentManager() *content.WriteManager {
+	return t.cmgr
+}
+
+// NewObjectWriter creates an object writer using the staged format.
+func (t *FormatConversionTarget) NewObjectWriter(ctx context.Context, opt object.WriterOptions) object.Writer {
+	return t.omgr.NewWriter(ctx, opt)
+}
+
+// Manifests returns the manifest manager using the staged format.
+func (t *FormatConversionTarget) Manifests() *manifest.Manager {
+	return t.mmgr
+}
+
+// Flush persists all pending manifests and contents.
+func (t *FormatConversionTarget) Flush(ctx context.Context) error {
+	if err := t.mmgr.Flush(ctx); err != nil {
+		return errors.Wrap(err, "error flushing manifests")
+	}
+
+	if err := t.cmgr.Flush(ctx); err != nil {
+		return errors.Wrap(err, "error flushing contents")
+	}
+
+	return nil
+}
+
+// Close releases resources associated with the target without flushing it.
+func (t *FormatConversionTarget) Close(ctx context.Context) error {
+	return t.close(ctx)
+}
+
+// OpenFormatConversionTarget opens the target of a format conversion using the provided staged format,
+// which is returned by format.Manager.PrepareConversion().
+func OpenFormatConversionTarget(ctx context.Context, rep DirectRepositoryWriter, prov format.Provider) (*FormatConversionTarget, error) {
+	enabled, err := listjournal.IsEnabled(ctx, rep.BlobStorage())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to determine blob list journal status")
+	}
+
+	if enabled {
+		return nil, errors.New("format conversion is not supported while blob list journal is enabled, disable it first")
+	}
+
+	st := conversionStorage{rep.BlobStorage()}
+	mr := metrics.NewRegistry()
+	dw := repodiag.NewWriter(st, prov)
+
+	scm, err := content.NewSharedManager(ctx, st, prov, nil, &content.ManagerOptions{
+		TimeNow:            rep.Time,
+		DisableInternalLog: true,
+	}, repodiag.NewLogManager(ctx, dw), mr)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create shared content manager")
+	}
+
+	cliOpts := rep.ClientOptions()
+
+	cm := content.NewWriteManager(ctx, scm, content.SessionOptions{
+		SessionUser: cliOpts.Username,
+		SessionHost: cliOpts.Hostname,
+	}, formatConversionWriterID)
+
+	closer := newRefCountedCloser(
+		scm.CloseShared,
+		dw.Wait,
+		mr.Close,
+	)
+
+	om, err := object.NewObjectManager(ctx, cm, rep.ObjectFormat(), mr)
+	if err != nil {
+		closer.Close(ctx) //nolint:errcheck
+		return nil, errors.Wrap(err, "unable to open object manager")
+	}
+
+	mm, err := manifest.NewManager(ctx, cm, manifest.ManagerOptions{TimeNow: rep.Time}, mr)
+	if err != nil {
+		closer.Close(ctx) //nolint:errcheck
+		return nil, errors.Wrap(err, "unable to open manifests")
+	}
+
+	return &FormatConversionTarget{
+		cmgr:  cm,
+		omgr:  om,
+		mmgr:  mm,
+		close: closer.Close,
+	}, nil
+}
+
+// FinishFormatConversion removes packs that are not referenced by the converted repository, except the held ones.
+// It must be called after the conversion has been committed and the repository reopened, while the upgrade lock
+// is still held, so that packs being written by other clients are never deleted.
+func FinishFormatConversion(ctx context.Context, rep DirectRepositoryWriter, held map[blob.ID]time.Time) error {
+	status, err := rep.FormatManager().GetConversionStatus(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to get conversion status")
+	}
+
+	if status != format.ConversionCommitted {
+		return errors.New("format conversion has not been committed")
+	}
+
+	return deleteUnreferencedPacks(ctx, rep, held)
+}
+
+func deleteUnreferencedPacks(ctx context.Context, rep DirectRepositoryWriter, held map[blob.ID]time.Time) error {
+	referenced := map[blob.ID]bool{}
+
+	if err := rep.ContentReader().IterateContents(ctx, content.IterateOptions{IncludeDeleted: true}, func(ci content.Info) error {
+		referenced[ci.PackBlobID] = true
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "unable to iterate contents")
+	}
+
+	var unreferenced []blob.ID
+
+	for _, prefix := range content.PackBlobIDPrefixes {
+		if err := rep.BlobStorage().ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+			if _, ok := held[bm.BlobID]; ok {
+				log(ctx).Debugf("preserving %v because it's on hold", bm.BlobID)
+				return nil
+			}
+
+			if !referenced[bm.BlobID] {
+				unreferenced = append(unreferenced, bm.BlobID)
+			}
+
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "unable to list packs")
+		}
+	}
+
+	log(ctx).Infof("Deleting %v packs written using the previous format.", len(unreferenced))
+
+	for _, id := range unreferenced {
+		if err := rep.BlobStorage().DeleteBlob(ctx, id); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+			return errors.Wrapf(err, "unable to delete pack %v", id)
+		}
+	}
+
+	return nil
+}
+
+// completeFormatConversion replaces the indexes of the repository with the ones written by a conversion that
+// is ready to be committed and switches the repository format. Neither format can read the repository while
+// this is in progress, so it is performed by the owner of the upgrade lock before the indexes are loaded.
+// Returns true if the format has changed.
+func completeFormatConversion(ctx context.Context, fmgr *format.Manager, st blob.Storage, upgradeOwnerID string) (bool, error) {
+	uli, err := fmgr.UpgradeLockIntent(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "upgrade lock intent")
+	}
+
+	if uli == nil || uli.OwnerID != upgradeOwnerID {
+		return false, nil
+	}
+
+	status, err := fmgr.GetConversionStatus(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "unable to get conversion status")
+	}
+
+	if status != format.ConversionReady {
+		return false, nil
+	}
+
+	log(ctx).Info("Switching repository to the converted format.")
+
+	staged := map[blob.ID]bool{}
+
+	if err := (conversionStorage{st}).ListBlobs(ctx, epoch.EpochManagerIndexUberPrefix, func(bm blob.Metadata) error {
+		staged[bm.BlobID] = true
+		return nil
+	}); err != nil {
+		return false, errors.Wrap(err, "unable to list converted indexes")
+	}
+
+	var obsolete []blob.ID
+
+	if err := st.ListBlobs(ctx, epoch.EpochManagerIndexUberPrefix, func(bm blob.Metadata) error {
+		if !staged[bm.BlobID] {
+			obsolete = append(obsolete, bm.BlobID)
+		}
+
+		return nil
+	}); err != nil {
+		return false, errors.Wrap(err, "unable to list indexes")
+	}
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	// converted indexes are copied before old ones are deleted, so that an interrupted switch
+	// never leaves the repository without indexes, it is simply repeated when reopened.
+	for id := range staged {
+		if err := st.GetBlob(ctx, conversionBlobID(id), 0, -1, &tmp); err != nil {
+			return false, errors.Wrapf(err, "unable to read converted index %v", id)
+		}
+
+		if err := st.PutBlob(ctx, id, tmp.Bytes(), blob.PutOptions{}); err != nil {
+			return false, errors.Wrapf(err, "unable to write index %v", id)
+		}
+	}
+
+	for _, id := range obsolete {
+		if err := st.DeleteBlob(ctx, id); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+			return false, errors.Wrapf(err, "unable to delete index %v", id)
+		}
+	}
+
+	if err := fmgr.CommitConversion(ctx); err != nil {
+		return false, errors.Wrap(err, "unable to commit format conversion")
+	}
+
+	return true, nil
+}
+
+// conversionStorage redirects index blobs to the conversion prefix, leaving all other blobs in place.
+type conversionStorage struct {
+	blob.Storage
+}
+
+func isConversionIndexBlob(id blob.ID) bool {
+	return strings.HasPrefix(string(id), epoch.EpochManagerIndexUberPrefix)
+}
+
+func conversionBlobID(id blob.ID) blob.ID {
+	if isConversionIndexBlob(id) {
+		return format.ConversionBlobIDPrefix + id
+	}
+
+	return id
+}
+
+func (s conversionStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	//nolint:wrapcheck
+	return s.Storage.GetBlob(ctx, conversionBlobID(id), offset, length, output)
+}
+
+func (s conversionStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	bm, err := s.Storage.GetMetadata(ctx, conversionBlobID(id))
+	bm.BlobID = id
+
+	//nolint:wrapcheck
+	return bm, err
+}
+
+func (s conversionStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	//nolint:wrapcheck
+	return s.Storage.PutBlob(ctx, conversionBlobID(id), data, opts)
+}
+
+func (s conversionStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	//nolint:wrapcheck
+	return s.Storage.DeleteBlob(ctx, conversionBlobID(id))
+}
+
+func (s conversionStorage) ExtendBlobRetention(ctx context.Context, id blob.ID, opts blob.ExtendOptions) error {
+	//nolint:wrapcheck
+	return s.Storage.ExtendBlobRetention(ctx, conversionBlobID(id), opts)
+}
+
+func (s conversionStorage) ListBlobs(ctx context.Context, prefix blob.ID, cb func(bm blob.Metadata) error) error {
+	if isConversionIndexBlob(prefix) {
+		//nolint:wrapcheck
+		return s.Storage.ListBlobs(ctx, conversionBlobID(prefix), func(bm blob.Metadata) error {
+			bm.BlobID = bm.BlobID[len(format.ConversionBlobIDPrefix):]
+			return cb(bm)
+		})
+	}
+
+	//nolint:wrapcheck
+	return s.Storage.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+		if isConversionIndexBlob(bm.BlobID) {
+			return nil
+		}
+
+		// staged indexes are only returned under their original names.
+		if id := blob.ID(strings.TrimPrefix(string(bm.BlobID), format.ConversionBlobIDPrefix)); id != bm.BlobID && isConversionIndexBlob(id) {
+			if !strings.HasPrefix(string(id), string(prefix)) {
+				return nil
+			}
+
+			bm.BlobID = id
+		}
+
+		return cb(bm)
+	})
+}
+
+// Close does not close the underlying storage, which is owned by the repository being converted.
+func (s conversionStorage) Close(ctx context.Context) error {
+	return nil
+}
@@ -9,6 +9,7 @@
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/feature"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/ecc"
@@ -35,13 +36,14 @@
 // NewRepositoryOptions specifies options that apply to newly created repositories.
 // All fields are optional, when not provided, reasonable defaults will be used.
 type NewRepositoryOptions struct {
-	UniqueID                          []byte               `json:"uniqueID"` // force the use of particular unique ID
-	BlockFormat                       format.ContentFormat `json:"blockFormat"`
-	DisableHMAC                       bool                 `json:"disableHMAC"`
-	ObjectFormat                      format.ObjectFormat  `json:"objectFormat"` // object format
-	RetentionMode                     blob.RetentionMode   `json:"retentionMode,omitempty"`
-	RetentionPeriod                   time.Duration        `json:"retentionPeriod,omitempty"`
-	FormatBlockKeyDerivationAlgorithm string               `json:"formatBlockKeyDerivationAlgorithm,omitempty"`
+	UniqueID                          []byte                `json:"uniqueID"` // force the use of particular unique ID
+	BlockFormat                       format.ContentFormat  `json:"blockFormat"`
+	DisableHMAC                       bool                  `json:"disableHMAC"`
+	ObjectFormat                      format.ObjectFormat   `json:"objectFormat"` // object format
+	RetentionMode                     blob.RetentionMode    `json:"retentionMode,omitempty"`
+	RetentionPeriod                   time.Duration         `json:"retentionPeriod,omitempty"`
+	FormatBlockKeyDerivationAlgorithm string                `json:"formatBlockKeyDerivationAlgorithm,omitempty"`
+	FormatReplicas                    format.ReplicaOptions `json:"formatReplicas"`
 }
 
 // Initialize creates initial repository data structures in the specified storage with given credentials.
@@ -63,7 +65,7 @@ func Initialize(ctx context.Context, st blob.Storage, opt *NewRepositoryOptions,
 }
 
 func formatBlobFromOptions(opt *NewRepositoryOptions) *format.KopiaRepositoryJSON {
-	return &format.KopiaRepositoryJSON{
+	f := &format.KopiaRepositoryJSON{
 		Tool:                   "https://github.com/kopia/kopia",
 		BuildInfo:              BuildInfo,
 		BuildVersion:           BuildVersion,
@@ -71,6 +73,13 @@ func formatBlobFromOptions(opt *NewRepositoryOptions) *format.KopiaRepositoryJSO
 		UniqueID:               applyDefaultRandomBytes(opt.UniqueID, format.UniqueIDLengthBytes),
 		EncryptionAlgorithm:    format.DefaultFormatEncryption,
 	}
+
+	if opt.FormatReplicas.Count > 0 {
+		replicas := opt.FormatReplicas
+		f.Replicas = &replicas
+	}
+
+	return f
 }
 
 func blobCfgBlobFromOptions(opt *NewRepositoryOptions) format.BlobStorageConfiguration {
@@ -110,6 +119,7 @@ func repositoryObjectFormatFromOptions(opt *NewRepositoryOptions) (*format.Repos
 				EpochParameters: opt.BlockFormat.EpochParameters,
 			},
 			EnablePasswordChange: opt.BlockFormat.EnablePasswordChange,
+			PublicKey:            opt.BlockFormat.PublicKey,
 		},
 		ObjectFormat: format.ObjectFormat{
 			Splitter: applyDefaultString(opt.ObjectFormat.Splitter, splitter.DefaultAlgorithm),
@@ -120,6 +130,15 @@ func repositoryObjectFormatFromOptions(opt *NewRepositoryOptions) (*format.Repos
 		f.HMACSecret = nil
 	}
 
+	if len(f.PublicKey) > 0 {
+		f.RequiredFeatures = append(f.RequiredFeatures, feature.Required{
+			Feature: format.AsymmetricEncryptionFeature,
+			IfNotUnderstood: feature.IfNotUnderstood{
+				Message: "The repository seals contents to a public key.",
+			},
+		})
+	}
+
 	if fv == format.FormatVersion1 || f.ContentFormat.ECCOverheadPercent == 0 {
 		f.ContentFormat.ECC = ""
 		f.ContentFormat.ECCOverheadPercent = 0
@@ -13,6 +13,7 @@
 	"github.com/kopia/kopia/internal/atomicfile"
 	"github.com/kopia/kopia/internal/ospath"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/quota"
 	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/format"
@@ -39,6 +40,24 @@ type ClientOptions struct {
 	FormatBlobCacheDuration time.Duration `json:"formatBlobCacheDuration,omitempty"`
 
 	Throttling *throttling.Limits `json:"throttlingLimits,omitempty"`
+
+	// StorageQuota limits total size of blobs this client will write to the storage.
+	StorageQuota *quota.Limits `json:"storageQuota,omitempty"`
+
+	// FaultProfileFile is the path to JSON file describing faults to inject into storage operations, for disaster drills.
+	FaultProfileFile string `json:"faultProfileFile,omitempty"`
+
+	// WriteOnly indicates that the client does not hold the private key of a repository using asymmetric
+	// encryption and can add new snapshots, but can't read contents of existing ones. The client still
+	// knows the symmetric keys protecting indexes and refusing to run maintenance is enforced locally,
+	// see format.AsymmetricEncryptionFeature.
+	WriteOnly bool `json:"writeOnly,omitempty"`
+
+	// PrivateKeyFile is the path to the file containing the private key of a repository using asymmetric encryption.
+	PrivateKeyFile string `json:"privateKeyFile,omitempty"`
+
+	// SnapshotSigningKeyFile is the path to the file containing the key used to sign snapshot manifests created by this client.
+	SnapshotSigningKeyFile string `json:"snapshotSigningKeyFile,omitempty"`
 }
 
 // ApplyDefaults returns a copy of ClientOptions with defaults filled out.
@@ -73,6 +73,11 @@ func DeleteUnreferencedBlobs(ctx context.Context, rep repo.DirectRepositoryWrite
 		return 0, errors.Wrap(err, "unable to load active sessions")
 	}
 
+	held, err := HeldBlobs(ctx, rep)
+	if err != nil {
+		return 0, err
+	}
+
 	cutoffTime := opt.NotAfterTime
 	if cutoffTime.IsZero() {
 		cutoffTime = rep.Time()
@@ -98,6 +103,11 @@ func DeleteUnreferencedBlobs(ctx context.Context, rep repo.DirectRepositoryWrite
 			return nil
 		}
 
+		if _, ok := held[bm.BlobID]; ok {
+			log(ctx).Debugf("  preserving %v because it's on hold", bm.BlobID)
+			return nil
+		}
+
 		sid := content.SessionIDFromBlobID(bm.BlobID)
 		if s, ok := activeSessions[sid]; ok {
 			if age := cutoffTime.Sub(s.CheckpointTime); age < safety.SessionExpirationAge {
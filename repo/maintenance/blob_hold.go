@@ -0,0 +1,64 @@
+package maintenance
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// BlobHoldManifestType is the type of manifests placing blobs on hold.
+const BlobHoldManifestType = "blob-hold"
+
+// BlobHold is stored in manifests of type BlobHoldManifestType. Maintenance never rewrites contents
+// stored in blobs on hold, nor deletes such blobs.
+type BlobHold struct {
+	Blobs []blob.ID `json:"blobs"`
+
+	// RetainUntil is the time until which the provider retention of the blobs has been extended,
+	// zero if the blobs are under legal hold instead.
+	RetainUntil time.Time `json:"retainUntil,omitempty"`
+}
+
+// HeldBlobs returns the set of blobs on hold, mapped to the latest time until which their retention
+// has been extended.
+func HeldBlobs(ctx context.Context, rep repo.Repository) (map[blob.ID]time.Time, error) {
+	entries, err := rep.FindManifests(ctx, map[string]string{"type": BlobHoldManifestType})
+	if err != nil {
+		return nil, errors.Wrap(err, "error looking for blob holds")
+	}
+
+	result := map[blob.ID]time.Time{}
+
+	for _, e := range entries {
+		var h BlobHold
+
+		if _, err := rep.GetManifest(ctx, e.ID, &h); err != nil {
+			return nil, errors.Wrapf(err, "error loading blob hold %v", e.ID)
+		}
+
+		for _, id := range h.Blobs {
+			if t, ok := result[id]; !ok || h.RetainUntil.After(t) {
+				result[id] = h.RetainUntil
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// isHeldFunc returns a function which determines whether the blob is on hold.
+func isHeldFunc(ctx context.Context, rep repo.Repository) (func(id blob.ID) bool, error) {
+	held, err := HeldBlobs(ctx, rep)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(id blob.ID) bool {
+		_, ok := held[id]
+		return ok
+	}, nil
+}
@@ -0,0 +1,332 @@
+package maintenance
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kopia/kopia/internal/blobcrypto"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/ecc"
+)
+
+const defaultRepairBlobsParallel = 8
+
+// ErrNoErrorCorrection is returned when repairing blobs in a repository which does not use error correction.
+var ErrNoErrorCorrection = errors.New("repository does not use error correction")
+
+// RepairBlobsOptions provides options for repairing damaged blobs.
+type RepairBlobsOptions struct {
+	Parallel int
+	DryRun   bool
+}
+
+// RepairBlobsStats contains the results of repairing damaged blobs.
+type RepairBlobsStats struct {
+	ScannedBlobs  int   `json:"scannedBlobs"`
+	ScannedBytes  int64 `json:"scannedBytes"`
+	DamagedShards int   `json:"damagedShards"`
+
+	// blobs whose damage has been repaired (or would be repaired in a dry run).
+	RepairedBlobs []blob.ID `json:"repairedBlobs"`
+
+	// number of contents rewritten from repaired pack blobs.
+	RewrittenContents int `json:"rewrittenContents"`
+
+	// blobs whose damage can't be repaired by error correction.
+	UnrecoverableBlobs []blob.ID `json:"unrecoverableBlobs"`
+}
+
+type repairBlobsState struct {
+	mu    sync.Mutex
+	stats RepairBlobsStats
+}
+
+func (s *repairBlobsState) scanned(length int64, damagedShards int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.ScannedBlobs++
+	s.stats.ScannedBytes += length
+	s.stats.DamagedShards += damagedShards
+}
+
+func (s *repairBlobsState) repaired(id blob.ID, rewrittenContents int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.RepairedBlobs = append(s.stats.RepairedBlobs, id)
+	s.stats.RewrittenContents += rewrittenContents
+}
+
+func (s *repairBlobsState) unrecoverable(id blob.ID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.UnrecoverableBlobs = append(s.stats.UnrecoverableBlobs, id)
+}
+
+// RepairBlobs scans pack and index blobs for shards damaged since they were written and corrects them using
+// the error correction of the repository, before they accumulate enough damage to become unrecoverable.
+// Damaged contents of pack blobs are rewritten to new packs, leaving the damaged packs to be deleted by
+// maintenance once they are no longer used, while index blobs are rewritten in place.
+func RepairBlobs(ctx context.Context, rep repo.DirectRepositoryWriter, opt RepairBlobsOptions) (*RepairBlobsStats, error) {
+	repairer, ok := rep.ContentReader().ContentFormat().Encryptor().(ecc.Repairer)
+	if !ok {
+		return nil, ErrNoErrorCorrection
+	}
+
+	if opt.Parallel == 0 {
+		opt.Parallel = defaultRepairBlobsParallel
+	}
+
+	var packs []content.PackInfo
+
+	if err := rep.ContentManager().IteratePacks(ctx, content.IteratePackOptions{
+		IncludePacksWithOnlyDeletedContent: true,
+		IncludeContentInfos:                true,
+	}, func(pi content.PackInfo) error {
+		packs = append(packs, pi)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error listing packs")
+	}
+
+	indexBlobs, err := rep.IndexBlobs(ctx, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing index blobs")
+	}
+
+	log(ctx).Infof("Scanning %v pack blobs and %v index blobs for damage...", len(packs), len(indexBlobs))
+
+	state := &repairBlobsState{}
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	work := make(chan func() error)
+
+	for range opt.Parallel {
+		eg.Go(func() error {
+			for w := range work {
+				if err := w(); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	}
+
+	eg.Go(func() error {
+		defer close(work)
+
+		for _, pi := range packs {
+			select {
+			case work <- func() error { return repairPack(egCtx, rep, repairer, pi, opt, state) }:
+			case <-egCtx.Done():
+				return nil
+			}
+		}
+
+		for _, ib := range indexBlobs {
+			select {
+			case work <- func() error { return repairIndexBlob(egCtx, rep, repairer, ib.BlobID, opt, state) }:
+			case <-egCtx.Done():
+				return nil
+			}
+		}
+
+		return nil
+	})
+
+	if err := eg.Wait(); err != nil {
+		return nil, errors.Wrap(err, "error repairing blobs")
+	}
+
+	if !opt.DryRun && state.stats.RewrittenContents > 0 {
+		if err := rep.ContentManager().Flush(ctx); err != nil {
+			return nil, errors.Wrap(err, "error flushing rewritten contents")
+		}
+	}
+
+	stats := state.stats
+
+	sortBlobIDs(stats.RepairedBlobs)
+	sortBlobIDs(stats.UnrecoverableBlobs)
+
+	log(ctx).Infof("Scanned %v blobs (%v), found %v damaged shards, repaired %v blobs, %v blobs are unrecoverable.",
+		stats.ScannedBlobs, units.BytesString(stats.ScannedBytes), stats.DamagedShards, len(stats.RepairedBlobs), len(stats.UnrecoverableBlobs))
+
+	return &stats, nil
+}
+
+// getBlobForRepair reads the entire blob using explicit range, which skips verification of checksums recorded by
+// the storage provider, so that damage is detected and corrected by error correction instead of failing the read.
+func getBlobForRepair(ctx context.Context, rep repo.DirectRepositoryWriter, blobID blob.ID, output *gather.WriteBuffer) error {
+	bm, err := rep.BlobReader().GetMetadata(ctx, blobID)
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	//nolint:wrapcheck
+	return rep.BlobReader().GetBlob(ctx, blobID, 0, bm.Length, output)
+}
+
+// repairPack checks the error correction of each content in the pack and rewrites damaged contents, which are
+// corrected when they are read.
+func repairPack(ctx context.Context, rep repo.DirectRepositoryWriter, repairer ecc.Repairer, pi content.PackInfo, opt RepairBlobsOptions, state *repairBlobsState) error {
+	var data, tmp gather.WriteBuffer
+	defer data.Close()
+	defer tmp.Close()
+
+	if err := getBlobForRepair(ctx, rep, pi.PackID, &data); err != nil {
+		if errors.Is(err, blob.ErrBlobNotFound) {
+			log(ctx).Errorf("Pack %v is missing.", pi.PackID)
+			state.unrecoverable(pi.PackID)
+
+			return nil
+		}
+
+		return errors.Wrapf(err, "unable to read pack %v", pi.PackID)
+	}
+
+	b := data.ToByteSlice()
+
+	var (
+		damagedContents []content.ID
+		damagedShards   int
+		unrecoverable   bool
+	)
+
+	for _, ci := range pi.ContentInfos {
+		end := int64(ci.PackOffset) + int64(ci.PackedLength)
+		if end > int64(len(b)) {
+			log(ctx).Errorf("Content %v is past the end of pack %v.", ci.ContentID, pi.PackID)
+
+			unrecoverable = true
+
+			continue
+		}
+
+		tmp.Reset()
+
+		n, err := repairer.Repair(gather.FromSlice(b[ci.PackOffset:end]), &tmp)
+		damagedShards += n
+
+		if err != nil {
+			log(ctx).Errorf("Content %v in pack %v is unrecoverable: %v", ci.ContentID, pi.PackID, err)
+
+			unrecoverable = true
+
+			continue
+		}
+
+		if n > 0 {
+			damagedContents = append(damagedContents, ci.ContentID)
+		}
+	}
+
+	state.scanned(int64(len(b)), damagedShards)
+
+	if unrecoverable {
+		state.unrecoverable(pi.PackID)
+	}
+
+	if len(damagedContents) == 0 {
+		return nil
+	}
+
+	log(ctx).Infof("Repairing %v damaged contents of pack %v.", len(damagedContents), pi.PackID)
+
+	if opt.DryRun {
+		if !unrecoverable {
+			state.repaired(pi.PackID, 0)
+		}
+
+		return nil
+	}
+
+	for _, cid := range damagedContents {
+		if err := rep.ContentManager().RewriteContent(ctx, cid); err != nil {
+			log(ctx).Errorf("Unable to rewrite damaged content %v from pack %v: %v", cid, pi.PackID, err)
+
+			if !unrecoverable {
+				unrecoverable = true
+
+				state.unrecoverable(pi.PackID)
+			}
+		}
+	}
+
+	if !unrecoverable {
+		state.repaired(pi.PackID, len(damagedContents))
+	}
+
+	return nil
+}
+
+// repairIndexBlob checks the error correction of the index blob and rewrites it in place with damaged shards
+// corrected, which produces the original contents of the blob.
+func repairIndexBlob(ctx context.Context, rep repo.DirectRepositoryWriter, repairer ecc.Repairer, blobID blob.ID, opt RepairBlobsOptions, state *repairBlobsState) error {
+	var data, repaired, decrypted gather.WriteBuffer
+	defer data.Close()
+	defer repaired.Close()
+	defer decrypted.Close()
+
+	if err := getBlobForRepair(ctx, rep, blobID, &data); err != nil {
+		if errors.Is(err, blob.ErrBlobNotFound) {
+			// index blobs may have been compacted and deleted since they were listed.
+			return nil
+		}
+
+		return errors.Wrapf(err, "unable to read index blob %v", blobID)
+	}
+
+	n, err := repairer.Repair(data.Bytes(), &repaired)
+	state.scanned(int64(data.Length()), n)
+
+	if err != nil {
+		log(ctx).Errorf("Index blob %v is unrecoverable: %v", blobID, err)
+		state.unrecoverable(blobID)
+
+		return nil
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	// verify the repaired blob before overwriting the damaged one.
+	if err := blobcrypto.Decrypt(rep.ContentReader().ContentFormat(), repaired.Bytes(), blobID, &decrypted); err != nil {
+		log(ctx).Errorf("Index blob %v could not be repaired: %v", blobID, err)
+		state.unrecoverable(blobID)
+
+		return nil
+	}
+
+	log(ctx).Infof("Repairing %v damaged shards of index blob %v.", n, blobID)
+
+	if !opt.DryRun {
+		// retention of index blobs is applied by the repository blob storage.
+		if err := rep.BlobStorage().PutBlob(ctx, blobID, repaired.Bytes(), blob.PutOptions{}); err != nil {
+			return errors.Wrapf(err, "unable to rewrite index blob %v", blobID)
+		}
+	}
+
+	state.repaired(blobID, 0)
+
+	return nil
+}
+
+func sortBlobIDs(ids []blob.ID) {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+}
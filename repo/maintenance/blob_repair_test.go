@@ -0,0 +1,226 @@
+package maintenance_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/ecc"
+	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/repo/maintenance"
+	"github.com/kopia/kopia/repo/object"
+)
+
+func TestRepairBlobs(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, format.FormatVersion3, repotesting.Options{
+		NewRepositoryOptions: func(nro *repo.NewRepositoryOptions) {
+			nro.BlockFormat.ECC = ecc.AlgorithmReedSolomonWithCrc32
+			nro.BlockFormat.ECCOverheadPercent = 10
+			nro.RetentionMode = blob.Governance
+			nro.RetentionPeriod = 24 * time.Hour
+		},
+	})
+
+	data := bytes.Repeat([]byte("some data protected by error correction "), 2000)
+
+	oid := mustWriteObjectData(t, env, data)
+	cid, _, ok := oid.ContentID()
+	require.True(t, ok)
+
+	ci, err := env.RepositoryWriter.ContentInfo(ctx, cid)
+	require.NoError(t, err)
+
+	indexBlobs, err := env.RepositoryWriter.IndexBlobs(ctx, false)
+	require.NoError(t, err)
+	require.NotEmpty(t, indexBlobs)
+
+	indexBlobID := indexBlobs[0].BlobID
+	originalIndexBlob := mustGetBlob(t, env.RootStorage(), indexBlobID)
+
+	// damage one shard of the content and one shard of the index blob.
+	mustFlipByte(t, env.RootStorage(), ci.PackBlobID, int(ci.PackOffset+ci.PackedLength/2))
+	mustFlipByte(t, env.RootStorage(), indexBlobID, len(originalIndexBlob)/2)
+
+	mode, _, err := env.RootStorage().(blobtesting.RetentionStorage).GetRetention(ctx, indexBlobID)
+	require.NoError(t, err)
+	require.Empty(t, mode)
+
+	env.MustReopen(t)
+
+	stats := mustRepairBlobs(t, env, maintenance.RepairBlobsOptions{DryRun: true})
+	require.Equal(t, 2, stats.DamagedShards)
+	require.ElementsMatch(t, []blob.ID{ci.PackBlobID, indexBlobID}, stats.RepairedBlobs)
+	require.Empty(t, stats.UnrecoverableBlobs)
+	require.NotEqual(t, originalIndexBlob, mustGetBlob(t, env.RootStorage(), indexBlobID))
+
+	stats = mustRepairBlobs(t, env, maintenance.RepairBlobsOptions{})
+	require.Equal(t, 2, stats.DamagedShards)
+	require.ElementsMatch(t, []blob.ID{ci.PackBlobID, indexBlobID}, stats.RepairedBlobs)
+	require.Equal(t, 1, stats.RewrittenContents)
+	require.Empty(t, stats.UnrecoverableBlobs)
+
+	// index blobs are rewritten in place, damaged contents are moved to new packs.
+	require.Equal(t, originalIndexBlob, mustGetBlob(t, env.RootStorage(), indexBlobID))
+
+	// with the same retention as when they were written.
+	mode, _, err = env.RootStorage().(blobtesting.RetentionStorage).GetRetention(ctx, indexBlobID)
+	require.NoError(t, err)
+	require.Equal(t, blob.Governance, mode)
+
+	env.MustReopen(t)
+
+	ci2, err := env.RepositoryWriter.ContentInfo(ctx, cid)
+	require.NoError(t, err)
+	require.NotEqual(t, ci.PackBlobID, ci2.PackBlobID)
+
+	mustReadObjectData(t, env.RepositoryWriter, oid, data)
+
+	stats = mustRepairBlobs(t, env, maintenance.RepairBlobsOptions{})
+	require.Zero(t, stats.DamagedShards)
+	require.Empty(t, stats.RepairedBlobs)
+
+	// damage beyond what error correction can repair.
+	mustFlipBytes(t, env.RootStorage(), ci2.PackBlobID, int(ci2.PackOffset), int(ci2.PackedLength)/2)
+
+	env.MustReopen(t)
+
+	stats = mustRepairBlobs(t, env, maintenance.RepairBlobsOptions{})
+	require.Equal(t, []blob.ID{ci2.PackBlobID}, stats.UnrecoverableBlobs)
+	require.Empty(t, stats.RepairedBlobs)
+}
+
+func TestRepairBlobs_Interval(t *testing.T) {
+	ta := faketime.NewClockTimeWithOffset(0)
+
+	ctx, env := repotesting.NewEnvironment(t, format.FormatVersion3, repotesting.Options{
+		OpenOptions: func(o *repo.Options) {
+			o.TimeNowFunc = ta.NowFunc()
+		},
+		NewRepositoryOptions: func(nro *repo.NewRepositoryOptions) {
+			nro.BlockFormat.ECC = ecc.AlgorithmReedSolomonWithCrc32
+			nro.BlockFormat.ECCOverheadPercent = 10
+		},
+	})
+
+	p, err := maintenance.GetParams(ctx, env.RepositoryWriter)
+	require.NoError(t, err)
+
+	p.RepairBlobs = true
+
+	require.NoError(t, maintenance.SetParams(ctx, env.RepositoryWriter, p))
+
+	runFullMaintenance := func() int {
+		require.NoError(t, maintenance.RunExclusive(ctx, env.RepositoryWriter, maintenance.ModeFull, true, func(ctx context.Context, runParams maintenance.RunParameters) error {
+			return maintenance.Run(ctx, runParams, maintenance.SafetyNone)
+		}))
+
+		s, err := maintenance.GetSchedule(ctx, env.RepositoryWriter)
+		require.NoError(t, err)
+
+		return len(s.Runs[maintenance.TaskRepairBlobsFull])
+	}
+
+	require.Equal(t, 1, runFullMaintenance())
+
+	// scanning all blobs is expensive, so it's not done in every full maintenance.
+	ta.Advance(24 * time.Hour)
+	require.Equal(t, 1, runFullMaintenance())
+
+	ta.Advance(7 * 24 * time.Hour)
+	require.Equal(t, 2, runFullMaintenance())
+}
+
+func TestRepairBlobs_NoErrorCorrection(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, format.FormatVersion3)
+
+	_, err := maintenance.RepairBlobs(ctx, env.RepositoryWriter, maintenance.RepairBlobsOptions{})
+	require.ErrorIs(t, err, maintenance.ErrNoErrorCorrection)
+}
+
+func mustRepairBlobs(t *testing.T, env *repotesting.Environment, opt maintenance.RepairBlobsOptions) *maintenance.RepairBlobsStats {
+	t.Helper()
+
+	var stats *maintenance.RepairBlobsStats
+
+	require.NoError(t, repo.DirectWriteSession(testlogging.Context(t), env.RepositoryWriter, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.DirectRepositoryWriter) error {
+		var err error
+
+		stats, err = maintenance.RepairBlobs(ctx, w, opt)
+
+		return err
+	}))
+
+	return stats
+}
+
+func mustWriteObjectData(t *testing.T, env *repotesting.Environment, data []byte) object.ID {
+	t.Helper()
+
+	var oid object.ID
+
+	require.NoError(t, repo.WriteSession(testlogging.Context(t), env.Repository, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		ow := w.NewObjectWriter(ctx, object.WriterOptions{})
+		ow.Write(data)
+
+		var err error
+
+		oid, err = ow.Result()
+
+		return err
+	}))
+
+	return oid
+}
+
+func mustReadObjectData(t *testing.T, rep repo.Repository, oid object.ID, want []byte) {
+	t.Helper()
+
+	r, err := rep.OpenObject(testlogging.Context(t), oid)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
+func mustGetBlob(t *testing.T, st blob.Storage, id blob.ID) []byte {
+	t.Helper()
+
+	var buf gather.WriteBuffer
+	defer buf.Close()
+
+	require.NoError(t, st.GetBlob(testlogging.Context(t), id, 0, -1, &buf))
+
+	return buf.ToByteSlice()
+}
+
+func mustFlipByte(t *testing.T, st blob.Storage, id blob.ID, offset int) {
+	t.Helper()
+
+	mustFlipBytes(t, st, id, offset, 1)
+}
+
+func mustFlipBytes(t *testing.T, st blob.Storage, id blob.ID, offset, length int) {
+	t.Helper()
+
+	b := mustGetBlob(t, st, id)
+
+	for i := offset; i < offset+length; i++ {
+		b[i] ^= 0xff
+	}
+
+	require.NoError(t, st.PutBlob(testlogging.Context(t), id, gather.FromSlice(b), blob.PutOptions{}))
+}
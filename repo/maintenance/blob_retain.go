@@ -51,6 +51,11 @@ func ExtendBlobRetentionTime(ctx context.Context, rep repo.DirectRepositoryWrite
 		return 0, nil
 	}
 
+	held, err := HeldBlobs(ctx, rep)
+	if err != nil {
+		return 0, err
+	}
+
 	extend := make(chan blob.Metadata, extendQueueSize)
 	extendOpts := blob.ExtendOptions{
 		RetentionMode:   blobCfg.RetentionMode,
@@ -90,7 +95,14 @@ func ExtendBlobRetentionTime(ctx context.Context, rep repo.DirectRepositoryWrite
 	// iterate all relevant (active, extendable) blobs and count them + optionally send to the channel to be extended
 	log(ctx).Info("Extending retention time for blobs...")
 
+	retainUntil := rep.Time().Add(blobCfg.RetentionPeriod)
+
 	err = blob.IterateAllPrefixesInParallel(ctx, opt.Parallel, rep.BlobStorage(), prefixes, func(bm blob.Metadata) error {
+		// do not shorten the retention of blobs on hold.
+		if t, ok := held[bm.BlobID]; ok && t.After(retainUntil) {
+			return nil
+		}
+
 		if !opt.DryRun {
 			extend <- bm
 		}
@@ -26,6 +26,9 @@ type RewriteContentsOptions struct {
 	ShortPacks     bool
 	FormatVersion  int
 	DryRun         bool
+
+	// InactiveEncryptionKeys rewrites contents encrypted with keys other than the active one.
+	InactiveEncryptionKeys bool
 }
 
 const shortPackThresholdPercent = 60 // blocks below 60% of max block size are considered to be 'short
@@ -48,6 +51,11 @@ func RewriteContents(ctx context.Context, rep repo.DirectRepositoryWriter, opt *
 		log(ctx).Info("Rewriting contents...")
 	}
 
+	held, err := HeldBlobs(ctx, rep)
+	if err != nil {
+		return err
+	}
+
 	cnt := getContentToRewrite(ctx, rep, opt)
 
 	var (
@@ -82,6 +90,11 @@ func RewriteContents(ctx context.Context, rep repo.DirectRepositoryWriter, opt *
 					optDeleted = " (deleted)"
 				}
 
+				if _, ok := held[c.PackBlobID]; ok {
+					log(ctx).Debugf("Not rewriting content %v (%v bytes) from pack %v%v, because the pack is on hold.", c.ContentID, c.PackedLength, c.PackBlobID, optDeleted)
+					continue
+				}
+
 				age := rep.Time().Sub(c.Timestamp())
 				if age < safety.RewriteMinAge {
 					log(ctx).Debugf("Not rewriting content %v (%v bytes) from pack %v%v %v, because it's too new.", c.ContentID, c.PackedLength, c.PackBlobID, optDeleted, age)
@@ -147,6 +160,11 @@ func getContentToRewrite(ctx context.Context, rep repo.DirectRepository, opt *Re
 		if opt.FormatVersion != 0 {
 			findContentWithFormatVersion(ctx, rep, ch, opt)
 		}
+
+		// add all contents that must be re-encrypted before their keys can be retired
+		if opt.InactiveEncryptionKeys {
+			findContentWithInactiveEncryptionKey(ctx, rep, ch, opt)
+		}
 	}()
 
 	return ch
@@ -179,6 +197,28 @@ func(b content.Info) error {
 		})
 }
 
+func findContentWithInactiveEncryptionKey(ctx context.Context, rep repo.DirectRepository, ch chan contentInfoOrError, opt *RewriteContentsOptions) {
+	active := rep.ContentReader().ContentFormat().GetActiveEncryptionKeyID()
+	if active == 0 {
+		// encryption key was never rotated.
+		return
+	}
+
+	_ = rep.ContentReader().IterateContents(
+		ctx,
+		content.IterateOptions{
+			Range:          opt.ContentIDRange,
+			IncludeDeleted: true,
+		},
+		func(b content.Info) error {
+			if b.EncryptionKeyID != active && strings.HasPrefix(string(b.PackBlobID), string(opt.PackPrefix)) {
+				ch <- contentInfoOrError{Info: b}
+			}
+
+			return nil
+		})
+}
+
 func findContentInShortPacks(ctx context.Context, rep repo.DirectRepository, ch chan contentInfoOrError, threshold int64, opt *RewriteContentsOptions) {
 	var prefixes []blob.ID
 
@@ -12,10 +12,16 @@
 func DropDeletedContents(ctx context.Context, rep repo.DirectRepositoryWriter, dropDeletedBefore time.Time, safety SafetyParameters) error {
 	log(ctx).Infof("Dropping contents deleted before %v", dropDeletedBefore)
 
+	isHeld, err := isHeldFunc(ctx, rep)
+	if err != nil {
+		return err
+	}
+
 	//nolint:wrapcheck
 	return rep.ContentManager().CompactIndexes(ctx, indexblob.CompactOptions{
 		AllIndexes:                       true,
 		DropDeletedBefore:                dropDeletedBefore,
 		DisableEventualConsistencySafety: safety.DisableEventualConsistencySafety,
+		IsRetained:                       isHeld,
 	})
 }
@@ -0,0 +1,167 @@
+package maintenance
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/blobcrypto"
+	"github.com/kopia/kopia/internal/epoch"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/repodiag"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/content/index"
+	"github.com/kopia/kopia/repo/content/indexblob"
+)
+
+// keyRingEncryptedBlobPrefixes are prefixes of blobs encrypted using the content encryption key ring,
+// which must be re-encrypted using the active key before other keys can be retired.
+//
+//nolint:gochecknoglobals
+var keyRingEncryptedBlobPrefixes = []blob.ID{
+	indexblob.V0IndexBlobPrefix,
+	indexblob.V0CompactionLogBlobPrefix,
+	indexblob.V0CleanupBlobPrefix,
+	epoch.UncompactedIndexBlobPrefix,
+	epoch.SingleEpochCompactionBlobPrefix,
+	epoch.RangeCheckpointIndexBlobPrefix,
+	content.BlobIDPrefixSession,
+	repodiag.LogBlobPrefix,
+}
+
+// RetireUnusedEncryptionKeys removes content encryption keys, including the original master key, that are
+// no longer active and are not referenced by any content, including deleted ones, and returns the IDs of retired keys.
+//
+// Nothing is retired until the active key is older than safety.EncryptionKeyRetireMinAge, so that clients
+// which have cached the format blob before the rotation can see the new key. Index and session blobs written
+// before then are re-encrypted using the active key before the keys are retired.
+func RetireUnusedEncryptionKeys(ctx context.Context, rep repo.DirectRepositoryWriter, safety SafetyParameters) ([]byte, error) {
+	keys, err := rep.FormatManager().ContentEncryptionKeys(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get encryption keys")
+	}
+
+	if len(keys) == 0 {
+		// encryption key was never rotated.
+		return nil, nil
+	}
+
+	masterKeyRetired, err := rep.FormatManager().IsMasterKeyRetired(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get encryption keys")
+	}
+
+	active := rep.FormatManager().GetActiveEncryptionKeyID()
+
+	var (
+		candidates    = map[byte]bool{}
+		activeCreated time.Time
+	)
+
+	if !masterKeyRetired && active != 0 {
+		candidates[0] = true
+	}
+
+	for _, k := range keys {
+		if k.ID == active {
+			activeCreated = k.CreatedTime
+		} else {
+			candidates[k.ID] = true
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	// clients which have not seen the active key yet may still be writing using older keys.
+	cutoff := activeCreated.Add(safety.EncryptionKeyRetireMinAge)
+	if rep.Time().Before(cutoff) {
+		log(ctx).Infof("Not retiring encryption keys until active key is older than %v.", safety.EncryptionKeyRetireMinAge)
+		return nil, nil
+	}
+
+	if err := rep.ContentReader().IterateContents(ctx, content.IterateOptions{
+		Range:          index.AllIDs,
+		IncludeDeleted: true,
+	}, func(ci content.Info) error {
+		delete(candidates, ci.EncryptionKeyID)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error iterating contents")
+	}
+
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	if err := reencryptBlobsWrittenBefore(ctx, rep, cutoff); err != nil {
+		return nil, errors.Wrap(err, "error re-encrypting blobs")
+	}
+
+	var ids, retired []byte
+
+	for id := range candidates {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	for _, id := range ids {
+		if err := rep.FormatManager().RetireEncryptionKey(ctx, id); err != nil {
+			return retired, errors.Wrapf(err, "unable to retire encryption key %v", id)
+		}
+
+		retired = append(retired, id)
+	}
+
+	return retired, nil
+}
+
+// reencryptBlobsWrittenBefore re-encrypts blobs which may have been written using keys other than the active one.
+// Re-encrypted blobs keep their IDs, which are derived from the plaintext.
+func reencryptBlobsWrittenBefore(ctx context.Context, rep repo.DirectRepositoryWriter, cutoff time.Time) error {
+	var payload, reencrypted gather.WriteBuffer
+	defer payload.Close()
+	defer reencrypted.Close()
+
+	for _, prefix := range keyRingEncryptedBlobPrefixes {
+		bms, err := blob.ListAllBlobs(ctx, rep.BlobStorage(), prefix)
+		if err != nil {
+			return errors.Wrapf(err, "error listing %v blobs", prefix)
+		}
+
+		for _, bm := range bms {
+			if !bm.Timestamp.Before(cutoff) {
+				continue
+			}
+
+			if err := rep.BlobStorage().GetBlob(ctx, bm.BlobID, 0, -1, &payload); err != nil {
+				if errors.Is(err, blob.ErrBlobNotFound) {
+					// blob may have been compacted and deleted since it was listed.
+					continue
+				}
+
+				return errors.Wrapf(err, "unable to read blob %v", bm.BlobID)
+			}
+
+			if err := blobcrypto.Reencrypt(rep.ContentReader().ContentFormat(), payload.Bytes(), bm.BlobID, &reencrypted); err != nil {
+				return errors.Wrapf(err, "unable to re-encrypt blob %v", bm.BlobID)
+			}
+
+			if err := rep.BlobStorage().PutBlob(ctx, bm.BlobID, reencrypted.Bytes(), blob.PutOptions{}); err != nil {
+				return errors.Wrapf(err, "unable to write blob %v", bm.BlobID)
+			}
+
+			log(ctx).Debugf("re-encrypted blob %v", bm.BlobID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package maintenance_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobcrypto"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/content/index"
+	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/repo/maintenance"
+	"github.com/kopia/kopia/repo/object"
+)
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	ta := faketime.NewClockTimeWithOffset(0)
+
+	ctx, env := repotesting.NewEnvironment(t, format.FormatVersion3, repotesting.Options{
+		OpenOptions: func(o *repo.Options) {
+			o.TimeNowFunc = ta.NowFunc()
+		},
+	})
+
+	oid1 := mustWriteObject(t, env, "before rotation")
+
+	// another client which has loaded the format blob before the rotation.
+	other := env.MustOpenAnother(t)
+
+	keyID, err := env.RepositoryWriter.FormatManager().RotateEncryptionKey(ctx)
+	require.NoError(t, err)
+	require.Equal(t, byte(1), keyID)
+
+	// older clients must not open the repository, they would write contents using the master key.
+	features, err := env.RepositoryWriter.FormatManager().RequiredFeatures(ctx)
+	require.NoError(t, err)
+	require.Len(t, features, 1)
+	require.Equal(t, format.EncryptionKeyRingFeature, features[0].Feature)
+
+	oid2 := mustWriteObject(t, env, "after rotation")
+
+	require.Equal(t, map[byte]int{0: 1, 1: 1}, contentCountByEncryptionKey(t, env.RepositoryWriter))
+
+	// both keys can be used for reading, including by clients that have not seen the new key yet.
+	require.NoError(t, other.Refresh(ctx))
+	mustReadObject(t, other, oid1, "before rotation")
+	mustReadObject(t, other, oid2, "after rotation")
+
+	keyID, err = env.RepositoryWriter.FormatManager().RotateEncryptionKey(ctx)
+	require.NoError(t, err)
+	require.Equal(t, byte(2), keyID)
+
+	features, err = env.RepositoryWriter.FormatManager().RequiredFeatures(ctx)
+	require.NoError(t, err)
+	require.Len(t, features, 1)
+
+	// nothing can be retired until contents are rewritten.
+	retired, err := maintenance.RetireUnusedEncryptionKeys(ctx, env.RepositoryWriter, maintenance.SafetyNone)
+	require.NoError(t, err)
+	require.Empty(t, retired)
+
+	require.NoError(t, repo.DirectWriteSession(ctx, env.RepositoryWriter, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.DirectRepositoryWriter) error {
+		return maintenance.RewriteContents(ctx, w, &maintenance.RewriteContentsOptions{
+			ContentIDRange:         index.AllIDs,
+			InactiveEncryptionKeys: true,
+		}, maintenance.SafetyNone)
+	}))
+
+	env.MustReopen(t, func(o *repo.Options) {
+		o.TimeNowFunc = ta.NowFunc()
+	})
+
+	require.Equal(t, map[byte]int{2: 2}, contentCountByEncryptionKey(t, env.RepositoryWriter))
+
+	// clients which have not seen the active key yet may still be writing using older keys.
+	retired, err = maintenance.RetireUnusedEncryptionKeys(ctx, env.RepositoryWriter, maintenance.SafetyFull)
+	require.NoError(t, err)
+	require.Empty(t, retired)
+
+	ta.Advance(maintenance.SafetyFull.EncryptionKeyRetireMinAge)
+
+	retired, err = maintenance.RetireUnusedEncryptionKeys(ctx, env.RepositoryWriter, maintenance.SafetyFull)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 1}, retired)
+
+	keys, err := env.RepositoryWriter.FormatManager().ContentEncryptionKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Equal(t, byte(2), keys[0].ID)
+	require.Nil(t, keys[0].MasterKey)
+
+	require.ErrorContains(t, env.RepositoryWriter.FormatManager().RetireEncryptionKey(ctx, 2), "is active")
+	require.ErrorContains(t, env.RepositoryWriter.FormatManager().RetireEncryptionKey(ctx, 0), "not found")
+
+	env.MustReopen(t, func(o *repo.Options) {
+		o.TimeNowFunc = ta.NowFunc()
+	})
+
+	// index blobs written using retired keys have been re-encrypted using the active key.
+	indexBlobs, err := env.RepositoryWriter.IndexBlobs(ctx, false)
+	require.NoError(t, err)
+	require.NotEmpty(t, indexBlobs)
+
+	for _, ib := range indexBlobs {
+		var encrypted, decrypted gather.WriteBuffer
+
+		require.NoError(t, env.RepositoryWriter.BlobReader().GetBlob(ctx, ib.BlobID, 0, -1, &encrypted))
+		require.NoError(t, blobcrypto.Decrypt(env.RepositoryWriter.ContentReader().ContentFormat(), encrypted.Bytes(), ib.BlobID, &decrypted))
+
+		encrypted.Close()
+		decrypted.Close()
+	}
+
+	mustReadObject(t, env.RepositoryWriter, oid1, "before rotation")
+	mustReadObject(t, env.RepositoryWriter, oid2, "after rotation")
+}
+
+func TestEncryptionKeyRotationNotSupported(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, format.FormatVersion1)
+
+	_, err := env.RepositoryWriter.FormatManager().RotateEncryptionKey(ctx)
+	require.ErrorContains(t, err, "requires index format v2")
+}
+
+func mustWriteObject(t *testing.T, env *repotesting.Environment, data string) object.ID {
+	t.Helper()
+
+	var oid object.ID
+
+	require.NoError(t, repo.WriteSession(testlogging.Context(t), env.Repository, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		ow := w.NewObjectWriter(ctx, object.WriterOptions{})
+		io.WriteString(ow, data)
+
+		var err error
+
+		oid, err = ow.Result()
+
+		return err
+	}))
+
+	return oid
+}
+
+func mustReadObject(t *testing.T, rep repo.Repository, oid object.ID, want string) {
+	t.Helper()
+
+	r, err := rep.OpenObject(testlogging.Context(t), oid)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	var buf bytes.Buffer
+
+	_, err = io.Copy(&buf, r)
+	require.NoError(t, err)
+	require.Equal(t, want, buf.String())
+}
+
+func contentCountByEncryptionKey(t *testing.T, rep repo.DirectRepository) map[byte]int {
+	t.Helper()
+
+	result := map[byte]int{}
+
+	require.NoError(t, rep.ContentReader().IterateContents(testlogging.Context(t), content.IterateOptions{
+		Range: index.AllIDs,
+	}, func(ci content.Info) error {
+		result[ci.EncryptionKeyID]++
+		return nil
+	}))
+
+	return result
+}
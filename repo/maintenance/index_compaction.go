@@ -13,9 +13,15 @@ func runTaskIndexCompactionQuick(ctx context.Context, runParams RunParameters, s
 
 		const maxSmallBlobsForIndexCompaction = 8
 
+		isHeld, err := isHeldFunc(ctx, runParams.rep)
+		if err != nil {
+			return err
+		}
+
 		return runParams.rep.ContentManager().CompactIndexes(ctx, indexblob.CompactOptions{
 			MaxSmallBlobs:                    maxSmallBlobsForIndexCompaction,
 			DisableEventualConsistencySafety: safety.DisableEventualConsistencySafety,
+			IsRetained:                       isHeld,
 		})
 	})
 }
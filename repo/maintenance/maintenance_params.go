@@ -25,6 +25,10 @@ type Params struct {
 	LogRetention LogRetentionOptions `json:"logRetention"`
 
 	ExtendObjectLocks bool `json:"extendObjectLocks"`
+
+	// RepairBlobs scans blobs for damage and repairs it using error correction as part of full maintenance,
+	// at most once a week.
+	RepairBlobs bool `json:"repairBlobs"`
 }
 
 // isOwnedByByThisUser determines whether current user is the maintenance owner.
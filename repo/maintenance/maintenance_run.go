@@ -11,9 +11,11 @@
 
 	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/epoch"
+	"github.com/kopia/kopia/internal/listjournal"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/content/index"
+	"github.com/kopia/kopia/repo/ecc"
 	"github.com/kopia/kopia/repo/logging"
 )
 
@@ -51,8 +53,17 @@
 	TaskEpochCleanupMarkers          = "cleanup-epoch-markers"
 	TaskEpochGenerateRange           = "generate-epoch-range-index"
 	TaskEpochCompactSingle           = "compact-single-epoch"
+	TaskReconcileBlobListJournal     = "reconcile-blob-list-journal"
+	TaskRetireEncryptionKeys         = "retire-encryption-keys"
+	TaskRepairBlobsFull              = "repair-blobs"
 )
 
+// blobListJournalReconcileInterval is the minimum time between full reconciliations of the blob list journal.
+const blobListJournalReconcileInterval = 7 * 24 * time.Hour
+
+// repairBlobsInterval is the minimum time between scans of all blobs for damage.
+const repairBlobsInterval = 7 * 24 * time.Hour
+
 // shouldRun returns Mode if repository is due for periodic maintenance.
 func shouldRun(ctx context.Context, rep repo.DirectRepository, p *Params) (Mode, error) {
 	if myUsername := rep.ClientOptions().UsernameAtHost(); p.Owner != myUsername {
@@ -149,6 +160,10 @@ func (e NotOwnedError) Error() string {
 // lock can be acquired. Lock is passed to the function, which ensures that every call to Run()
 // is within the exclusive context.
 func RunExclusive(ctx context.Context, rep repo.DirectRepositoryWriter, mode Mode, force bool, cb func(ctx context.Context, runParams RunParameters) error) error {
+	if rep.ClientOptions().WriteOnly {
+		return errors.Errorf("maintenance can't be run by a write-only client")
+	}
+
 	rep.DisableIndexRefresh()
 
 	ctx = rep.AlsoLogToContentLog(ctx)
@@ -407,7 +422,13 @@ func runTaskEpochMaintenanceFull(ctx context.Context, runParams RunParameters, s
 
 	return ReportRun(ctx, runParams.rep, TaskEpochDeleteSupersededIndexes, s, func() error {
 		log(ctx).Info("Cleaning up old index blobs which have already been compacted...")
-		return errors.Wrap(em.CleanupSupersededIndexes(ctx), "error removing superseded epoch index blobs")
+
+		isHeld, err := isHeldFunc(ctx, runParams.rep)
+		if err != nil {
+			return err
+		}
+
+		return errors.Wrap(em.CleanupSupersededIndexes(ctx, isHeld), "error removing superseded epoch index blobs")
 	})
 }
 
@@ -445,8 +466,9 @@ func runTaskRewriteContentsQuick(ctx context.Context, runParams RunParameters, s
 func runTaskRewriteContentsFull(ctx context.Context, runParams RunParameters, s *Schedule, safety SafetyParameters) error {
 	return ReportRun(ctx, runParams.rep, TaskRewriteContentsFull, s, func() error {
 		return RewriteContents(ctx, runParams.rep, &RewriteContentsOptions{
-			ContentIDRange: index.AllIDs,
-			ShortPacks:     true,
+			ContentIDRange:         index.AllIDs,
+			ShortPacks:             true,
+			InactiveEncryptionKeys: true,
 		}, safety)
 	})
 }
@@ -479,12 +501,66 @@ func runTaskExtendBlobRetentionTimeFull(ctx context.Context, runParams RunParame
 	})
 }
 
+func runTaskRetireEncryptionKeysFull(ctx context.Context, runParams RunParameters, s *Schedule, safety SafetyParameters) error {
+	keys, err := runParams.rep.FormatManager().ContentEncryptionKeys(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to get encryption keys")
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return ReportRun(ctx, runParams.rep, TaskRetireEncryptionKeys, s, func() error {
+		retired, err := RetireUnusedEncryptionKeys(ctx, runParams.rep, safety)
+
+		log(ctx).Infof("Retired %v encryption keys.", len(retired))
+
+		return err
+	})
+}
+
+func runTaskRepairBlobsFull(ctx context.Context, runParams RunParameters, s *Schedule) error {
+	if _, ok := runParams.rep.ContentReader().ContentFormat().Encryptor().(ecc.Repairer); !ok {
+		log(ctx).Debug("Repository does not use error correction, not repairing blobs.")
+		return nil
+	}
+
+	if next := maxEndTime(s.Runs[TaskRepairBlobsFull]).Add(repairBlobsInterval); runParams.rep.Time().Before(next) {
+		log(ctx).Debugf("Not repairing blobs until %v.", next.Format(time.RFC3339))
+		return nil
+	}
+
+	return ReportRun(ctx, runParams.rep, TaskRepairBlobsFull, s, func() error {
+		stats, err := RepairBlobs(ctx, runParams.rep, RepairBlobsOptions{})
+		if err != nil {
+			return err
+		}
+
+		// unrecoverable blobs are reported without failing maintenance, which would not fix them.
+		for _, id := range stats.UnrecoverableBlobs {
+			log(ctx).Errorf("Blob %v is damaged beyond repair.", id)
+		}
+
+		return nil
+	})
+}
+
 func runFullMaintenance(ctx context.Context, runParams RunParameters, safety SafetyParameters) error {
 	s, err := GetSchedule(ctx, runParams.rep)
 	if err != nil {
 		return errors.Wrap(err, "unable to get schedule")
 	}
 
+	// repair damage before it accumulates and becomes unrecoverable.
+	if runParams.Params.RepairBlobs {
+		if err := runTaskRepairBlobsFull(ctx, runParams, s); err != nil {
+			return errors.Wrap(err, "error repairing blobs")
+		}
+	} else {
+		log(ctx).Debug("Repairing damaged blobs is disabled.")
+	}
+
 	if shouldFullRewriteContents(s, safety) {
 		// find packs that are less than 80% full and rewrite contents in them into
 		// new consolidated packs, orphaning old packs in the process.
@@ -506,6 +582,11 @@ func runFullMaintenance(ctx context.Context, runParams RunParameters, safety Saf
 		if err := runTaskDeleteOrphanedBlobsFull(ctx, runParams, s, safety); err != nil {
 			return errors.Wrap(err, "error deleting unreferenced blobs")
 		}
+
+		// packs encrypted with old keys are gone, the keys can be retired.
+		if err := runTaskRetireEncryptionKeysFull(ctx, runParams, s, safety); err != nil {
+			return errors.Wrap(err, "error retiring encryption keys")
+		}
 	} else {
 		notDeletingOrphanedBlobs(ctx, s, safety)
 	}
@@ -523,6 +604,10 @@ func runFullMaintenance(ctx context.Context, runParams RunParameters, safety Saf
 		return errors.Wrap(err, "error cleaning up epoch manager")
 	}
 
+	if err := runTaskReconcileBlobListJournalFull(ctx, runParams, s); err != nil {
+		return errors.Wrap(err, "error reconciling blob list journal")
+	}
+
 	// clean up logs last
 	if err := runTaskCleanupLogs(ctx, runParams, s); err != nil {
 		return errors.Wrap(err, "error cleaning up logs")
@@ -531,6 +616,32 @@ func runFullMaintenance(ctx context.Context, runParams RunParameters, safety Saf
 	return nil
 }
 
+// runTaskReconcileBlobListJournalFull periodically compares the blob list journal against a full listing
+// of the storage to detect drift and to compact the journal into a new checkpoint.
+func runTaskReconcileBlobListJournalFull(ctx context.Context, runParams RunParameters, s *Schedule) error {
+	if _, ok := runParams.rep.BlobStorage().(listjournal.Reconciler); !ok {
+		return nil
+	}
+
+	if next := maxEndTime(s.Runs[TaskReconcileBlobListJournal]).Add(blobListJournalReconcileInterval); runParams.rep.Time().Before(next) {
+		log(ctx).Debugf("Not reconciling blob list journal until %v.", next.Format(time.RFC3339))
+		return nil
+	}
+
+	return ReportRun(ctx, runParams.rep, TaskReconcileBlobListJournal, s, func() error {
+		log(ctx).Info("Reconciling blob list journal...")
+
+		stats, _, err := listjournal.Reconcile(ctx, runParams.rep.BlobStorage())
+		if err != nil {
+			return errors.Wrap(err, "error reconciling blob list journal")
+		}
+
+		log(ctx).Infof("Reconciled blob list journal with %v blobs (%v missing, %v extra), deleted %v segments.", stats.Blobs, stats.Missing, stats.Extra, stats.DeletedSegments)
+
+		return nil
+	})
+}
+
 // shouldQuickRewriteContents returns true if it's currently ok to rewrite contents.
 // since each content rewrite will require deleting of orphaned blobs after some time passes,
 // we don't want to starve blob deletion by constantly doing rewrites.
@@ -33,6 +33,10 @@ type SafetyParameters struct {
 
 	// Minimum time that must pass after content rewrite before we delete orphaned blobs.
 	MinRewriteToOrphanDeletionDelay time.Duration
+
+	// Minimum age of the active encryption key before the keys it replaced are retired, which allows
+	// clients using cached format blob to see the new key and flush writes made with old keys.
+	EncryptionKeyRetireMinAge time.Duration
 }
 
 // Supported safety levels.
@@ -64,5 +68,6 @@ type SafetyParameters struct {
 		SessionExpirationAge:            96 * time.Hour, //nolint:mnd
 		RequireTwoGCCycles:              true,
 		MinRewriteToOrphanDeletionDelay: time.Hour,
+		EncryptionKeyRetireMinAge:       24 * time.Hour, //nolint:mnd
 	}
 )
@@ -38,6 +38,10 @@ type committedManifestManager struct {
 	// manifest contents
 	// +checklocks:cmmu
 	autoCompactionThreshold int
+
+	// writeOnly indicates that manifests written by other clients can't be decrypted,
+	// so only entries committed by this manager are visible.
+	writeOnly bool
 }
 
 func (m *committedManifestManager) getCommittedEntryOrNil(ctx context.Context, id ID) (*manifestEntry, error) {
@@ -136,6 +140,10 @@ func (m *committedManifestManager) writeEntriesLocked(ctx context.Context, entri
 func (m *committedManifestManager) loadCommittedContentsLocked(ctx context.Context) error {
 	m.verifyLocked()
 
+	if m.writeOnly {
+		return nil
+	}
+
 	var (
 		mu        sync.Mutex
 		manifests map[content.ID]manifest
@@ -213,6 +221,10 @@ func (m *committedManifestManager) loadManifestContentsLocked(manifests map[cont
 }
 
 func (m *committedManifestManager) compact(ctx context.Context) error {
+	if m.writeOnly {
+		return errors.Errorf("manifests can't be compacted by a write-only client")
+	}
+
 	m.lock()
 	defer m.unlock()
 
@@ -364,7 +376,7 @@ func loadManifestContent(ctx context.Context, b contentManager, contentID conten
 	return man, errors.Wrapf(err, "unable to parse manifest %q", contentID)
 }
 
-func newCommittedManager(b contentManager, autoCompactionThreshold int) *committedManifestManager {
+func newCommittedManager(b contentManager, autoCompactionThreshold int, writeOnly bool) *committedManifestManager {
 	debugID := ""
 	if os.Getenv("KOPIA_DEBUG_MANIFEST_MANAGER") != "" {
 		debugID = fmt.Sprintf("%x", rand.Int63()) //nolint:gosec
@@ -376,5 +388,6 @@ func newCommittedManager(b contentManager, autoCompactionThreshold int) *committ
 		committedEntries:        map[ID]*manifestEntry{},
 		committedContentIDs:     map[content.ID]bool{},
 		autoCompactionThreshold: autoCompactionThreshold,
+		writeOnly:               writeOnly,
 	}
 }
@@ -97,6 +97,32 @@ func (m *Manager) Put(ctx context.Context, labels map[string]string, payload int
 	return e.ID, nil
 }
 
+// PutWithMetadata serializes the provided payload to JSON and persists it using the ID, labels and modification time
+// from the provided metadata, which preserves the identity of manifests copied from another repository.
+func (m *Manager) PutWithMetadata(ctx context.Context, md *EntryMetadata, payload interface{}) error {
+	if md.Labels[TypeLabelKey] == "" {
+		return errors.Errorf("'type' label is required")
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "marshal error")
+	}
+
+	e := &manifestEntry{
+		ID:      md.ID,
+		ModTime: md.ModTime.UTC(),
+		Labels:  copyLabels(md.Labels),
+		Content: b,
+	}
+
+	m.mu.Lock()
+	m.pendingEntries[e.ID] = e
+	m.mu.Unlock()
+
+	return nil
+}
+
 // GetMetadata returns metadata about provided manifest item or ErrNotFound if the item can't be found.
 func (m *Manager) GetMetadata(ctx context.Context, id ID) (*EntryMetadata, error) {
 	e, err := m.getPendingOrCommitted(ctx, id)
@@ -288,6 +314,9 @@ func copyLabels(m map[string]string) map[string]string {
 type ManagerOptions struct {
 	TimeNow                 func() time.Time // Time provider
 	AutoCompactionThreshold int
+
+	// WriteOnly must be set when the client can't decrypt manifests written by other clients.
+	WriteOnly bool
 }
 
 // NewManager returns new manifest manager for the provided content manager.
@@ -308,7 +337,7 @@ func NewManager(ctx context.Context, b contentManager, options ManagerOptions, m
 		b:              b,
 		pendingEntries: map[ID]*manifestEntry{},
 		timeNow:        timeNow,
-		committed:      newCommittedManager(b, autoCompactionThreshold),
+		committed:      newCommittedManager(b, autoCompactionThreshold, options.WriteOnly),
 	}
 
 	return m, nil
@@ -70,6 +70,8 @@ func (om *Manager) NewWriter(ctx context.Context, opt WriterOptions) Writer {
 	w.description = opt.Description
 	w.prefix = opt.Prefix
 	w.compressor = compression.ByName[opt.Compressor]
+	w.minCompressionSavings = opt.MinCompressionSavings
+	w.onChunkCompression = opt.OnChunkCompression
 	w.totalLength = 0
 	w.currentPosition = 0
 
@@ -131,12 +133,12 @@ func (om *Manager) Concatenate(ctx context.Context, objectIDs []ID) (ID, error)
 	log(ctx).Debugf("concatenated: %v total: %v", concatenatedEntries, totalLength)
 
 	w := om.NewWriter(ctx, WriterOptions{
-		Prefix:      indirectContentPrefix,
+		Prefix:      IndirectContentPrefix,
 		Description: "CONCATENATED INDEX",
 	})
 	defer w.Close() //nolint:errcheck
 
-	if werr := writeIndirectObject(w, concatenatedEntries); werr != nil {
+	if werr := WriteIndirectObject(w, concatenatedEntries); werr != nil {
 		return EmptyID, werr
 	}
 
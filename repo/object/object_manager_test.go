@@ -255,6 +255,70 @@ func TestCompression_ContentCompressionDisabled(t *testing.T) {
 	require.True(t, isCompressed) // oid will indicate compression
 }
 
+func TestCompression_AutoDetect(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	const chunkSize = 128 << 10
+
+	// compressible chunk followed by an incompressible one.
+	data := append(makeMaybeCompressibleData(chunkSize, true), makeMaybeCompressibleData(chunkSize, false)...)
+
+	for _, contentCompression := range []bool{true, false} {
+		t.Run(fmt.Sprintf("contentCompression=%v", contentCompression), func(t *testing.T) {
+			var cmap map[content.ID]compression.HeaderID
+			if contentCompression {
+				cmap = map[content.ID]compression.HeaderID{}
+			}
+
+			_, fcm, om := setupTest(t, cmap)
+
+			var compressed, skipped int64
+
+			w := om.NewWriter(ctx, WriterOptions{
+				Compressor:            "gzip",
+				Splitter:              "FIXED-128K",
+				MinCompressionSavings: 10,
+				OnChunkCompression: func(length int64, isCompressed bool) {
+					if isCompressed {
+						compressed += length
+					} else {
+						skipped += length
+					}
+				},
+			})
+
+			_, err := w.Write(data)
+			require.NoError(t, err)
+
+			oid, err := w.Result()
+			require.NoError(t, err)
+
+			require.EqualValues(t, chunkSize, compressed)
+			require.EqualValues(t, chunkSize, skipped)
+
+			ndx, ok := oid.IndexObjectID()
+			require.True(t, ok)
+
+			entries, err := LoadIndexObject(ctx, fcm, ndx)
+			require.NoError(t, err)
+			require.Len(t, entries, 2)
+
+			cid0, isCompressed0, _ := entries[0].Object.ContentID()
+			cid1, isCompressed1, _ := entries[1].Object.ContentID()
+
+			if contentCompression {
+				require.Equal(t, compression.ByName["gzip"].HeaderID(), cmap[cid0])
+				require.Equal(t, content.NoCompression, cmap[cid1])
+			} else {
+				require.True(t, isCompressed0)
+				require.False(t, isCompressed1)
+			}
+
+			verifyFull(ctx, t, om, oid, data)
+		})
+	}
+}
+
 func TestWriterCompleteChunkInTwoWrites(t *testing.T) {
 	ctx := testlogging.Context(t)
 	_, _, om := setupTest(t, nil)
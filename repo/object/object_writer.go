@@ -17,7 +17,11 @@
 
 var log = logging.Module("object")
 
-const indirectContentPrefix = "x"
+// IndirectContentPrefix is the prefix of contents holding indexes of indirect objects.
+const IndirectContentPrefix = "x"
+
+// compressionSampleSize is the size of the prefix of each chunk compressed to estimate its compressibility.
+const compressionSampleSize = 32 << 10
 
 // Writer allows writing content to the storage and supports automatic deduplication and encryption
 // of written data.
@@ -70,6 +74,9 @@ type objectWriter struct {
 
 	compressor compression.Compressor
 
+	minCompressionSavings int
+	onChunkCompression    func(length int64, compressed bool)
+
 	prefix      content.IDPrefix
 	buffer      gather.WriteBuffer
 	totalLength int64
@@ -184,16 +191,21 @@ func (w *objectWriter) prepareAndWriteContentChunk(chunkID int, data gather.Byte
 	var b gather.WriteBuffer
 	defer b.Close()
 
+	compressor, err := w.chunkCompressor(data)
+	if err != nil {
+		return err
+	}
+
 	// allocate buffer to hold either compressed bytes or the uncompressed
 	comp := content.NoCompression
-	objectComp := w.compressor
+	objectComp := compressor
 
 	// in super rare cases this may be stale, but if it is it will be false which is always safe.
 	supportsContentCompression := w.om.contentMgr.SupportsContentCompression()
 
 	// do not compress in this layer, instead pass comp to the content manager.
-	if supportsContentCompression && w.compressor != nil {
-		comp = w.compressor.HeaderID()
+	if supportsContentCompression && compressor != nil {
+		comp = compressor.HeaderID()
 		objectComp = nil
 	}
 
@@ -216,6 +228,43 @@ func (w *objectWriter) prepareAndWriteContentChunk(chunkID int, data gather.Byte
 	return nil
 }
 
+// chunkCompressor returns the compressor to be used for the provided chunk. When compressibility is detected
+// automatically, a prefix of the chunk is compressed first and the chunk is stored uncompressed
+// unless the prefix shrinks by at least minCompressionSavings percent.
+func (w *objectWriter) chunkCompressor(data gather.Bytes) (compression.Compressor, error) {
+	if w.compressor == nil || w.minCompressionSavings <= 0 {
+		return w.compressor, nil
+	}
+
+	compressible, err := isCompressible(w.compressor, data, w.minCompressionSavings)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.onChunkCompression != nil {
+		w.onChunkCompression(int64(data.Length()), compressible)
+	}
+
+	if !compressible {
+		return nil, nil
+	}
+
+	return w.compressor, nil
+}
+
+func isCompressible(comp compression.Compressor, data gather.Bytes, minSavingsPercent int) (bool, error) {
+	var sample gather.WriteBuffer
+	defer sample.Close()
+
+	n := int64(min(data.Length(), compressionSampleSize))
+
+	if err := comp.Compress(&sample, io.LimitReader(data.Reader(), n)); err != nil {
+		return false, errors.Wrap(err, "sample compression error")
+	}
+
+	return int64(sample.Length())*100 <= n*int64(100-minSavingsPercent), nil //nolint:mnd
+}
+
 func (w *objectWriter) saveError(err error) error {
 	if err != nil {
 		// store write error so that we fail at Result() later.
@@ -302,12 +351,12 @@ func (w *objectWriter) checkpointLocked() (ID, error) {
 
 	if iw.prefix == "" {
 		// force a prefix for indirect contents to make sure they get packaged into metadata (q) blobs.
-		iw.prefix = indirectContentPrefix
+		iw.prefix = IndirectContentPrefix
 	}
 
 	defer iw.Close() //nolint:errcheck
 
-	if err := writeIndirectObject(iw, w.indirectIndex); err != nil {
+	if err := WriteIndirectObject(iw, w.indirectIndex); err != nil {
 		return EmptyID, err
 	}
 
@@ -319,7 +368,8 @@ func (w *objectWriter) checkpointLocked() (ID, error) {
 	return IndirectObjectID(oid), nil
 }
 
-func writeIndirectObject(w io.Writer, entries []IndirectObjectEntry) error {
+// WriteIndirectObject writes the stream of an index object consisting of the provided entries.
+func WriteIndirectObject(w io.Writer, entries []IndirectObjectEntry) error {
 	ind := indirectObject{
 		StreamID: "kopia:indirect",
 		Entries:  entries,
@@ -339,4 +389,11 @@ type WriterOptions struct {
 	Compressor  compression.Name
 	Splitter    string // use particular splitter instead of default
 	AsyncWrites int    // allow up to N content writes to be asynchronous
+
+	// MinCompressionSavings enables automatic detection of compressibility when positive, chunks whose sample
+	// does not shrink by at least this percentage when compressed are stored uncompressed.
+	MinCompressionSavings int
+
+	// OnChunkCompression is invoked for each chunk when compressibility is detected automatically.
+	OnChunkCompression func(length int64, compressed bool)
 }
@@ -20,7 +20,9 @@
 	"github.com/kopia/kopia/internal/retry"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/blob/beforeop"
+	"github.com/kopia/kopia/repo/blob/faultinject"
 	loggingwrapper "github.com/kopia/kopia/repo/blob/logging"
+	"github.com/kopia/kopia/repo/blob/quota"
 	"github.com/kopia/kopia/repo/blob/readonly"
 	"github.com/kopia/kopia/repo/blob/storagemetrics"
 	"github.com/kopia/kopia/repo/blob/throttling"
@@ -46,6 +48,10 @@
 var supportedFeatures = []feature.Feature{
 	"index-v1",
 	"index-v2",
+	content.ZstdDictionaryFeature,
+	format.EncryptionKeyRingFeature,
+	format.AsymmetricEncryptionFeature,
+	BlobListJournalFeature,
 }
 
 // throttlingWindow is the duration window during which the throttling token bucket fully replenishes.
@@ -58,6 +64,9 @@
 // localCacheIntegrityHMACSecretLength length of HMAC secret protecting local cache items.
 const localCacheIntegrityHMACSecretLength = 16
 
+// quotaUsageCacheFile is the name of the file in the cache directory where storage usage is cached.
+const quotaUsageCacheFile = "quota-usage.json"
+
 //nolint:gochecknoglobals
 var localCacheIntegrityPurpose = []byte("local-cache-integrity")
 
@@ -211,12 +220,32 @@ func openDirect(ctx context.Context, configFile string, lc *LocalConfig, passwor
 		return nil, errors.Wrap(err, "cannot open storage")
 	}
 
+	if lc.FaultProfileFile != "" {
+		fst, ferr := addFaultInjection(ctx, st, lc.FaultProfileFile)
+		if ferr != nil {
+			st.Close(ctx) //nolint:errcheck
+			return nil, ferr
+		}
+
+		st = fst
+	}
+
 	if options.TraceStorage {
 		st = loggingwrapper.NewWrapper(st, log(ctx), "[STORAGE] ")
 	}
 
 	if lc.ReadOnly {
 		st = readonly.NewWrapper(st)
+	} else if lc.StorageQuota != nil && !lc.StorageQuota.IsEmpty() {
+		qopt := quota.Options{
+			RestrictedPrefixes: content.PackBlobIDPrefixes,
+		}
+
+		if lc.Caching != nil && lc.Caching.CacheDirectory != "" {
+			qopt.UsageCacheFile = filepath.Join(lc.Caching.CacheDirectory, quotaUsageCacheFile)
+		}
+
+		st = quota.NewWrapper(st, *lc.StorageQuota, qopt)
 	}
 
 	cliOpts := lc.ApplyDefaults(ctx, "Repository in "+st.DisplayName())
@@ -230,6 +259,59 @@ func openDirect(ctx context.Context, configFile string, lc *LocalConfig, passwor
 	return r, nil
 }
 
+// localCacheIntegrityHMACSecret derives the secret protecting the integrity of locally cached data.
+func localCacheIntegrityHMACSecret(fmgr *format.Manager) []byte {
+	if fmgr.SupportsPasswordChange() {
+		return crypto.DeriveKeyFromMasterKey(fmgr.GetHmacSecret(), fmgr.UniqueID(), localCacheIntegrityPurpose, localCacheIntegrityHMACSecretLength)
+	}
+
+	// deriving from ufb.FormatEncryptionKey was actually a bug, that only matters will change when we change the password
+	return crypto.DeriveKeyFromMasterKey(fmgr.FormatEncryptionKey(), fmgr.UniqueID(), localCacheIntegrityPurpose, localCacheIntegrityHMACSecretLength)
+}
+
+// underlyingStorageWrapper is implemented by storage wrappers that allow adding another wrapper below them,
+// such as the retry loop of storage providers.
+type underlyingStorageWrapper interface {
+	WrapUnderlying(wrap func(st blob.Storage) blob.Storage) blob.Storage
+}
+
+// addFaultInjection wraps the storage with fault injection described by the provided profile.
+// Faults are injected below the retry loop of storage providers, so injected errors are retried
+// the same way as provider errors, which allows drills to exercise retry settings.
+func addFaultInjection(ctx context.Context, st blob.Storage, profileFile string) (blob.Storage, error) {
+	p, err := faultinject.LoadProfile(profileFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load fault profile")
+	}
+
+	var wrapErr error
+
+	wrap := func(st blob.Storage) blob.Storage {
+		fst, err := faultinject.NewWrapper(st, p)
+		if err != nil {
+			wrapErr = err
+			return st
+		}
+
+		return fst
+	}
+
+	if w, ok := st.(underlyingStorageWrapper); ok {
+		st = w.WrapUnderlying(wrap)
+	} else {
+		// providers without retry loop, such as filesystem, retry internally below the blob.Storage interface.
+		st = wrap(st)
+	}
+
+	if wrapErr != nil {
+		return nil, errors.Wrap(wrapErr, "unable to add fault injection")
+	}
+
+	log(ctx).Warnf("Injecting storage faults described in %v.", profileFile)
+
+	return st, nil
+}
+
 // openWithConfig opens the repository with a given configuration, avoiding the need for a config file.
 //
 //nolint:funlen,gocyclo
@@ -254,13 +336,12 @@ func openWithConfig(ctx context.Context, st blob.Storage, cliOpts ClientOptions,
 		return nil, err
 	}
 
-	if fmgr.SupportsPasswordChange() {
-		cacheOpts.HMACSecret = crypto.DeriveKeyFromMasterKey(fmgr.GetHmacSecret(), fmgr.UniqueID(), localCacheIntegrityPurpose, localCacheIntegrityHMACSecretLength)
-	} else {
-		// deriving from ufb.FormatEncryptionKey was actually a bug, that only matters will change when we change the password
-		cacheOpts.HMACSecret = crypto.DeriveKeyFromMasterKey(fmgr.FormatEncryptionKey(), fmgr.UniqueID(), localCacheIntegrityPurpose, localCacheIntegrityHMACSecretLength)
+	if err := setupAsymmetricEncryption(fmgr, cliOpts); err != nil {
+		return nil, err
 	}
 
+	cacheOpts.HMACSecret = localCacheIntegrityHMACSecret(fmgr)
+
 	limits := throttlingLimitsFromConnectionInfo(ctx, st.ConnectionInfo())
 	if cliOpts.Throttling != nil {
 		limits = *cliOpts.Throttling
@@ -313,11 +394,34 @@ func openWithConfig(ctx context.Context, st blob.Storage, cliOpts ClientOptions,
 		return nil, err
 	}
 
+	converted, err := completeFormatConversion(ctx, fmgr, st, options.UpgradeOwnerID)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to complete format conversion")
+	}
+
+	if converted {
+		// contents must be read using the new format from now on.
+		if fmgr, err = format.NewManager(ctx, st, cacheOpts.CacheDirectory, cliOpts.FormatBlobCacheDuration, password, cmOpts.TimeNow); err != nil {
+			return nil, errors.Wrap(err, "unable to create format manager")
+		}
+
+		if err := setupAsymmetricEncryption(fmgr, cliOpts); err != nil {
+			return nil, err
+		}
+
+		cacheOpts.HMACSecret = localCacheIntegrityHMACSecret(fmgr)
+	}
+
 	if !cliOpts.PermissiveCacheLoading {
 		// background/interleaving upgrade lock storage monitor
 		st = upgradeLockMonitor(fmgr, options.UpgradeOwnerID, st, cmOpts.TimeNow, options.OnFatalError, options.TestOnlyIgnoreMissingRequiredFeatures)
 	}
 
+	st, err = maybeAddBlobListJournal(ctx, st, fmgr, cacheOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to add blob list journal")
+	}
+
 	dw := repodiag.NewWriter(st, fmgr)
 	logManager := repodiag.NewLogManager(ctx, dw)
 
@@ -336,7 +440,7 @@ func openWithConfig(ctx context.Context, st blob.Storage, cliOpts ClientOptions,
 		return nil, errors.Wrap(ferr, "unable to open object manager")
 	}
 
-	manifests, ferr := manifest.NewManager(ctx, cm, manifest.ManagerOptions{TimeNow: cmOpts.TimeNow}, mr)
+	manifests, ferr := manifest.NewManager(ctx, cm, manifest.ManagerOptions{TimeNow: cmOpts.TimeNow, WriteOnly: cliOpts.WriteOnly}, mr)
 	if ferr != nil {
 		return nil, errors.Wrap(ferr, "unable to open manifests")
 	}
@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/pem"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/format"
+)
+
+const (
+	privateKeyFileMode = 0o600
+	privateKeyPEMType  = "KOPIA REPOSITORY PRIVATE KEY"
+)
+
+// WritePrivateKeyFile writes the private key of a repository using asymmetric encryption to a new file,
+// failing if the file already exists.
+func WritePrivateKeyFile(fname string, privateKey []byte) error {
+	var b bytes.Buffer
+
+	if err := pem.Encode(&b, &pem.Block{Type: privateKeyPEMType, Bytes: privateKey}); err != nil {
+		return errors.Wrap(err, "unable to encode private key")
+	}
+
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, privateKeyFileMode) //nolint:gosec
+	if err != nil {
+		return errors.Wrap(err, "error creating private key file")
+	}
+
+	if _, err := f.Write(b.Bytes()); err != nil {
+		f.Close() //nolint:errcheck
+		return errors.Wrap(err, "error writing private key file")
+	}
+
+	return errors.Wrap(f.Close(), "error closing private key file")
+}
+
+// ReadPrivateKeyFile reads the private key of a repository using asymmetric encryption from a file.
+func ReadPrivateKeyFile(fname string) ([]byte, error) {
+	b, err := os.ReadFile(fname) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading private key file")
+	}
+
+	blk, _ := pem.Decode(b)
+	if blk == nil || blk.Type != privateKeyPEMType {
+		return nil, errors.Errorf("%v does not contain a repository private key", fname)
+	}
+
+	return blk.Bytes, nil
+}
+
+// setupAsymmetricEncryption validates client options against the repository format and loads
+// the private key, if one is configured.
+func setupAsymmetricEncryption(fmgr *format.Manager, cliOpts ClientOptions) error {
+	if len(fmgr.PublicKey()) == 0 {
+		if cliOpts.WriteOnly || cliOpts.PrivateKeyFile != "" {
+			return errors.Errorf("repository does not use asymmetric encryption")
+		}
+
+		return nil
+	}
+
+	if cliOpts.WriteOnly {
+		if cliOpts.PrivateKeyFile != "" {
+			return errors.Errorf("write-only clients can't use a private key")
+		}
+
+		return nil
+	}
+
+	if cliOpts.PrivateKeyFile == "" {
+		return errors.Errorf("repository uses asymmetric encryption, connect with a private key file or as a write-only client")
+	}
+
+	privateKey, err := ReadPrivateKeyFile(cliOpts.PrivateKeyFile)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(fmgr.SetPrivateKey(privateKey), "invalid private key")
+}
@@ -0,0 +1,165 @@
+package repo_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/encryption"
+	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/repo/maintenance"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/repo/object"
+)
+
+func TestWriteOnlyClient(t *testing.T) {
+	ctx := testlogging.Context(t)
+	st := repotesting.NewReconnectableStorage(t, blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil))
+	pass := repotesting.DefaultPasswordForTesting
+
+	publicKey, privateKey, err := encryption.NewSealedBoxKeyPair()
+	require.NoError(t, err)
+
+	privateKeyFile := filepath.Join(testutil.TempDirectory(t), "private.key")
+	require.NoError(t, repo.WritePrivateKeyFile(privateKeyFile, privateKey))
+	require.Error(t, repo.WritePrivateKeyFile(privateKeyFile, privateKey), "existing key must not be overwritten")
+
+	require.NoError(t, repo.Initialize(ctx, st, &repo.NewRepositoryOptions{
+		BlockFormat: format.ContentFormat{
+			PublicKey: publicKey,
+		},
+	}, pass))
+
+	connect := func(opt repo.ClientOptions) (repo.Repository, error) {
+		configFile := filepath.Join(testutil.TempDirectory(t), "kopia.config")
+
+		if err := repo.Connect(ctx, configFile, st, pass, &repo.ConnectOptions{
+			ClientOptions:  opt,
+			CachingOptions: content.CachingOptions{CacheDirectory: testutil.TempDirectory(t)},
+		}); err != nil {
+			return nil, err
+		}
+
+		r, err := repo.Open(ctx, configFile, pass, nil)
+		if err == nil {
+			t.Cleanup(func() { r.Close(ctx) })
+		}
+
+		return r, err
+	}
+
+	_, err = connect(repo.ClientOptions{})
+	require.ErrorContains(t, err, "asymmetric encryption")
+
+	_, otherPrivateKey, err := encryption.NewSealedBoxKeyPair()
+	require.NoError(t, err)
+
+	otherPrivateKeyFile := filepath.Join(testutil.TempDirectory(t), "other.key")
+	require.NoError(t, repo.WritePrivateKeyFile(otherPrivateKeyFile, otherPrivateKey))
+
+	_, err = connect(repo.ClientOptions{PrivateKeyFile: otherPrivateKeyFile})
+	require.ErrorContains(t, err, "does not match")
+
+	writeOnly, err := connect(repo.ClientOptions{WriteOnly: true})
+	require.NoError(t, err)
+
+	full, err := connect(repo.ClientOptions{PrivateKeyFile: privateKeyFile})
+	require.NoError(t, err)
+
+	// older clients must not open the repository, they would write contents which are not sealed.
+	features, err := full.(repo.DirectRepository).FormatManager().RequiredFeatures(ctx)
+	require.NoError(t, err)
+	require.Len(t, features, 1)
+	require.Equal(t, format.AsymmetricEncryptionFeature, features[0].Feature)
+
+	labels := map[string]string{"type": "test"}
+
+	var (
+		fullOID, writeOnlyOID object.ID
+		fullMID, writeOnlyMID manifest.ID
+	)
+
+	writeObjectAndManifest := func(r repo.Repository, data string, oid *object.ID, mid *manifest.ID) {
+		require.NoError(t, repo.WriteSession(ctx, r, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+			ow := w.NewObjectWriter(ctx, object.WriterOptions{})
+			io.WriteString(ow, data)
+
+			var err error
+
+			if *oid, err = ow.Result(); err != nil {
+				return err
+			}
+
+			*mid, err = w.PutManifest(ctx, labels, map[string]string{"data": data})
+
+			return err
+		}))
+	}
+
+	writeObjectAndManifest(full, "written by full client", &fullOID, &fullMID)
+	writeObjectAndManifest(writeOnly, "written by write-only client", &writeOnlyOID, &writeOnlyMID)
+
+	// identical contents are deduplicated by the write-only client.
+	var dupOID object.ID
+
+	writeObjectAndManifest(writeOnly, "written by full client", &dupOID, new(manifest.ID))
+	require.Equal(t, fullOID, dupOID)
+
+	// the write-only client can't read any contents, including its own.
+	_, err = writeOnly.OpenObject(ctx, writeOnlyOID)
+	require.ErrorIs(t, err, encryption.ErrWriteOnly)
+
+	// manifests written by other clients are not visible.
+	require.NoError(t, writeOnly.Refresh(ctx))
+
+	entries, err := writeOnly.FindManifests(ctx, labels)
+	require.NoError(t, err)
+
+	for _, e := range entries {
+		require.NotEqual(t, fullMID, e.ID)
+	}
+
+	// the client holding the private key can read everything.
+	require.NoError(t, full.Refresh(ctx))
+	mustReadObjectString(t, full, fullOID, "written by full client")
+	mustReadObjectString(t, full, writeOnlyOID, "written by write-only client")
+
+	var got map[string]string
+
+	_, err = full.GetManifest(ctx, writeOnlyMID, &got)
+	require.NoError(t, err)
+	require.Equal(t, "written by write-only client", got["data"])
+
+	entries, err = full.FindManifests(ctx, labels)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	// maintenance requires the private key.
+	require.ErrorContains(t, repo.DirectWriteSession(ctx, writeOnly.(repo.DirectRepository), repo.WriteSessionOptions{}, func(ctx context.Context, w repo.DirectRepositoryWriter) error {
+		return maintenance.RunExclusive(ctx, w, maintenance.ModeQuick, true, func(context.Context, maintenance.RunParameters) error {
+			return nil
+		})
+	}), "write-only")
+}
+
+func mustReadObjectString(t *testing.T, r repo.Repository, oid object.ID, want string) {
+	t.Helper()
+
+	or, err := r.OpenObject(testlogging.Context(t), oid)
+	require.NoError(t, err)
+
+	defer or.Close()
+
+	b, err := io.ReadAll(or)
+	require.NoError(t, err)
+	require.Equal(t, want, string(b))
+}
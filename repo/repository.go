@@ -280,7 +280,8 @@ func (r *directRepository) NewDirectWriter(ctx context.Context, opt WriteSession
 	}, writeManagerID)
 
 	mmgr, err := manifest.NewManager(ctx, cmgr, manifest.ManagerOptions{
-		TimeNow: r.timeNow,
+		TimeNow:   r.timeNow,
+		WriteOnly: r.cliOpts.WriteOnly,
 	}, r.metricsRegistry)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "error creating manifest manager")
@@ -0,0 +1,143 @@
+package splitter
+
+import (
+	"math/bits"
+)
+
+// FastCDC normalization level, chunks shorter than the normal size use a mask with
+// fastCDCNormalization more bits and longer chunks a mask with fastCDCNormalization fewer bits.
+const fastCDCNormalization = 2
+
+// fastCDCGearSeed is the seed of the gear table. Changing it changes all chunk boundaries.
+const fastCDCGearSeed = 0x6b6f706961666364
+
+//nolint:gochecknoglobals
+var fastCDCGear = newFastCDCGearTable(fastCDCGearSeed)
+
+// newFastCDCGearTable returns the table of random values used by the gear hash, generated using splitmix64.
+func newFastCDCGearTable(seed uint64) [256]uint64 {
+	var t [256]uint64
+
+	x := seed
+
+	for i := range t {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9 //nolint:mnd
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb //nolint:mnd
+		t[i] = z ^ (z >> 31)                     //nolint:mnd
+	}
+
+	return t
+}
+
+// fastCDCSplitter implements FastCDC content-defined chunking with normalized chunking.
+// The gear hash is reset at the beginning of each chunk and the first minSize bytes are skipped,
+// so chunk boundaries only depend on the contents of the chunk.
+type fastCDCSplitter struct {
+	hash  uint64
+	count int
+
+	minSize    int
+	normalSize int
+	maxSize    int
+
+	// the gear hash mixes each byte into the most significant bits last, so masks select the top bits.
+	maskS uint64 // harder to match, used below normal size
+	maskL uint64 // easier to match, used above normal size
+}
+
+func (rs *fastCDCSplitter) Close() {
+}
+
+func (rs *fastCDCSplitter) Reset() {
+	rs.hash = 0
+	rs.count = 0
+}
+
+func (rs *fastCDCSplitter) NextSplitPoint(b []byte) int {
+	var consumed int
+
+	// until minSize, skip bytes without hashing them
+	if left := rs.minSize - rs.count; left > 0 {
+		n := min(left, len(b))
+
+		rs.count += n
+		consumed += n
+		b = b[n:]
+	}
+
+	// until normal size, use the harder mask
+	if left := rs.normalSize - rs.count; left > 0 {
+		n := min(left, len(b))
+
+		if i := rs.roll(b[:n], rs.maskS); i >= 0 {
+			return consumed + i + 1
+		}
+
+		consumed += n
+		b = b[n:]
+	}
+
+	// until max size, use the easier mask
+	if left := rs.maxSize - rs.count; left > 0 {
+		n := min(left, len(b))
+
+		if i := rs.roll(b[:n], rs.maskL); i >= 0 {
+			return consumed + i + 1
+		}
+
+		consumed += n
+	}
+
+	// if we're over the max size, split
+	if rs.count >= rs.maxSize {
+		rs.Reset()
+		return consumed
+	}
+
+	return -1
+}
+
+// roll adds the provided bytes to the hash and returns the index of the byte after which the chunk ends
+// or -1 if all bytes have been consumed without finding a split point.
+func (rs *fastCDCSplitter) roll(b []byte, mask uint64) int {
+	h := rs.hash
+
+	for i, c := range b {
+		h = (h << 1) + fastCDCGear[c]
+
+		if h&mask == 0 {
+			rs.Reset()
+			return i
+		}
+	}
+
+	rs.hash = h
+	rs.count += len(b)
+
+	return -1
+}
+
+func (rs *fastCDCSplitter) MaxSegmentSize() int {
+	return rs.maxSize
+}
+
+func newFastCDCSplitterFactory(avgSize int) Factory {
+	// avgSize must be a power of two
+	avgBits := bits.TrailingZeros(uint(avgSize))
+	minSize, maxSize := avgSize/4, avgSize*2 //nolint:mnd
+
+	maskS := ^uint64(0) << (64 - avgBits - fastCDCNormalization) //nolint:mnd
+	maskL := ^uint64(0) << (64 - avgBits + fastCDCNormalization) //nolint:mnd
+
+	return func() Splitter {
+		return &fastCDCSplitter{
+			minSize:    minSize,
+			normalSize: avgSize,
+			maxSize:    maxSize,
+			maskS:      maskS,
+			maskL:      maskL,
+		}
+	}
+}
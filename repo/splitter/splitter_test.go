@@ -1,11 +1,17 @@
 package splitter
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"math"
 	"math/rand"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/kopia/kopia/internal/testutil"
 )
 
@@ -37,6 +43,10 @@ func TestSplitterStability(t *testing.T) {
 		{newRabinKarp64SplitterFactory(2048), 1887, 2649, 1028, 4096},
 		{newRabinKarp64SplitterFactory(32768), 121, 41322, 16896, 65536},
 		{newRabinKarp64SplitterFactory(65536), 53, 94339, 35875, 131072},
+		{newFastCDCSplitterFactory(32), 137209, 36, 9, 64},
+		{newFastCDCSplitterFactory(1024), 4275, 1169, 258, 2048},
+		{newFastCDCSplitterFactory(2048), 2156, 2319, 514, 4096},
+		{newFastCDCSplitterFactory(32768), 136, 36764, 8767, 65536},
 
 		{pooled(Fixed(1000)), 5000, 1000, 1000, 1000},
 
@@ -50,6 +60,10 @@ func TestSplitterStability(t *testing.T) {
 		{pooled(newRabinKarp64SplitterFactory(2048)), 1887, 2649, 1028, 4096},
 		{pooled(newRabinKarp64SplitterFactory(32768)), 121, 41322, 16896, 65536},
 		{pooled(newRabinKarp64SplitterFactory(65536)), 53, 94339, 35875, 131072},
+		{pooled(newFastCDCSplitterFactory(32)), 137209, 36, 9, 64},
+		{pooled(newFastCDCSplitterFactory(1024)), 4275, 1169, 258, 2048},
+		{pooled(newFastCDCSplitterFactory(2048)), 2156, 2319, 514, 4096},
+		{pooled(newFastCDCSplitterFactory(32768)), 136, 36764, 8767, 65536},
 	}
 
 	// run each test twice to rule out the possibility of some state leaking through splitter reuse
@@ -115,6 +129,74 @@ func TestSplitterStability(t *testing.T) {
 	}
 }
 
+// TestFastCDCBoundaries pins chunk boundaries of registered FastCDC splitters, which must never change,
+// since that would prevent deduplication against data written by previous releases.
+func TestFastCDCBoundaries(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	rnd := make([]byte, 32<<20)
+
+	if n, err := r.Read(rnd); n != len(rnd) || err != nil {
+		t.Fatalf("can't initialize random data: %v", err)
+	}
+
+	cases := map[string]struct {
+		count  int
+		first  []int
+		digest string // first 8 bytes of SHA-256 of all boundary offsets
+	}{
+		"DYNAMIC-128K-FASTCDC": {229, []int{142867, 213739, 384317}, "b9ee1d079306472c"},
+		"DYNAMIC-256K-FASTCDC": {108, []int{213739, 512552, 893930}, "429cca876290b5d2"},
+		"DYNAMIC-512K-FASTCDC": {57, []int{213739, 745885, 1304022}, "253a196667792e93"},
+		"DYNAMIC-1M-FASTCDC":   {27, []int{1078651, 2317849, 3488820}, "e407c5711f636236"},
+		"DYNAMIC-2M-FASTCDC":   {14, []int{2317849, 4521206, 7376856}, "60316295b2f0d3b2"},
+		"DYNAMIC-4M-FASTCDC":   {6, []int{4521206, 12001386, 16471895}, "661ede73531e1ef4"},
+		"DYNAMIC-8M-FASTCDC":   {3, []int{12001386, 20953304, 33421132}, "eb4921d10975a073"},
+	}
+
+	for _, name := range SupportedAlgorithms() {
+		if strings.HasSuffix(name, "-FASTCDC") {
+			require.Contains(t, cases, name, "boundaries of %v must be pinned", name)
+		}
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			s := GetFactory(name)()
+			defer s.Close()
+
+			var (
+				boundaries []int
+				offset     int
+			)
+
+			h := sha256.New()
+
+			for data := rnd; len(data) > 0; {
+				n := s.NextSplitPoint(data)
+				if n < 0 {
+					break
+				}
+
+				offset += n
+				boundaries = append(boundaries, offset)
+
+				var b [8]byte
+
+				binary.BigEndian.PutUint64(b[:], uint64(offset))
+				h.Write(b[:])
+
+				data = data[n:]
+			}
+
+			require.Len(t, boundaries, tc.count)
+			require.Equal(t, tc.first, boundaries[:len(tc.first)])
+			require.Equal(t, tc.digest, hex.EncodeToString(h.Sum(nil)[:8]))
+		})
+	}
+}
+
 func getSplitPoints(data []byte, s Splitter) (minSplit, maxSplit, count int) {
 	maxSplit = 0
 	minSplit = int(math.MaxInt32)
@@ -0,0 +1,444 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+)
+
+const (
+	signingKeyFileMode = 0o600
+	signingKeyPEMType  = "KOPIA SNAPSHOT SIGNING KEY"
+
+	signingKeyFingerprintLength = 8
+
+	// chainSequenceKey is the label holding the chain sequence number of chained snapshot manifests,
+	// which allows the predecessor to be found without loading all manifests of the source.
+	chainSequenceKey = "chainSequence"
+)
+
+// ChainLink links a snapshot manifest to its predecessor for the same source, making modifications,
+// deletions and reordering of snapshot history evident. Snapshots are linked and signed only by clients
+// with a snapshot signing key configured.
+//
+// The chain can't reveal deletion of the newest snapshots of a source, since nothing links to them.
+// A signature only proves possession of the signing key, the signer name is asserted by the client
+// itself and can only be trusted when the key is known to belong to it.
+type ChainLink struct {
+	// Sequence is the position of the snapshot in the chain, starting at 1.
+	Sequence int64 `json:"seq"`
+
+	// Previous is the hash of the predecessor, empty for the first snapshot.
+	Previous string `json:"prev,omitempty"`
+
+	// Hash covers the fields of the manifest that identify the snapshot and its position in the chain.
+	Hash string `json:"hash"`
+
+	// ContentHash covers the root entry and statistics of the snapshot, which may be legitimately rewritten
+	// (for example by 'snapshot fix' or format conversion), together with Hash and the signer.
+	ContentHash string `json:"contentHash"`
+
+	Signer    string `json:"signer,omitempty"`
+	SignerKey []byte `json:"signerKey,omitempty"`
+
+	// Signature is the signature of ContentHash.
+	Signature []byte `json:"sig,omitempty"`
+}
+
+// linkedFields contains the fields of the manifest covered by the chain hash. Description, tags and pins
+// are left out, since they can be changed after the snapshot has been created.
+type linkedFields struct {
+	Source           SourceInfo      `json:"source"`
+	StartTime        fs.UTCTimestamp `json:"startTime"`
+	EndTime          fs.UTCTimestamp `json:"endTime"`
+	IncompleteReason string          `json:"incomplete,omitempty"`
+
+	Sequence int64  `json:"seq"`
+	Previous string `json:"prev,omitempty"`
+}
+
+// contentFields contains the fields of the manifest covered by the content hash.
+type contentFields struct {
+	Stats     *Stats    `json:"stats"`
+	RootEntry *DirEntry `json:"rootEntry"`
+
+	Hash      string `json:"hash"`
+	Signer    string `json:"signer,omitempty"`
+	SignerKey []byte `json:"signerKey,omitempty"`
+}
+
+func computeChainHash(m *Manifest) (string, error) {
+	return hashOf(linkedFields{
+		Source:           m.Source,
+		StartTime:        m.StartTime,
+		EndTime:          m.EndTime,
+		IncompleteReason: m.IncompleteReason,
+		Sequence:         m.Chain.Sequence,
+		Previous:         m.Chain.Previous,
+	})
+}
+
+func computeContentHash(m *Manifest) (string, error) {
+	return hashOf(contentFields{
+		Stats:     &m.Stats,
+		RootEntry: m.RootEntry,
+		Hash:      m.Chain.Hash,
+		Signer:    m.Chain.Signer,
+		SignerKey: m.Chain.SignerKey,
+	})
+}
+
+func hashOf(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to marshal manifest")
+	}
+
+	h := sha256.Sum256(b)
+
+	return hex.EncodeToString(h[:]), nil
+}
+
+// addChainLink links the provided manifest to the latest chained snapshot of the same source and signs it
+// using the signing key of the client.
+func addChainLink(ctx context.Context, rep repo.Repository, man *Manifest) error {
+	entries, err := rep.FindManifests(ctx, sourceInfoToLabels(man.Source))
+	if err != nil {
+		return errors.Wrap(err, "unable to find previous snapshots")
+	}
+
+	var latest manifest.ID
+
+	link := &ChainLink{Sequence: 1}
+
+	for _, e := range entries {
+		seq, err := strconv.ParseInt(e.Labels[chainSequenceKey], 10, 64)
+		if err != nil {
+			// not chained.
+			continue
+		}
+
+		if seq >= link.Sequence {
+			link.Sequence = seq + 1
+			latest = e.ID
+		}
+	}
+
+	if latest != "" {
+		p, err := LoadSnapshot(ctx, rep, latest)
+		if err != nil {
+			return errors.Wrap(err, "unable to load previous snapshot")
+		}
+
+		if p.Chain == nil {
+			return errors.Errorf("previous snapshot %v is not chained", latest)
+		}
+
+		link.Previous = p.Chain.Hash
+	}
+
+	loaded, err := asLoaded(man)
+	if err != nil {
+		return err
+	}
+
+	loaded.Chain = link
+
+	if link.Hash, err = computeChainHash(loaded); err != nil {
+		return err
+	}
+
+	if err := signChainContent(rep, loaded); err != nil {
+		return err
+	}
+
+	man.Chain = link
+
+	return nil
+}
+
+// UpdateChainContent updates the content hash of a chained snapshot after its root entry or statistics
+// have been rewritten, without changing its position in the chain. When the content has changed,
+// the snapshot is signed again using the signing key of the client, if one is configured, so the rewritten
+// snapshot is attributed to the client which has rewritten it. It is called by SaveSnapshot() and must
+// be called before snapshots are saved by other means.
+func UpdateChainContent(rep repo.Repository, man *Manifest) error {
+	if man.Chain == nil {
+		return nil
+	}
+
+	loaded, err := asLoaded(man)
+	if err != nil {
+		return err
+	}
+
+	h, err := computeContentHash(loaded)
+	if err != nil {
+		return err
+	}
+
+	if h == man.Chain.ContentHash {
+		return nil
+	}
+
+	link := *man.Chain
+	loaded.Chain = &link
+
+	if err := signChainContent(rep, loaded); err != nil {
+		return err
+	}
+
+	man.Chain = &link
+
+	return nil
+}
+
+// signChainContent computes the content hash of the provided manifest and signs it using the signing key
+// of the client, if one is configured.
+func signChainContent(rep repo.Repository, m *Manifest) error {
+	link := m.Chain
+
+	link.Signer = ""
+	link.SignerKey = nil
+	link.Signature = nil
+
+	var signingKey ed25519.PrivateKey
+
+	if fname := rep.ClientOptions().SnapshotSigningKeyFile; fname != "" {
+		k, err := ReadSigningKeyFile(fname)
+		if err != nil {
+			return err
+		}
+
+		signingKey = k
+		link.Signer = rep.ClientOptions().UsernameAtHost()
+		link.SignerKey = signingKey.Public().(ed25519.PublicKey) //nolint:forcetypeassert
+	}
+
+	h, err := computeContentHash(m)
+	if err != nil {
+		return err
+	}
+
+	link.ContentHash = h
+
+	if signingKey != nil {
+		link.Signature = ed25519.Sign(signingKey, []byte(link.ContentHash))
+	}
+
+	return nil
+}
+
+// asLoaded returns the copy of the manifest as it will be loaded, which may differ in representation
+// from the one being saved, so that hashes computed when saving and verifying match.
+func asLoaded(man *Manifest) (*Manifest, error) {
+	var loaded Manifest
+
+	b, err := json.Marshal(man)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal manifest")
+	}
+
+	if err := json.Unmarshal(b, &loaded); err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal manifest")
+	}
+
+	return &loaded, nil
+}
+
+// ChainStatus describes the result of verification of a snapshot in the chain.
+type ChainStatus string
+
+// Supported chain statuses.
+const (
+	ChainStatusOK                 ChainStatus = "ok"                  // snapshot and its link to the predecessor are intact
+	ChainStatusNotChained         ChainStatus = "not-chained"         // snapshot was created without a chain link
+	ChainStatusModified           ChainStatus = "modified"            // snapshot does not match its hash
+	ChainStatusInvalidSignature   ChainStatus = "invalid-signature"   // signature does not match the hash
+	ChainStatusBrokenLink         ChainStatus = "broken-link"         // predecessor does not match the link
+	ChainStatusReordered          ChainStatus = "reordered"           // link points to a snapshot at a different position
+	ChainStatusMissingPredecessor ChainStatus = "missing-predecessor" // predecessor has been deleted
+)
+
+// ChainEntry is the result of verification of a single snapshot in the chain.
+type ChainEntry struct {
+	Manifest *Manifest
+	Status   ChainStatus
+
+	// Missing is the number of deleted snapshots immediately preceding this one.
+	Missing int64
+}
+
+// Signed returns true if the snapshot has been signed.
+func (e *ChainEntry) Signed() bool {
+	return e.Manifest.Chain != nil && len(e.Manifest.Chain.Signature) > 0
+}
+
+// VerifyChain verifies the hash chain of snapshots of the provided source, returning the status of each snapshot
+// ordered by the position in the chain, followed by snapshots which are not chained.
+//
+// Deletion of the newest snapshots of the source is not detected, callers which need to detect it must
+// compare the latest sequence number with one recorded elsewhere.
+func VerifyChain(ctx context.Context, rep repo.Repository, si SourceInfo) ([]*ChainEntry, error) {
+	manifests, err := ListSnapshots(ctx, rep, si)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		chained, notChained []*ChainEntry
+		bySequence          = map[int64][]*Manifest{}
+		byHash              = map[string]*Manifest{}
+	)
+
+	for _, m := range manifests {
+		if m.Chain == nil {
+			notChained = append(notChained, &ChainEntry{Manifest: m, Status: ChainStatusNotChained})
+			continue
+		}
+
+		chained = append(chained, &ChainEntry{Manifest: m})
+		bySequence[m.Chain.Sequence] = append(bySequence[m.Chain.Sequence], m)
+		byHash[m.Chain.Hash] = m
+	}
+
+	sort.Slice(chained, func(i, j int) bool {
+		a, b := chained[i].Manifest, chained[j].Manifest
+		if a.Chain.Sequence != b.Chain.Sequence {
+			return a.Chain.Sequence < b.Chain.Sequence
+		}
+
+		return a.StartTime < b.StartTime
+	})
+
+	sort.Slice(notChained, func(i, j int) bool {
+		return notChained[i].Manifest.StartTime < notChained[j].Manifest.StartTime
+	})
+
+	for i, e := range chained {
+		e.Status, err = verifyChainEntry(e.Manifest, bySequence, byHash)
+		if err != nil {
+			return nil, err
+		}
+
+		if e.Status == ChainStatusMissingPredecessor {
+			e.Missing = e.Manifest.Chain.Sequence - 1
+
+			if i > 0 {
+				e.Missing -= chained[i-1].Manifest.Chain.Sequence
+			}
+		}
+	}
+
+	return append(chained, notChained...), nil
+}
+
+func verifyChainEntry(m *Manifest, bySequence map[int64][]*Manifest, byHash map[string]*Manifest) (ChainStatus, error) {
+	h, err := computeChainHash(m)
+	if err != nil {
+		return "", err
+	}
+
+	ch, err := computeContentHash(m)
+	if err != nil {
+		return "", err
+	}
+
+	if h != m.Chain.Hash || ch != m.Chain.ContentHash {
+		return ChainStatusModified, nil
+	}
+
+	if len(m.Chain.Signature) > 0 || len(m.Chain.SignerKey) > 0 {
+		if len(m.Chain.SignerKey) != ed25519.PublicKeySize || !ed25519.Verify(m.Chain.SignerKey, []byte(m.Chain.ContentHash), m.Chain.Signature) {
+			return ChainStatusInvalidSignature, nil
+		}
+	}
+
+	if m.Chain.Sequence <= 1 {
+		if m.Chain.Sequence < 1 || m.Chain.Previous != "" {
+			return ChainStatusBrokenLink, nil
+		}
+
+		return ChainStatusOK, nil
+	}
+
+	predecessors := bySequence[m.Chain.Sequence-1]
+
+	for _, p := range predecessors {
+		if p.Chain.Hash == m.Chain.Previous {
+			return ChainStatusOK, nil
+		}
+	}
+
+	if _, ok := byHash[m.Chain.Previous]; ok {
+		return ChainStatusReordered, nil
+	}
+
+	if len(predecessors) > 0 {
+		return ChainStatusBrokenLink, nil
+	}
+
+	return ChainStatusMissingPredecessor, nil
+}
+
+// SigningKeyFingerprint returns the short fingerprint identifying a public signing key.
+func SigningKeyFingerprint(publicKey []byte) string {
+	h := sha256.Sum256(publicKey)
+
+	return hex.EncodeToString(h[:signingKeyFingerprintLength])
+}
+
+// GenerateSigningKeyFile generates a new snapshot signing key, writes it to a new file and returns its public key.
+func GenerateSigningKeyFile(fname string) (ed25519.PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to generate signing key")
+	}
+
+	var b bytes.Buffer
+
+	if err := pem.Encode(&b, &pem.Block{Type: signingKeyPEMType, Bytes: priv.Seed()}); err != nil {
+		return nil, errors.Wrap(err, "unable to encode signing key")
+	}
+
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, signingKeyFileMode) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating signing key file")
+	}
+
+	if _, err := f.Write(b.Bytes()); err != nil {
+		f.Close() //nolint:errcheck
+		return nil, errors.Wrap(err, "error writing signing key file")
+	}
+
+	return pub, errors.Wrap(f.Close(), "error closing signing key file")
+}
+
+// ReadSigningKeyFile reads the snapshot signing key from a file.
+func ReadSigningKeyFile(fname string) (ed25519.PrivateKey, error) {
+	b, err := os.ReadFile(fname) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading signing key file")
+	}
+
+	blk, _ := pem.Decode(b)
+	if blk == nil || blk.Type != signingKeyPEMType || len(blk.Bytes) != ed25519.SeedSize {
+		return nil, errors.Errorf("%v does not contain a snapshot signing key", fname)
+	}
+
+	return ed25519.NewKeyFromSeed(blk.Bytes), nil
+}
@@ -0,0 +1,211 @@
+package snapshot_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestVerifyChain(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	src := snapshot.SourceInfo{Host: "host-1", UserName: "user-1", Path: "/some/path"}
+
+	// snapshots are not chained without a signing key.
+	m0 := &snapshot.Manifest{Source: src}
+	mustSaveSnapshot(t, env.RepositoryWriter, m0)
+	require.Nil(t, m0.Chain)
+	require.NoError(t, env.RepositoryWriter.DeleteManifest(ctx, m0.ID))
+
+	mustConfigureSigningKey(t, env)
+
+	var manifests []*snapshot.Manifest
+
+	for i := range 4 {
+		m := &snapshot.Manifest{
+			Source:    src,
+			StartTime: fs.UTCTimestampFromTime(time.Unix(int64(1000+i), 0)),
+			EndTime:   fs.UTCTimestampFromTime(time.Unix(int64(1001+i), 0)),
+		}
+
+		mustSaveSnapshot(t, env.RepositoryWriter, m)
+
+		require.NotNil(t, m.Chain)
+		require.EqualValues(t, i+1, m.Chain.Sequence)
+
+		if i > 0 {
+			require.Equal(t, manifests[i-1].Chain.Hash, m.Chain.Previous)
+		}
+
+		manifests = append(manifests, m)
+	}
+
+	// incomplete snapshots are not chained.
+	mustSaveSnapshot(t, env.RepositoryWriter, &snapshot.Manifest{Source: src, IncompleteReason: "checkpoint"})
+
+	verifyChainStatuses(t, env.RepositoryWriter, src,
+		snapshot.ChainStatusOK,
+		snapshot.ChainStatusOK,
+		snapshot.ChainStatusOK,
+		snapshot.ChainStatusOK,
+		snapshot.ChainStatusNotChained)
+
+	// descriptions and pins can be changed without breaking the chain.
+	manifests[1].Description = "new description"
+	require.NoError(t, snapshot.UpdateSnapshot(ctx, env.RepositoryWriter, manifests[1]))
+
+	// so can root entries and statistics, which are rewritten by 'snapshot fix' and format conversion.
+	manifests[3].Stats.TotalFileCount++
+	require.NoError(t, snapshot.UpdateSnapshot(ctx, env.RepositoryWriter, manifests[3]))
+
+	verifyChainStatuses(t, env.RepositoryWriter, src,
+		snapshot.ChainStatusOK,
+		snapshot.ChainStatusOK,
+		snapshot.ChainStatusOK,
+		snapshot.ChainStatusOK,
+		snapshot.ChainStatusNotChained)
+
+	// other fields cannot.
+	manifests[2].EndTime = fs.UTCTimestampFromTime(time.Unix(2000, 0))
+	require.NoError(t, snapshot.UpdateSnapshot(ctx, env.RepositoryWriter, manifests[2]))
+
+	// rewriting statistics without updating the content hash is detected.
+	var tampered snapshot.Manifest
+
+	md, err := env.RepositoryWriter.GetManifest(ctx, manifests[3].ID, &tampered)
+	require.NoError(t, err)
+
+	tampered.Stats.TotalFileCount++
+
+	_, err = env.RepositoryWriter.PutManifest(ctx, md.Labels, &tampered)
+	require.NoError(t, err)
+	require.NoError(t, env.RepositoryWriter.DeleteManifest(ctx, manifests[3].ID))
+
+	// deleting a snapshot is detected by its successor.
+	require.NoError(t, env.RepositoryWriter.DeleteManifest(ctx, manifests[0].ID))
+
+	entries := verifyChainStatuses(t, env.RepositoryWriter, src,
+		snapshot.ChainStatusMissingPredecessor,
+		snapshot.ChainStatusModified,
+		snapshot.ChainStatusModified,
+		snapshot.ChainStatusNotChained)
+
+	require.EqualValues(t, 1, entries[0].Missing)
+	require.True(t, entries[0].Signed())
+}
+
+func TestVerifyChain_Signed(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	keyFile := filepath.Join(t.TempDir(), "signing.key")
+
+	pub, err := snapshot.GenerateSigningKeyFile(keyFile)
+	require.NoError(t, err)
+
+	_, err = snapshot.GenerateSigningKeyFile(keyFile)
+	require.Error(t, err, "existing key file must not be overwritten")
+
+	src := snapshot.SourceInfo{Host: "host-1", UserName: "user-1", Path: "/some/path"}
+
+	// snapshot created before the key was configured.
+	mustSaveSnapshot(t, env.RepositoryWriter, &snapshot.Manifest{Source: src})
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	opt := env.RepositoryWriter.ClientOptions()
+	opt.SnapshotSigningKeyFile = keyFile
+
+	require.NoError(t, repo.SetClientOptions(ctx, env.ConfigFile(), opt))
+	env.MustReopen(t)
+
+	m2 := &snapshot.Manifest{Source: src}
+	mustSaveSnapshot(t, env.RepositoryWriter, m2)
+
+	m3 := &snapshot.Manifest{Source: src}
+	mustSaveSnapshot(t, env.RepositoryWriter, m3)
+
+	require.EqualValues(t, 1, m2.Chain.Sequence)
+	require.Equal(t, []byte(pub), m2.Chain.SignerKey)
+	require.Equal(t, opt.UsernameAtHost(), m2.Chain.Signer)
+
+	entries := verifyChainStatuses(t, env.RepositoryWriter, src,
+		snapshot.ChainStatusOK,
+		snapshot.ChainStatusOK,
+		snapshot.ChainStatusNotChained)
+
+	require.True(t, entries[0].Signed())
+	require.True(t, entries[1].Signed())
+	require.False(t, entries[2].Signed())
+
+	m3.Chain.Signature[0] ^= 1
+	require.NoError(t, snapshot.UpdateSnapshot(ctx, env.RepositoryWriter, m3))
+
+	verifyChainStatuses(t, env.RepositoryWriter, src,
+		snapshot.ChainStatusOK,
+		snapshot.ChainStatusInvalidSignature,
+		snapshot.ChainStatusNotChained)
+
+	// rewriting a snapshot by a client without signing key removes the signature of the original client.
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	opt.SnapshotSigningKeyFile = ""
+
+	require.NoError(t, repo.SetClientOptions(ctx, env.ConfigFile(), opt))
+	env.MustReopen(t)
+
+	m2.Stats.TotalFileCount++
+	require.NoError(t, snapshot.UpdateSnapshot(ctx, env.RepositoryWriter, m2))
+
+	entries = verifyChainStatuses(t, env.RepositoryWriter, src,
+		snapshot.ChainStatusOK,
+		snapshot.ChainStatusInvalidSignature,
+		snapshot.ChainStatusNotChained)
+
+	require.False(t, entries[0].Signed())
+
+	// snapshots created without the key are not chained.
+	m4 := &snapshot.Manifest{Source: src}
+	mustSaveSnapshot(t, env.RepositoryWriter, m4)
+	require.Nil(t, m4.Chain)
+}
+
+func mustConfigureSigningKey(t *testing.T, env *repotesting.Environment) {
+	t.Helper()
+
+	ctx := testlogging.Context(t)
+	keyFile := filepath.Join(t.TempDir(), "signing.key")
+
+	_, err := snapshot.GenerateSigningKeyFile(keyFile)
+	require.NoError(t, err)
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	opt := env.RepositoryWriter.ClientOptions()
+	opt.SnapshotSigningKeyFile = keyFile
+
+	require.NoError(t, repo.SetClientOptions(ctx, env.ConfigFile(), opt))
+	env.MustReopen(t)
+}
+
+func verifyChainStatuses(t *testing.T, rep repo.Repository, src snapshot.SourceInfo, want ...snapshot.ChainStatus) []*snapshot.ChainEntry {
+	t.Helper()
+
+	entries, err := snapshot.VerifyChain(testlogging.Context(t), rep, src)
+	require.NoError(t, err)
+
+	var got []snapshot.ChainStatus
+
+	for _, e := range entries {
+		got = append(got, e.Status)
+	}
+
+	require.Equal(t, want, got)
+
+	return entries
+}
@@ -0,0 +1,158 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/maintenance"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/repo/object"
+)
+
+// ErrSnapshotOnHold is returned when deleting a snapshot which is on hold.
+var ErrSnapshotOnHold = errors.New("snapshot is on hold, remove the hold first")
+
+// Hold places the blobs holding a snapshot on hold, so that they are neither modified nor deleted
+// by maintenance and are protected by the storage provider using a legal hold or extended retention.
+type Hold struct {
+	ID manifest.ID `json:"-"`
+
+	Source       SourceInfo      `json:"source"`
+	StartTime    fs.UTCTimestamp `json:"startTime"`
+	RootObjectID object.ID       `json:"rootID"`
+
+	Reason     string          `json:"reason,omitempty"`
+	CreatedBy  string          `json:"createdBy,omitempty"`
+	CreateTime fs.UTCTimestamp `json:"createTime"`
+	LegalHold  bool            `json:"legalHold,omitempty"`
+
+	maintenance.BlobHold
+}
+
+// Covers returns true if the hold applies to the provided snapshot. Snapshots are matched by their contents
+// rather than manifest IDs, which change when snapshots are updated.
+func (h *Hold) Covers(m *Manifest) bool {
+	return h.Source == m.Source && h.StartTime == m.StartTime && h.RootObjectID == m.RootObjectID()
+}
+
+func holdLabels(si SourceInfo) map[string]string {
+	labels := sourceInfoToLabels(si)
+	labels[typeKey] = maintenance.BlobHoldManifestType
+
+	return labels
+}
+
+// ListHolds returns the holds placed on snapshots of the provided source or all sources if nil.
+func ListHolds(ctx context.Context, rep repo.Repository, si *SourceInfo) ([]*Hold, error) {
+	labels := map[string]string{typeKey: maintenance.BlobHoldManifestType}
+	if si != nil {
+		labels = holdLabels(*si)
+	}
+
+	entries, err := rep.FindManifests(ctx, labels)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to find holds")
+	}
+
+	var result []*Hold
+
+	for _, e := range entries {
+		h := &Hold{}
+
+		if _, err := rep.GetManifest(ctx, e.ID, h); err != nil {
+			return nil, errors.Wrapf(err, "unable to load hold %v", e.ID)
+		}
+
+		h.ID = e.ID
+
+		result = append(result, h)
+	}
+
+	return result, nil
+}
+
+// FindHolds returns the holds placed on the provided snapshot.
+func FindHolds(ctx context.Context, rep repo.Repository, m *Manifest) ([]*Hold, error) {
+	holds, err := ListHolds(ctx, rep, &m.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Hold
+
+	for _, h := range holds {
+		if h.Covers(m) {
+			result = append(result, h)
+		}
+	}
+
+	return result, nil
+}
+
+// SaveHold saves the provided hold and returns its ID.
+func SaveHold(ctx context.Context, rep repo.RepositoryWriter, h *Hold) (manifest.ID, error) {
+	id, err := rep.PutManifest(ctx, holdLabels(h.Source), h)
+	if err != nil {
+		return "", errors.Wrap(err, "error putting hold")
+	}
+
+	h.ID = id
+
+	return id, nil
+}
+
+// CheckNotOnHold returns ErrSnapshotOnHold if the provided snapshot is on hold.
+func CheckNotOnHold(ctx context.Context, rep repo.Repository, m *Manifest) error {
+	holds, err := FindHolds(ctx, rep, m)
+	if err != nil {
+		return err
+	}
+
+	if len(holds) > 0 {
+		return errors.Wrapf(ErrSnapshotOnHold, "snapshot %v of %v at %v", m.ID, m.Source, m.StartTime.ToTime())
+	}
+
+	return nil
+}
+
+// DeleteSnapshot deletes the manifest of the provided snapshot unless the snapshot is on hold.
+func DeleteSnapshot(ctx context.Context, rep repo.RepositoryWriter, m *Manifest) error {
+	if err := CheckNotOnHold(ctx, rep, m); err != nil {
+		return err
+	}
+
+	return errors.Wrap(rep.DeleteManifest(ctx, m.ID), "error deleting snapshot manifest")
+}
+
+// DeleteManifest deletes the manifest with the provided ID. Snapshot manifests are deleted using DeleteSnapshot,
+// so snapshots on hold can't be deleted.
+func DeleteManifest(ctx context.Context, rep repo.RepositoryWriter, id manifest.ID) error {
+	var data json.RawMessage
+
+	em, err := rep.GetManifest(ctx, id, &data)
+	if errors.Is(err, manifest.ErrNotFound) {
+		// deleting manifests which don't exist is a no-op.
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "error loading manifest")
+	}
+
+	if em.Labels[typeKey] != ManifestType {
+		return errors.Wrap(rep.DeleteManifest(ctx, id), "error deleting manifest")
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return errors.Wrap(err, "unable to parse snapshot manifest")
+	}
+
+	m.ID = id
+
+	return DeleteSnapshot(ctx, rep, m)
+}
@@ -3,6 +3,7 @@
 
 import (
 	"context"
+	"strconv"
 
 	"github.com/pkg/errors"
 
@@ -136,6 +137,22 @@ func SaveSnapshot(ctx context.Context, rep repo.RepositoryWriter, man *Manifest)
 		labels[key] = value
 	}
 
+	// complete snapshots created by clients with a signing key are linked to their predecessors
+	// when saved for the first time, updated snapshots keep their original link.
+	if man.Chain == nil {
+		if man.IncompleteReason == "" && rep.ClientOptions().SnapshotSigningKeyFile != "" {
+			if err := addChainLink(ctx, rep, man); err != nil {
+				return "", errors.Wrap(err, "unable to link snapshot to its predecessor")
+			}
+		}
+	} else if err := UpdateChainContent(rep, man); err != nil {
+		return "", errors.Wrap(err, "unable to update snapshot chain")
+	}
+
+	if man.Chain != nil {
+		labels[chainSequenceKey] = strconv.FormatInt(man.Chain.Sequence, 10)
+	}
+
 	id, err := rep.PutManifest(ctx, labels, man)
 	if err != nil {
 		return "", errors.Wrap(err, "error putting manifest")
@@ -36,6 +36,9 @@ type Manifest struct {
 
 	// list of manually-defined pins which prevent the snapshot from being deleted.
 	Pins []string `json:"pins,omitempty"`
+
+	// link to the previous snapshot of the same source.
+	Chain *ChainLink `json:"chain,omitempty"`
 }
 
 // UpdatePins updates pins in the provided manifest.
@@ -18,6 +18,8 @@ type CompressionPolicy struct {
 	NoParentNeverCompress bool             `json:"noParentNeverCompress,omitempty"`
 	MinSize               int64            `json:"minSize,omitempty"`
 	MaxSize               int64            `json:"maxSize,omitempty"`
+	AutoDetect            *OptionalBool    `json:"autoDetect,omitempty"`
+	AutoDetectMinSavings  *OptionalInt     `json:"autoDetectMinSavings,omitempty"`
 }
 
 // CompressionPolicyDefinition specifies which policy definition provided the value of a particular field.
@@ -27,9 +29,17 @@ type CompressionPolicyDefinition struct {
 	NeverCompress  snapshot.SourceInfo `json:"neverCompress,omitempty"`
 	MinSize        snapshot.SourceInfo `json:"minSize,omitempty"`
 	MaxSize        snapshot.SourceInfo `json:"maxSize,omitempty"`
+
+	AutoDetect           snapshot.SourceInfo `json:"autoDetect,omitempty"`
+	AutoDetectMinSavings snapshot.SourceInfo `json:"autoDetectMinSavings,omitempty"`
 }
 
+// DefaultAutoDetectMinSavings is the default percentage by which a sample of each content must shrink
+// when compressed for the content to be compressed in auto-detect mode.
+const DefaultAutoDetectMinSavings = 10
+
 // CompressorForFile returns compression name to be used for compressing a given file according to policy, using attributes such as name or size.
+// In auto-detect mode compressibility of each content of files which are not excluded is determined by sampling.
 func (p *CompressionPolicy) CompressorForFile(e fs.Entry) compression.Name {
 	ext := filepath.Ext(e.Name())
 	size := e.Size()
@@ -57,11 +67,23 @@ func (p *CompressionPolicy) CompressorForFile(e fs.Entry) compression.Name {
 	return p.CompressorName
 }
 
+// MinSavingsPercent returns the minimum percentage by which a sample of each content must shrink when compressed
+// for the content to be stored compressed, or 0 if compressibility is not detected automatically.
+func (p *CompressionPolicy) MinSavingsPercent() int {
+	if !p.AutoDetect.OrDefault(false) {
+		return 0
+	}
+
+	return p.AutoDetectMinSavings.OrDefault(DefaultAutoDetectMinSavings)
+}
+
 // Merge applies default values from the provided policy.
 func (p *CompressionPolicy) Merge(src CompressionPolicy, def *CompressionPolicyDefinition, si snapshot.SourceInfo) {
 	mergeCompressionName(&p.CompressorName, src.CompressorName, &def.CompressorName, si)
 	mergeInt64(&p.MinSize, src.MinSize, &def.MinSize, si)
 	mergeInt64(&p.MaxSize, src.MaxSize, &def.MaxSize, si)
+	mergeOptionalBool(&p.AutoDetect, src.AutoDetect, &def.AutoDetect, si)
+	mergeOptionalInt(&p.AutoDetectMinSavings, src.AutoDetectMinSavings, &def.AutoDetectMinSavings, si)
 
 	mergeStrings(&p.OnlyCompress, &p.NoParentOnlyCompress, src.OnlyCompress, src.NoParentOnlyCompress, &def.OnlyCompress, si)
 	mergeStrings(&p.NeverCompress, &p.NoParentNeverCompress, src.NeverCompress, src.NoParentNeverCompress, &def.NeverCompress, si)
@@ -37,7 +37,7 @@ func ApplyRetentionPolicy(ctx context.Context, rep repo.RepositoryWriter, source
 
 	if reallyDelete {
 		for _, manifestID := range toDelete {
-			if err := rep.DeleteManifest(ctx, manifestID); err != nil {
+			if err := snapshot.DeleteManifest(ctx, rep, manifestID); err != nil {
 				return toDelete, errors.Wrapf(err, "error deleting manifest %v", manifestID)
 			}
 		}
@@ -71,9 +71,19 @@ func getExpiredSnapshotsForSource(ctx context.Context, rep repo.Repository, snap
 
 	pol.RetentionPolicy.ComputeRetentionReasons(snapshots)
 
+	holds, err := snapshot.ListHolds(ctx, rep, &src)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list holds")
+	}
+
 	var toDelete []manifest.ID
 
 	for _, s := range snapshots {
+		if isHeld(s, holds) {
+			log(ctx).Debugf("  keeping %v on hold", s.StartTime.ToTime())
+			continue
+		}
+
 		if len(s.RetentionReasons) == 0 && len(s.Pins) == 0 {
 			log(ctx).Debugf("  deleting %v", s.StartTime)
 			toDelete = append(toDelete, s.ID)
@@ -84,3 +94,13 @@ func getExpiredSnapshotsForSource(ctx context.Context, rep repo.Repository, snap
 
 	return toDelete, nil
 }
+
+func isHeld(m *snapshot.Manifest, holds []*snapshot.Hold) bool {
+	for _, h := range holds {
+		if h.Covers(m) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,553 @@
+// Package snapshotconvert implements in-place conversion of repository contents, objects and snapshots to a new format.
+package snapshotconvert
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/content/index"
+	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/repo/logging"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+var log = logging.Module("snapshotconvert")
+
+const (
+	checkpointManifestType = "format-conversion-checkpoint"
+
+	defaultCheckpointInterval = 10000
+)
+
+// Options specifies the options for format conversion.
+type Options struct {
+	Format format.ConversionOptions
+
+	// Parallel is the number of contents copied in parallel.
+	Parallel int
+
+	// CheckpointInterval is the number of converted contents and objects after which the progress is persisted.
+	CheckpointInterval int
+}
+
+// Stats contains statistics of a format conversion.
+type Stats struct {
+	Contents  int
+	Objects   int
+	Manifests int
+}
+
+// checkpoint records mappings of contents and objects converted since the previous checkpoint.
+type checkpoint struct {
+	Contents map[string]string `json:"contents,omitempty"`
+	Objects  map[string]string `json:"objects,omitempty"`
+}
+
+func newCheckpoint() *checkpoint {
+	return &checkpoint{
+		Contents: map[string]string{},
+		Objects:  map[string]string{},
+	}
+}
+
+type converter struct {
+	rep    repo.DirectRepositoryWriter
+	target *repo.FormatConversionTarget
+
+	checkpointInterval int
+
+	// serializes checkpoints.
+	checkpointMu sync.Mutex
+
+	mu sync.Mutex
+	// +checklocks:mu
+	contents map[content.ID]content.ID
+	// +checklocks:mu
+	objects map[object.ID]object.ID
+	// +checklocks:mu
+	pending *checkpoint
+	// +checklocks:mu
+	pendingCount int
+	// +checklocks:mu
+	stats Stats
+}
+
+// Convert rewrites all contents, objects and manifests of the repository using the new format, which is staged
+// until the conversion is ready to be committed. The repository must be locked using the upgrade lock.
+// The conversion can be interrupted and resumed by calling Convert with the same options. Snapshots placed
+// on hold must be released before the conversion.
+func Convert(ctx context.Context, rep repo.DirectRepositoryWriter, opt Options) (Stats, error) {
+	// holds refer to packs which are replaced by the conversion, so they would no longer protect the snapshots.
+	holds, err := snapshot.ListHolds(ctx, rep, nil)
+	if err != nil {
+		return Stats{}, errors.Wrap(err, "unable to list snapshot holds")
+	}
+
+	if len(holds) > 0 {
+		return Stats{}, errors.Errorf("format conversion is not supported while %v snapshot hold(s) are in place, remove them first", len(holds))
+	}
+
+	prov, err := rep.FormatManager().PrepareConversion(ctx, opt.Format)
+	if err != nil {
+		return Stats{}, errors.Wrap(err, "unable to prepare conversion")
+	}
+
+	target, err := repo.OpenFormatConversionTarget(ctx, rep, prov)
+	if err != nil {
+		return Stats{}, errors.Wrap(err, "unable to open conversion target")
+	}
+
+	defer target.Close(ctx) //nolint:errcheck
+
+	c := &converter{
+		rep:                rep,
+		target:             target,
+		checkpointInterval: opt.CheckpointInterval,
+		contents:           map[content.ID]content.ID{},
+		objects:            map[object.ID]object.ID{},
+		pending:            newCheckpoint(),
+	}
+
+	if c.checkpointInterval <= 0 {
+		c.checkpointInterval = defaultCheckpointInterval
+	}
+
+	if err := c.loadCheckpoints(ctx); err != nil {
+		return Stats{}, err
+	}
+
+	if err := c.convertContents(ctx, opt.Parallel); err != nil {
+		return c.getStats(), err
+	}
+
+	if err := c.convertManifests(ctx); err != nil {
+		return c.getStats(), err
+	}
+
+	if err := c.finish(ctx); err != nil {
+		return c.getStats(), err
+	}
+
+	if err := rep.FormatManager().SetConversionReady(ctx); err != nil {
+		return c.getStats(), errors.Wrap(err, "unable to mark conversion as ready")
+	}
+
+	return c.getStats(), nil
+}
+
+func (c *converter) getStats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+func (c *converter) loadCheckpoints(ctx context.Context) error {
+	entries, err := c.target.Manifests().Find(ctx, map[string]string{manifest.TypeLabelKey: checkpointManifestType})
+	if err != nil {
+		return errors.Wrap(err, "unable to find checkpoints")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range entries {
+		var cp checkpoint
+
+		if _, err := c.target.Manifests().Get(ctx, e.ID, &cp); err != nil {
+			return errors.Wrapf(err, "unable to load checkpoint %v", e.ID)
+		}
+
+		for k, v := range cp.Contents {
+			oldID, err := content.ParseID(k)
+			if err != nil {
+				return errors.Wrapf(err, "invalid content ID in checkpoint %v", e.ID)
+			}
+
+			newID, err := content.ParseID(v)
+			if err != nil {
+				return errors.Wrapf(err, "invalid content ID in checkpoint %v", e.ID)
+			}
+
+			c.contents[oldID] = newID
+		}
+
+		for k, v := range cp.Objects {
+			oldID, err := object.ParseID(k)
+			if err != nil {
+				return errors.Wrapf(err, "invalid object ID in checkpoint %v", e.ID)
+			}
+
+			newID, err := object.ParseID(v)
+			if err != nil {
+				return errors.Wrapf(err, "invalid object ID in checkpoint %v", e.ID)
+			}
+
+			c.objects[oldID] = newID
+		}
+	}
+
+	if len(entries) > 0 {
+		log(ctx).Infof("Resuming conversion with %v contents and %v objects already converted.", len(c.contents), len(c.objects))
+	}
+
+	return nil
+}
+
+// convertContents copies all data contents, leaving out directories, indirect object indexes and manifests,
+// which are rewritten because they refer to other contents.
+func (c *converter) convertContents(ctx context.Context, parallel int) error {
+	log(ctx).Info("Converting contents...")
+
+	if err := c.rep.ContentReader().IterateContents(ctx, content.IterateOptions{Parallel: parallel}, func(ci content.Info) error {
+		switch ci.ContentID.Prefix() {
+		case snapshotfs.ObjectIDPrefixDirectory, object.IndirectContentPrefix, manifest.ContentPrefix:
+			return nil
+		}
+
+		_, err := c.convertContent(ctx, ci.ContentID)
+
+		return err
+	}); err != nil {
+		return errors.Wrap(err, "error converting contents")
+	}
+
+	return c.checkpoint(ctx)
+}
+
+func (c *converter) convertContent(ctx context.Context, cid content.ID) (content.ID, error) {
+	c.mu.Lock()
+	newID, ok := c.contents[cid]
+	c.mu.Unlock()
+
+	if ok {
+		return newID, nil
+	}
+
+	ci, err := c.rep.ContentInfo(ctx, cid)
+	if err != nil {
+		return content.EmptyID, errors.Wrapf(err, "unable to get content info %v", cid)
+	}
+
+	data, err := c.rep.ContentReader().GetContent(ctx, cid)
+	if err != nil {
+		return content.EmptyID, errors.Wrapf(err, "unable to read content %v", cid)
+	}
+
+	newID, err = c.target.ContentManager().WriteContent(ctx, gather.FromSlice(data), cid.Prefix(), ci.CompressionHeaderID)
+	if err != nil {
+		return content.EmptyID, errors.Wrapf(err, "unable to write content %v", cid)
+	}
+
+	c.mu.Lock()
+	c.contents[cid] = newID
+	c.pending.Contents[cid.String()] = newID.String()
+	c.pendingCount++
+	c.stats.Contents++
+	c.mu.Unlock()
+
+	return newID, c.maybeCheckpoint(ctx)
+}
+
+func (c *converter) convertManifests(ctx context.Context) error {
+	log(ctx).Info("Converting manifests...")
+
+	entries, err := c.rep.FindManifests(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "unable to list manifests")
+	}
+
+	for _, e := range entries {
+		_, err := c.target.Manifests().GetMetadata(ctx, e.ID)
+		if err == nil {
+			// converted before the conversion has been interrupted.
+			continue
+		}
+
+		if !errors.Is(err, manifest.ErrNotFound) {
+			return errors.Wrapf(err, "unable to get manifest %v", e.ID)
+		}
+
+		if err := c.convertManifest(ctx, e); err != nil {
+			return err
+		}
+
+		if err := c.maybeCheckpoint(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *converter) convertManifest(ctx context.Context, e *manifest.EntryMetadata) error {
+	var payload interface{}
+
+	if e.Labels[manifest.TypeLabelKey] == snapshot.ManifestType {
+		var m snapshot.Manifest
+
+		if _, err := c.rep.GetManifest(ctx, e.ID, &m); err != nil {
+			return errors.Wrapf(err, "unable to load snapshot %v", e.ID)
+		}
+
+		if m.RootEntry != nil {
+			oid, err := c.convertEntry(ctx, m.RootEntry)
+			if err != nil {
+				return errors.Wrapf(err, "unable to convert snapshot %v", e.ID)
+			}
+
+			m.RootEntry.ObjectID = oid
+		}
+
+		if err := snapshot.UpdateChainContent(c.rep, &m); err != nil {
+			return errors.Wrapf(err, "unable to update chain of snapshot %v", e.ID)
+		}
+
+		payload = &m
+	} else {
+		var raw json.RawMessage
+
+		if _, err := c.rep.GetManifest(ctx, e.ID, &raw); err != nil {
+			return errors.Wrapf(err, "unable to load manifest %v", e.ID)
+		}
+
+		payload = raw
+	}
+
+	if err := c.target.Manifests().PutWithMetadata(ctx, e, payload); err != nil {
+		return errors.Wrapf(err, "unable to write manifest %v", e.ID)
+	}
+
+	c.mu.Lock()
+	c.pendingCount++
+	c.stats.Manifests++
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *converter) convertEntry(ctx context.Context, de *snapshot.DirEntry) (object.ID, error) {
+	if de.ObjectID == object.EmptyID {
+		return object.EmptyID, nil
+	}
+
+	if de.Type == snapshot.EntryTypeDirectory {
+		return c.convertDirectory(ctx, de.ObjectID)
+	}
+
+	return c.convertObject(ctx, de.ObjectID)
+}
+
+func (c *converter) convertDirectory(ctx context.Context, oid object.ID) (object.ID, error) {
+	if newID, ok := c.mappedObject(oid); ok {
+		return newID, nil
+	}
+
+	dm, err := c.readDirectory(ctx, oid)
+	if err != nil {
+		return object.EmptyID, err
+	}
+
+	for _, de := range dm.Entries {
+		if de.ObjectID, err = c.convertEntry(ctx, de); err != nil {
+			return object.EmptyID, err
+		}
+	}
+
+	w := c.target.NewObjectWriter(ctx, object.WriterOptions{
+		Description: "DIR:" + oid.String(),
+		Prefix:      snapshotfs.ObjectIDPrefixDirectory,
+	})
+
+	defer w.Close() //nolint:errcheck
+
+	if err := json.NewEncoder(w).Encode(dm); err != nil {
+		return object.EmptyID, errors.Wrap(err, "unable to encode directory JSON")
+	}
+
+	newID, err := w.Result()
+	if err != nil {
+		return object.EmptyID, errors.Wrapf(err, "unable to write directory %v", oid)
+	}
+
+	return newID, c.recordObject(ctx, oid, newID)
+}
+
+func (c *converter) readDirectory(ctx context.Context, oid object.ID) (*snapshot.DirManifest, error) {
+	r, err := c.rep.OpenObject(ctx, oid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open directory %v", oid)
+	}
+
+	defer r.Close() //nolint:errcheck
+
+	var dm snapshot.DirManifest
+
+	if err := json.NewDecoder(r).Decode(&dm); err != nil {
+		return nil, errors.Wrapf(err, "unable to decode directory %v", oid)
+	}
+
+	return &dm, nil
+}
+
+func (c *converter) convertObject(ctx context.Context, oid object.ID) (object.ID, error) {
+	indexObjectID, ok := oid.IndexObjectID()
+	if !ok {
+		cid, compressed, ok := oid.ContentID()
+		if !ok {
+			return object.EmptyID, errors.Errorf("invalid object ID %v", oid)
+		}
+
+		newContentID, err := c.convertContent(ctx, cid)
+		if err != nil {
+			return object.EmptyID, err
+		}
+
+		if compressed {
+			return object.Compressed(object.DirectObjectID(newContentID)), nil
+		}
+
+		return object.DirectObjectID(newContentID), nil
+	}
+
+	if newID, ok := c.mappedObject(oid); ok {
+		return newID, nil
+	}
+
+	entries, err := object.LoadIndexObject(ctx, c.rep.ContentManager(), indexObjectID)
+	if err != nil {
+		return object.EmptyID, errors.Wrapf(err, "unable to load index of %v", oid)
+	}
+
+	for i := range entries {
+		if entries[i].Object, err = c.convertObject(ctx, entries[i].Object); err != nil {
+			return object.EmptyID, err
+		}
+	}
+
+	w := c.target.NewObjectWriter(ctx, object.WriterOptions{
+		Description: "LIST(" + oid.String() + ")",
+		Prefix:      indexContentPrefix(indexObjectID),
+	})
+
+	defer w.Close() //nolint:errcheck
+
+	if err := object.WriteIndirectObject(w, entries); err != nil {
+		return object.EmptyID, err
+	}
+
+	newIndexObjectID, err := w.Result()
+	if err != nil {
+		return object.EmptyID, errors.Wrapf(err, "unable to write index of %v", oid)
+	}
+
+	newID := object.IndirectObjectID(newIndexObjectID)
+
+	return newID, c.recordObject(ctx, oid, newID)
+}
+
+// indexContentPrefix returns the prefix of contents holding the provided index object.
+func indexContentPrefix(oid object.ID) index.IDPrefix {
+	for {
+		indexObjectID, ok := oid.IndexObjectID()
+		if !ok {
+			break
+		}
+
+		oid = indexObjectID
+	}
+
+	cid, _, _ := oid.ContentID()
+
+	return cid.Prefix()
+}
+
+func (c *converter) mappedObject(oid object.ID) (object.ID, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	newID, ok := c.objects[oid]
+
+	return newID, ok
+}
+
+func (c *converter) recordObject(ctx context.Context, oldID, newID object.ID) error {
+	c.mu.Lock()
+	c.objects[oldID] = newID
+	c.pending.Objects[oldID.String()] = newID.String()
+	c.pendingCount++
+	c.stats.Objects++
+	c.mu.Unlock()
+
+	return c.maybeCheckpoint(ctx)
+}
+
+func (c *converter) maybeCheckpoint(ctx context.Context) error {
+	c.mu.Lock()
+	due := c.pendingCount >= c.checkpointInterval
+	c.mu.Unlock()
+
+	if !due {
+		return nil
+	}
+
+	return c.checkpoint(ctx)
+}
+
+// checkpoint persists all converted contents, objects and manifests along with the mappings
+// recorded since the previous checkpoint.
+func (c *converter) checkpoint(ctx context.Context) error {
+	c.checkpointMu.Lock()
+	defer c.checkpointMu.Unlock()
+
+	c.mu.Lock()
+	cp := c.pending
+	c.pending = newCheckpoint()
+	c.pendingCount = 0
+	stats := c.stats
+	c.mu.Unlock()
+
+	if len(cp.Contents)+len(cp.Objects) > 0 {
+		if _, err := c.target.Manifests().Put(ctx, map[string]string{manifest.TypeLabelKey: checkpointManifestType}, cp); err != nil {
+			return errors.Wrap(err, "unable to write checkpoint")
+		}
+	}
+
+	if err := c.target.Flush(ctx); err != nil {
+		return errors.Wrap(err, "unable to flush converted contents")
+	}
+
+	log(ctx).Infof("Converted %v contents, %v objects and %v manifests.", stats.Contents, stats.Objects, stats.Manifests)
+
+	return nil
+}
+
+// finish removes checkpoints, which are no longer needed once all manifests have been converted.
+func (c *converter) finish(ctx context.Context) error {
+	if err := c.checkpoint(ctx); err != nil {
+		return err
+	}
+
+	entries, err := c.target.Manifests().Find(ctx, map[string]string{manifest.TypeLabelKey: checkpointManifestType})
+	if err != nil {
+		return errors.Wrap(err, "unable to find checkpoints")
+	}
+
+	for _, e := range entries {
+		if err := c.target.Manifests().Delete(ctx, e.ID); err != nil {
+			return errors.Wrapf(err, "unable to delete checkpoint %v", e.ID)
+		}
+	}
+
+	//nolint:wrapcheck
+	return c.target.Flush(ctx)
+}
@@ -14,7 +14,7 @@
 func writeDirManifest(ctx context.Context, rep repo.RepositoryWriter, dirRelativePath string, dirManifest *snapshot.DirManifest) (object.ID, error) {
 	writer := rep.NewObjectWriter(ctx, object.WriterOptions{
 		Description: "DIR:" + dirRelativePath,
-		Prefix:      objectIDPrefixDirectory,
+		Prefix:      ObjectIDPrefixDirectory,
 	})
 
 	defer writer.Close() //nolint:errcheck
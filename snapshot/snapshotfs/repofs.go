@@ -18,7 +18,8 @@
 
 // Well-known object ID prefixes.
 const (
-	objectIDPrefixDirectory = "k"
+	// ObjectIDPrefixDirectory is the prefix of contents holding directory listings.
+	ObjectIDPrefixDirectory = "k"
 )
 
 type repositoryEntry struct {
@@ -341,7 +342,7 @@ func IsDirectoryID(oid object.ID) bool {
 	}
 
 	if cid, _, ok := oid.ContentID(); ok {
-		return cid.Prefix() == objectIDPrefixDirectory
+		return cid.Prefix() == ObjectIDPrefixDirectory
 	}
 
 	return false
@@ -894,6 +894,39 @@ func TestUpload_VirtualDirectoryWithStreamingFile_WithCompression(t *testing.T)
 	assert.Less(t, testutil.MustGetTotalDirSize(t, th.repoDir), int64(14000))
 }
 
+func TestUpload_CompressionAutoDetect(t *testing.T) {
+	ctx := testlogging.Context(t)
+	th := newUploadTestHarness(ctx, t)
+
+	defer th.cleanup()
+
+	u := NewUploader(th.repo)
+
+	pol := *policy.DefaultPolicy
+	pol.CompressionPolicy.CompressorName = "pgzip"
+	pol.CompressionPolicy.NeverCompress = []string{".zip"}
+	pol.CompressionPolicy.AutoDetect = policy.NewOptionalBool(true)
+
+	policyTree := policy.BuildTree(nil, &pol)
+
+	compressible := []byte(strings.Repeat("a", 4096))
+	incompressible := make([]byte, 5000)
+	rand.Read(incompressible)
+
+	// files excluded by extension are not sampled.
+	staticRoot := virtualfs.NewStaticDirectory("rootdir", []fs.Entry{
+		virtualfs.StreamingFileFromReader("compressible.txt", io.NopCloser(bytes.NewReader(compressible))),
+		virtualfs.StreamingFileFromReader("compressible.zip", io.NopCloser(bytes.NewReader(bytes.ToUpper(compressible)))),
+		virtualfs.StreamingFileFromReader("incompressible.txt", io.NopCloser(bytes.NewReader(incompressible))),
+	})
+
+	man, err := u.Upload(ctx, staticRoot, policyTree, snapshot.SourceInfo{})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(len(compressible)), atomic.LoadInt64(&man.Stats.AutoCompressedSize), "auto-compressed size")
+	assert.Equal(t, int64(len(incompressible)), atomic.LoadInt64(&man.Stats.AutoCompressionSkippedSize), "auto-compression skipped size")
+}
+
 func TestUpload_VirtualDirectoryWithStreamingFileWithModTime(t *testing.T) {
 	content := []byte("Streaming Temporary file content")
 	mt := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
@@ -111,19 +111,25 @@ func runInternal(ctx context.Context, rep repo.DirectRepositoryWriter, gcDelete
 		return errors.Wrap(err, "unable to find in-use content ID")
 	}
 
+	held, err := maintenance.HeldBlobs(ctx, rep)
+	if err != nil {
+		return errors.Wrap(err, "unable to find blobs on hold")
+	}
+
 	log(ctx).Info("Looking for unreferenced contents...")
 
 	// Ensure that the iteration includes deleted contents, so those can be
 	// undeleted (recovered).
-	err := rep.ContentReader().IterateContents(ctx, content.IterateOptions{IncludeDeleted: true}, func(ci content.Info) error {
-		if manifest.ContentPrefix == ci.ContentID.Prefix() {
+	err = rep.ContentReader().IterateContents(ctx, content.IterateOptions{IncludeDeleted: true}, func(ci content.Info) error {
+		if manifest.ContentPrefix == ci.ContentID.Prefix() || content.ZstdDictionaryContentPrefix == ci.ContentID.Prefix() {
 			system.Add(int64(ci.PackedLength))
 			return nil
 		}
 
 		var cidbuf [128]byte
 
-		if used.Contains(ci.ContentID.Append(cidbuf[:0])) {
+		// contents stored in packs on hold are never dropped.
+		if _, ok := held[ci.PackBlobID]; ok || used.Contains(ci.ContentID.Append(cidbuf[:0])) {
 			if ci.Deleted {
 				if err := rep.ContentManager().UndeleteContent(ctx, ci.ContentID); err != nil {
 					return errors.Wrapf(err, "Could not undelete referenced content: %v", ci)
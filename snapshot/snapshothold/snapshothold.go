@@ -0,0 +1,302 @@
+// Package snapshothold places snapshots on hold, protecting the blobs holding them using provider legal holds
+// or extended retention and preventing maintenance from rewriting or deleting them.
+package snapshothold
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/content/index"
+	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/repo/logging"
+	"github.com/kopia/kopia/repo/maintenance"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+var log = logging.Module("snapshothold")
+
+const defaultParallel = 16
+
+// Options specifies how snapshots are protected.
+type Options struct {
+	// LegalHold places a provider legal hold on the blobs, which lasts until the hold is removed.
+	LegalHold bool
+
+	// RetainUntil extends the provider retention of the blobs, when LegalHold is not set.
+	RetainUntil time.Time
+
+	// RetentionMode used when extending retention, defaults to the retention mode of the repository.
+	RetentionMode blob.RetentionMode
+
+	Reason   string
+	Parallel int
+}
+
+// Add places the provided snapshot on hold. The hold is recorded before the blobs are protected by the provider,
+// so if protecting them fails, maintenance still leaves them intact and Add can be retried.
+func Add(ctx context.Context, rep repo.DirectRepositoryWriter, m *snapshot.Manifest, opt Options) (*snapshot.Hold, error) {
+	extendOpts, err := extendOptions(ctx, rep, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	// protecting the format blob first verifies that the storage supports the requested protection.
+	if err := rep.BlobStorage().ExtendBlobRetention(ctx, format.KopiaRepositoryBlobID, extendOpts); err != nil {
+		return nil, errors.Wrap(err, "unable to protect format blob")
+	}
+
+	blobs, err := reachableBlobs(ctx, rep, m)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &snapshot.Hold{
+		Source:       m.Source,
+		StartTime:    m.StartTime,
+		RootObjectID: m.RootObjectID(),
+		Reason:       opt.Reason,
+		CreatedBy:    rep.ClientOptions().UsernameAtHost(),
+		CreateTime:   fs.UTCTimestampFromTime(rep.Time()),
+		LegalHold:    opt.LegalHold,
+		BlobHold: maintenance.BlobHold{
+			Blobs: blobs,
+		},
+	}
+
+	if !opt.LegalHold {
+		h.RetainUntil = opt.RetainUntil.UTC()
+	}
+
+	if _, err := snapshot.SaveHold(ctx, rep, h); err != nil {
+		return nil, err
+	}
+
+	if err := rep.Flush(ctx); err != nil {
+		return nil, errors.Wrap(err, "unable to flush repository")
+	}
+
+	log(ctx).Infof("Protecting %v blobs of snapshot %v of %v.", len(blobs), m.ID, m.Source)
+
+	if err := extendAll(ctx, rep, blobs, extendOpts, opt.Parallel); err != nil {
+		return h, err
+	}
+
+	return h, nil
+}
+
+// Remove removes the provided hold, releasing legal holds on blobs which are not held by other legal holds.
+// Extended retention cannot be shortened and remains in effect until it expires.
+func Remove(ctx context.Context, rep repo.DirectRepositoryWriter, h *snapshot.Hold, parallel int) error {
+	if err := rep.DeleteManifest(ctx, h.ID); err != nil {
+		return errors.Wrapf(err, "unable to delete hold %v", h.ID)
+	}
+
+	if !h.LegalHold {
+		log(ctx).Infof("Retention of the blobs remains in effect until %v.", h.RetainUntil.Local())
+		return nil
+	}
+
+	remaining, err := snapshot.ListHolds(ctx, rep, nil)
+	if err != nil {
+		return err
+	}
+
+	stillHeld := map[blob.ID]bool{}
+
+	for _, r := range remaining {
+		if r.ID == h.ID || !r.LegalHold {
+			continue
+		}
+
+		for _, id := range r.Blobs {
+			stillHeld[id] = true
+		}
+	}
+
+	var release []blob.ID
+
+	for _, id := range h.Blobs {
+		if !stillHeld[id] {
+			release = append(release, id)
+		}
+	}
+
+	if err := rep.Flush(ctx); err != nil {
+		return errors.Wrap(err, "unable to flush repository")
+	}
+
+	log(ctx).Infof("Releasing legal hold on %v blobs.", len(release))
+
+	return extendAll(ctx, rep, release, blob.ExtendOptions{LegalHold: blob.LegalHoldOff}, parallel)
+}
+
+func extendOptions(ctx context.Context, rep repo.DirectRepository, opt Options) (blob.ExtendOptions, error) {
+	if opt.LegalHold {
+		return blob.ExtendOptions{LegalHold: blob.LegalHoldOn}, nil
+	}
+
+	period := opt.RetainUntil.Sub(rep.Time())
+	if period <= 0 {
+		return blob.ExtendOptions{}, errors.New("retention time must be in the future")
+	}
+
+	mode := opt.RetentionMode
+	if mode == "" {
+		blobCfg, err := rep.FormatManager().BlobCfgBlob(ctx)
+		if err != nil {
+			return blob.ExtendOptions{}, errors.Wrap(err, "blob configuration")
+		}
+
+		mode = blobCfg.RetentionMode
+	}
+
+	if mode == "" {
+		return blob.ExtendOptions{}, errors.New("repository does not use object lock retention, retention mode must be specified")
+	}
+
+	return blob.ExtendOptions{
+		RetentionMode:   mode,
+		RetentionPeriod: period,
+	}, nil
+}
+
+// reachableBlobs returns the sorted IDs of packs holding contents of the snapshot, all manifests and dictionaries,
+// current index blobs and the format blob, which are needed to read the snapshot.
+func reachableBlobs(ctx context.Context, rep repo.DirectRepository, m *snapshot.Manifest) ([]blob.ID, error) {
+	var mu sync.Mutex
+
+	result := map[blob.ID]bool{
+		format.KopiaRepositoryBlobID: true,
+	}
+
+	addContents := func(ctx context.Context, contentIDs []content.ID) error {
+		for _, cid := range contentIDs {
+			ci, err := rep.ContentInfo(ctx, cid)
+			if err != nil {
+				return errors.Wrapf(err, "unable to get info for content %v", cid)
+			}
+
+			mu.Lock()
+			result[ci.PackBlobID] = true
+			mu.Unlock()
+		}
+
+		return nil
+	}
+
+	w, err := snapshotfs.NewTreeWalker(ctx, snapshotfs.TreeWalkerOptions{
+		EntryCallback: func(ctx context.Context, _ fs.Entry, oid object.ID, _ string) error {
+			contentIDs, err := rep.VerifyObject(ctx, oid)
+			if err != nil {
+				return errors.Wrapf(err, "error verifying %v", oid)
+			}
+
+			return addContents(ctx, contentIDs)
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create tree walker")
+	}
+
+	defer w.Close(ctx)
+
+	root, err := snapshotfs.SnapshotRoot(rep, m)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get snapshot root")
+	}
+
+	if err := w.Process(ctx, root, ""); err != nil {
+		return nil, errors.Wrap(err, "error processing snapshot root")
+	}
+
+	// manifests and zstd dictionaries are needed to read snapshots.
+	for _, prefix := range []content.IDPrefix{manifest.ContentPrefix, content.ZstdDictionaryContentPrefix} {
+		if err := rep.ContentReader().IterateContents(ctx, content.IterateOptions{
+			Range: index.PrefixRange(prefix),
+		}, func(ci content.Info) error {
+			result[ci.PackBlobID] = true
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "unable to iterate %q contents", prefix)
+		}
+	}
+
+	indexBlobs, err := rep.IndexBlobs(ctx, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list index blobs")
+	}
+
+	for _, ib := range indexBlobs {
+		result[ib.BlobID] = true
+	}
+
+	var ids []blob.ID
+
+	for id := range result {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return ids, nil
+}
+
+func extendAll(ctx context.Context, rep repo.DirectRepositoryWriter, ids []blob.ID, opts blob.ExtendOptions, parallel int) error {
+	if parallel <= 0 {
+		parallel = defaultParallel
+	}
+
+	ch := make(chan blob.ID)
+
+	eg, ctx := errgroup.WithContext(ctx)
+
+	for range parallel {
+		eg.Go(func() error {
+			for id := range ch {
+				err := rep.BlobStorage().ExtendBlobRetention(ctx, id, opts)
+				if errors.Is(err, blob.ErrBlobNotFound) {
+					// superseded index blobs may have been deleted since the hold was placed.
+					log(ctx).Debugf("blob %v no longer exists", id)
+					continue
+				}
+
+				if err != nil {
+					return errors.Wrapf(err, "unable to protect blob %v", id)
+				}
+			}
+
+			return nil
+		})
+	}
+
+	eg.Go(func() error {
+		defer close(ch)
+
+		for _, id := range ids {
+			select {
+			case ch <- id:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		return nil
+	})
+
+	//nolint:wrapcheck
+	return eg.Wait()
+}
@@ -0,0 +1,143 @@
+package snapshotmaintenance_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/maintenance"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/snapshotconvert"
+	"github.com/kopia/kopia/snapshot/snapshothold"
+	"github.com/kopia/kopia/snapshot/snapshotmaintenance"
+)
+
+func (s *formatSpecificTestSuite) TestSnapshotHold(t *testing.T) {
+	ft := faketime.NewAutoAdvance(time.Date(2020, 9, 10, 0, 0, 0, 0, time.UTC), time.Second)
+
+	ctx, env := repotesting.NewEnvironment(t, s.formatVersion, repotesting.Options{
+		OpenOptions: func(o *repo.Options) {
+			o.TimeNowFunc = ft.NowFunc()
+		},
+		NewRepositoryOptions: func(nro *repo.NewRepositoryOptions) {
+			nro.RetentionMode = blob.Governance
+			nro.RetentionPeriod = 24 * time.Hour
+		},
+	})
+
+	st, ok := env.RootStorage().(blobtesting.RetentionStorage)
+	require.True(t, ok)
+
+	dir := mockfs.NewDirectory()
+	dir.AddFile("f1", []byte{1, 2, 3, 4}, defaultPermissions)
+
+	si := snapshot.SourceInfo{Host: "host", UserName: "user", Path: "/foo"}
+
+	s1 := mustSnapshot(t, env.RepositoryWriter, dir, si)
+	mustFlush(t, env.RepositoryWriter)
+
+	rootInfo, err := env.RepositoryWriter.ContentInfo(ctx, mustGetContentID(t, s1.RootObjectID()))
+	require.NoError(t, err)
+
+	_, err = snapshothold.Add(ctx, env.RepositoryWriter, s1, snapshothold.Options{})
+	require.Error(t, err, "hold kind must be specified")
+
+	_, err = snapshothold.Add(ctx, env.RepositoryWriter, s1, snapshothold.Options{RetainUntil: ft.NowFunc()().Add(-time.Hour)})
+	require.Error(t, err, "retention must be in the future")
+
+	h, err := snapshothold.Add(ctx, env.RepositoryWriter, s1, snapshothold.Options{LegalHold: true, Reason: "audit"})
+	require.NoError(t, err)
+	require.Contains(t, h.Blobs, rootInfo.PackBlobID)
+
+	held, err := st.GetLegalHold(ctx, rootInfo.PackBlobID)
+	require.NoError(t, err)
+	require.True(t, held)
+
+	holds, err := snapshot.FindHolds(ctx, env.RepositoryWriter, s1)
+	require.NoError(t, err)
+	require.Len(t, holds, 1)
+	require.Equal(t, "audit", holds[0].Reason)
+
+	// format conversion would replace the held packs.
+	_, err = snapshotconvert.Convert(ctx, env.RepositoryWriter, snapshotconvert.Options{})
+	require.ErrorContains(t, err, "snapshot hold(s) are in place")
+
+	// held snapshots are not expired.
+	mustSnapshot(t, env.RepositoryWriter, dir, si)
+
+	require.NoError(t, policy.SetPolicy(ctx, env.RepositoryWriter, si, &policy.Policy{
+		RetentionPolicy: policy.RetentionPolicy{KeepLatest: newOptionalInt(1)},
+	}))
+
+	expired, err := policy.ApplyRetentionPolicy(ctx, env.RepositoryWriter, si, true)
+	require.NoError(t, err)
+	require.Empty(t, expired)
+
+	// delete the manifest bypassing the check and remove the contents of the snapshot
+	dir.Remove("f1")
+	dir.AddFile("f2", []byte{5, 6, 7, 8}, defaultPermissions)
+
+	snapshots, err := snapshot.ListSnapshots(ctx, env.RepositoryWriter, si)
+	require.NoError(t, err)
+
+	for _, m := range snapshots {
+		require.NoError(t, env.RepositoryWriter.DeleteManifest(ctx, m.ID))
+	}
+
+	mustSnapshot(t, env.RepositoryWriter, dir, si)
+	mustFlush(t, env.RepositoryWriter)
+
+	runFullMaintenance := func() {
+		t.Helper()
+
+		for range 3 {
+			ft.Advance(maintenance.SafetyFull.MinContentAgeSubjectToGC + time.Hour)
+			require.NoError(t, snapshotmaintenance.Run(ctx, env.RepositoryWriter, maintenance.ModeFull, true, maintenance.SafetyFull))
+			mustFlush(t, env.RepositoryWriter)
+		}
+	}
+
+	runFullMaintenance()
+
+	// contents of the held snapshot are intact.
+	info, err := env.RepositoryWriter.ContentInfo(ctx, rootInfo.ContentID)
+	require.NoError(t, err)
+	require.False(t, info.Deleted)
+	require.Equal(t, rootInfo.PackBlobID, info.PackBlobID)
+
+	_, err = env.RootStorage().GetMetadata(ctx, rootInfo.PackBlobID)
+	require.NoError(t, err)
+
+	_, err = env.RepositoryWriter.VerifyObject(ctx, s1.RootObjectID())
+	require.NoError(t, err)
+
+	// held index blobs are not removed after compaction.
+	for _, id := range h.Blobs {
+		_, err = env.RootStorage().GetMetadata(ctx, id)
+		require.NoError(t, err, id)
+	}
+
+	require.NoError(t, snapshothold.Remove(ctx, env.RepositoryWriter, h, 0))
+	mustFlush(t, env.RepositoryWriter)
+
+	held, err = st.GetLegalHold(ctx, rootInfo.PackBlobID)
+	require.NoError(t, err)
+	require.False(t, held)
+
+	runFullMaintenance()
+
+	_, err = env.RootStorage().GetMetadata(ctx, rootInfo.PackBlobID)
+	require.ErrorIs(t, err, blob.ErrBlobNotFound)
+}
+
+func newOptionalInt(v policy.OptionalInt) *policy.OptionalInt {
+	return &v
+}
@@ -14,6 +14,12 @@ type Stats struct {
 	// +checkatomic
 	ExcludedTotalFileSize int64 `json:"excludedTotalSize"`
 
+	// sizes of file contents compressed and stored uncompressed when compressibility is detected automatically.
+	// +checkatomic
+	AutoCompressedSize int64 `json:"autoCompressedSize,omitempty"`
+	// +checkatomic
+	AutoCompressionSkippedSize int64 `json:"autoCompressionSkippedSize,omitempty"`
+
 	// keep all int32 aligned because they will be atomically updated
 	// +checkatomic
 	TotalFileCount int32 `json:"fileCount"`
@@ -45,3 +51,13 @@ func (s *Stats) AddExcluded(md fs.Entry) {
 		atomic.AddInt64(&s.ExcludedTotalFileSize, md.Size())
 	}
 }
+
+// AddAutoCompression adds the information about a chunk of file data, which was compressed or stored
+// uncompressed based on its detected compressibility.
+func (s *Stats) AddAutoCompression(length int64, compressed bool) {
+	if compressed {
+		atomic.AddInt64(&s.AutoCompressedSize, length)
+	} else {
+		atomic.AddInt64(&s.AutoCompressionSkippedSize, length)
+	}
+}
@@ -10,6 +10,7 @@
 	"github.com/stretchr/testify/require"
 
 	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/maintenance"
 	"github.com/kopia/kopia/tests/clitestutil"
 	"github.com/kopia/kopia/tests/testenv"
 )
@@ -93,6 +94,17 @@ func (s *formatSpecificTestSuite) TestECC(t *testing.T) {
 	require.NoError(t, err)
 
 	require.Equal(t, data[:], restoreData)
+
+	// repair writes the corrected data back, so that the damage does not accumulate.
+	var stats maintenance.RepairBlobsStats
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "blob", "repair", "--json"), &stats)
+	require.Positive(t, stats.DamagedShards)
+	require.Empty(t, stats.UnrecoverableBlobs)
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "blob", "repair", "--json"), &stats)
+	require.Zero(t, stats.DamagedShards)
+	require.Empty(t, stats.RepairedBlobs)
 }
 
 func (s *formatSpecificTestSuite) flipOneByteFromEachFile(e *testenv.CLITest) error {